@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/maintainer"
+)
+
+func main() {
+	maintainer.Main(os.Args[1:])
+}
@@ -0,0 +1,189 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: control.proto
+
+package controlpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	MaintainerControl_TriggerRun_FullMethodName    = "/trelloboardmaintainer.control.v1.MaintainerControl/TriggerRun"
+	MaintainerControl_GetRun_FullMethodName        = "/trelloboardmaintainer.control.v1.MaintainerControl/GetRun"
+	MaintainerControl_GetLastReport_FullMethodName = "/trelloboardmaintainer.control.v1.MaintainerControl/GetLastReport"
+)
+
+// MaintainerControlClient is the client API for MaintainerControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MaintainerControlClient interface {
+	// Starts the maintenance run. Fails with FAILED_PRECONDITION if a run is in progress
+	TriggerRun(ctx context.Context, in *TriggerRunRequest, opts ...grpc.CallOption) (*Run, error)
+	// Returns the run by id. Fails with NOT_FOUND if there is no such run
+	GetRun(ctx context.Context, in *GetRunRequest, opts ...grpc.CallOption) (*Run, error)
+	// Returns the most recently finished run. Fails with NOT_FOUND if no run has finished yet
+	GetLastReport(ctx context.Context, in *GetLastReportRequest, opts ...grpc.CallOption) (*Run, error)
+}
+
+type maintainerControlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMaintainerControlClient(cc grpc.ClientConnInterface) MaintainerControlClient {
+	return &maintainerControlClient{cc}
+}
+
+func (c *maintainerControlClient) TriggerRun(ctx context.Context, in *TriggerRunRequest, opts ...grpc.CallOption) (*Run, error) {
+	out := new(Run)
+	err := c.cc.Invoke(ctx, MaintainerControl_TriggerRun_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintainerControlClient) GetRun(ctx context.Context, in *GetRunRequest, opts ...grpc.CallOption) (*Run, error) {
+	out := new(Run)
+	err := c.cc.Invoke(ctx, MaintainerControl_GetRun_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintainerControlClient) GetLastReport(ctx context.Context, in *GetLastReportRequest, opts ...grpc.CallOption) (*Run, error) {
+	out := new(Run)
+	err := c.cc.Invoke(ctx, MaintainerControl_GetLastReport_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MaintainerControlServer is the server API for MaintainerControl service.
+// All implementations must embed UnimplementedMaintainerControlServer
+// for forward compatibility
+type MaintainerControlServer interface {
+	// Starts the maintenance run. Fails with FAILED_PRECONDITION if a run is in progress
+	TriggerRun(context.Context, *TriggerRunRequest) (*Run, error)
+	// Returns the run by id. Fails with NOT_FOUND if there is no such run
+	GetRun(context.Context, *GetRunRequest) (*Run, error)
+	// Returns the most recently finished run. Fails with NOT_FOUND if no run has finished yet
+	GetLastReport(context.Context, *GetLastReportRequest) (*Run, error)
+	mustEmbedUnimplementedMaintainerControlServer()
+}
+
+// UnimplementedMaintainerControlServer must be embedded to have forward compatible implementations.
+type UnimplementedMaintainerControlServer struct {
+}
+
+func (UnimplementedMaintainerControlServer) TriggerRun(context.Context, *TriggerRunRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerRun not implemented")
+}
+func (UnimplementedMaintainerControlServer) GetRun(context.Context, *GetRunRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRun not implemented")
+}
+func (UnimplementedMaintainerControlServer) GetLastReport(context.Context, *GetLastReportRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLastReport not implemented")
+}
+func (UnimplementedMaintainerControlServer) mustEmbedUnimplementedMaintainerControlServer() {}
+
+// UnsafeMaintainerControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MaintainerControlServer will
+// result in compilation errors.
+type UnsafeMaintainerControlServer interface {
+	mustEmbedUnimplementedMaintainerControlServer()
+}
+
+func RegisterMaintainerControlServer(s grpc.ServiceRegistrar, srv MaintainerControlServer) {
+	s.RegisterService(&MaintainerControl_ServiceDesc, srv)
+}
+
+func _MaintainerControl_TriggerRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintainerControlServer).TriggerRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MaintainerControl_TriggerRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintainerControlServer).TriggerRun(ctx, req.(*TriggerRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MaintainerControl_GetRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintainerControlServer).GetRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MaintainerControl_GetRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintainerControlServer).GetRun(ctx, req.(*GetRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MaintainerControl_GetLastReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLastReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintainerControlServer).GetLastReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MaintainerControl_GetLastReport_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintainerControlServer).GetLastReport(ctx, req.(*GetLastReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MaintainerControl_ServiceDesc is the grpc.ServiceDesc for MaintainerControl service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MaintainerControl_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "trelloboardmaintainer.control.v1.MaintainerControl",
+	HandlerType: (*MaintainerControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "TriggerRun",
+			Handler:    _MaintainerControl_TriggerRun_Handler,
+		},
+		{
+			MethodName: "GetRun",
+			Handler:    _MaintainerControl_GetRun_Handler,
+		},
+		{
+			MethodName: "GetLastReport",
+			Handler:    _MaintainerControl_GetLastReport_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "control.proto",
+}
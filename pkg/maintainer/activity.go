@@ -0,0 +1,105 @@
+package maintainer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/adlio/trello"
+)
+
+const ACTIVITY_ACTION_TYPES_ENV = "ACTIVITY_ACTION_TYPES"
+const COUNT_ATTACHMENTS_AS_ACTIVITY_ENV = "COUNT_ATTACHMENTS_AS_ACTIVITY"
+const ACTIVITY_COMMENT_MEMBERS_ENV = "ACTIVITY_COMMENT_MEMBERS"
+
+// Card creation, membership change, list change and comment
+const defaultActivityActionTypes = "createCard,copyCard,emailCard,convertToCardFromCheckItem,moveCardToBoard," +
+	"addMemberToCard,removeMemberFromCard," +
+	"updateCard:idList," +
+	"commentCard"
+
+// New photos of the sighted pet and cover changes
+const attachmentActivityActionTypes = "addAttachmentToCard,updateCard:idAttachmentCover"
+
+// Set of Trello action types which reset the staleness clock of the card.
+// The types use Trello action filter syntax: "type" or "type:field" (e.g. "updateCard:desc")
+type activityFilter struct {
+	tokens []string
+	// action type -> fields ("" means any update of this type)
+	types map[string][]string
+	// ids of the members whose comments count as activity (any member if empty)
+	commentMembers map[string]bool
+}
+
+func parseActivityFilter(commaSepTypes string) activityFilter {
+	filter := activityFilter{types: make(map[string][]string)}
+	seen := make(map[string]bool)
+	for _, token := range strings.Split(commaSepTypes, ",") {
+		token = strings.TrimSpace(token)
+		if len(token) == 0 || seen[token] {
+			continue
+		}
+		seen[token] = true
+		filter.tokens = append(filter.tokens, token)
+		actionType, field, _ := strings.Cut(token, ":")
+		filter.types[actionType] = append(filter.types[actionType], field)
+	}
+	return filter
+}
+
+func activityFilterFromEnv() activityFilter {
+	types := extractEnvOrDefault(ACTIVITY_ACTION_TYPES_ENV, defaultActivityActionTypes)
+	if extractBoolEnvOrDefault(COUNT_ATTACHMENTS_AS_ACTIVITY_ENV, false) {
+		types += "," + attachmentActivityActionTypes
+	}
+	filter := parseActivityFilter(types)
+	for _, memberID := range strings.Split(extractEnvOrDefault(ACTIVITY_COMMENT_MEMBERS_ENV, ""), ",") {
+		if memberID = strings.TrimSpace(memberID); len(memberID) > 0 {
+			if filter.commentMembers == nil {
+				filter.commentMembers = make(map[string]bool)
+			}
+			filter.commentMembers[memberID] = true
+		}
+	}
+	return filter
+}
+
+// Value for the "filter" argument of Trello actions API
+func (f activityFilter) apiFilter() string {
+	return strings.Join(f.tokens, ",")
+}
+
+// Whether the action counts as card activity.
+// Trello already filters the actions by field server side, so only the list change and the comment author are double checked here
+func (f activityFilter) matches(action *trello.Action) bool {
+	fields, ok := f.types[action.Type]
+	if !ok {
+		return false
+	}
+	if f.rejectsCommentAuthor(action) {
+		return false
+	}
+	for _, field := range fields {
+		if field != "idList" || action.DidChangeListForCard() {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the action is the comment of the member not listed in ACTIVITY_COMMENT_MEMBERS
+func (f activityFilter) rejectsCommentAuthor(action *trello.Action) bool {
+	return action.Type == "commentCard" && len(f.commentMembers) > 0 && !f.commentMembers[action.IDMemberCreator]
+}
+
+// Bumped when the activity time computation changes, so the times cached before are not used
+const activityCacheVersion = "3"
+
+// Identifies the filter in the cached activity times, so changing the filter invalidates them
+func (f activityFilter) fingerprint() string {
+	members := make([]string, 0, len(f.commentMembers))
+	for member := range f.commentMembers {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return activityCacheVersion + "|" + f.apiFilter() + "|" + strings.Join(members, ",")
+}
@@ -0,0 +1,127 @@
+package maintainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+	bolt "go.etcd.io/bbolt"
+)
+
+const ACTIVITY_CACHE_PATH_ENV = "ACTIVITY_CACHE_PATH"
+
+var activityCacheBucket = []byte("activity")
+
+// The entries cached that long ago are dropped when the cache is opened, so the entries of the cards gone from the lists don't pile up
+const activityCacheRetention = 90 * 24 * time.Hour
+
+type activityCacheEntry struct {
+	DateLastActivity time.Time `json:"dateLastActivity"`
+	Filter           string    `json:"filter"`
+	LastActivity     time.Time `json:"lastActivity"`
+	CachedAt         time.Time `json:"cachedAt"`
+}
+
+// Persistent (BoltDB) cache of the latest activity time of the cards. The entry is valid while the card dateLastActivity
+// and the activity filter are the same, since any new action of the card moves its dateLastActivity.
+// The entry is put again after the own due date and cover updates, which move it too. A nil cache is valid and caches nothing
+type activityCache struct {
+	db *bolt.DB
+}
+
+// Opens the cache configured with ACTIVITY_CACHE_PATH env var.
+// Returns nil if the cache is not configured
+func openActivityCacheFromEnv() (*activityCache, error) {
+	path := extractEnvOrDefault(ACTIVITY_CACHE_PATH_ENV, "")
+	if len(path) == 0 {
+		return nil, nil
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("can't open activity cache %v: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(activityCacheBucket)
+		if err != nil {
+			return err
+		}
+		var expired [][]byte
+		err = bucket.ForEach(func(k, v []byte) error {
+			var entry activityCacheEntry
+			if json.Unmarshal(v, &entry) != nil || time.Since(entry.CachedAt) > activityCacheRetention {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't initialize activity cache %v: %w", path, err)
+	}
+	return &activityCache{db: db}, nil
+}
+
+func (c *activityCache) get(card *trello.Card, filter string) (time.Time, bool) {
+	if c == nil || card.DateLastActivity == nil {
+		return time.Time{}, false
+	}
+	var entry activityCacheEntry
+	found := false
+	c.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(activityCacheBucket).Get([]byte(card.ID)); data != nil {
+			found = json.Unmarshal(data, &entry) == nil
+		}
+		return nil
+	})
+	if !found || !entry.DateLastActivity.Equal(*card.DateLastActivity) || entry.Filter != filter {
+		return time.Time{}, false
+	}
+	return entry.LastActivity, true
+}
+
+func (c *activityCache) put(card *trello.Card, filter string, lastActivity time.Time, now time.Time) {
+	if c == nil || card.DateLastActivity == nil {
+		return
+	}
+	data, err := json.Marshal(activityCacheEntry{DateLastActivity: *card.DateLastActivity, Filter: filter, LastActivity: lastActivity, CachedAt: now})
+	if err != nil {
+		return
+	}
+	// the cards are checked concurrently, Batch coalesces their writes
+	err = c.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(activityCacheBucket).Put([]byte(card.ID), data)
+	})
+	if err != nil {
+		log.Printf("Failed to cache activity of card %v: %v\n", card.ID, err)
+	}
+}
+
+func (c *activityCache) close() error {
+	if c == nil {
+		return nil
+	}
+	return c.db.Close()
+}
+
+// The latest activity time of the card from the cache, or from the card actions (which are cached then)
+func cachedCardLastActivity(cache *activityCache, gateway trelloops.TrelloGateway, list *trello.List, card *trello.Card, activity activityFilter, now time.Time) time.Time {
+	filter := activity.fingerprint()
+	if lastActivity, found := cache.get(card, filter); found {
+		return lastActivity
+	}
+	lastActivity, _ := cardLastActivity(gateway, list, card, activity)
+	cache.put(card, filter, lastActivity, now)
+	return lastActivity
+}
@@ -0,0 +1,250 @@
+package maintainer
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const API_LISTEN_ADDR_ENV = "API_LISTEN_ADDR"
+const API_TOKEN_ENV = "API_TOKEN"
+
+type apiRunStatus string
+
+const (
+	apiRunRunning   apiRunStatus = "running"
+	apiRunSucceeded apiRunStatus = "succeeded"
+	apiRunFailed    apiRunStatus = "failed"
+)
+
+// Maintenance run triggered via the API
+type apiRun struct {
+	ID         uint64       `json:"id"`
+	Status     apiRunStatus `json:"status"`
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	// id of the run in the action journal, if it is configured
+	JournalRunID uint64 `json:"journalRunId,omitempty"`
+	// number of actions taken so far by type
+	Actions map[journalActionType]int `json:"actions"`
+}
+
+// Runs are kept in memory, only one of them may be active at a time
+type apiServer struct {
+	token  string
+	mu     sync.Mutex
+	runs   map[uint64]*apiRun
+	lastID uint64
+	active *apiRun
+}
+
+// Counts the actions of the run
+type apiRunProgress struct {
+	server *apiServer
+	run    *apiRun
+}
+
+func (p *apiRunProgress) publish(entry journalEntry) error {
+	p.server.mu.Lock()
+	defer p.server.mu.Unlock()
+	p.run.JournalRunID = entry.RunID
+	p.run.Actions[entry.Action]++
+	return nil
+}
+
+func (p *apiRunProgress) close() error {
+	return nil
+}
+
+func (p *apiRunProgress) describe() string {
+	return fmt.Sprintf("API run %d", p.run.ID)
+}
+
+// Serves the control API until the process is stopped
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", extractEnvOrDefault(API_LISTEN_ADDR_ENV, ":8080"), "address to listen on")
+	grpcAddr := flags.String("grpc-addr", extractEnvOrDefault(GRPC_LISTEN_ADDR_ENV, ""), "address to serve gRPC on (disabled if empty)")
+	pprofAddr := flags.String("pprof-addr", extractEnvOrDefault(PPROF_LISTEN_ADDR_ENV, ""), "address to serve net/http/pprof on (disabled if empty)")
+	flags.Parse(args)
+	if len(*pprofAddr) > 0 {
+		go servePprof(*pprofAddr)
+	}
+
+	server := &apiServer{
+		token: extractSecretEnvOrExit(API_TOKEN_ENV),
+		runs:  make(map[uint64]*apiRun),
+	}
+	if len(*grpcAddr) > 0 {
+		go serveGRPC(*grpcAddr, server)
+	}
+	ready := &readiness{}
+	ready.watch(newTrelloClient(extractSecretEnvOrExit(TRELLO_KEY_ENV), extractSecretEnvOrExit(TRELLO_TOKEN_ENV)))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", ready.handleReadyz)
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.HandleFunc("/runs", server.authenticated(server.handleRuns))
+	mux.HandleFunc("/runs/", server.authenticated(server.handleRun))
+	newWebUI(server).register(mux)
+	log.Printf("Control API listens on %v\n", *addr)
+	log.Fatalf("ERROR: control API stopped: %v\n", http.ListenAndServe(*addr, mux))
+}
+
+func (s *apiServer) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Copy of the run which is safe to use without the lock
+func (run *apiRun) snapshot() apiRun {
+	copied := *run
+	copied.Actions = make(map[journalActionType]int, len(run.Actions))
+	for action, count := range run.Actions {
+		copied.Actions[action] = count
+	}
+	return copied
+}
+
+// Starts the maintenance run unless one is in progress. Returns the started or the active run
+func (s *apiServer) startRun() (apiRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != nil {
+		return s.active.snapshot(), false
+	}
+	s.lastID++
+	run := &apiRun{
+		ID:        s.lastID,
+		Status:    apiRunRunning,
+		StartedAt: time.Now(),
+		Actions:   make(map[journalActionType]int),
+	}
+	s.runs[run.ID] = run
+	s.active = run
+	go s.execute(run)
+	log.Printf("Maintenance run %d requested via the API\n", run.ID)
+	return run.snapshot(), true
+}
+
+func (s *apiServer) findRun(id uint64) (apiRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, found := s.runs[id]
+	if !found {
+		return apiRun{}, false
+	}
+	return run.snapshot(), true
+}
+
+// The most recently finished run
+func (s *apiServer) lastFinishedRun() (apiRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var last *apiRun
+	for _, run := range s.runs {
+		if run.FinishedAt != nil && (last == nil || run.FinishedAt.After(*last.FinishedAt)) {
+			last = run
+		}
+	}
+	if last == nil {
+		return apiRun{}, false
+	}
+	return last.snapshot(), true
+}
+
+// POST /runs starts the maintenance run
+func (s *apiServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+	run, started := s.startRun()
+	if !started {
+		writeAPIJSON(w, http.StatusConflict, run)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/runs/%d", run.ID))
+	writeAPIJSON(w, http.StatusAccepted, run)
+}
+
+// GET /runs/{id} returns the progress or the result of the run
+func (s *apiServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/runs/"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "invalid run id")
+		return
+	}
+	run, found := s.findRun(id)
+	if !found {
+		writeAPIError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, run)
+}
+
+// Performs the maintenance. The invalid configuration and the panics of the maintenance passes (the card ones included)
+// mark the run failed instead of stopping the server
+func (s *apiServer) execute(run *apiRun) {
+	lock, err := acquireRunLockFromEnv()
+	if err != nil {
+		s.finish(run, err)
+		return
+	}
+	defer lock.release()
+	var failure interface{}
+	defer func() {
+		if r := recover(); r != nil {
+			reportPanicValue(r)
+			failure = r
+		}
+		s.finish(run, failure)
+	}()
+	if err := runMaintenance(maintenanceOptions{sinks: []actionSink{&apiRunProgress{server: s, run: run}}}); err != nil {
+		failure = err
+	}
+}
+
+func (s *apiServer) finish(run *apiRun, failure interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = apiRunSucceeded
+	if failure != nil {
+		run.Status = apiRunFailed
+		run.Error = fmt.Sprint(failure)
+		log.Printf("Maintenance run %d failed: %v\n", run.ID, failure)
+	}
+	s.active = nil
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write API response: %v\n", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, map[string]string{"error": message})
+}
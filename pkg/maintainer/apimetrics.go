@@ -0,0 +1,248 @@
+package maintainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// Upper bounds of the Trello request latency histogram buckets, in seconds
+var trelloLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Trello API usage of the process. All of the clients created by newTrelloClient report here
+var trelloMetrics = newTrelloAPIMetrics()
+
+type trelloRequestKey struct {
+	method   string
+	endpoint string
+	status   string
+}
+
+type latencyHistogram struct {
+	// cumulative counts are computed when the histogram is written, the buckets hold the counts of their own range only
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *latencyHistogram) observe(seconds float64) {
+	i := sort.SearchFloat64s(trelloLatencyBuckets, seconds)
+	if i < len(h.buckets) {
+		h.buckets[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// The last rate limit state reported by Trello in the response headers
+type trelloRateLimit struct {
+	max       int
+	remaining int
+}
+
+type trelloAPIMetrics struct {
+	mu        sync.Mutex
+	requests  map[trelloRequestKey]uint64
+	latency   map[string]*latencyHistogram
+	rateLimit map[string]trelloRateLimit
+	cacheHits uint64
+}
+
+func newTrelloAPIMetrics() *trelloAPIMetrics {
+	return &trelloAPIMetrics{
+		requests:  make(map[trelloRequestKey]uint64),
+		latency:   make(map[string]*latencyHistogram),
+		rateLimit: make(map[string]trelloRateLimit),
+	}
+}
+
+// status is "error" if the request failed without the response
+func (m *trelloAPIMetrics) observe(method string, endpoint string, status string, elapsed time.Duration, header http.Header) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[trelloRequestKey{method: method, endpoint: endpoint, status: status}]++
+	histogram, found := m.latency[endpoint]
+	if !found {
+		histogram = &latencyHistogram{buckets: make([]uint64, len(trelloLatencyBuckets))}
+		m.latency[endpoint] = histogram
+	}
+	histogram.observe(elapsed.Seconds())
+	// Trello limits the requests both per API key and per token
+	for _, scope := range []string{"key", "token"} {
+		max, maxErr := strconv.Atoi(header.Get("X-Rate-Limit-Api-" + scope + "-Max"))
+		remaining, remainingErr := strconv.Atoi(header.Get("X-Rate-Limit-Api-" + scope + "-Remaining"))
+		if maxErr == nil && remainingErr == nil {
+			m.rateLimit[scope] = trelloRateLimit{max: max, remaining: remaining}
+		}
+	}
+}
+
+// The request served from the response cache without reaching Trello
+func (m *trelloAPIMetrics) observeCacheHit() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cacheHits++
+}
+
+// Total number of requests and the failed ones (no response or non 2xx status)
+func (m *trelloAPIMetrics) totals() (uint64, uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var total, failed uint64
+	for key, count := range m.requests {
+		total += count
+		if !strings.HasPrefix(key.status, "2") {
+			failed += count
+		}
+	}
+	return total, failed
+}
+
+// Logs the totals, e.g. at the end of a single run which has no metrics endpoint
+func (m *trelloAPIMetrics) logSummary() {
+	total, failed := m.totals()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	summary := fmt.Sprintf("Trello API: %d requests, %d failed, %d served from cache", total, failed, m.cacheHits)
+	if limit, found := m.rateLimit["token"]; found {
+		summary += fmt.Sprintf(", token rate limit %d of %d remaining", limit.remaining, limit.max)
+	}
+	log.Println(summary)
+}
+
+// Writes the metrics in Prometheus text exposition format
+func (m *trelloAPIMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP trello_board_maintainer_build_info Version of the running binary.")
+	fmt.Fprintln(w, "# TYPE trello_board_maintainer_build_info gauge")
+	fmt.Fprintf(w, "trello_board_maintainer_build_info{version=%q,commit=%q,build_date=%q} 1\n", version, commit, buildDate)
+
+	keys := make([]trelloRequestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	fmt.Fprintln(w, "# HELP trello_requests_total Trello API requests by endpoint and status code.")
+	fmt.Fprintln(w, "# TYPE trello_requests_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "trello_requests_total{method=%q,endpoint=%q,status=%q} %d\n", key.method, key.endpoint, key.status, m.requests[key])
+	}
+
+	endpoints := make([]string, 0, len(m.latency))
+	for endpoint := range m.latency {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	fmt.Fprintln(w, "# HELP trello_request_duration_seconds Trello API request latency by endpoint.")
+	fmt.Fprintln(w, "# TYPE trello_request_duration_seconds histogram")
+	for _, endpoint := range endpoints {
+		histogram := m.latency[endpoint]
+		var cumulative uint64
+		for i, bound := range trelloLatencyBuckets {
+			cumulative += histogram.buckets[i]
+			fmt.Fprintf(w, "trello_request_duration_seconds_bucket{endpoint=%q,le=\"%g\"} %d\n", endpoint, bound, cumulative)
+		}
+		fmt.Fprintf(w, "trello_request_duration_seconds_bucket{endpoint=%q,le=\"+Inf\"} %d\n", endpoint, histogram.count)
+		fmt.Fprintf(w, "trello_request_duration_seconds_sum{endpoint=%q} %g\n", endpoint, histogram.sum)
+		fmt.Fprintf(w, "trello_request_duration_seconds_count{endpoint=%q} %d\n", endpoint, histogram.count)
+	}
+
+	fmt.Fprintln(w, "# HELP trello_cache_hits_total Trello API requests served from the response cache.")
+	fmt.Fprintln(w, "# TYPE trello_cache_hits_total counter")
+	fmt.Fprintf(w, "trello_cache_hits_total %d\n", m.cacheHits)
+
+	fmt.Fprintln(w, "# HELP trello_rate_limit_remaining Requests left in the current Trello rate limit window, as of the last response.")
+	fmt.Fprintln(w, "# TYPE trello_rate_limit_remaining gauge")
+	for _, scope := range []string{"key", "token"} {
+		if limit, found := m.rateLimit[scope]; found {
+			fmt.Fprintf(w, "trello_rate_limit_remaining{scope=%q} %d\n", scope, limit.remaining)
+		}
+	}
+	fmt.Fprintln(w, "# HELP trello_rate_limit_max Requests allowed in the Trello rate limit window.")
+	fmt.Fprintln(w, "# TYPE trello_rate_limit_max gauge")
+	for _, scope := range []string{"key", "token"} {
+		if limit, found := m.rateLimit[scope]; found {
+			fmt.Fprintf(w, "trello_rate_limit_max{scope=%q} %d\n", scope, limit.max)
+		}
+	}
+}
+
+// GET /metrics
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	trelloMetrics.write(w)
+}
+
+// Records every request sent through it to the metrics and traces it as the child span of the request context.
+// The requests wait for the limiter of the API key and the circuit breaker, if they are set
+type instrumentedTransport struct {
+	next       http.RoundTripper
+	metrics    *trelloAPIMetrics
+	keyLimiter *rate.Limiter
+	breaker    *circuitBreaker
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.keyLimiter != nil {
+		if err := t.keyLimiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	endpoint := trelloops.Endpoint(req.URL.Path)
+	ctx, span := tracer.Start(req.Context(), "Trello "+req.Method+" "+endpoint, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPMethod(req.Method), attribute.String("trello.endpoint", endpoint)))
+	defer span.End()
+	probe := false
+	if t.breaker != nil {
+		var err error
+		if probe, err = t.breaker.wait(ctx); err != nil {
+			recordSpanError(span, err)
+			return nil, err
+		}
+	}
+	started := time.Now()
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if t.breaker != nil {
+		if errors.Is(err, context.Canceled) {
+			t.breaker.abandon(probe)
+		} else {
+			t.breaker.record(isOutageResponse(resp, err))
+		}
+	}
+	if err != nil {
+		t.metrics.observe(req.Method, endpoint, "error", time.Since(started), http.Header{})
+		recordSpanError(span, err)
+		return resp, err
+	}
+	t.metrics.observe(req.Method, endpoint, strconv.Itoa(resp.StatusCode), time.Since(started), resp.Header)
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
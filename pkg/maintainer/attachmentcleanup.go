@@ -0,0 +1,133 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_ATTACHMENT_CLEANUP_LISTS_ENV = "TRELLO_ATTACHMENT_CLEANUP_LISTS"
+const ATTACHMENT_RETENTION_DAYS_ENV = "ATTACHMENT_RETENTION_DAYS"
+
+// Deletes the uploaded attachments (the photos of the pets and their owners) of the cards of the lists archived longer than retention ago.
+// The card is backed up first if the backup storage is set and keeps its description, comments and link attachments
+func cleanUpListsArchivedAttachments(ctx context.Context, client *trello.Client, commaSepListIds string, retention time.Duration, backup cardBackupStorage, audit *auditLog, confirm *operatorConfirmation) {
+	now := time.Now()
+	processLists(ctx, commaSepListIds, "archived card attachment cleanup", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		trelloClient := listClient(ctx, client)
+		list := trelloops.FetchList(trelloClient, listId)
+		cards, err := list.GetCards(trello.Arguments{"filter": "closed"})
+		if err != nil {
+			log.Panicf("Can't fetch archived cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		cleaned := 0
+		for _, card := range cards {
+			if card.Badges.Attachments == 0 {
+				continue
+			}
+			archivedAt, err := cardArchivedAt(card)
+			if err != nil {
+				log.Printf("Can't find when card \"%v\" (%v) was archived: %v\n", card.Name, card.ID, err)
+				continue
+			}
+			if now.Sub(archivedAt) <= retention {
+				continue
+			}
+			record := auditRecord{
+				Timestamp: now,
+				Pass:      "attachmentCleanup",
+				CardID:    card.ID,
+				CardName:  card.Name,
+				ListID:    list.ID,
+				ListName:  list.Name,
+				Rule:      fmt.Sprintf("archived %s ago, attachment retention %s", humanizeDuration(now.Sub(archivedAt)), humanizeDuration(retention)),
+			}
+			deleted, declined, err := deleteCardUploads(trelloClient, list, card, backup, now, record.Rule, confirm)
+			if err != nil {
+				log.Printf("Failed to clean up attachments of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+				record.Decision = auditDecisionError
+				record.Detail = fmt.Sprintf("%d attachments deleted: %v", deleted, err)
+				audit.write(record)
+				continue
+			}
+			if deleted == 0 && declined == 0 {
+				continue
+			}
+			record.Decision = auditDecisionCleanup
+			record.Detail = fmt.Sprintf("%d attachments deleted", deleted)
+			if declined > 0 {
+				record.Detail += fmt.Sprintf(", %d declined by the operator", declined)
+			}
+			if deleted == 0 {
+				record.Decision = auditDecisionSkip
+			}
+			audit.write(record)
+			if deleted > 0 {
+				cleaned++
+			}
+		}
+		log.Printf("Attachments of %d archived cards of the list %v are deleted\n", cleaned, list.Name)
+	})
+}
+
+// When the card was archived, the last activity time if Trello doesn't return the archival action
+func cardArchivedAt(card *trello.Card) (time.Time, error) {
+	actions, err := card.GetActions(trello.Arguments{"filter": "updateCard:closed", "limit": "10"})
+	if err != nil {
+		return time.Time{}, err
+	}
+	// the newest first
+	for _, action := range actions {
+		if action.Data != nil && action.Data.Card != nil && action.Data.Card.Closed {
+			return action.Date, nil
+		}
+	}
+	if card.DateLastActivity == nil {
+		return time.Time{}, fmt.Errorf("neither the archival action nor the last activity time is known")
+	}
+	return *card.DateLastActivity, nil
+}
+
+// Deletes the uploaded attachments of the card the operator approves after its backup (if set), returns how many are deleted and declined
+func deleteCardUploads(client *trello.Client, list *trello.List, card *trello.Card, backup cardBackupStorage, now time.Time, rule string, confirm *operatorConfirmation) (deleted int, declined int, err error) {
+	attachments, err := card.GetAttachments(trello.Defaults())
+	if err != nil {
+		return 0, 0, fmt.Errorf("can't fetch attachments: %w", err)
+	}
+	var uploads []*trello.Attachment
+	for _, attachment := range attachments {
+		if !attachment.IsUpload {
+			continue
+		}
+		if !confirm.approve(fmt.Sprintf("delete attachment \"%v\" of archived card \"%v\" (%v) of the list %v: %s", attachment.Name, card.Name, card.ID, list.Name, rule)) {
+			log.Printf("Attachment \"%v\" of archived card \"%v\" (%v) is not deleted: declined by the operator\n", attachment.Name, card.Name, card.ID)
+			declined++
+			continue
+		}
+		uploads = append(uploads, attachment)
+	}
+	if len(uploads) == 0 {
+		return 0, declined, nil
+	}
+	if backup != nil {
+		if err := backupCard(trelloops.NewClientGateway(client), backup, list, card, now); err != nil {
+			return 0, declined, fmt.Errorf("attachments are NOT deleted as the card backup failed: %w", err)
+		}
+	}
+	for _, attachment := range uploads {
+		if err := trelloops.JSONRequest(client, http.MethodDelete, fmt.Sprintf("cards/%s/attachments/%s", card.ID, attachment.ID), nil, nil); err != nil {
+			return deleted, declined, fmt.Errorf("can't delete attachment %v: %w", attachment.ID, err)
+		}
+		log.Printf("Deleted attachment \"%v\" of archived card \"%v\" (%v)\n", attachment.Name, card.Name, card.ID)
+		deleted++
+	}
+	return deleted, declined, nil
+}
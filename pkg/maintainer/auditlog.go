@@ -0,0 +1,110 @@
+package maintainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const AUDIT_LOG_PATH_ENV = "AUDIT_LOG_PATH"
+
+type auditDecision string
+
+const (
+	auditDecisionSkip       auditDecision = "skip"
+	auditDecisionArchive    auditDecision = "archive"
+	auditDecisionDelete     auditDecision = "delete"
+	auditDecisionMove       auditDecision = "moveToBoard"
+	auditDecisionMoveToList auditDecision = "moveToList"
+	auditDecisionReorder    auditDecision = "reorder"
+	auditDecisionLink       auditDecision = "link"
+	auditDecisionLabel      auditDecision = "label"
+	auditDecisionScrub      auditDecision = "scrub"
+	auditDecisionComment    auditDecision = "comment"
+	auditDecisionPlugin     auditDecision = "plugin"
+	auditDecisionCleanup    auditDecision = "cleanup"
+	auditDecisionNormalize  auditDecision = "normalize"
+	auditDecisionNeedsFix   auditDecision = "needsFix"
+	auditDecisionError      auditDecision = "error"
+)
+
+// A single decision the bot made about the card (including the decision to do nothing)
+type auditRecord struct {
+	Timestamp    time.Time     `json:"timestamp"`
+	Pass         string        `json:"pass"`
+	CardID       string        `json:"cardId"`
+	CardName     string        `json:"cardName"`
+	ListID       string        `json:"listId"`
+	ListName     string        `json:"listName"`
+	Decision     auditDecision `json:"decision"`
+	Rule         string        `json:"rule"`
+	LastActivity *time.Time    `json:"lastActivity,omitempty"`
+	InactiveFor  string        `json:"inactiveFor,omitempty"`
+	Threshold    string        `json:"threshold,omitempty"`
+	Similarity   *float64      `json:"similarity,omitempty"`
+	Detail       string        `json:"detail,omitempty"`
+}
+
+// Append-only JSONL file with all of the decisions. A nil auditLog is valid and writes nothing.
+// summary (if set) counts the errors, the errors are also reported to Sentry if it is configured.
+// The auditLog without the file only counts and reports the errors
+type auditLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	summary *runSummary
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("can't open audit log %v: %w", path, err)
+	}
+	return &auditLog{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Opens the audit log configured with AUDIT_LOG_PATH env var.
+// Returns nil if the audit log is not configured
+func openAuditLogFromEnv() (*auditLog, error) {
+	path := extractEnvOrDefault(AUDIT_LOG_PATH_ENV, "")
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return openAuditLog(path)
+}
+
+func (a *auditLog) write(record auditRecord) {
+	if a == nil {
+		return
+	}
+	if record.Decision == auditDecisionError {
+		if a.summary != nil {
+			a.summary.recordError()
+		}
+		reportAuditError(record)
+	}
+	if record.Decision == auditDecisionNeedsFix && a.summary != nil {
+		a.summary.recordNeedsFix(record.Detail)
+	}
+	if a.encoder == nil {
+		return
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.encoder.Encode(record); err != nil {
+		log.Printf("Failed to write audit record for card %v: %v\n", record.CardID, err)
+	}
+}
+
+func (a *auditLog) close() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
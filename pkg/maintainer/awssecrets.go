@@ -0,0 +1,202 @@
+package maintainer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Prefixes of the secret env var values referring to AWS, e.g.
+// TRELLO_TOKEN=aws-sm:arn:aws:secretsmanager:eu-central-1:123456789012:secret:trello-AbCdEf#token
+// or TRELLO_TOKEN=aws-ssm:/trello-board-maintainer/token
+const awsSecretsManagerPrefix = "aws-sm:"
+const awsParameterStorePrefix = "aws-ssm:"
+
+// Resolved references are re-read after it, so the rotated secrets are picked up by the next run
+const awsSecretCacheTTL = 5 * time.Minute
+
+type awsCachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// Resolves the references to Secrets Manager secrets and SSM Parameter Store parameters
+// with the standard AWS credentials: env vars, shared credentials file or instance/pod role
+type awsSecretResolver struct {
+	creds *credentials.Credentials
+	http  *http.Client
+	mu    sync.Mutex
+	cache map[string]awsCachedSecret
+}
+
+var awsSecrets = &awsSecretResolver{
+	creds: credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	}),
+	http:  &http.Client{Timeout: 15 * time.Second, Transport: outboundTransport()},
+	cache: make(map[string]awsCachedSecret),
+}
+
+func isAWSSecretReference(value string) bool {
+	return strings.HasPrefix(value, awsSecretsManagerPrefix) || strings.HasPrefix(value, awsParameterStorePrefix)
+}
+
+// Returns the secret the reference points to. Secrets Manager references may select the field of the JSON secret after "#"
+func (r *awsSecretResolver) resolve(reference string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cached, found := r.cache[reference]; found && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+	var value string
+	var err error
+	if strings.HasPrefix(reference, awsSecretsManagerPrefix) {
+		value, err = r.secretsManagerValue(strings.TrimPrefix(reference, awsSecretsManagerPrefix))
+	} else {
+		value, err = r.parameterValue(strings.TrimPrefix(reference, awsParameterStorePrefix))
+	}
+	if err != nil {
+		return "", err
+	}
+	r.cache[reference] = awsCachedSecret{value: value, expires: time.Now().Add(awsSecretCacheTTL)}
+	return value, nil
+}
+
+func (r *awsSecretResolver) secretsManagerValue(secretRef string) (string, error) {
+	secretID, field, hasField := strings.Cut(secretRef, "#")
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := r.call("secretsmanager", awsRegion(secretID), "secretsmanager.GetSecretValue", map[string]string{"SecretId": secretID}, &resp); err != nil {
+		return "", fmt.Errorf("can't get secret %s from AWS Secrets Manager: %w", secretID, err)
+	}
+	if !hasField {
+		return resp.SecretString, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(resp.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("AWS Secrets Manager secret %s is not a JSON object, can't select field %s: %w", secretID, field, err)
+	}
+	value, found := fields[field]
+	if !found {
+		return "", fmt.Errorf("AWS Secrets Manager secret %s has no field %s", secretID, field)
+	}
+	return fmt.Sprint(value), nil
+}
+
+func (r *awsSecretResolver) parameterValue(name string) (string, error) {
+	var resp struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	if err := r.call("ssm", awsRegion(name), "AmazonSSM.GetParameter", map[string]interface{}{"Name": name, "WithDecryption": true}, &resp); err != nil {
+		return "", fmt.Errorf("can't get parameter %s from AWS SSM Parameter Store: %w", name, err)
+	}
+	return resp.Parameter.Value, nil
+}
+
+// The region of the ARN, or the region of the environment for the plain names
+func awsRegion(nameOrARN string) string {
+	if parts := strings.SplitN(nameOrARN, ":", 5); len(parts) == 5 && parts[0] == "arn" && len(parts[3]) > 0 {
+		return parts[3]
+	}
+	return extractEnvOrDefault("AWS_REGION", extractEnvOrDefault("AWS_DEFAULT_REGION", "us-east-1"))
+}
+
+// Calls the AWS JSON 1.1 API action, signing the request with Signature Version 4
+func (r *awsSecretResolver) call(service string, region string, target string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	creds, err := r.creds.Get()
+	if err != nil {
+		return fmt.Errorf("no AWS credentials: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://"+service+"."+region+".amazonaws.com/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWSRequestV4(req, payload, creds, service, region, time.Now().UTC())
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("AWS responded with HTTP %d: %s %s", resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+	return json.Unmarshal(data, out)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func signAWSRequestV4(req *http.Request, payload []byte, creds credentials.Value, service string, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if len(creds.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{req.Method, "/", "", canonicalHeaders.String(), signedHeaders, sha256Hex(payload)}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
@@ -0,0 +1,212 @@
+package maintainer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const CARD_BACKUP_STORAGE_ENV = "CARD_BACKUP_STORAGE"
+const CARD_BACKUP_DIR_ENV = "CARD_BACKUP_DIR"
+const CARD_BACKUP_BUCKET_ENV = "CARD_BACKUP_BUCKET"
+const CARD_BACKUP_PREFIX_ENV = "CARD_BACKUP_PREFIX"
+const CARD_BACKUP_ENDPOINT_ENV = "CARD_BACKUP_ENDPOINT"
+const CARD_BACKUP_REGION_ENV = "CARD_BACKUP_REGION"
+const CARD_BACKUP_USE_SSL_ENV = "CARD_BACKUP_USE_SSL"
+const CARD_BACKUP_ACCESS_KEY_ENV = "CARD_BACKUP_ACCESS_KEY"
+const CARD_BACKUP_SECRET_KEY_ENV = "CARD_BACKUP_SECRET_KEY"
+
+const defaultS3Endpoint = "s3.amazonaws.com"
+
+// GCS is accessed via its S3 compatible XML API, which requires HMAC keys
+// (Cloud Storage -> Settings -> Interoperability)
+const defaultGCSEndpoint = "storage.googleapis.com"
+
+// Everything we know about the card at the moment it is removed from the board
+type cardBackup struct {
+	BackedUpAt  time.Time               `json:"backedUpAt"`
+	ListID      string                  `json:"listId"`
+	ListName    string                  `json:"listName"`
+	Card        *trello.Card            `json:"card"`
+	Actions     trello.ActionCollection `json:"actions"`
+	Attachments []*trello.Attachment    `json:"attachments"`
+	Labels      []*trello.Label         `json:"labels"`
+}
+
+// Place where card backups are persisted
+type cardBackupStorage interface {
+	store(name string, data []byte) error
+	load(name string) ([]byte, error)
+	describe() string
+}
+
+type localDirBackupStorage struct {
+	dir string
+}
+
+func newLocalDirBackupStorage(dir string) (*localDirBackupStorage, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("can't create backup dir %v: %w", dir, err)
+	}
+	return &localDirBackupStorage{dir: dir}, nil
+}
+
+func (s *localDirBackupStorage) store(name string, data []byte) error {
+	path := filepath.Join(s.dir, name)
+	// writing to temp file first, so that a crash does not leave a truncated backup behind
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (s *localDirBackupStorage) load(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, name))
+}
+
+func (s *localDirBackupStorage) describe() string {
+	return fmt.Sprintf("local dir %v", s.dir)
+}
+
+// Stores backups as objects in S3 compatible bucket (AWS S3, MinIO, GCS interoperability API, etc.)
+type objectStorageBackupStorage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newObjectStorageBackupStorage(endpoint string, useSSL bool, region string, creds *credentials.Credentials, bucket string, prefix string) (*objectStorageBackupStorage, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:     creds,
+		Secure:    useSSL,
+		Region:    region,
+		Transport: outboundTransport(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't create object storage client for %v: %w", endpoint, err)
+	}
+	return &objectStorageBackupStorage{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *objectStorageBackupStorage) store(name string, data []byte) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, path.Join(s.prefix, name),
+		bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	return err
+}
+
+func (s *objectStorageBackupStorage) load(name string) ([]byte, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, path.Join(s.prefix, name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}
+
+func (s *objectStorageBackupStorage) describe() string {
+	return fmt.Sprintf("bucket %v/%v at %v", s.bucket, s.prefix, s.client.EndpointURL().Host)
+}
+
+// Configures the backup storage according to the CARD_BACKUP_* env vars.
+// Returns nil storage if backups are not configured
+func newCardBackupStorageFromEnv() (cardBackupStorage, error) {
+	dir := extractEnvOrDefault(CARD_BACKUP_DIR_ENV, "")
+	defaultKind := ""
+	if len(dir) > 0 {
+		defaultKind = "local"
+	}
+	kind := extractEnvOrDefault(CARD_BACKUP_STORAGE_ENV, defaultKind)
+
+	switch kind {
+	case "":
+		return nil, nil
+	case "local":
+		if len(dir) == 0 {
+			return nil, fmt.Errorf("%s must be set for local card backups", CARD_BACKUP_DIR_ENV)
+		}
+		return newLocalDirBackupStorage(dir)
+	case "s3", "gcs":
+		defaultEndpoint := defaultS3Endpoint
+		if kind == "gcs" {
+			defaultEndpoint = defaultGCSEndpoint
+		}
+		endpoint := extractEnvOrDefault(CARD_BACKUP_ENDPOINT_ENV, defaultEndpoint)
+		bucket := extractEnvOrDefault(CARD_BACKUP_BUCKET_ENV, "")
+		if len(bucket) == 0 {
+			return nil, fmt.Errorf("%s must be set for %s card backups", CARD_BACKUP_BUCKET_ENV, kind)
+		}
+		useSSLStr := extractEnvOrDefault(CARD_BACKUP_USE_SSL_ENV, "true")
+		useSSL, err := strconv.ParseBool(useSSLStr)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse %s value \"%s\"", CARD_BACKUP_USE_SSL_ENV, useSSLStr)
+		}
+
+		accessKey := extractSecretEnvOrDefault(CARD_BACKUP_ACCESS_KEY_ENV, "")
+		secretKey := extractSecretEnvOrDefault(CARD_BACKUP_SECRET_KEY_ENV, "")
+		var creds *credentials.Credentials
+		if len(accessKey) > 0 {
+			creds = credentials.NewStaticV4(accessKey, secretKey, "")
+		} else if kind == "s3" {
+			// standard AWS env vars, shared credentials file or instance role
+			creds = credentials.NewChainCredentials([]credentials.Provider{
+				&credentials.EnvAWS{},
+				&credentials.FileAWSCredentials{},
+				&credentials.IAM{},
+			})
+		} else {
+			return nil, fmt.Errorf("%s and %s (HMAC key) must be set for gcs card backups", CARD_BACKUP_ACCESS_KEY_ENV, CARD_BACKUP_SECRET_KEY_ENV)
+		}
+
+		return newObjectStorageBackupStorage(endpoint, useSSL,
+			extractEnvOrDefault(CARD_BACKUP_REGION_ENV, ""), creds,
+			bucket, extractEnvOrDefault(CARD_BACKUP_PREFIX_ENV, ""))
+	default:
+		return nil, fmt.Errorf("unsupported %s value \"%s\" (expected local, s3 or gcs)", CARD_BACKUP_STORAGE_ENV, kind)
+	}
+}
+
+func cardBackupName(cardID string) string {
+	return cardID + ".json"
+}
+
+// Fetches full card history and persist it to the storage
+func backupCard(gateway trelloops.TrelloGateway, storage cardBackupStorage, list *trello.List, card *trello.Card, now time.Time) error {
+	actions, err := gateway.GetCardActions(card, trello.Arguments{"filter": "all", "limit": "1000"})
+	if err != nil {
+		return fmt.Errorf("can't fetch actions: %w", err)
+	}
+	attachments, err := gateway.GetCardAttachments(card)
+	if err != nil {
+		return fmt.Errorf("can't fetch attachments: %w", err)
+	}
+
+	backup := cardBackup{
+		BackedUpAt:  now,
+		ListID:      list.ID,
+		ListName:    list.Name,
+		Card:        card,
+		Actions:     actions,
+		Attachments: attachments,
+		Labels:      card.Labels,
+	}
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't serialize card: %w", err)
+	}
+	return storage.store(cardBackupName(card.ID), data)
+}
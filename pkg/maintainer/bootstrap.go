@@ -0,0 +1,98 @@
+package maintainer
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// The lists of the lost pet board, left to right
+var bootstrapLists = []string{"Intake", "Candidates", "In progress", "Long-term", "Resolved"}
+
+// The cards in progress for longer are routed to the long-term list
+const bootstrapLongTermDays = 30
+
+// Creates the board with the standard lists, labels and custom fields and prints the config file profile maintaining it
+func runBootstrap(args []string) {
+	flags := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	name := flags.String("name", "", "name of the new board (required)")
+	organization := flags.String("org", "", "id of the workspace to create the board in (the personal boards if empty)")
+	flags.Parse(args)
+	if len(*name) == 0 {
+		log.Fatalf("ERROR: the board name is required. Use -name\n")
+	}
+
+	client := newTrelloClient(extractSecretEnvOrExit(TRELLO_KEY_ENV), extractSecretEnvOrExit(TRELLO_TOKEN_ENV))
+	board := trello.NewBoard(*name)
+	board.IDOrganization = *organization
+	if err := client.CreateBoard(&board, trello.Arguments{"defaultLists": "false", "defaultLabels": "false"}); err != nil {
+		log.Fatalf("ERROR: can't create board %s: %v\n", *name, err)
+	}
+	log.Printf("Created board %s (%s): %s\n", board.Name, board.ID, board.ShortURL)
+
+	listIDs := make(map[string]string)
+	for _, listName := range bootstrapLists {
+		list, err := client.CreateList(&board, listName, trello.Arguments{"pos": "bottom"})
+		if err != nil {
+			log.Fatalf("ERROR: can't create list %s on the board %s: %v\n", listName, board.ID, err)
+		}
+		log.Printf("Created list %s (%s)\n", list.Name, list.ID)
+		listIDs[listName] = list.ID
+	}
+
+	brokenLinkLabel := extractEnvOrDefault(BROKEN_LINK_LABEL_ENV, "broken link")
+	resolvedLabel := extractEnvOrDefault(RESOLVED_LABEL_ENV, "Resolved")
+	for _, label := range []trello.Label{
+		{Name: brokenLinkLabel, Color: "red"},
+		{Name: resolvedLabel, Color: "green"},
+		{Name: "Keep", Color: "yellow"},
+	} {
+		if err := board.CreateLabel(&label); err != nil {
+			log.Fatalf("ERROR: can't create label %s on the board %s: %v\n", label.Name, board.ID, err)
+		}
+		log.Printf("Created label %s (%s)\n", label.Name, label.ID)
+	}
+
+	similarityField := extractEnvOrDefault(SIMILARITY_CUSTOM_FIELD_ENV, "Similarity")
+	coordinatesField := extractEnvOrDefault(COORDINATES_CUSTOM_FIELD_ENV, "Coordinates")
+	if err := trelloops.EnableBoardPowerUp(client, board.ID, trelloops.CustomFieldsPowerUpID); err != nil {
+		log.Fatalf("ERROR: can't enable the Custom Fields Power-Up on the board %s: %v\n", board.ID, err)
+	}
+	for _, field := range []struct{ name, fieldType string }{
+		{similarityField, "number"},
+		{coordinatesField, "text"},
+	} {
+		created, err := trelloops.CreateBoardCustomField(client, board.ID, field.name, field.fieldType)
+		if err != nil {
+			log.Fatalf("ERROR: can't create custom field %s on the board %s: %v\n", field.name, board.ID, err)
+		}
+		log.Printf("Created %s custom field %s (%s)\n", field.fieldType, created.Name, created.ID)
+	}
+
+	candidates, inProgress, longTerm, resolved := listIDs["Candidates"], listIDs["In progress"], listIDs["Long-term"], listIDs["Resolved"]
+	config := map[string]interface{}{
+		"profiles": []map[string]interface{}{{
+			"name":            board.Name,
+			"reorderLists":    []string{candidates + ":similarity"},
+			"ageRouting":      []string{fmt.Sprintf("%s:%d", inProgress, bootstrapLongTermDays), longTerm},
+			"linkCheckLists":  []string{candidates, inProgress, longTerm},
+			"brokenLinkLabel": brokenLinkLabel,
+			"keywordLists":    []string{inProgress, longTerm},
+			"resolvedList":    resolved,
+			"resolvedLabel":   resolvedLabel,
+			"archiveLists":    []string{resolved},
+		}},
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config); err != nil {
+		log.Fatalf("ERROR: can't print the config: %v\n", err)
+	}
+	log.Printf("The config file profile is printed. Also set %s=%s, %s=%s and %s=%s\n",
+		CARD_INTAKE_LIST_ENV, listIDs["Intake"], SIMILARITY_CUSTOM_FIELD_ENV, similarityField, COORDINATES_CUSTOM_FIELD_ENV, coordinatesField)
+}
@@ -0,0 +1,98 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_BOT_COMMENT_CLEANUP_LISTS_ENV = "TRELLO_BOT_COMMENT_CLEANUP_LISTS"
+const BOT_COMMENT_RETENTION_DAYS_ENV = "BOT_COMMENT_RETENTION_DAYS"
+
+// Deletes the bot messages (the comments of the member of the token rendered from the message templates, e.g. the warnings and the duplicate notes)
+// posted longer than retention ago from the open cards of the lists, so long-lived cards don't accumulate stale bot notices.
+// The other comments of the member (the comments copied by the restore and the dedupe merge) are kept
+func cleanUpListsBotComments(ctx context.Context, client *trello.Client, commaSepListIds string, retention time.Duration, audit *auditLog, confirm *operatorConfirmation) {
+	bot, err := client.GetMyMember(trello.Defaults())
+	if err != nil {
+		log.Panicf("Can't fetch the member of the token: %v", err)
+	}
+	patterns := botMessagePatterns()
+	now := time.Now()
+	processLists(ctx, commaSepListIds, "bot comment cleanup", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		trelloClient := listClient(ctx, client)
+		gateway := trelloops.NewClientGateway(trelloClient)
+		list := trelloops.FetchList(trelloClient, listId)
+		cards, err := list.GetCards(trello.Arguments{"filter": "open"})
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		deleted := 0
+		rule := fmt.Sprintf("bot comments older than %s", humanizeDuration(retention))
+		for _, card := range cards {
+			count, declined, err := cleanUpCardBotComments(gateway, list, card, bot.ID, patterns, now.Add(-retention), rule, confirm)
+			if count == 0 && declined == 0 && err == nil {
+				continue
+			}
+			record := auditRecord{
+				Timestamp: now,
+				Pass:      "botCommentCleanup",
+				CardID:    card.ID,
+				CardName:  card.Name,
+				ListID:    list.ID,
+				ListName:  list.Name,
+				Rule:      rule,
+				Decision:  auditDecisionCleanup,
+				Detail:    fmt.Sprintf("%d comments deleted", count),
+			}
+			if declined > 0 {
+				record.Detail += fmt.Sprintf(", %d declined by the operator", declined)
+			}
+			if count == 0 {
+				record.Decision = auditDecisionSkip
+			}
+			if err != nil {
+				log.Printf("Failed to clean up bot comments of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+				record.Decision = auditDecisionError
+				record.Detail = fmt.Sprintf("%d comments deleted: %v", count, err)
+			}
+			audit.write(record)
+			deleted += count
+		}
+		log.Printf("%d old bot comments are deleted from the list %v\n", deleted, list.Name)
+	})
+}
+
+// Deletes the bot messages of the member posted before the cutoff the operator approves, returns how many are deleted and declined
+func cleanUpCardBotComments(gateway trelloops.TrelloGateway, list *trello.List, card *trello.Card, memberID string, patterns []*regexp.Regexp, cutoff time.Time, rule string, confirm *operatorConfirmation) (deleted int, declined int, err error) {
+	comments, err := gateway.GetCardActions(card, trello.Arguments{"filter": "commentCard", "limit": "1000"})
+	if err != nil {
+		return 0, 0, fmt.Errorf("can't fetch comments: %w", err)
+	}
+	for _, comment := range comments {
+		if comment.IDMemberCreator != memberID || !comment.Date.Before(cutoff) || comment.Data == nil || !isBotMessage(patterns, comment.Data.Text) {
+			continue
+		}
+		if !confirm.approve(fmt.Sprintf("delete bot comment %v of card \"%v\" (%v) of the list %v: %s", comment.ID, card.Name, card.ID, list.Name, rule)) {
+			log.Printf("Bot comment %v of card \"%v\" (%v) of the list %v is not deleted: declined by the operator\n", comment.ID, card.Name, card.ID, list.Name)
+			declined++
+			continue
+		}
+		if err := gateway.DeleteComment(card, comment.ID); err != nil {
+			return deleted, declined, fmt.Errorf("can't delete comment %v: %w", comment.ID, err)
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d old bot comments of card \"%v\" (%v)\n", deleted, card.Name, card.ID)
+	}
+	return deleted, declined, nil
+}
@@ -0,0 +1,79 @@
+package maintainer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+func TestIsBotMessage(t *testing.T) {
+	patterns := botMessagePatterns()
+	cases := []struct {
+		name string
+		text string
+		bot  bool
+	}{
+		{"stale archive", "Archived by TrelloBoardMaintainer: no activity for 12 days (threshold 10 days)", true},
+		{"kashtanka without match", "Closed by TrelloBoardMaintainer: the case is closed in Kashtanka", true},
+		{"kashtanka with match", "Closed by TrelloBoardMaintainer: the case is found in Kashtanka, match: https://kashtanka.pet/1", true},
+		{"multiline summary", "Maintenance run 2024-05-17 10:30 (2m): 3 archived\n1 error", true},
+		{"volunteer comment", "Called the owner, the cat is still missing", false},
+		{"bot message with volunteer text after it", "Archived by TrelloBoardMaintainer: no activity\nplease don't archive", true},
+		{"copied volunteer comment", "Anna (2024-05-17T10:30:00Z):\nCalled the owner", false},
+		{"copied bot message", "TrelloBoardMaintainer (2024-05-17T10:30:00Z):\nArchived by TrelloBoardMaintainer: duplicate of https://trello.com/c/1", false},
+		{"template prefix in the middle", "Note: Archived by TrelloBoardMaintainer: duplicate of https://trello.com/c/1", false},
+	}
+	for _, c := range cases {
+		if bot := isBotMessage(patterns, c.text); bot != c.bot {
+			t.Errorf("%s: expected %v, got %v", c.name, c.bot, bot)
+		}
+	}
+}
+
+func TestCleanUpCardBotCommentsKeepsCopiedComments(t *testing.T) {
+	now := time.Now()
+	created := now.Add(-60 * 24 * time.Hour).Truncate(time.Second)
+	gateway, list, card := testBoard(created, now)
+	old := now.Add(-40 * 24 * time.Hour)
+	comments := []struct {
+		member string
+		date   time.Time
+		text   string
+	}{
+		{"bot", old, "Merged by TrelloBoardMaintainer: duplicate https://trello.com/c/1 (Cat)"},
+		{"bot", now, "Merged by TrelloBoardMaintainer: duplicate https://trello.com/c/2 (Cat)"},
+		{"bot", old, copiedCommentText(&trello.Action{IDMemberCreator: "volunteer", Date: old, Data: &trello.ActionData{Text: "Found the owner"}})},
+		{"volunteer", old, "Archived by TrelloBoardMaintainer: no, keep it"},
+	}
+	for i, comment := range comments {
+		gateway.AddAction(card.ID, &trello.Action{ID: testID(created, 10+i), Type: "commentCard", IDMemberCreator: comment.member, Date: comment.date, Data: &trello.ActionData{Text: comment.text}})
+	}
+
+	deleted, _, err := cleanUpCardBotComments(gateway, list, card, "bot", botMessagePatterns(), now.Add(-30*24*time.Hour), "old", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected only the old bot message deleted, %d are", deleted)
+	}
+	if left := gateway.Comments(card.ID); len(left) != 3 {
+		t.Errorf("expected 3 comments left, got %q", left)
+	}
+}
+
+func TestCleanUpCardBotCommentsAsksOperator(t *testing.T) {
+	now := time.Now()
+	created := now.Add(-60 * 24 * time.Hour).Truncate(time.Second)
+	gateway, list, card := testBoard(created, now)
+	old := now.Add(-40 * 24 * time.Hour)
+	gateway.AddAction(card.ID, &trello.Action{ID: testID(created, 10), Type: "commentCard", IDMemberCreator: "bot", Date: old, Data: &trello.ActionData{Text: "Merged by TrelloBoardMaintainer into https://trello.com/c/1"}})
+
+	deleted, declined, err := cleanUpCardBotComments(gateway, list, card, "bot", botMessagePatterns(), now.Add(-30*24*time.Hour), "old", &operatorConfirmation{quit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 || declined != 1 || len(gateway.Comments(card.ID)) != 1 {
+		t.Errorf("expected the declined comment kept, %d deleted and %d declined", deleted, declined)
+	}
+}
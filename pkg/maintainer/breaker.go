@@ -0,0 +1,129 @@
+package maintainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const CIRCUIT_BREAKER_FAILURES_ENV = "CIRCUIT_BREAKER_FAILURES"
+const CIRCUIT_BREAKER_COOLDOWN_SECONDS_ENV = "CIRCUIT_BREAKER_COOLDOWN_SECONDS"
+const CIRCUIT_BREAKER_MAX_PAUSE_MINUTES_ENV = "CIRCUIT_BREAKER_MAX_PAUSE_MINUTES"
+
+// Pauses the Trello requests for the cooldown after the consecutive failures (no response, HTTP 5xx or 429),
+// then lets a single probe request through: its success resumes the requests, its failure pauses them again.
+// Once the outage lasts longer than maxPause the requests fail immediately instead of waiting for the probe,
+// while the probe is still sent after each cooldown, so the process resumes once Trello is back
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	maxPause  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	// start of the outage, zero while the circuit is closed
+	openedAt  time.Time
+	openUntil time.Time
+	probing   bool
+}
+
+var trelloBreakerOnce sync.Once
+var trelloBreaker *circuitBreaker
+
+// The breaker shared by all of the Trello clients. nil if disabled with CIRCUIT_BREAKER_FAILURES=0
+func trelloCircuitBreakerFromEnv() *circuitBreaker {
+	trelloBreakerOnce.Do(func() {
+		threshold := extractIntEnvOrDefault(CIRCUIT_BREAKER_FAILURES_ENV, 5)
+		if threshold <= 0 {
+			return
+		}
+		trelloBreaker = &circuitBreaker{
+			threshold: threshold,
+			cooldown:  time.Duration(extractIntEnvOrDefault(CIRCUIT_BREAKER_COOLDOWN_SECONDS_ENV, 60)) * time.Second,
+			maxPause:  time.Duration(extractIntEnvOrDefault(CIRCUIT_BREAKER_MAX_PAUSE_MINUTES_ENV, 15)) * time.Minute,
+		}
+	})
+	return trelloBreaker
+}
+
+// Whether the request outcome counts towards the outage. The canceled request says nothing about Trello
+func isOutageResponse(resp *http.Response, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// Waits until the request may be sent, tells whether it is the probe. Every successful wait must be followed by record or abandon
+func (b *circuitBreaker) wait(ctx context.Context) (bool, error) {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		if b.openedAt.IsZero() {
+			b.mu.Unlock()
+			return false, nil
+		}
+		pause := b.openUntil.Sub(now)
+		if pause <= 0 && !b.probing {
+			b.probing = true
+			b.mu.Unlock()
+			return true, nil
+		}
+		if b.maxPause > 0 && now.Sub(b.openedAt) > b.maxPause {
+			outage := now.Sub(b.openedAt)
+			b.mu.Unlock()
+			return false, fmt.Errorf("Trello API has been failing for %v, the requests are not sent", outage.Round(time.Second))
+		}
+		b.mu.Unlock()
+		if pause <= 0 {
+			// the probe is in flight
+			pause = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+}
+
+// Forgets the request whose outcome is unknown (e.g. canceled). If it was the probe, another request may probe
+func (b *circuitBreaker) abandon(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if !failed {
+		if !b.openedAt.IsZero() {
+			log.Printf("Trello API is back after %v, the requests are resumed\n", now.Sub(b.openedAt).Round(time.Second))
+		}
+		b.failures = 0
+		b.openedAt = time.Time{}
+		b.probing = false
+		return
+	}
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		if b.openedAt.IsZero() {
+			b.openedAt = now
+			log.Printf("%d Trello requests failed in a row, the requests are paused for %v\n", b.failures, b.cooldown)
+		}
+		b.openUntil = now.Add(b.cooldown)
+		b.probing = false
+	}
+}
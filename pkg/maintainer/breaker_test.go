@@ -0,0 +1,99 @@
+package maintainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsOutageResponse(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		resp   *http.Response
+		err    error
+		outage bool
+	}{
+		{"ok", &http.Response{StatusCode: http.StatusOK}, nil, false},
+		{"not found", &http.Response{StatusCode: http.StatusNotFound}, nil, false},
+		{"server error", &http.Response{StatusCode: http.StatusBadGateway}, nil, true},
+		{"rate limited", &http.Response{StatusCode: http.StatusTooManyRequests}, nil, true},
+		{"no response", nil, errors.New("connection refused"), true},
+		{"canceled", nil, fmt.Errorf("request: %w", context.Canceled), false},
+	} {
+		if outage := isOutageResponse(tc.resp, tc.err); outage != tc.outage {
+			t.Errorf("%s: expected outage %v, got %v", tc.name, tc.outage, outage)
+		}
+	}
+}
+
+// Waits with the short timeout, the timeout means the request is held
+func testBreakerWait(b *circuitBreaker) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	return b.wait(ctx)
+}
+
+func TestCircuitBreakerOpensProbesAndResumes(t *testing.T) {
+	b := &circuitBreaker{threshold: 2, cooldown: 20 * time.Millisecond}
+	b.record(true)
+	if probe, err := testBreakerWait(b); err != nil || probe {
+		t.Fatalf("expected the requests to go while below the threshold, got probe %v, %v", probe, err)
+	}
+	b.record(true)
+
+	if _, err := testBreakerWait(b); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the requests to be paused for the cooldown, got %v", err)
+	}
+	time.Sleep(b.cooldown)
+	probe, err := testBreakerWait(b)
+	if err != nil || !probe {
+		t.Fatalf("expected the probe after the cooldown, got probe %v, %v", probe, err)
+	}
+	if _, err := testBreakerWait(b); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the other requests to wait for the probe, got %v", err)
+	}
+	b.record(false)
+
+	if probe, err := testBreakerWait(b); err != nil || probe {
+		t.Errorf("expected the requests to resume after the successful probe, got probe %v, %v", probe, err)
+	}
+}
+
+func TestCircuitBreakerProbesBeyondMaxPause(t *testing.T) {
+	b := &circuitBreaker{threshold: 1, cooldown: 20 * time.Millisecond, maxPause: 10 * time.Millisecond}
+	b.record(true)
+	time.Sleep(b.cooldown)
+	if probe, err := testBreakerWait(b); err != nil || !probe {
+		t.Fatalf("expected the probe after the cooldown, got probe %v, %v", probe, err)
+	}
+	b.record(true)
+
+	if _, err := testBreakerWait(b); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the requests to fail immediately beyond the max pause, got %v", err)
+	}
+	time.Sleep(b.cooldown)
+	probe, err := testBreakerWait(b)
+	if err != nil || !probe {
+		t.Fatalf("expected the probe to be sent beyond the max pause, got probe %v, %v", probe, err)
+	}
+	b.record(false)
+
+	if probe, err := testBreakerWait(b); err != nil || probe {
+		t.Errorf("expected the requests to resume once Trello is back, got probe %v, %v", probe, err)
+	}
+}
+
+func TestCircuitBreakerAbandonedProbeLetsAnotherProbe(t *testing.T) {
+	b := &circuitBreaker{threshold: 1, cooldown: 10 * time.Millisecond}
+	b.record(true)
+	time.Sleep(b.cooldown)
+	probe, _ := testBreakerWait(b)
+	b.abandon(probe)
+
+	if probe, err := testBreakerWait(b); err != nil || !probe {
+		t.Errorf("expected another probe after the canceled one, got probe %v, %v", probe, err)
+	}
+}
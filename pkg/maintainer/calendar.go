@@ -0,0 +1,146 @@
+package maintainer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const STALENESS_BUSINESS_DAYS_ONLY_ENV = "STALENESS_BUSINESS_DAYS_ONLY"
+const WEEKEND_DAYS_ENV = "WEEKEND_DAYS"
+const HOLIDAYS_ENV = "HOLIDAYS"
+
+const holidayDateLayout = "2006-01-02"
+
+// Calendar of the days which are counted towards card inactivity
+type businessCalendar struct {
+	weekend  map[time.Weekday]bool
+	holidays map[string]bool
+	// the days are split at its midnights, the board timezone (time.Local, see BOARD_TIMEZONE) if nil
+	location *time.Location
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		fullName := day.String()
+		if strings.EqualFold(name, fullName) || strings.EqualFold(name, fullName[:3]) {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown week day \"%s\"", name)
+}
+
+// commaSepWeekend is like "Sat,Sun", commaSepHolidays is like "2024-01-01,2024-05-09"
+func newBusinessCalendar(commaSepWeekend string, commaSepHolidays string) (*businessCalendar, error) {
+	calendar := &businessCalendar{
+		weekend:  make(map[time.Weekday]bool),
+		holidays: make(map[string]bool),
+	}
+	for _, dayName := range strings.Split(commaSepWeekend, ",") {
+		dayName = strings.TrimSpace(dayName)
+		if len(dayName) == 0 {
+			continue
+		}
+		day, err := parseWeekday(dayName)
+		if err != nil {
+			return nil, err
+		}
+		calendar.weekend[day] = true
+	}
+	for _, holiday := range strings.Split(commaSepHolidays, ",") {
+		holiday = strings.TrimSpace(holiday)
+		if len(holiday) == 0 {
+			continue
+		}
+		if _, err := time.Parse(holidayDateLayout, holiday); err != nil {
+			return nil, fmt.Errorf("can't parse holiday date \"%s\" (expected YYYY-MM-DD)", holiday)
+		}
+		calendar.holidays[holiday] = true
+	}
+	if len(calendar.weekend) == 7 {
+		return nil, fmt.Errorf("all week days are configured as weekend")
+	}
+	return calendar, nil
+}
+
+// Returns nil if staleness is calculated using the wall clock
+func businessCalendarFromEnv() (*businessCalendar, error) {
+	if !extractBoolEnvOrDefault(STALENESS_BUSINESS_DAYS_ONLY_ENV, false) {
+		return nil, nil
+	}
+	return newBusinessCalendar(
+		extractEnvOrDefault(WEEKEND_DAYS_ENV, "Sat,Sun"),
+		extractEnvOrDefault(HOLIDAYS_ENV, ""))
+}
+
+// Identifies the calendar in the incremental verdicts, so changing the weekend, the holidays or the timezone invalidates them.
+// Empty for the nil calendar (the wall clock)
+func (c *businessCalendar) fingerprint() string {
+	if c == nil {
+		return ""
+	}
+	var weekend []string
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if c.weekend[day] {
+			weekend = append(weekend, day.String()[:3])
+		}
+	}
+	holidays := make([]string, 0, len(c.holidays))
+	for holiday := range c.holidays {
+		holidays = append(holidays, holiday)
+	}
+	sort.Strings(holidays)
+	return strings.Join(weekend, ",") + "|" + strings.Join(holidays, ",") + "|" + c.in(time.Time{}).Location().String()
+}
+
+// The time in the location of the calendar days
+func (c *businessCalendar) in(t time.Time) time.Time {
+	if c.location != nil {
+		return t.In(c.location)
+	}
+	return t.In(time.Local)
+}
+
+func (c *businessCalendar) isBusinessDay(t time.Time) bool {
+	return !c.weekend[t.Weekday()] && !c.holidays[t.Format(holidayDateLayout)]
+}
+
+// Time elapsed between from and to, not counting weekends and holidays.
+// Days are split at midnight of the calendar location whatever the locations of from and to are
+func (c *businessCalendar) businessDuration(from time.Time, to time.Time) time.Duration {
+	var total time.Duration
+	cur := c.in(from)
+	to = c.in(to)
+	for cur.Before(to) {
+		y, m, d := cur.Date()
+		nextMidnight := time.Date(y, m, d+1, 0, 0, 0, 0, cur.Location())
+		segmentEnd := nextMidnight
+		if to.Before(segmentEnd) {
+			segmentEnd = to
+		}
+		if c.isBusinessDay(cur) {
+			total += segmentEnd.Sub(cur)
+		}
+		cur = segmentEnd
+	}
+	return total
+}
+
+// The moment when businessDuration(from, result) reaches d, in the calendar location
+func (c *businessCalendar) addBusinessDuration(from time.Time, d time.Duration) time.Time {
+	cur := c.in(from)
+	remaining := d
+	for {
+		y, m, day := cur.Date()
+		nextMidnight := time.Date(y, m, day+1, 0, 0, 0, 0, cur.Location())
+		if c.isBusinessDay(cur) {
+			segment := nextMidnight.Sub(cur)
+			if remaining <= segment {
+				return cur.Add(remaining)
+			}
+			remaining -= segment
+		}
+		cur = nextMidnight
+	}
+}
@@ -0,0 +1,25 @@
+package maintainer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusinessDaysAreCountedInCalendarLocation(t *testing.T) {
+	calendar, err := newBusinessCalendar("Sat,Sun", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar.location = time.FixedZone("MSK", 3*60*60)
+	// Friday in UTC but already Saturday in the calendar location
+	from := time.Date(2024, 3, 1, 22, 0, 0, 0, time.UTC)
+
+	staleAt := calendar.addBusinessDuration(from, 24*time.Hour)
+
+	if expected := time.Date(2024, 3, 5, 0, 0, 0, 0, calendar.location); !staleAt.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, staleAt)
+	}
+	if elapsed := calendar.businessDuration(from, staleAt.UTC()); elapsed != 24*time.Hour {
+		t.Errorf("expected the card to be inactive for 24h at the moment it becomes stale, got %v", elapsed)
+	}
+}
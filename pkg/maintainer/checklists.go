@@ -0,0 +1,131 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// ignore (the default), extend (the threshold of the cards with unchecked checklist items) or exempt (such cards from the stale card actions)
+const INCOMPLETE_CHECKLIST_POLICY_ENV = "INCOMPLETE_CHECKLIST_POLICY"
+const INCOMPLETE_CHECKLIST_THRESHOLD_FACTOR_ENV = "INCOMPLETE_CHECKLIST_THRESHOLD_FACTOR"
+
+type checklistPolicyEnum string
+
+const (
+	checklistPolicyIgnore checklistPolicyEnum = "ignore"
+	checklistPolicyExtend checklistPolicyEnum = "extend"
+	checklistPolicyExempt checklistPolicyEnum = "exempt"
+)
+
+// How the unfinished checklist, telling that a volunteer is mid-way through the case workflow, affects the staleness
+type checklistPolicy struct {
+	mode checklistPolicyEnum
+	// the threshold multiplier of the extend mode
+	factor float64
+}
+
+func checklistPolicyFromEnv() (checklistPolicy, error) {
+	policy := checklistPolicy{
+		mode:   checklistPolicyEnum(strings.ToLower(extractEnvOrDefault(INCOMPLETE_CHECKLIST_POLICY_ENV, string(checklistPolicyIgnore)))),
+		factor: extractFloatEnvOrDefault(INCOMPLETE_CHECKLIST_THRESHOLD_FACTOR_ENV, 2),
+	}
+	switch policy.mode {
+	case checklistPolicyIgnore, checklistPolicyExempt:
+	case checklistPolicyExtend:
+		if policy.factor <= 1 {
+			return policy, fmt.Errorf("%s must be greater than 1, got %v", INCOMPLETE_CHECKLIST_THRESHOLD_FACTOR_ENV, policy.factor)
+		}
+	default:
+		return policy, fmt.Errorf("unsupported %s value %s (expected ignore, extend or exempt)", INCOMPLETE_CHECKLIST_POLICY_ENV, policy.mode)
+	}
+	return policy, nil
+}
+
+// Why the checklists of the card affect its staleness, or empty string if they don't
+func incompleteChecklist(card *trello.Card) string {
+	if card.Badges.CheckItems > card.Badges.CheckItemsChecked {
+		return fmt.Sprintf("%d of %d checklist items are done", card.Badges.CheckItemsChecked, card.Badges.CheckItems)
+	}
+	return ""
+}
+
+// The inactivity threshold of the card, extended if the policy says so
+func (p checklistPolicy) threshold(card *trello.Card, threshold time.Duration) time.Duration {
+	if p.mode == checklistPolicyExtend && len(incompleteChecklist(card)) > 0 {
+		return time.Duration(float64(threshold) * p.factor)
+	}
+	return threshold
+}
+
+// Why the stale card is exempt from the stale card actions, or empty string if it isn't
+func (p checklistPolicy) protection(card *trello.Card) string {
+	if p.mode != checklistPolicyExempt {
+		return ""
+	}
+	return incompleteChecklist(card)
+}
+
+// The name of the checklist item ticked when the bot archives the card (disabled if empty)
+const ARCHIVE_CHECKLIST_ITEM_ENV = "ARCHIVE_CHECKLIST_ITEM"
+
+// The checklist created with the ticked item on the cards without such an item
+const ARCHIVE_CHECKLIST_ENV = "ARCHIVE_CHECKLIST"
+
+// Ticks the closing item of the card archived by the bot, so that the reports based on the checklists count the case closed
+type archiveChecklist struct {
+	checklist string
+	item      string
+}
+
+// Returns nil if the closing item is not configured
+func archiveChecklistFromEnv() *archiveChecklist {
+	item := strings.TrimSpace(extractEnvOrDefault(ARCHIVE_CHECKLIST_ITEM_ENV, ""))
+	if len(item) == 0 {
+		return nil
+	}
+	return &archiveChecklist{
+		checklist: extractEnvOrDefault(ARCHIVE_CHECKLIST_ENV, "Closing"),
+		item:      item,
+	}
+}
+
+// Ticks the item with the configured name in any of the card checklists, or adds the closing checklist with the ticked item
+// if there is no such item. Does nothing if the closing item is nil
+func (c *archiveChecklist) close(gateway trelloops.TrelloGateway, card *trello.Card) error {
+	if c == nil {
+		return nil
+	}
+	checklists, err := gateway.GetChecklists(card)
+	if err != nil {
+		return fmt.Errorf("can't fetch the checklists: %w", err)
+	}
+	for _, checklist := range checklists {
+		for _, item := range checklist.CheckItems {
+			if !strings.EqualFold(strings.TrimSpace(item.Name), c.item) {
+				continue
+			}
+			if item.State == "complete" {
+				return nil
+			}
+			if err := gateway.CompleteCheckItem(card, item.ID); err != nil {
+				return fmt.Errorf("can't tick the item \"%s\" of the checklist \"%s\": %w", item.Name, checklist.Name, err)
+			}
+			log.Printf("Ticked the item \"%s\" of card \"%v\" (%v)\n", item.Name, card.Name, card.ID)
+			return nil
+		}
+	}
+	checklist, err := gateway.CreateChecklist(card, c.checklist)
+	if err != nil {
+		return fmt.Errorf("can't create the checklist \"%s\": %w", c.checklist, err)
+	}
+	if err := gateway.AddCheckItem(checklist, c.item, true); err != nil {
+		return fmt.Errorf("can't add the item \"%s\" to the checklist \"%s\": %w", c.item, c.checklist, err)
+	}
+	log.Printf("Added the checklist \"%s\" with the ticked item \"%s\" to card \"%v\" (%v)\n", c.checklist, c.item, card.Name, card.ID)
+	return nil
+}
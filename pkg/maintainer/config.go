@@ -0,0 +1,540 @@
+package maintainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+)
+
+const CONFIG_FILE_ENV = "CONFIG_FILE"
+
+// Lists and settings maintained together. A run may contain several profiles
+// (e.g. one per board) with independent thresholds, actions and reorder strategies.
+// List settings are comma separated in the same format as the corresponding env vars
+type maintenanceProfile struct {
+	name                    string
+	archiveLists            string
+	archiveBoards           string
+	deleteLists             string
+	moveLists               string
+	moveTargetBoard         string
+	moveTargetList          string
+	reorderLists            string
+	reorderBoards           string
+	renormalizeLists        string
+	cardInactivityThreshold time.Duration
+	archiveAuditComment     bool
+	listMaxCards            int
+	listOverflow            bool
+	minSimilarity           float64
+	lowSimilarityList       string
+	// dated intake lists rotation (disabled if intakeBoard is empty)
+	intakeBoard           string
+	intakeListPrefix      string
+	intakeRotation        string
+	intakeArchiveOldLists bool
+	// "boardId/nameRegex" specs of the lists to archive once they have no open cards
+	archiveEmptyLists string
+	// "listId:maxDays,...,listId" buckets the cards are moved between by age
+	ageRouting string
+	// lists where the cards without cover get their first image attachment as cover
+	imageCoverLists string
+	// lists checked for duplicate cards, what to do with the duplicates and the pet id regex of the card name
+	dedupeLists   string
+	dedupeAction  string
+	dedupeIDRegex string
+	// lists whose cards are checked for dead attachment links, the label for such cards or the list they are moved to
+	linkCheckLists       string
+	brokenLinkLabel      string
+	brokenLinkReviewList string
+	// lists whose cards mentioning the resolved keywords are moved to resolvedList (and labeled with resolvedLabel if it is set)
+	keywordLists     string
+	resolvedKeywords string
+	resolvedList     string
+	resolvedLabel    string
+	// lists whose cards get the map link of the coordinates found in the description
+	mapLinkLists string
+	// lists whose cards get the label of the region their coordinates are in
+	regionLabelLists string
+	// lists whose cards are closed when their cases are solved in Kashtanka, moved to kashtankaSolvedList if it is set
+	kashtankaLists      string
+	kashtankaSolvedList string
+	// lists whose cards older than memberDataRetention lose their member assignments and mentions
+	memberScrubLists    string
+	memberDataRetention time.Duration
+	// lists whose open cards lose the bot comments older than botCommentRetention
+	botCommentLists     string
+	botCommentRetention time.Duration
+	// lists whose cards archived longer than attachmentRetention ago lose their uploaded attachments
+	attachmentCleanupLists string
+	attachmentRetention    time.Duration
+	// lists whose card descriptions are rewritten into the canonical form
+	descNormalizeLists string
+	// boards whose unused labels are deleted
+	labelCleanupBoards string
+	// boards whose members without actions for longer than memberInactivity are reported, or removed if removeInactiveMembers is set
+	memberCleanupBoards   string
+	memberInactivity      time.Duration
+	removeInactiveMembers bool
+	// boards whose lists are kept in the configured order, "boardId:alphabetical", "boardId:created" or "boardId:First|Second|..."
+	listOrderBoards string
+	// lists whose open cards are mirrored with the personal data stripped onto the lists of the same names of the public mirrorBoard
+	mirrorLists string
+	mirrorBoard string
+	// declarative card rules of the config file, applied in their order
+	rules []ruleConfig
+}
+
+// The profile configured with the env vars
+func maintenanceProfileFromEnv() maintenanceProfile {
+	cardInactivityThresholdHoursStr := extractEnvOrDefault(CARD_INACTIVITY_THRESHOLD_HOURS_ENV, "336")
+	cardInactivityThresholdHours, err := strconv.ParseFloat(cardInactivityThresholdHoursStr, 64)
+	if err != nil {
+		configFatalf("can't parse number of card inactivity threshold (hours). String: %s", cardInactivityThresholdHoursStr)
+	}
+	return maintenanceProfile{
+		name:                    "env",
+		archiveLists:            extractEnvOrDefault(TRELLO_ARCHIVES_LISTS_ENV, ""),
+		archiveBoards:           extractEnvOrDefault(TRELLO_ARCHIVE_BOARDS_ENV, ""),
+		deleteLists:             extractEnvOrDefault(TRELLO_DELETE_LISTS_ENV, ""),
+		moveLists:               extractEnvOrDefault(TRELLO_MOVE_LISTS_ENV, ""),
+		moveTargetBoard:         extractEnvOrDefault(TRELLO_MOVE_TARGET_BOARD_ENV, ""),
+		moveTargetList:          extractEnvOrDefault(TRELLO_MOVE_TARGET_LIST_ENV, ""),
+		reorderLists:            extractEnvOrDefault(TRELLO_REORDER_LISTS_ENV, ""),
+		reorderBoards:           extractEnvOrDefault(TRELLO_REORDER_BOARDS_ENV, ""),
+		renormalizeLists:        extractEnvOrDefault(TRELLO_RENORMALIZE_LISTS_ENV, ""),
+		cardInactivityThreshold: time.Duration(cardInactivityThresholdHours * 60 * 60 * 1e9),
+		archiveAuditComment:     extractBoolEnvOrDefault(ARCHIVE_AUDIT_COMMENT_ENV, false),
+		listMaxCards:            extractIntEnvOrDefault(LIST_MAX_CARDS_ENV, 0),
+		listOverflow:            extractBoolEnvOrDefault(LIST_OVERFLOW_ENV, false),
+		minSimilarity:           extractFloatEnvOrDefault(MIN_SIMILARITY_ENV, 0),
+		lowSimilarityList:       extractEnvOrDefault(LOW_SIMILARITY_LIST_ENV, ""),
+		intakeBoard:             extractEnvOrDefault(INTAKE_BOARD_ENV, ""),
+		intakeListPrefix:        extractEnvOrDefault(INTAKE_LIST_PREFIX_ENV, "Intake "),
+		intakeRotation:          extractEnvOrDefault(INTAKE_ROTATION_ENV, "weekly"),
+		intakeArchiveOldLists:   extractBoolEnvOrDefault(INTAKE_ARCHIVE_OLD_LISTS_ENV, false),
+		archiveEmptyLists:       extractEnvOrDefault(ARCHIVE_EMPTY_LISTS_ENV, ""),
+		ageRouting:              extractEnvOrDefault(AGE_ROUTING_ENV, ""),
+		imageCoverLists:         extractEnvOrDefault(TRELLO_IMAGE_COVER_LISTS_ENV, ""),
+		dedupeLists:             extractEnvOrDefault(TRELLO_DEDUPE_LISTS_ENV, ""),
+		dedupeAction:            extractEnvOrDefault(DEDUPE_ACTION_ENV, "archive"),
+		dedupeIDRegex:           extractEnvOrDefault(DEDUPE_ID_REGEX_ENV, ""),
+		linkCheckLists:          extractEnvOrDefault(TRELLO_LINK_CHECK_LISTS_ENV, ""),
+		brokenLinkLabel:         extractEnvOrDefault(BROKEN_LINK_LABEL_ENV, "broken link"),
+		brokenLinkReviewList:    extractEnvOrDefault(BROKEN_LINK_REVIEW_LIST_ENV, ""),
+		keywordLists:            extractEnvOrDefault(TRELLO_KEYWORD_LISTS_ENV, ""),
+		resolvedKeywords:        extractEnvOrDefault(RESOLVED_KEYWORDS_ENV, defaultResolvedKeywords),
+		resolvedList:            extractEnvOrDefault(RESOLVED_LIST_ENV, ""),
+		resolvedLabel:           extractEnvOrDefault(RESOLVED_LABEL_ENV, ""),
+		mapLinkLists:            extractEnvOrDefault(TRELLO_MAP_LINK_LISTS_ENV, ""),
+		regionLabelLists:        extractEnvOrDefault(TRELLO_REGION_LABEL_LISTS_ENV, ""),
+		kashtankaLists:          extractEnvOrDefault(TRELLO_KASHTANKA_LISTS_ENV, ""),
+		kashtankaSolvedList:     extractEnvOrDefault(KASHTANKA_SOLVED_LIST_ENV, ""),
+		memberScrubLists:        extractEnvOrDefault(TRELLO_MEMBER_SCRUB_LISTS_ENV, ""),
+		memberDataRetention:     time.Duration(extractFloatEnvOrDefault(MEMBER_DATA_RETENTION_DAYS_ENV, 365) * 24 * float64(time.Hour)),
+		botCommentLists:         extractEnvOrDefault(TRELLO_BOT_COMMENT_CLEANUP_LISTS_ENV, ""),
+		botCommentRetention:     time.Duration(extractFloatEnvOrDefault(BOT_COMMENT_RETENTION_DAYS_ENV, 30) * 24 * float64(time.Hour)),
+		attachmentCleanupLists:  extractEnvOrDefault(TRELLO_ATTACHMENT_CLEANUP_LISTS_ENV, ""),
+		attachmentRetention:     time.Duration(extractFloatEnvOrDefault(ATTACHMENT_RETENTION_DAYS_ENV, 90) * 24 * float64(time.Hour)),
+		descNormalizeLists:      extractEnvOrDefault(TRELLO_DESC_NORMALIZE_LISTS_ENV, ""),
+		labelCleanupBoards:      extractEnvOrDefault(TRELLO_LABEL_CLEANUP_BOARDS_ENV, ""),
+		memberCleanupBoards:     extractEnvOrDefault(TRELLO_MEMBER_CLEANUP_BOARDS_ENV, ""),
+		memberInactivity:        time.Duration(extractFloatEnvOrDefault(MEMBER_INACTIVITY_MONTHS_ENV, 6) * 30 * 24 * float64(time.Hour)),
+		removeInactiveMembers:   extractBoolEnvOrDefault(REMOVE_INACTIVE_MEMBERS_ENV, false),
+		listOrderBoards:         extractEnvOrDefault(TRELLO_LIST_ORDER_BOARDS_ENV, ""),
+		mirrorLists:             extractEnvOrDefault(TRELLO_MIRROR_LISTS_ENV, ""),
+		mirrorBoard:             extractEnvOrDefault(TRELLO_MIRROR_BOARD_ENV, ""),
+	}
+}
+
+// Checks the parts of the profile which can be checked without Trello API calls
+func (p *maintenanceProfile) validate() error {
+	if len(p.reorderLists) > 0 {
+		for _, listSpec := range strings.Split(p.reorderLists, ",") {
+			if _, _, err := parseReorderListSpec(listSpec); err != nil {
+				return fmt.Errorf("invalid reorder lists: %w", err)
+			}
+		}
+	}
+	if len(p.reorderBoards) > 0 {
+		for _, rawSpec := range strings.Split(p.reorderBoards, ",") {
+			boardSpec, err := trelloops.ParseBoardListsSpec(rawSpec, true)
+			if err == nil {
+				_, _, err = parseReorderListSpec(boardSpec.BoardID + boardSpec.Suffix)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid reorder boards: %w", err)
+			}
+		}
+	}
+	if len(p.archiveBoards) > 0 {
+		for _, rawSpec := range strings.Split(p.archiveBoards, ",") {
+			if _, err := trelloops.ParseBoardListsSpec(rawSpec, false); err != nil {
+				return fmt.Errorf("invalid archive boards: %w", err)
+			}
+		}
+	}
+	if len(p.archiveEmptyLists) > 0 {
+		for _, rawSpec := range strings.Split(p.archiveEmptyLists, ",") {
+			if _, err := trelloops.ParseBoardListsSpec(rawSpec, false); err != nil {
+				return fmt.Errorf("invalid empty lists archival spec: %w", err)
+			}
+		}
+	}
+	if len(p.ageRouting) > 0 {
+		if _, err := parseAgeRouting(p.ageRouting); err != nil {
+			return fmt.Errorf("invalid age routing: %w", err)
+		}
+	}
+	if len(p.dedupeLists) > 0 {
+		if _, err := p.dedupeRules(); err != nil {
+			return err
+		}
+	}
+	if _, err := p.cardRules(); err != nil {
+		return err
+	}
+	if len(p.keywordLists) > 0 {
+		if len(p.resolvedList) == 0 {
+			return fmt.Errorf("resolved list (%s) is not set", RESOLVED_LIST_ENV)
+		}
+		if _, err := compileKeywordsRegex(p.resolvedKeywords); err != nil {
+			return fmt.Errorf("invalid resolved keywords: %w", err)
+		}
+	}
+	if len(p.moveLists) > 0 && len(p.moveTargetBoard) == 0 {
+		return fmt.Errorf("move target board (%s) is not set", TRELLO_MOVE_TARGET_BOARD_ENV)
+	}
+	if p.cardInactivityThreshold < 0 {
+		return fmt.Errorf("card inactivity threshold must not be negative")
+	}
+	if len(p.memberScrubLists) > 0 && p.memberDataRetention <= 0 {
+		return fmt.Errorf("member data retention must be positive")
+	}
+	if len(p.botCommentLists) > 0 && p.botCommentRetention <= 0 {
+		return fmt.Errorf("bot comment retention must be positive")
+	}
+	if len(p.attachmentCleanupLists) > 0 && p.attachmentRetention <= 0 {
+		return fmt.Errorf("attachment retention must be positive")
+	}
+	if len(p.memberCleanupBoards) > 0 && p.memberInactivity <= 0 {
+		return fmt.Errorf("member inactivity must be positive")
+	}
+	if len(p.listOrderBoards) > 0 {
+		for _, rawSpec := range strings.Split(p.listOrderBoards, ",") {
+			if _, err := parseListOrderSpec(rawSpec); err != nil {
+				return fmt.Errorf("invalid list order boards: %w", err)
+			}
+		}
+	}
+	if len(p.mirrorLists) > 0 && len(p.mirrorBoard) == 0 {
+		return fmt.Errorf("the mirror board is required to mirror the lists")
+	}
+	if p.listMaxCards < 0 {
+		return fmt.Errorf("list max cards must not be negative")
+	}
+	if len(p.intakeBoard) > 0 {
+		if _, err := parseIntakeRotation(p.intakeRotation); err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(p.intakeListPrefix)) == 0 {
+			return fmt.Errorf("intake list prefix must not be empty")
+		}
+	}
+	return nil
+}
+
+// Checks that the services the profile needs are configured
+func (p *maintenanceProfile) checkServices(kashtanka *kashtankaClient, regions regionResolver, referencePoint *geoPoint) error {
+	if kashtanka == nil && len(p.kashtankaLists) > 0 {
+		return fmt.Errorf("%s is not set, solved cases can't be looked up", KASHTANKA_CASE_URL_ENV)
+	}
+	if regions == nil && len(p.regionLabelLists) > 0 {
+		return fmt.Errorf("neither %s nor %s is set, regions can't be labeled", REGIONS_GEOJSON_ENV, REGION_GEOCODER_URL_ENV)
+	}
+	if referencePoint == nil && p.usesReorderStrategy(reorderStrategyDistance) {
+		return fmt.Errorf("%s must be set for the distance reorder strategy", REORDER_REFERENCE_POINT_ENV)
+	}
+	return nil
+}
+
+// Whether any of the reorder lists or boards of the profile is ordered with the strategy
+func (p *maintenanceProfile) usesReorderStrategy(strategy reorderStrategyEnum) bool {
+	for _, specs := range []string{p.reorderLists, p.reorderBoards} {
+		if len(specs) == 0 {
+			continue
+		}
+		for _, rawSpec := range strings.Split(specs, ",") {
+			boardSpec, err := trelloops.ParseBoardListsSpec(rawSpec, true)
+			if err != nil {
+				continue
+			}
+			if _, listStrategy, err := parseReorderListSpec(boardSpec.BoardID + boardSpec.Suffix); err == nil && listStrategy == strategy {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Dedupe action and the pet id regex (nil if not configured) of the profile
+func (p *maintenanceProfile) dedupeRules() (dedupePolicy, error) {
+	var policy dedupePolicy
+	action, err := parseDedupeAction(p.dedupeAction)
+	if err != nil {
+		return policy, err
+	}
+	policy.action = action
+	if len(p.dedupeIDRegex) > 0 {
+		idRegex, err := regexp.Compile(p.dedupeIDRegex)
+		if err != nil {
+			return policy, fmt.Errorf("can't compile dedupe id regex: %w", err)
+		}
+		if idRegex.NumSubexp() != 1 {
+			return policy, fmt.Errorf("dedupe id regex must have exactly one capture group, got %d", idRegex.NumSubexp())
+		}
+		policy.idRegex = idRegex
+	}
+	return policy, nil
+}
+
+// The compiled rules of the profile
+func (p *maintenanceProfile) cardRules() ([]cardRule, error) {
+	rules := make([]cardRule, 0, len(p.rules))
+	for i, config := range p.rules {
+		if len(config.Name) == 0 {
+			config.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		rule, err := config.compile()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// JSON config file (CONFIG_FILE env var) with the list of profiles, e.g.
+//
+//	{"profiles": [{"name": "Lost", "archiveBoards": ["5f1a.../^Candidates"], "inactivityThresholdHours": 168}]}
+//
+// Lists are configured only by the file, the omitted settings are taken from the env vars.
+// exemptCardIds are added to EXEMPT_CARD_IDS
+type configFile struct {
+	Profiles      []profileConfig   `json:"profiles"`
+	ExemptCardIDs []string          `json:"exemptCardIds"`
+	Messages      map[string]string `json:"messages"`
+}
+
+type profileConfig struct {
+	Name                     string       `json:"name"`
+	ArchiveLists             []string     `json:"archiveLists"`
+	ArchiveBoards            []string     `json:"archiveBoards"`
+	DeleteLists              []string     `json:"deleteLists"`
+	MoveLists                []string     `json:"moveLists"`
+	MoveTargetBoard          *string      `json:"moveTargetBoard"`
+	MoveTargetList           *string      `json:"moveTargetList"`
+	ReorderLists             []string     `json:"reorderLists"`
+	ReorderBoards            []string     `json:"reorderBoards"`
+	RenormalizeLists         []string     `json:"renormalizeLists"`
+	InactivityThresholdHours *float64     `json:"inactivityThresholdHours"`
+	ArchiveAuditComment      *bool        `json:"archiveAuditComment"`
+	ListMaxCards             *int         `json:"listMaxCards"`
+	ListOverflow             *bool        `json:"listOverflow"`
+	MinSimilarity            *float64     `json:"minSimilarity"`
+	LowSimilarityList        *string      `json:"lowSimilarityList"`
+	IntakeBoard              *string      `json:"intakeBoard"`
+	IntakeListPrefix         *string      `json:"intakeListPrefix"`
+	IntakeRotation           *string      `json:"intakeRotation"`
+	IntakeArchiveOldLists    *bool        `json:"intakeArchiveOldLists"`
+	ArchiveEmptyLists        []string     `json:"archiveEmptyLists"`
+	AgeRouting               []string     `json:"ageRouting"`
+	ImageCoverLists          []string     `json:"imageCoverLists"`
+	DedupeLists              []string     `json:"dedupeLists"`
+	DedupeAction             *string      `json:"dedupeAction"`
+	DedupeIDRegex            *string      `json:"dedupeIdRegex"`
+	LinkCheckLists           []string     `json:"linkCheckLists"`
+	BrokenLinkLabel          *string      `json:"brokenLinkLabel"`
+	BrokenLinkReviewList     *string      `json:"brokenLinkReviewList"`
+	KeywordLists             []string     `json:"keywordLists"`
+	ResolvedKeywords         []string     `json:"resolvedKeywords"`
+	ResolvedList             *string      `json:"resolvedList"`
+	ResolvedLabel            *string      `json:"resolvedLabel"`
+	MapLinkLists             []string     `json:"mapLinkLists"`
+	RegionLabelLists         []string     `json:"regionLabelLists"`
+	KashtankaLists           []string     `json:"kashtankaLists"`
+	KashtankaSolvedList      *string      `json:"kashtankaSolvedList"`
+	MemberScrubLists         []string     `json:"memberScrubLists"`
+	MemberDataRetentionDays  *float64     `json:"memberDataRetentionDays"`
+	BotCommentCleanupLists   []string     `json:"botCommentCleanupLists"`
+	BotCommentRetentionDays  *float64     `json:"botCommentRetentionDays"`
+	AttachmentCleanupLists   []string     `json:"attachmentCleanupLists"`
+	AttachmentRetentionDays  *float64     `json:"attachmentRetentionDays"`
+	DescNormalizeLists       []string     `json:"descNormalizeLists"`
+	LabelCleanupBoards       []string     `json:"labelCleanupBoards"`
+	MemberCleanupBoards      []string     `json:"memberCleanupBoards"`
+	MemberInactivityMonths   *float64     `json:"memberInactivityMonths"`
+	RemoveInactiveMembers    *bool        `json:"removeInactiveMembers"`
+	ListOrderBoards          []string     `json:"listOrderBoards"`
+	MirrorLists              []string     `json:"mirrorLists"`
+	MirrorBoard              *string      `json:"mirrorBoard"`
+	Rules                    []ruleConfig `json:"rules"`
+}
+
+func (c *profileConfig) toProfile(defaults maintenanceProfile) maintenanceProfile {
+	profile := defaults
+	profile.name = c.Name
+	profile.archiveLists = strings.Join(c.ArchiveLists, ",")
+	profile.archiveBoards = strings.Join(c.ArchiveBoards, ",")
+	profile.deleteLists = strings.Join(c.DeleteLists, ",")
+	profile.moveLists = strings.Join(c.MoveLists, ",")
+	profile.reorderLists = strings.Join(c.ReorderLists, ",")
+	profile.reorderBoards = strings.Join(c.ReorderBoards, ",")
+	profile.renormalizeLists = strings.Join(c.RenormalizeLists, ",")
+	profile.archiveEmptyLists = strings.Join(c.ArchiveEmptyLists, ",")
+	profile.ageRouting = strings.Join(c.AgeRouting, ",")
+	profile.imageCoverLists = strings.Join(c.ImageCoverLists, ",")
+	profile.dedupeLists = strings.Join(c.DedupeLists, ",")
+	profile.linkCheckLists = strings.Join(c.LinkCheckLists, ",")
+	if c.BrokenLinkLabel != nil {
+		profile.brokenLinkLabel = *c.BrokenLinkLabel
+	}
+	if c.BrokenLinkReviewList != nil {
+		profile.brokenLinkReviewList = *c.BrokenLinkReviewList
+	}
+	profile.keywordLists = strings.Join(c.KeywordLists, ",")
+	profile.mapLinkLists = strings.Join(c.MapLinkLists, ",")
+	profile.regionLabelLists = strings.Join(c.RegionLabelLists, ",")
+	profile.kashtankaLists = strings.Join(c.KashtankaLists, ",")
+	if c.KashtankaSolvedList != nil {
+		profile.kashtankaSolvedList = *c.KashtankaSolvedList
+	}
+	profile.memberScrubLists = strings.Join(c.MemberScrubLists, ",")
+	profile.rules = c.Rules
+	if c.MemberDataRetentionDays != nil {
+		profile.memberDataRetention = time.Duration(*c.MemberDataRetentionDays * 24 * float64(time.Hour))
+	}
+	profile.botCommentLists = strings.Join(c.BotCommentCleanupLists, ",")
+	if c.BotCommentRetentionDays != nil {
+		profile.botCommentRetention = time.Duration(*c.BotCommentRetentionDays * 24 * float64(time.Hour))
+	}
+	profile.attachmentCleanupLists = strings.Join(c.AttachmentCleanupLists, ",")
+	profile.descNormalizeLists = strings.Join(c.DescNormalizeLists, ",")
+	profile.labelCleanupBoards = strings.Join(c.LabelCleanupBoards, ",")
+	profile.memberCleanupBoards = strings.Join(c.MemberCleanupBoards, ",")
+	profile.listOrderBoards = strings.Join(c.ListOrderBoards, ",")
+	profile.mirrorLists = strings.Join(c.MirrorLists, ",")
+	if c.MirrorBoard != nil {
+		profile.mirrorBoard = *c.MirrorBoard
+	}
+	if c.MemberInactivityMonths != nil {
+		profile.memberInactivity = time.Duration(*c.MemberInactivityMonths * 30 * 24 * float64(time.Hour))
+	}
+	if c.RemoveInactiveMembers != nil {
+		profile.removeInactiveMembers = *c.RemoveInactiveMembers
+	}
+	if c.AttachmentRetentionDays != nil {
+		profile.attachmentRetention = time.Duration(*c.AttachmentRetentionDays * 24 * float64(time.Hour))
+	}
+	if len(c.ResolvedKeywords) > 0 {
+		profile.resolvedKeywords = strings.Join(c.ResolvedKeywords, ",")
+	}
+	if c.ResolvedList != nil {
+		profile.resolvedList = *c.ResolvedList
+	}
+	if c.ResolvedLabel != nil {
+		profile.resolvedLabel = *c.ResolvedLabel
+	}
+	if c.DedupeAction != nil {
+		profile.dedupeAction = *c.DedupeAction
+	}
+	if c.DedupeIDRegex != nil {
+		profile.dedupeIDRegex = *c.DedupeIDRegex
+	}
+	if c.MoveTargetBoard != nil {
+		profile.moveTargetBoard = *c.MoveTargetBoard
+	}
+	if c.MoveTargetList != nil {
+		profile.moveTargetList = *c.MoveTargetList
+	}
+	if c.InactivityThresholdHours != nil {
+		profile.cardInactivityThreshold = time.Duration(*c.InactivityThresholdHours * float64(time.Hour))
+	}
+	if c.ArchiveAuditComment != nil {
+		profile.archiveAuditComment = *c.ArchiveAuditComment
+	}
+	if c.ListMaxCards != nil {
+		profile.listMaxCards = *c.ListMaxCards
+	}
+	if c.ListOverflow != nil {
+		profile.listOverflow = *c.ListOverflow
+	}
+	if c.MinSimilarity != nil {
+		profile.minSimilarity = *c.MinSimilarity
+	}
+	if c.LowSimilarityList != nil {
+		profile.lowSimilarityList = *c.LowSimilarityList
+	}
+	// the intake board is a list setting, so it is not inherited from the env vars
+	profile.intakeBoard = ""
+	if c.IntakeBoard != nil {
+		profile.intakeBoard = *c.IntakeBoard
+	}
+	if c.IntakeListPrefix != nil {
+		profile.intakeListPrefix = *c.IntakeListPrefix
+	}
+	if c.IntakeRotation != nil {
+		profile.intakeRotation = *c.IntakeRotation
+	}
+	if c.IntakeArchiveOldLists != nil {
+		profile.intakeArchiveOldLists = *c.IntakeArchiveOldLists
+	}
+	return profile
+}
+
+// Returns the contents of the config file, or nil if there is no config file
+func configFileFromEnv() (*configFile, error) {
+	path := extractEnvOrDefault(CONFIG_FILE_ENV, "")
+	if len(path) == 0 {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read config file %v: %w", path, err)
+	}
+	var config configFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("can't parse config file %v: %w", path, err)
+	}
+	return &config, nil
+}
+
+// Returns the profiles of the config file, or the single profile configured with env vars if there is no config file
+func maintenanceProfilesFromEnv() ([]maintenanceProfile, error) {
+	defaults := maintenanceProfileFromEnv()
+	config, err := configFileFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return []maintenanceProfile{defaults}, nil
+	}
+	path := extractEnvOrDefault(CONFIG_FILE_ENV, "")
+	if len(config.Profiles) == 0 {
+		return nil, fmt.Errorf("config file %v has no profiles", path)
+	}
+	profiles := make([]maintenanceProfile, 0, len(config.Profiles))
+	for i, profileConfig := range config.Profiles {
+		if len(profileConfig.Name) == 0 {
+			profileConfig.Name = fmt.Sprintf("profile %d", i+1)
+		}
+		profiles = append(profiles, profileConfig.toProfile(defaults))
+	}
+	return profiles, nil
+}
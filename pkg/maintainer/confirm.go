@@ -0,0 +1,71 @@
+package maintainer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Asks the operator to confirm the actions one at a time.
+// "all" approves the rest of the actions without asking, "quit" declines them
+type operatorConfirmation struct {
+	mu   sync.Mutex
+	in   *bufio.Reader
+	out  io.Writer
+	all  bool
+	quit bool
+	// shows the action and reads the answer instead of the in and out if set (e.g. by the dashboard)
+	ask func(action string) (string, error)
+}
+
+func newTerminalConfirmation() *operatorConfirmation {
+	return &operatorConfirmation{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+}
+
+func (c *operatorConfirmation) prompt(action string) (string, error) {
+	if c.ask != nil {
+		return c.ask(action)
+	}
+	fmt.Fprintf(c.out, "%s\nProceed? [y/n/all/quit] ", action)
+	return c.in.ReadString('\n')
+}
+
+// Returns true if the action is approved. The nil confirmation approves everything
+func (c *operatorConfirmation) approve(action string) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.all {
+		return true
+	}
+	if c.quit {
+		return false
+	}
+	for {
+		answer, err := c.prompt(action)
+		if err != nil && len(answer) == 0 {
+			log.Println("No more answers, the rest of the actions are declined")
+			c.quit = true
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		case "a", "all":
+			c.all = true
+			return true
+		case "q", "quit":
+			log.Println("Quit, the rest of the actions are declined")
+			c.quit = true
+			return false
+		}
+	}
+}
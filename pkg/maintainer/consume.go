@@ -0,0 +1,206 @@
+package maintainer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+	"github.com/segmentio/kafka-go"
+)
+
+const KAFKA_BROKERS_ENV = "KAFKA_BROKERS"
+const KAFKA_TOPIC_ENV = "KAFKA_TOPIC"
+const KAFKA_GROUP_ID_ENV = "KAFKA_GROUP_ID"
+const CARD_INTAKE_LIST_ENV = "CARD_INTAKE_LIST"
+
+// Attempts to create the card before the consumer gives up (and exits, so that the message is redelivered)
+const cardCreationAttempts = 3
+
+// Candidate match produced by the detection pipeline
+type candidateMessage struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Similarity  *float64 `json:"similarity,omitempty"`
+	// URLs of the photos and the original adverts
+	Attachments []string `json:"attachments,omitempty"`
+	// target list, CARD_INTAKE_LIST is used if empty
+	ListID string `json:"listId,omitempty"`
+}
+
+// Creates the cards out of the candidate match messages of the Kafka topic until interrupted.
+// The offset is committed only after the card is created
+func runConsume(args []string) {
+	flags := flag.NewFlagSet("consume", flag.ExitOnError)
+	flags.Parse(args)
+
+	trelloAppKey := extractSecretEnvOrExit(TRELLO_KEY_ENV)
+	trelloToken := extractSecretEnvOrExit(TRELLO_TOKEN_ENV)
+	brokers := strings.Split(extractEnvOrExit(KAFKA_BROKERS_ENV), ",")
+	topic := extractEnvOrExit(KAFKA_TOPIC_ENV)
+	groupID := extractEnvOrDefault(KAFKA_GROUP_ID_ENV, "trello-board-maintainer")
+	intakeList := extractEnvOrDefault(CARD_INTAKE_LIST_ENV, "")
+	similarityField := extractEnvOrDefault(SIMILARITY_CUSTOM_FIELD_ENV, "")
+
+	journal, err := openActionJournalFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	if journal != nil {
+		defer journal.close()
+	}
+	currentRun, err := startRunFromEnv(journal, journalRunConsume, time.Now())
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	defer currentRun.close()
+
+	creator := &cardCreator{
+		client:          newTrelloClient(trelloAppKey, trelloToken),
+		intakeList:      intakeList,
+		similarityField: similarityField,
+		lists:           make(map[string]*trello.List),
+		fields:          make(map[string][]*trello.CustomField),
+		journal:         currentRun,
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		Topic:   topic,
+		GroupID: groupID,
+	})
+	defer reader.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Consuming candidate matches from topic %v as group %v\n", topic, groupID)
+	for {
+		message, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				log.Println("Consumer stopped")
+				return
+			}
+			log.Fatalf("ERROR: can't fetch message from Kafka: %v\n", err)
+		}
+		var candidate candidateMessage
+		if err := json.Unmarshal(message.Value, &candidate); err != nil {
+			log.Printf("Skipping malformed message at offset %d: %v\n", message.Offset, err)
+		} else if err := creator.createWithRetries(candidate); err != nil {
+			log.Fatalf("ERROR: can't create card for message at offset %d: %v\n", message.Offset, err)
+		}
+		if err := reader.CommitMessages(ctx, message); err != nil {
+			log.Fatalf("ERROR: can't commit offset %d: %v\n", message.Offset, err)
+		}
+	}
+}
+
+// Creates cards out of candidate messages. The lists and the custom fields of their boards are cached
+type cardCreator struct {
+	client          *trello.Client
+	intakeList      string
+	similarityField string
+	lists           map[string]*trello.List
+	fields          map[string][]*trello.CustomField
+	journal         *runJournal
+}
+
+func (c *cardCreator) createWithRetries(candidate candidateMessage) error {
+	var err error
+	for attempt := 1; attempt <= cardCreationAttempts; attempt++ {
+		if err = c.create(candidate); err == nil {
+			return nil
+		}
+		log.Printf("Attempt %d to create card \"%v\" failed: %v\n", attempt, candidate.Title, err)
+		time.Sleep(time.Duration(attempt) * 5 * time.Second)
+	}
+	return err
+}
+
+func (c *cardCreator) create(candidate candidateMessage) error {
+	listID := candidate.ListID
+	if len(listID) == 0 {
+		listID = c.intakeList
+	}
+	if len(listID) == 0 {
+		return fmt.Errorf("message has no listId and %s is not set", CARD_INTAKE_LIST_ENV)
+	}
+	list, cached := c.lists[listID]
+	if !cached {
+		var err error
+		list, err = c.client.GetList(listID)
+		if err != nil {
+			return fmt.Errorf("can't fetch list %v: %w", listID, err)
+		}
+		c.lists[listID] = list
+	}
+
+	var similarityFieldID string
+	desc := candidate.Description
+	if candidate.Similarity != nil {
+		if len(c.similarityField) > 0 {
+			field, err := c.boardSimilarityField(list.IDBoard)
+			if err != nil {
+				return err
+			}
+			similarityFieldID = field.ID
+		} else {
+			// the similarity is read from the last word of the description
+			desc = strings.TrimRight(desc, " \n") + "\n\n" + strconv.FormatFloat(*candidate.Similarity, 'f', 4, 64)
+		}
+	}
+
+	card := &trello.Card{
+		Name:   candidate.Title,
+		Desc:   desc,
+		IDList: listID,
+		Pos:    65536,
+	}
+	if err := c.client.CreateCard(card); err != nil {
+		return fmt.Errorf("can't create card: %w", err)
+	}
+	if len(similarityFieldID) > 0 {
+		if err := trelloops.NewClientGateway(c.client).SetCardCustomFieldValue(card, similarityFieldID, *candidate.Similarity); err != nil {
+			log.Printf("Failed to set similarity of card %v: %v\n", card.ID, err)
+		}
+	}
+	for _, attachmentURL := range candidate.Attachments {
+		if err := card.AddURLAttachment(&trello.Attachment{URL: attachmentURL}); err != nil {
+			log.Printf("Failed to attach %v to card %v: %v\n", attachmentURL, card.ID, err)
+		}
+	}
+	log.Printf("Created card \"%v\" (%v) in the list %v\n", card.Name, card.ID, list.Name)
+	c.journal.record(journalEntry{
+		Action:   journalActionCreate,
+		CardID:   card.ID,
+		CardName: card.Name,
+		BoardID:  list.IDBoard,
+		ListID:   list.ID,
+		ListName: list.Name,
+		Reason:   "candidate match from the pipeline",
+	})
+	return nil
+}
+
+func (c *cardCreator) boardSimilarityField(boardID string) (*trello.CustomField, error) {
+	fields, cached := c.fields[boardID]
+	if !cached {
+		fields = fetchBoardCustomFields(trelloops.NewClientGateway(c.client), boardID)
+		c.fields[boardID] = fields
+	}
+	field := trelloops.FindBoardCustomField(fields, c.similarityField)
+	if field == nil {
+		return nil, fmt.Errorf("board %v has no custom field %v", boardID, c.similarityField)
+	}
+	return field, nil
+}
@@ -0,0 +1,115 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const STALENESS_COVER_COLORS_ENV = "STALENESS_COVER_COLORS"
+const STALENESS_COVER_WARN_RATIO_ENV = "STALENESS_COVER_WARN_RATIO"
+const STALENESS_COVER_ALERT_RATIO_ENV = "STALENESS_COVER_ALERT_RATIO"
+const TRELLO_IMAGE_COVER_LISTS_ENV = "TRELLO_IMAGE_COVER_LISTS"
+
+// Cover colors showing how close the card is to its staleness threshold:
+// green below warnRatio of the threshold, yellow below alertRatio, red after that
+type coverColorScheme struct {
+	warnRatio  float64
+	alertRatio float64
+}
+
+// Returns nil if cover colors are disabled
+func coverColorSchemeFromEnv() (*coverColorScheme, error) {
+	if !extractBoolEnvOrDefault(STALENESS_COVER_COLORS_ENV, false) {
+		return nil, nil
+	}
+	scheme := &coverColorScheme{
+		warnRatio:  extractFloatEnvOrDefault(STALENESS_COVER_WARN_RATIO_ENV, 0.5),
+		alertRatio: extractFloatEnvOrDefault(STALENESS_COVER_ALERT_RATIO_ENV, 0.8),
+	}
+	if scheme.warnRatio <= 0 || scheme.alertRatio <= scheme.warnRatio || scheme.alertRatio > 1 {
+		return nil, fmt.Errorf("%s and %s must satisfy 0 < warn < alert <= 1", STALENESS_COVER_WARN_RATIO_ENV, STALENESS_COVER_ALERT_RATIO_ENV)
+	}
+	return scheme, nil
+}
+
+func (s *coverColorScheme) colorFor(elapsed float64, threshold float64) string {
+	ratio := elapsed / threshold
+	switch {
+	case ratio < s.warnRatio:
+		return "green"
+	case ratio < s.alertRatio:
+		return "yellow"
+	default:
+		return "red"
+	}
+}
+
+// Sets the cover color of the card according to the scheme.
+// Image covers and the covers which already have the right color are not touched
+func updateCardCoverColor(gateway trelloops.TrelloGateway, scheme *coverColorScheme, card *trello.Card, current trelloops.CardCover, elapsed float64, threshold float64) {
+	if len(current.IDAttachment) > 0 || len(card.IDAttachmentCover) > 0 {
+		return
+	}
+	color := scheme.colorFor(elapsed, threshold)
+	if current.Color == color {
+		return
+	}
+	if err := gateway.SetCardCoverColor(card, color); err != nil {
+		log.Printf("Failed to set cover color of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+		return
+	}
+	log.Printf("Cover of card \"%v\" (%v) set to %s\n", card.Name, card.ID, color)
+}
+
+// Image attachments can be used as covers. Link attachments are images if Trello generated previews for them
+func isImageAttachment(attachment *trello.Attachment) bool {
+	return strings.HasPrefix(attachment.MimeType, "image/") || len(attachment.Previews) > 0
+}
+
+// Sets the cover of the card to its first image attachment. Does nothing if the card already has an image cover
+func setImageCover(card *trello.Card) error {
+	if len(card.IDAttachmentCover) > 0 {
+		return nil
+	}
+	attachments, err := card.GetAttachments(trello.Defaults())
+	if err != nil {
+		return fmt.Errorf("can't fetch attachments: %w", err)
+	}
+	sort.SliceStable(attachments, func(i, j int) bool { return attachments[i].Pos < attachments[j].Pos })
+	for _, attachment := range attachments {
+		if !isImageAttachment(attachment) {
+			continue
+		}
+		if err := card.Update(trello.Arguments{"idAttachmentCover": attachment.ID}); err != nil {
+			return err
+		}
+		log.Printf("Cover of card \"%v\" (%v) set to attachment %v\n", card.Name, card.ID, attachment.Name)
+		return nil
+	}
+	return nil
+}
+
+// Sets image covers of all of the cards of the lists that have no image cover
+func setListsImageCovers(ctx context.Context, client *trello.Client, commaSepListId string) {
+	processLists(ctx, commaSepListId, "image covers", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		list := trelloops.FetchList(listClient(ctx, client), listId)
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		for _, card := range cards {
+			if err := setImageCover(card); err != nil {
+				log.Printf("Failed to set image cover of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+			}
+		}
+	})
+}
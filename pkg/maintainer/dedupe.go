@@ -0,0 +1,335 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_DEDUPE_LISTS_ENV = "TRELLO_DEDUPE_LISTS"
+const DEDUPE_ACTION_ENV = "DEDUPE_ACTION"
+const DEDUPE_ID_REGEX_ENV = "DEDUPE_ID_REGEX"
+
+type dedupeActionEnum int32
+
+const (
+	// the duplicates are archived
+	dedupeActionArchive dedupeActionEnum = iota + 1
+	// the link to the original card is attached to the duplicates
+	dedupeActionLink
+	// unique comments, attachments and labels of the duplicates are copied to the original, then the duplicates are archived
+	dedupeActionMerge
+)
+
+func parseDedupeAction(name string) (dedupeActionEnum, error) {
+	switch name {
+	case "archive":
+		return dedupeActionArchive, nil
+	case "link":
+		return dedupeActionLink, nil
+	case "merge":
+		return dedupeActionMerge, nil
+	default:
+		return 0, fmt.Errorf("unsupported dedupe action \"%s\" (expected archive, link or merge)", name)
+	}
+}
+
+// How the duplicates are detected and what is done with them
+type dedupePolicy struct {
+	action dedupeActionEnum
+	// extracts the pet identifier from the card name (the first capture group), nil if not configured
+	idRegex        *regexp.Regexp
+	archiveComment bool
+	journal        *runJournal
+	audit          *auditLog
+	// asks the operator before archiving each duplicate (nil approves everything)
+	confirm *operatorConfirmation
+}
+
+// The oldest card of the group is kept as the original
+type duplicateGroup struct {
+	original    *trello.Card
+	duplicates  []*trello.Card
+	attachments map[string][]*trello.Attachment
+	// why the duplicate is considered one, by card id
+	reasons map[string]string
+}
+
+// Groups the cards sharing an attachment URL or the pet identifier of the name.
+// Cards are in the same group if they are connected by a chain of shared keys
+func findDuplicates(cards []*trello.Card, attachments map[string][]*trello.Attachment, idRegex *regexp.Regexp) []*duplicateGroup {
+	parent := make(map[string]string, len(cards))
+	var find func(id string) string
+	find = func(id string) string {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+	for _, card := range cards {
+		parent[card.ID] = card.ID
+	}
+	// key -> the first card having it
+	owners := make(map[string]*trello.Card)
+	reasons := make(map[string]string)
+	link := func(card *trello.Card, key string, reason string) {
+		owner, seen := owners[key]
+		if !seen {
+			owners[key] = card
+			return
+		}
+		if find(owner.ID) != find(card.ID) {
+			parent[find(card.ID)] = find(owner.ID)
+		}
+		if _, explained := reasons[card.ID]; !explained {
+			reasons[card.ID] = reason
+		}
+		if _, explained := reasons[owner.ID]; !explained {
+			reasons[owner.ID] = reason
+		}
+	}
+	for _, card := range cards {
+		for _, attachment := range attachments[card.ID] {
+			if len(attachment.URL) > 0 && !attachment.IsUpload {
+				link(card, "url:"+attachment.URL, "same attachment "+attachment.URL)
+			}
+		}
+		if idRegex != nil {
+			if match := idRegex.FindStringSubmatch(card.Name); match != nil && len(match[1]) > 0 {
+				link(card, "id:"+match[1], "same pet id "+match[1])
+			}
+		}
+	}
+
+	members := make(map[string][]*trello.Card)
+	for _, card := range cards {
+		root := find(card.ID)
+		members[root] = append(members[root], card)
+	}
+	var groups []*duplicateGroup
+	for _, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return tieBreakCreationDate.less(group[i], group[j]) })
+		groups = append(groups, &duplicateGroup{
+			original:    group[0],
+			duplicates:  group[1:],
+			attachments: attachments,
+			reasons:     reasons,
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].original.ID < groups[j].original.ID })
+	return groups
+}
+
+func hasAttachmentURL(attachments []*trello.Attachment, url string) bool {
+	for _, attachment := range attachments {
+		if attachment.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupeList(list *trello.List, policy dedupePolicy) {
+	cards, err := list.GetCards()
+	if err != nil {
+		log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+	}
+	cards = withoutExemptCards(list, cards)
+	attachments := make(map[string][]*trello.Attachment, len(cards))
+	for _, card := range cards {
+		cardAttachments, err := card.GetAttachments(trello.Defaults())
+		if err != nil {
+			log.Printf("Can't fetch attachments of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+			continue
+		}
+		attachments[card.ID] = cardAttachments
+	}
+	groups := findDuplicates(cards, attachments, policy.idRegex)
+	log.Printf("%d groups of duplicates found in the list %v\n", len(groups), list.Name)
+	now := time.Now()
+	for _, group := range groups {
+		for _, duplicate := range group.duplicates {
+			handleDuplicate(list, group, duplicate, now, policy)
+		}
+	}
+}
+
+func handleDuplicate(list *trello.List, group *duplicateGroup, duplicate *trello.Card, now time.Time, policy dedupePolicy) {
+	original := group.original
+	audit := auditRecord{
+		Timestamp: now,
+		Pass:      "dedupe",
+		CardID:    duplicate.ID,
+		CardName:  duplicate.Name,
+		ListID:    list.ID,
+		ListName:  list.Name,
+		Rule:      fmt.Sprintf("duplicate of %v (%v): %s", original.Name, original.ID, group.reasons[duplicate.ID]),
+	}
+	failed := func(err error) {
+		log.Printf("Failed to handle duplicate card \"%v\" (%v): %v\n", duplicate.Name, duplicate.ID, err)
+		audit.Decision = auditDecisionError
+		audit.Detail = err.Error()
+		policy.audit.write(audit)
+	}
+	if policy.action != dedupeActionLink && !policy.confirm.approve(fmt.Sprintf("%v card \"%v\" (%v) of the list %v: %s", journalActionArchive, duplicate.Name, duplicate.ID, list.Name, audit.Rule)) {
+		audit.Decision = auditDecisionSkip
+		audit.Detail = "declined by the operator"
+		policy.audit.write(audit)
+		return
+	}
+	switch policy.action {
+	case dedupeActionLink:
+		if hasAttachmentURL(group.attachments[duplicate.ID], original.ShortURL) {
+			audit.Decision = auditDecisionSkip
+			audit.Detail = "already linked"
+			policy.audit.write(audit)
+			return
+		}
+		linkAttachment := &trello.Attachment{Name: "Original: " + original.Name, URL: original.ShortURL}
+		if err := duplicate.AddURLAttachment(linkAttachment); err != nil {
+			failed(err)
+			return
+		}
+		log.Printf("Card \"%v\" (%v) linked to its original %v\n", duplicate.Name, duplicate.ID, original.ShortURL)
+		audit.Decision = auditDecisionLink
+		policy.audit.write(audit)
+	case dedupeActionMerge:
+		if err := mergeIntoOriginal(group, duplicate); err != nil {
+			failed(fmt.Errorf("merge failed, duplicate is not archived: %w", err))
+			return
+		}
+		comment := renderMessage(messageDuplicateMerged, map[string]interface{}{"Card": duplicate, "Original": original})
+		if _, err := duplicate.AddComment(comment); err != nil {
+			log.Printf("Failed to post merge comment to card \"%v\" (%v): %v\n", duplicate.Name, duplicate.ID, err)
+		}
+		if err := duplicate.Archive(); err != nil {
+			failed(err)
+			return
+		}
+		log.Printf("Merged card \"%v\" (%v) into %v\n", duplicate.Name, duplicate.ID, original.ID)
+		policy.journal.record(journalEntry{
+			Timestamp: now,
+			Action:    journalActionArchive,
+			CardID:    duplicate.ID,
+			CardName:  duplicate.Name,
+			BoardID:   list.IDBoard,
+			ListID:    list.ID,
+			ListName:  list.Name,
+			Reason:    "merged, " + audit.Rule,
+		})
+		audit.Decision = auditDecisionArchive
+		audit.Detail = "merged into " + original.ShortURL
+		policy.audit.write(audit)
+	case dedupeActionArchive:
+		if policy.archiveComment {
+			comment := renderMessage(messageDuplicateArchived, map[string]interface{}{"Card": duplicate, "Original": original})
+			if _, err := duplicate.AddComment(comment); err != nil {
+				log.Printf("Failed to post audit comment to card \"%v\" (%v): %v\n", duplicate.Name, duplicate.ID, err)
+			}
+		}
+		if err := duplicate.Archive(); err != nil {
+			failed(err)
+			return
+		}
+		log.Printf("Archived card \"%v\" (%v) as a duplicate of %v\n", duplicate.Name, duplicate.ID, original.ID)
+		policy.journal.record(journalEntry{
+			Timestamp: now,
+			Action:    journalActionArchive,
+			CardID:    duplicate.ID,
+			CardName:  duplicate.Name,
+			BoardID:   list.IDBoard,
+			ListID:    list.ID,
+			ListName:  list.Name,
+			Reason:    audit.Rule,
+		})
+		audit.Decision = auditDecisionArchive
+		policy.audit.write(audit)
+	default:
+		log.Panicf("Unsupported dedupe action: %v", policy.action)
+	}
+}
+
+func dedupeLists(ctx context.Context, client *trello.Client, commaSepListId string, policy dedupePolicy) {
+	processLists(ctx, commaSepListId, "duplicates", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		dedupeList(trelloops.FetchList(listClient(ctx, client), listId), policy)
+	})
+}
+
+// Copies the comments, link attachments and labels of the duplicate which the original card doesn't have yet
+// and posts the cross-link comment to the original
+func mergeIntoOriginal(group *duplicateGroup, duplicate *trello.Card) error {
+	original := group.original
+	originalComments, err := original.GetActions(trello.Arguments{"filter": "commentCard", "limit": "1000"})
+	if err != nil {
+		return fmt.Errorf("can't fetch comments of the original card: %w", err)
+	}
+	duplicateComments, err := duplicate.GetActions(trello.Arguments{"filter": "commentCard", "limit": "1000"})
+	if err != nil {
+		return fmt.Errorf("can't fetch comments of the duplicate: %w", err)
+	}
+	hasComment := func(text string) bool {
+		for _, action := range originalComments {
+			if action.Data != nil && strings.Contains(action.Data.Text, text) {
+				return true
+			}
+		}
+		return false
+	}
+	// Trello returns the actions newest first
+	for i := len(duplicateComments) - 1; i >= 0; i-- {
+		action := duplicateComments[i]
+		if action.Data == nil || len(action.Data.Text) == 0 || hasComment(action.Data.Text) {
+			continue
+		}
+		if _, err := original.AddComment(copiedCommentText(action)); err != nil {
+			return fmt.Errorf("can't copy comment %v: %w", action.ID, err)
+		}
+	}
+
+	for _, attachment := range group.attachments[duplicate.ID] {
+		if len(attachment.URL) == 0 || hasAttachmentURL(group.attachments[original.ID], attachment.URL) {
+			continue
+		}
+		if err := original.AddURLAttachment(&trello.Attachment{Name: attachment.Name, URL: attachment.URL}); err != nil {
+			return fmt.Errorf("can't copy attachment %v: %w", attachment.ID, err)
+		}
+		group.attachments[original.ID] = append(group.attachments[original.ID], attachment)
+	}
+
+	for _, labelID := range duplicate.IDLabels {
+		if containsString(original.IDLabels, labelID) {
+			continue
+		}
+		if err := original.AddIDLabel(labelID); err != nil {
+			return fmt.Errorf("can't copy label %v: %w", labelID, err)
+		}
+		original.IDLabels = append(original.IDLabels, labelID)
+	}
+
+	note := renderMessage(messageDuplicateNote, map[string]interface{}{"Card": original, "Duplicate": duplicate})
+	if _, err := original.AddComment(note); err != nil {
+		log.Printf("Failed to post merge comment to card \"%v\" (%v): %v\n", original.Name, original.ID, err)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
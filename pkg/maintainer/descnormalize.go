@@ -0,0 +1,227 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_DESC_NORMALIZE_LISTS_ENV = "TRELLO_DESC_NORMALIZE_LISTS"
+
+// The structured fields of the canonical description, in their order. The similarity goes last,
+// so that its value stays the last word of the description
+var descFields = []struct {
+	name    string
+	aliases []string
+}{
+	{"Species", []string{"species", "animal", "kind", "вид"}},
+	{"Location", []string{"location", "place", "address", "where", "место", "адрес"}},
+	{"Date", []string{"date", "when", "дата"}},
+	{"Similarity", []string{"similarity", "score", "сходство"}},
+}
+
+// "**Species:** cat", "location: Moscow" and the like. The markdown emphasis around the label and the value is dropped
+var descFieldLinePattern = regexp.MustCompile(`^\s*[*_]*\s*([\p{L} ]+?)\s*[*_]*\s*[:：]\s*[*_]*\s*(.*?)\s*[*_]*\s*$`)
+
+// The date layouts seen on the cards, the date is normalized to the first one
+var descDateLayouts = []string{"2006-01-02", "02.01.2006", "2.1.2006", "02.01.06", "02/01/2006", "2/1/2006", "2 Jan 2006", "January 2, 2006", "2006/01/02"}
+
+// The card description split into the structured fields and the free text
+type cardDescription struct {
+	fields map[string]string
+	text   string
+}
+
+func descFieldName(label string) string {
+	label = strings.ToLower(strings.TrimSpace(label))
+	for _, field := range descFields {
+		for _, alias := range field.aliases {
+			if label == alias {
+				return field.name
+			}
+		}
+	}
+	return ""
+}
+
+// Splits the description. The similarity written without the label (the last word, or the match of SIMILARITY_REGEX) becomes the field as well
+func parseCardDescription(desc string, similarity similaritySource) cardDescription {
+	parsed := cardDescription{fields: make(map[string]string)}
+	var text []string
+	for _, line := range strings.Split(strings.ReplaceAll(desc, "\r\n", "\n"), "\n") {
+		if match := descFieldLinePattern.FindStringSubmatch(line); match != nil {
+			if name := descFieldName(match[1]); len(name) > 0 && len(match[2]) > 0 {
+				if _, seen := parsed.fields[name]; !seen {
+					parsed.fields[name] = match[2]
+					continue
+				}
+			}
+		}
+		text = append(text, strings.TrimRight(line, " \t"))
+	}
+	rest := strings.Join(text, "\n")
+	if _, labeled := parsed.fields["Similarity"]; !labeled && len(similarity.customFieldName) == 0 {
+		if similarity.descRegex != nil {
+			if loc := similarity.descRegex.FindStringSubmatchIndex(rest); loc != nil {
+				parsed.fields["Similarity"] = rest[loc[2]:loc[3]]
+				rest = rest[:loc[0]] + rest[loc[1]:]
+			}
+		} else {
+			trimmed := strings.TrimRight(rest, " \n")
+			lastWord := trimmed[strings.LastIndexAny(trimmed, " \n")+1:]
+			// the numbers out of the similarity range are rather the phone numbers or the years
+			if value, err := parseSimilarityValue(lastWord); err == nil && value >= 0 && value <= 1 {
+				parsed.fields["Similarity"] = lastWord
+				rest = trimmed[:len(trimmed)-len(lastWord)]
+			}
+		}
+	}
+	parsed.text = rest
+	return parsed
+}
+
+var descBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// The canonical description: the known fields one per line, the free text and the similarity
+func (d cardDescription) canonical() string {
+	var header []string
+	for _, field := range descFields[:len(descFields)-1] {
+		if value, found := d.fields[field.name]; found {
+			header = append(header, field.name+": "+normalizeDescField(field.name, value))
+		}
+	}
+	var parts []string
+	if len(header) > 0 {
+		parts = append(parts, strings.Join(header, "\n"))
+	}
+	if text := strings.TrimSpace(descBlankLines.ReplaceAllString(d.text, "\n\n")); len(text) > 0 {
+		parts = append(parts, text)
+	}
+	if value, found := d.fields["Similarity"]; found {
+		parts = append(parts, "Similarity: "+normalizeDescField("Similarity", value))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func normalizeDescField(name string, value string) string {
+	switch name {
+	case "Species":
+		return strings.ToLower(value)
+	case "Date":
+		for _, layout := range descDateLayouts {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date.Format(descDateLayouts[0])
+			}
+		}
+	case "Similarity":
+		if similarity, err := parseSimilarityValue(value); err == nil {
+			return strconv.FormatFloat(similarity, 'f', 4, 64)
+		}
+	}
+	return value
+}
+
+// The similarity read from the description the way the reorder reads it, without logging the failures
+func descSimilarity(desc string, similarity similaritySource) *float64 {
+	str := desc[strings.LastIndex(desc, " ")+1:]
+	if similarity.descRegex != nil {
+		match := similarity.descRegex.FindStringSubmatch(desc)
+		if match == nil {
+			return nil
+		}
+		str = match[1]
+	}
+	value, err := parseSimilarityValue(str)
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+func sameSimilarity(a *float64, b *float64) bool {
+	return a == nil && b == nil || a != nil && b != nil && fmt.Sprintf("%.4f", *a) == fmt.Sprintf("%.4f", *b)
+}
+
+// Returns the canonical description of the card, or why it is left as it is
+func normalizedCardDescription(card *trello.Card, similarity similaritySource, coordinates coordinatesSource) (string, error) {
+	parsed := parseCardDescription(card.Desc, similarity)
+	desc := parsed.canonical()
+	// the similarity and the coordinates must be read from the rewritten description as they are meant
+	if len(similarity.customFieldName) == 0 {
+		var expected *float64
+		if value, found := parsed.fields["Similarity"]; found {
+			if parsedValue, err := parseSimilarityValue(value); err == nil {
+				expected = &parsedValue
+			}
+		}
+		old, rewritten := descSimilarity(card.Desc, similarity), descSimilarity(desc, similarity)
+		// the out of range value is rather the manual edit which hid the labeled similarity
+		if expected != nil && old != nil && *old >= 0 && *old <= 1 && !sameSimilarity(old, expected) {
+			return "", fmt.Errorf("the similarity %v of the description differs from its labeled value", *old)
+		}
+		if expected == nil {
+			expected = old
+		}
+		if !sameSimilarity(expected, rewritten) {
+			return "", fmt.Errorf("the similarity of the rewritten description is read differently")
+		}
+	}
+	if old := coordinates.parse(card.Desc); old != nil {
+		if rewritten := coordinates.parse(desc); rewritten == nil || *old != *rewritten {
+			return "", fmt.Errorf("the coordinates of the rewritten description are read differently")
+		}
+	}
+	return desc, nil
+}
+
+// Rewrites the descriptions of the cards of the lists into the canonical form, so that the manual edits don't break the parsing
+func normalizeListsDescriptions(ctx context.Context, client *trello.Client, commaSepListIds string, similarity similaritySource, coordinates coordinatesSource, audit *auditLog) {
+	processLists(ctx, commaSepListIds, "description normalization", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		list := trelloops.FetchList(listClient(ctx, client), listId)
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		normalized := 0
+		for _, card := range cards {
+			desc, err := normalizedCardDescription(card, similarity, coordinates)
+			if err != nil {
+				log.Printf("Description of card \"%v\" (%v) is NOT normalized: %v\n", card.Name, card.ID, err)
+				continue
+			}
+			if desc == card.Desc {
+				continue
+			}
+			record := auditRecord{
+				Timestamp: time.Now(),
+				Pass:      "descNormalize",
+				CardID:    card.ID,
+				CardName:  card.Name,
+				ListID:    list.ID,
+				ListName:  list.Name,
+				Rule:      "description differs from the canonical form",
+				Decision:  auditDecisionNormalize,
+			}
+			if err := card.Update(trello.Arguments{"desc": desc}); err != nil {
+				log.Printf("Failed to normalize description of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+				record.Decision = auditDecisionError
+				record.Detail = err.Error()
+				audit.write(record)
+				continue
+			}
+			audit.write(record)
+			normalized++
+		}
+		log.Printf("Descriptions of %d cards of the list %v are normalized\n", normalized, list.Name)
+	})
+}
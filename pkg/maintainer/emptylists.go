@@ -0,0 +1,48 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const ARCHIVE_EMPTY_LISTS_ENV = "ARCHIVE_EMPTY_LISTS"
+
+// Archives the lists selected by the "boardId/nameRegex" specs which have no open cards.
+// The lists in keepLists (e.g. the targets the cards are moved to) are never archived, confirm (if set) asks the operator before each archival
+func archiveEmptyLists(client *trello.Client, commaSepBoardSpecs string, keepLists map[string]bool, confirm *operatorConfirmation) {
+	for _, rawSpec := range strings.Split(commaSepBoardSpecs, ",") {
+		boardSpec, err := trelloops.ParseBoardListsSpec(rawSpec, false)
+		if err != nil {
+			log.Panicf("Invalid board spec %v: %v", rawSpec, err)
+		}
+		for _, list := range trelloops.FetchOpenLists(client, boardSpec.BoardID) {
+			if keepLists[list.ID] {
+				continue
+			}
+			if boardSpec.NameRegex != nil && !boardSpec.NameRegex.MatchString(list.Name) {
+				continue
+			}
+			cards, err := list.GetCards(trello.Arguments{"filter": "open", "fields": "id"})
+			if err != nil {
+				log.Printf("Can't fetch cards of the list %v (%v): %v\n", list.Name, list.ID, err)
+				continue
+			}
+			if len(cards) > 0 {
+				continue
+			}
+			if !confirm.approve(fmt.Sprintf("archive empty list %v (%v)", list.Name, list.ID)) {
+				log.Printf("Empty list %v (%v) is not archived: declined by the operator\n", list.Name, list.ID)
+				continue
+			}
+			if err := list.Archive(); err != nil {
+				log.Printf("Failed to archive empty list %v (%v): %v\n", list.Name, list.ID, err)
+				continue
+			}
+			log.Printf("Archived empty list %v (%v)\n", list.Name, list.ID)
+		}
+	}
+}
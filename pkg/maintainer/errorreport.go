@@ -0,0 +1,74 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+const SENTRY_DSN_ENV = "SENTRY_DSN"
+const SENTRY_ENVIRONMENT_ENV = "SENTRY_ENVIRONMENT"
+
+// Whether the panics and the card errors are reported to Sentry (or a compatible service)
+var errorReportingEnabled bool
+
+// Configures the reporting if SENTRY_DSN is set. Returns the function flushing the reports, which must be called before exit
+func setupErrorReportingFromEnv() func() {
+	dsn := extractSecretEnvOrDefault(SENTRY_DSN_ENV, "")
+	if len(dsn) == 0 {
+		return func() {}
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: extractEnvOrDefault(SENTRY_ENVIRONMENT_ENV, ""),
+	})
+	if err != nil {
+		log.Fatalf("ERROR: can't configure error reporting: %v\n", err)
+	}
+	errorReportingEnabled = true
+	log.Println("Errors are reported to Sentry")
+	return func() {
+		if !sentry.Flush(10 * time.Second) {
+			log.Println("Not all of the error reports are sent")
+		}
+	}
+}
+
+// Reports the panic of the calling goroutine and panics again. Must be deferred
+func reportPanic() {
+	if r := recover(); r != nil {
+		reportPanicValue(r)
+		panic(r)
+	}
+}
+
+func reportPanicValue(r interface{}) {
+	if errorReportingEnabled {
+		sentry.CurrentHub().Recover(r)
+	}
+}
+
+// Reports the failed decision with its card and list context.
+// The errors of the same pass and rule are grouped into one issue, so a failure repeating for every card is reported once
+func reportAuditError(record auditRecord) {
+	if !errorReportingEnabled {
+		return
+	}
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetTags(map[string]string{
+			"pass":    record.Pass,
+			"list_id": record.ListID,
+		})
+		scope.SetContext("card", map[string]interface{}{
+			"id":       record.CardID,
+			"name":     record.CardName,
+			"listName": record.ListName,
+			"rule":     record.Rule,
+			"detail":   record.Detail,
+		})
+		scope.SetFingerprint([]string{"audit", record.Pass, record.Rule})
+		sentry.CaptureMessage(fmt.Sprintf("%s failed: %s", record.Pass, record.Rule))
+	})
+}
@@ -0,0 +1,120 @@
+package maintainer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const EVENT_BUS_ENV = "EVENT_BUS"
+const EVENT_KAFKA_BROKERS_ENV = "EVENT_KAFKA_BROKERS"
+const EVENT_KAFKA_TOPIC_ENV = "EVENT_KAFKA_TOPIC"
+
+// Receives every action recorded by the run
+type actionSink interface {
+	publish(entry journalEntry) error
+	close() error
+	describe() string
+}
+
+// Opens the sinks configured by env vars
+func actionSinksFromEnv() ([]actionSink, error) {
+	var sinks []actionSink
+	if bus := extractEnvOrDefault(EVENT_BUS_ENV, ""); len(bus) > 0 {
+		sink, err := eventBusFromEnv(bus)
+		if err != nil {
+			closeActionSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if webhook := actionWebhookFromEnv(); webhook != nil {
+		sinks = append(sinks, webhook)
+	}
+	return sinks, nil
+}
+
+func closeActionSinks(sinks []actionSink) {
+	for _, sink := range sinks {
+		if err := sink.close(); err != nil {
+			log.Printf("Failed to close %s: %v\n", sink.describe(), err)
+		}
+	}
+}
+
+// The actions the downstream services may react to: the card left (or returned to) the board or its list
+func isCardLifecycleAction(action journalActionType) bool {
+	switch action {
+	case journalActionArchive, journalActionDelete, journalActionMoveToBoard, journalActionMoveToList,
+		journalActionCreate, journalActionUnarchive, journalActionRecreate, journalActionMoveBack:
+		return true
+	default:
+		return false
+	}
+}
+
+// Message bus implementations. New buses (e.g. NATS or RabbitMQ) are added here
+func eventBusFromEnv(bus string) (actionSink, error) {
+	switch bus {
+	case "kafka":
+		return kafkaEventsFromEnv()
+	default:
+		return nil, fmt.Errorf("unsupported event bus \"%s\" (expected kafka)", bus)
+	}
+}
+
+// Publishes the card lifecycle events to the Kafka topic as JSON journal entries keyed by the card ID,
+// so the events of the same card are delivered in order
+type kafkaEvents struct {
+	writer *kafka.Writer
+}
+
+func kafkaEventsFromEnv() (*kafkaEvents, error) {
+	brokers := extractEnvOrDefault(EVENT_KAFKA_BROKERS_ENV, extractEnvOrDefault(KAFKA_BROKERS_ENV, ""))
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("%s (or %s) must be set for the kafka event bus", EVENT_KAFKA_BROKERS_ENV, KAFKA_BROKERS_ENV)
+	}
+	topic := extractEnvOrDefault(EVENT_KAFKA_TOPIC_ENV, "")
+	if len(topic) == 0 {
+		return nil, fmt.Errorf("%s must be set for the kafka event bus", EVENT_KAFKA_TOPIC_ENV)
+	}
+	return &kafkaEvents{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: 100 * time.Millisecond,
+			// the messages are flushed on close, delivery failures are logged
+			Async: true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					log.Printf("Failed to publish %d events to Kafka topic %v: %v\n", len(messages), topic, err)
+				}
+			},
+		},
+	}, nil
+}
+
+func (k *kafkaEvents) publish(entry journalEntry) error {
+	if !isCardLifecycleAction(entry.Action) {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return k.writer.WriteMessages(context.Background(), kafka.Message{Key: []byte(entry.CardID), Value: data})
+}
+
+func (k *kafkaEvents) close() error {
+	return k.writer.Close()
+}
+
+func (k *kafkaEvents) describe() string {
+	return "Kafka topic " + k.writer.Topic
+}
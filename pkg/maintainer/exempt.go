@@ -0,0 +1,86 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/adlio/trello"
+)
+
+const EXEMPT_CARD_IDS_ENV = "EXEMPT_CARD_IDS"
+const EXCLUDE_CARD_NAME_REGEX_ENV = "EXCLUDE_CARD_NAME_REGEX"
+
+// Cards never touched by any of the passes (e.g. pinned instructions living in the maintained lists).
+// Set once at startup by loadExemptCardIDs
+var exemptCardIDs map[string]bool
+
+// Loads the exempt cards of EXEMPT_CARD_IDS and of the config file
+func loadExemptCardIDs() error {
+	ids := make(map[string]bool)
+	for _, id := range strings.Split(extractEnvOrDefault(EXEMPT_CARD_IDS_ENV, ""), ",") {
+		if id = strings.TrimSpace(id); len(id) > 0 {
+			ids[id] = true
+		}
+	}
+	config, err := configFileFromEnv()
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		for _, id := range config.ExemptCardIDs {
+			ids[strings.TrimSpace(id)] = true
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("%d cards are exempt from the maintenance\n", len(ids))
+	}
+	exemptCardIDs = ids
+	return nil
+}
+
+// Returns the cards of the list except the exempt ones
+func withoutExemptCards(list *trello.List, cards []*trello.Card) []*trello.Card {
+	if len(exemptCardIDs) == 0 {
+		return cards
+	}
+	kept := make([]*trello.Card, 0, len(cards))
+	for _, card := range cards {
+		if exemptCardIDs[card.ID] {
+			log.Printf("Card \"%v\" (%v) of the list %v is exempt, skipping it\n", card.Name, card.ID, list.Name)
+			continue
+		}
+		kept = append(kept, card)
+	}
+	return kept
+}
+
+// Returns the cards whose names don't match the regex (all of the cards if it is nil)
+func withoutExcludedNames(list *trello.List, cards []*trello.Card, excludeNames *regexp.Regexp) []*trello.Card {
+	if excludeNames == nil {
+		return cards
+	}
+	kept := make([]*trello.Card, 0, len(cards))
+	for _, card := range cards {
+		if excludeNames.MatchString(card.Name) {
+			log.Printf("Card \"%v\" (%v) of the list %v matches %s, skipping it\n", card.Name, card.ID, list.Name, EXCLUDE_CARD_NAME_REGEX_ENV)
+			continue
+		}
+		kept = append(kept, card)
+	}
+	return kept
+}
+
+// Returns nil if the regex is not configured
+func excludeCardNameRegexFromEnv() (*regexp.Regexp, error) {
+	pattern := extractEnvOrDefault(EXCLUDE_CARD_NAME_REGEX_ENV, "")
+	if len(pattern) == 0 {
+		return nil, nil
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("can't compile %s: %w", EXCLUDE_CARD_NAME_REGEX_ENV, err)
+	}
+	return regex, nil
+}
@@ -0,0 +1,134 @@
+package maintainer
+
+import (
+	"encoding/csv"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// Lists maintained by the stale card and reorder passes of all of the profiles, without duplicates
+func maintainedListIDs(client *trello.Client, profiles []maintenanceProfile) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, profile := range profiles {
+		specs := []string{
+			trelloops.AppendBoardLists(client, profile.archiveLists, profile.archiveBoards, false),
+			profile.deleteLists,
+			profile.moveLists,
+			trelloops.AppendBoardLists(client, profile.reorderLists, profile.reorderBoards, true),
+		}
+		for _, spec := range specs {
+			if len(spec) == 0 {
+				continue
+			}
+			for _, listSpec := range strings.Split(spec, ",") {
+				listId, _, _ := parseReorderListSpec(listSpec)
+				if !seen[listId] {
+					seen[listId] = true
+					ids = append(ids, listId)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// Dumps all cards of the lists to CSV for offline analysis in spreadsheets
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	lists := flags.String("lists", "", "comma separated ids of the lists to export (defaults to the lists maintained by the stale card and reorder passes)")
+	out := flags.String("out", "", "CSV file to write (stdout if empty)")
+	flags.Parse(args)
+
+	client := newTrelloClient(extractSecretEnvOrExit(TRELLO_KEY_ENV), extractSecretEnvOrExit(TRELLO_TOKEN_ENV))
+	similarity, err := similaritySourceFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+
+	var listIds []string
+	if len(*lists) > 0 {
+		listIds = strings.Split(*lists, ",")
+	} else {
+		profiles, err := maintenanceProfilesFromEnv()
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		listIds = maintainedListIDs(client, profiles)
+	}
+	if len(listIds) == 0 {
+		log.Fatalf("ERROR: no lists to export. Use -lists or configure the maintained lists\n")
+	}
+
+	var w io.Writer = os.Stdout
+	if len(*out) > 0 {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("ERROR: can't create export file: %v\n", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	csvOut := csv.NewWriter(w)
+	csvOut.Write([]string{"list_id", "list_name", "card_id", "url", "name", "desc", "similarity", "last_activity", "labels", "members", "attachments"})
+
+	// board id -> custom fields, fetched once if the similarity is read from the custom field
+	boardFields := make(map[string][]*trello.CustomField)
+	exported := 0
+	for _, listId := range listIds {
+		list := trelloops.FetchList(client, listId)
+		source := similarity
+		if len(source.customFieldName) > 0 {
+			if _, fetched := boardFields[list.IDBoard]; !fetched {
+				boardFields[list.IDBoard] = fetchBoardCustomFields(trelloops.NewClientGateway(client), list.IDBoard)
+			}
+			source.boardCustomFields = boardFields[list.IDBoard]
+		}
+		cards, err := list.GetCards(trello.Arguments{
+			"customFieldItems": "true",
+			"members":          "true",
+			"attachments":      "true",
+		})
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		for _, card := range cards {
+			var similarityCell, lastActivityCell string
+			if value := source.extract(card); value != nil {
+				similarityCell = strconv.FormatFloat(*value, 'f', -1, 64)
+			}
+			if card.DateLastActivity != nil {
+				lastActivityCell = card.DateLastActivity.Format(time.RFC3339)
+			}
+			labels := make([]string, 0, len(card.Labels))
+			for _, label := range card.Labels {
+				labels = append(labels, label.Name)
+			}
+			members := make([]string, 0, len(card.Members))
+			for _, member := range card.Members {
+				members = append(members, member.Username)
+			}
+			attachments := make([]string, 0, len(card.Attachments))
+			for _, attachment := range card.Attachments {
+				attachments = append(attachments, attachment.URL)
+			}
+			csvOut.Write([]string{list.ID, list.Name, card.ID, card.ShortURL, card.Name, card.Desc, similarityCell, lastActivityCell,
+				strings.Join(labels, ";"), strings.Join(members, ";"), strings.Join(attachments, " ")})
+			exported++
+		}
+		log.Printf("Exported %d cards of the list %v\n", len(cards), list.Name)
+	}
+	csvOut.Flush()
+	if err := csvOut.Error(); err != nil {
+		log.Fatalf("ERROR: can't write the export: %v\n", err)
+	}
+	log.Printf("Done. %d cards exported\n", exported)
+}
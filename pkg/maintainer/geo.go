@@ -0,0 +1,191 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const COORDINATES_REGEX_ENV = "COORDINATES_REGEX"
+const COORDINATES_CUSTOM_FIELD_ENV = "COORDINATES_CUSTOM_FIELD"
+const REORDER_REFERENCE_POINT_ENV = "REORDER_REFERENCE_POINT"
+const TRELLO_MAP_LINK_LISTS_ENV = "TRELLO_MAP_LINK_LISTS"
+const MAP_LINK_PROVIDER_ENV = "MAP_LINK_PROVIDER"
+
+// Decimal "lat, lon" pair like "55.7558, 37.6173"
+const defaultCoordinatesRegex = `(-?\d{1,2}\.\d+)\s*[,;]\s*(-?\d{1,3}\.\d+)`
+
+const mapLinkAttachmentName = "Map"
+
+type geoPoint struct {
+	lat float64
+	lon float64
+}
+
+func (p geoPoint) String() string {
+	return strconv.FormatFloat(p.lat, 'f', 6, 64) + "," + strconv.FormatFloat(p.lon, 'f', 6, 64)
+}
+
+// Extracts the coordinates with the regex having two capture groups (latitude and longitude).
+// The text custom field (if configured) takes precedence over the card description
+type coordinatesSource struct {
+	regex             *regexp.Regexp
+	customFieldName   string
+	boardCustomFields []*trello.CustomField
+}
+
+func coordinatesSourceFromEnv() (coordinatesSource, error) {
+	pattern := extractEnvOrDefault(COORDINATES_REGEX_ENV, defaultCoordinatesRegex)
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return coordinatesSource{}, fmt.Errorf("can't compile %s: %w", COORDINATES_REGEX_ENV, err)
+	}
+	if regex.NumSubexp() != 2 {
+		return coordinatesSource{}, fmt.Errorf("%s must have exactly two capture groups (latitude and longitude), got %d", COORDINATES_REGEX_ENV, regex.NumSubexp())
+	}
+	return coordinatesSource{
+		regex:           regex,
+		customFieldName: extractEnvOrDefault(COORDINATES_CUSTOM_FIELD_ENV, ""),
+	}, nil
+}
+
+// Returns nil if the card has no valid coordinates
+func (s coordinatesSource) extract(card *trello.Card) *geoPoint {
+	if len(s.customFieldName) > 0 && s.boardCustomFields != nil {
+		if value, ok := card.CustomFields(s.boardCustomFields)[s.customFieldName].(string); ok {
+			if point := s.parse(value); point != nil {
+				return point
+			}
+		}
+	}
+	return s.parse(card.Desc)
+}
+
+func (s coordinatesSource) parse(text string) *geoPoint {
+	for _, match := range s.regex.FindAllStringSubmatch(text, -1) {
+		lat, latErr := strconv.ParseFloat(match[1], 64)
+		lon, lonErr := strconv.ParseFloat(match[2], 64)
+		if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			continue
+		}
+		return &geoPoint{lat: lat, lon: lon}
+	}
+	return nil
+}
+
+// Parses "lat,lon"
+func parseGeoPoint(str string) (geoPoint, error) {
+	latStr, lonStr, ok := strings.Cut(str, ",")
+	if !ok {
+		return geoPoint{}, fmt.Errorf("expected \"lat,lon\", got \"%s\"", str)
+	}
+	lat, latErr := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	lon, lonErr := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return geoPoint{}, fmt.Errorf("invalid coordinates \"%s\"", str)
+	}
+	return geoPoint{lat: lat, lon: lon}, nil
+}
+
+// Returns nil if the reference point is not configured
+func referencePointFromEnv() (*geoPoint, error) {
+	str := extractEnvOrDefault(REORDER_REFERENCE_POINT_ENV, "")
+	if len(str) == 0 {
+		return nil, nil
+	}
+	point, err := parseGeoPoint(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", REORDER_REFERENCE_POINT_ENV, err)
+	}
+	return &point, nil
+}
+
+const earthRadiusMeters = 6371e3
+
+// Great-circle (haversine) distance in meters
+func distanceMeters(a geoPoint, b geoPoint) float64 {
+	toRad := math.Pi / 180
+	dLat := (b.lat - a.lat) * toRad
+	dLon := (b.lon - a.lon) * toRad
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(a.lat*toRad)*math.Cos(b.lat*toRad)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+type mapProviderEnum int32
+
+const (
+	mapProviderOSM mapProviderEnum = iota + 1
+	mapProviderGoogle
+)
+
+func parseMapProvider(name string) (mapProviderEnum, error) {
+	switch name {
+	case "osm":
+		return mapProviderOSM, nil
+	case "google":
+		return mapProviderGoogle, nil
+	default:
+		return 0, fmt.Errorf("unsupported map link provider \"%s\" (expected osm or google)", name)
+	}
+}
+
+func (p mapProviderEnum) link(point geoPoint) string {
+	switch p {
+	case mapProviderOSM:
+		lat, lon := strconv.FormatFloat(point.lat, 'f', 6, 64), strconv.FormatFloat(point.lon, 'f', 6, 64)
+		return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%s&mlon=%s#map=16/%s/%s", lat, lon, lat, lon)
+	case mapProviderGoogle:
+		return "https://www.google.com/maps/search/?api=1&query=" + point.String()
+	default:
+		log.Panicf("Unsupported map provider: %v", p)
+		return ""
+	}
+}
+
+// Attaches the map link to the card unless the card already has the map attachment
+func attachMapLink(card *trello.Card, coordinates coordinatesSource, provider mapProviderEnum) error {
+	point := coordinates.extract(card)
+	if point == nil {
+		return nil
+	}
+	attachments, err := card.GetAttachments(trello.Defaults())
+	if err != nil {
+		return fmt.Errorf("can't fetch attachments: %w", err)
+	}
+	url := provider.link(*point)
+	for _, attachment := range attachments {
+		if attachment.URL == url || attachment.Name == mapLinkAttachmentName {
+			return nil
+		}
+	}
+	if err := card.AddURLAttachment(&trello.Attachment{Name: mapLinkAttachmentName, URL: url}); err != nil {
+		return err
+	}
+	log.Printf("Attached map link %v to card \"%v\" (%v)\n", url, card.Name, card.ID)
+	return nil
+}
+
+func attachListsMapLinks(ctx context.Context, client *trello.Client, commaSepListId string, coordinates coordinatesSource, provider mapProviderEnum) {
+	processLists(ctx, commaSepListId, "map links", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		list := trelloops.FetchList(listClient(ctx, client), listId)
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		for _, card := range cards {
+			if err := attachMapLink(card, coordinates, provider); err != nil {
+				log.Printf("Failed to attach map link to card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+			}
+		}
+	})
+}
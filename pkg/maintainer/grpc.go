@@ -0,0 +1,98 @@
+package maintainer
+
+//go:generate protoc --proto_path=../.. --go_out=../.. --go_opt=module=github.com/LostPetInitiative/TrelloBoardMaintainer --go-grpc_out=../.. --go-grpc_opt=module=github.com/LostPetInitiative/TrelloBoardMaintainer proto/control.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/controlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const GRPC_LISTEN_ADDR_ENV = "GRPC_LISTEN_ADDR"
+
+// gRPC flavour of the control API (see proto/control.proto), shares the runs with the REST API
+type grpcControl struct {
+	controlpb.UnimplementedMaintainerControlServer
+	server *apiServer
+}
+
+func serveGRPC(addr string, server *apiServer) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("ERROR: can't listen for gRPC on %v: %v\n", addr, err)
+	}
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(server.authenticatedGRPC))
+	controlpb.RegisterMaintainerControlServer(grpcServer, &grpcControl{server: server})
+	log.Printf("gRPC control API listens on %v\n", addr)
+	log.Fatalf("ERROR: gRPC control API stopped: %v\n", grpcServer.Serve(listener))
+}
+
+func (s *apiServer) authenticatedGRPC(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 {
+		token = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "invalid or missing bearer token")
+	}
+	return handler(ctx, req)
+}
+
+func (c *grpcControl) TriggerRun(context.Context, *controlpb.TriggerRunRequest) (*controlpb.Run, error) {
+	run, started := c.server.startRun()
+	if !started {
+		return nil, status.Errorf(codes.FailedPrecondition, "run %d is in progress", run.ID)
+	}
+	return runToProto(run), nil
+}
+
+func (c *grpcControl) GetRun(_ context.Context, req *controlpb.GetRunRequest) (*controlpb.Run, error) {
+	run, found := c.server.findRun(req.GetId())
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "run %d not found", req.GetId())
+	}
+	return runToProto(run), nil
+}
+
+func (c *grpcControl) GetLastReport(context.Context, *controlpb.GetLastReportRequest) (*controlpb.Run, error) {
+	run, found := c.server.lastFinishedRun()
+	if !found {
+		return nil, status.Error(codes.NotFound, "no run has finished yet")
+	}
+	return runToProto(run), nil
+}
+
+func runToProto(run apiRun) *controlpb.Run {
+	result := &controlpb.Run{
+		Id:           run.ID,
+		StartedAt:    timestamppb.New(run.StartedAt),
+		Error:        run.Error,
+		JournalRunId: run.JournalRunID,
+		Actions:      make(map[string]int64, len(run.Actions)),
+	}
+	switch run.Status {
+	case apiRunRunning:
+		result.Status = controlpb.RunStatus_RUN_STATUS_RUNNING
+	case apiRunSucceeded:
+		result.Status = controlpb.RunStatus_RUN_STATUS_SUCCEEDED
+	case apiRunFailed:
+		result.Status = controlpb.RunStatus_RUN_STATUS_FAILED
+	}
+	if run.FinishedAt != nil {
+		result.FinishedAt = timestamppb.New(*run.FinishedAt)
+	}
+	for action, count := range run.Actions {
+		result.Actions[string(action)] = int64(count)
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// How often the readiness is re-checked, so that revoked credentials or a broken config file are noticed
+const readinessCheckInterval = time.Minute
+
+// Readiness of the service: the config is loaded and the Trello credentials are valid.
+// reason is exposed by /readyz without authentication, so it never contains the error details (Trello errors include the token)
+type readiness struct {
+	mu     sync.Mutex
+	reason string
+	err    error
+}
+
+func (r *readiness) check(client *trello.Client) {
+	reason, err := checkReadiness(client)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil && (r.err == nil || r.err.Error() != err.Error()) {
+		log.Printf("Service is not ready: %v\n", err)
+	}
+	r.reason = reason
+	r.err = err
+}
+
+func checkReadiness(client *trello.Client) (string, error) {
+	profiles, err := maintenanceProfilesFromEnv()
+	if err != nil {
+		return "config is not loaded", err
+	}
+	for _, profile := range profiles {
+		if err := profile.validate(); err != nil {
+			return "config is invalid", fmt.Errorf("invalid profile \"%s\": %w", profile.name, err)
+		}
+	}
+	if _, err := client.GetMyMember(trello.Defaults()); err != nil {
+		return "Trello credentials are not validated", fmt.Errorf("can't validate Trello credentials: %w", err)
+	}
+	return "", nil
+}
+
+// Checks the readiness now and then periodically
+func (r *readiness) watch(client *trello.Client) {
+	r.check(client)
+	go func() {
+		for range time.Tick(readinessCheckInterval) {
+			r.check(client)
+		}
+	}()
+}
+
+// GET /healthz responds 200 while the process serves requests
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeAPIJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GET /readyz responds 200 once the config is loaded and the credentials are validated, 503 otherwise
+func (r *readiness) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	reason := r.reason
+	r.mu.Unlock()
+	if len(reason) > 0 {
+		writeAPIError(w, http.StatusServiceUnavailable, reason)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
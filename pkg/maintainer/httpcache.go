@@ -0,0 +1,137 @@
+package maintainer
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+)
+
+const TRELLO_CACHE_TTL_SECONDS_ENV = "TRELLO_CACHE_TTL_SECONDS"
+
+// Board and list metadata the passes fetch over and over within a run. The card endpoints are never cached
+var cachedTrelloEndpoints = map[string]bool{
+	"boards/:id":              true,
+	"boards/:id/lists":        true,
+	"boards/:id/labels":       true,
+	"boards/:id/customFields": true,
+	"lists/:id":               true,
+}
+
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// Responses shared by all of the Trello clients
+type responseCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	responses map[string]*cachedResponse
+}
+
+// Serves the repeated GET requests of the metadata endpoints from memory for the cache ttl. The expired response with ETag
+// is revalidated with If-None-Match, so the unchanged payload is not downloaded again.
+// Any change other than of the cards and comments drops all of the cached responses, e.g. a new list or label
+type cachingTransport struct {
+	next    http.RoundTripper
+	cache   *responseCache
+	metrics *trelloAPIMetrics
+}
+
+var trelloCacheOnce sync.Once
+var trelloCache *responseCache
+
+// Puts the process-wide cache in front of the transport unless it is disabled with TRELLO_CACHE_TTL_SECONDS=0
+func trelloCachingTransportFromEnv(next http.RoundTripper) http.RoundTripper {
+	trelloCacheOnce.Do(func() {
+		ttl := time.Duration(extractIntEnvOrDefault(TRELLO_CACHE_TTL_SECONDS_ENV, 60)) * time.Second
+		if ttl > 0 {
+			trelloCache = &responseCache{ttl: ttl, responses: make(map[string]*cachedResponse)}
+		}
+	})
+	if trelloCache == nil {
+		return next
+	}
+	return &cachingTransport{next: next, cache: trelloCache, metrics: trelloMetrics}
+}
+
+func (c cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(c.status),
+		StatusCode:    c.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(c.body)),
+		ContentLength: int64(len(c.body)),
+		Request:       req,
+	}
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := trelloops.Endpoint(req.URL.Path)
+	if req.Method != http.MethodGet {
+		if !strings.HasPrefix(endpoint, "cards") && !strings.HasPrefix(endpoint, "actions") {
+			t.cache.mu.Lock()
+			t.cache.responses = make(map[string]*cachedResponse)
+			t.cache.mu.Unlock()
+		}
+		return t.next.RoundTrip(req)
+	}
+	if !cachedTrelloEndpoints[endpoint] {
+		return t.next.RoundTrip(req)
+	}
+
+	// the URL includes the token, so the clients of different tokens don't share the responses
+	key := req.URL.String()
+	t.cache.mu.Lock()
+	cached, found := t.cache.responses[key]
+	fresh := found && time.Now().Before(cached.expires)
+	t.cache.mu.Unlock()
+	if fresh {
+		t.metrics.observeCacheHit()
+		return cached.response(req), nil
+	}
+	etag := ""
+	if found {
+		etag = cached.header.Get("ETag")
+	}
+	if len(etag) > 0 {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNotModified && len(etag) > 0 {
+		resp.Body.Close()
+		t.cache.mu.Lock()
+		cached.expires = time.Now().Add(t.cache.ttl)
+		t.cache.mu.Unlock()
+		t.metrics.observeCacheHit()
+		return cached.response(req), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	entry := &cachedResponse{status: resp.StatusCode, header: resp.Header.Clone(), body: body, expires: time.Now().Add(t.cache.ttl)}
+	t.cache.mu.Lock()
+	t.cache.responses[key] = entry
+	t.cache.mu.Unlock()
+	return entry.response(req), nil
+}
@@ -0,0 +1,117 @@
+package maintainer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Trello serving the board with the ETag of its version, creating a list changes the board
+type testETagAPI struct {
+	mu          sync.Mutex
+	version     int
+	requests    int
+	conditional int
+}
+
+func (api *testETagAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.requests++
+	if r.Method == http.MethodPost && r.URL.Path == "/1/lists" {
+		api.version++
+	}
+	etag := fmt.Sprintf("\"v%d\"", api.version)
+	if len(r.Header.Get("If-None-Match")) > 0 {
+		api.conditional++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("ETag", etag)
+	fmt.Fprintf(w, "v%d", api.version)
+}
+
+// The number of the requests received and of the conditional ones
+func (api *testETagAPI) counts() (int, int) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return api.requests, api.conditional
+}
+
+func TestCachingTransportRevalidatesAndInvalidates(t *testing.T) {
+	api := &testETagAPI{version: 1}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	cache := &responseCache{ttl: time.Hour, responses: make(map[string]*cachedResponse)}
+	client := &http.Client{Transport: &cachingTransport{next: http.DefaultTransport, cache: cache, metrics: newTrelloAPIMetrics()}}
+	board := "/1/boards/5f1a0c2e9b1d4a0012345678?key=k&token=t"
+	card := "/1/cards/5f1a0c2e9b1d4a0087654321"
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		expire bool
+		// the board changes on Trello without the cache seeing it (e.g. by another client)
+		changed     bool
+		upstream    bool
+		conditional bool
+		body        string
+	}{
+		{"first fetch", http.MethodGet, board, false, false, true, false, "v1"},
+		{"fresh response", http.MethodGet, board, false, false, false, false, "v1"},
+		{"expired unchanged response is revalidated", http.MethodGet, board, true, false, true, true, "v1"},
+		{"revalidated response is fresh again", http.MethodGet, board, false, false, false, false, "v1"},
+		{"cards are never cached", http.MethodGet, card, false, false, true, false, "v1"},
+		{"card update", http.MethodPut, card, false, false, true, false, "v1"},
+		{"card update keeps the metadata", http.MethodGet, board, false, false, false, false, "v1"},
+		{"new list", http.MethodPost, "/1/lists", false, false, true, false, "v2"},
+		{"new list drops the metadata", http.MethodGet, board, false, false, true, false, "v2"},
+		{"fresh response hides the change", http.MethodGet, board, false, true, false, false, "v2"},
+		{"expired changed response is downloaded", http.MethodGet, board, true, false, true, true, "v3"},
+	}
+	for _, step := range steps {
+		if step.expire {
+			cache.mu.Lock()
+			for _, cached := range cache.responses {
+				cached.expires = time.Now().Add(-time.Second)
+			}
+			cache.mu.Unlock()
+		}
+		if step.changed {
+			api.mu.Lock()
+			api.version++
+			api.mu.Unlock()
+		}
+		requests, conditional := api.counts()
+		req, err := http.NewRequest(step.method, server.URL+step.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if string(body) != step.body || resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected %s, got HTTP %d %s", step.name, step.body, resp.StatusCode, body)
+		}
+		requestsAfter, conditionalAfter := api.counts()
+		if upstream := requestsAfter > requests; upstream != step.upstream {
+			t.Errorf("%s: expected the request sent to Trello %v, got %v", step.name, step.upstream, upstream)
+		}
+		if sent := conditionalAfter > conditional; sent != step.conditional {
+			t.Errorf("%s: expected the conditional request %v, got %v", step.name, step.conditional, sent)
+		}
+	}
+}
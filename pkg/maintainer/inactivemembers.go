@@ -0,0 +1,106 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_MEMBER_CLEANUP_BOARDS_ENV = "TRELLO_MEMBER_CLEANUP_BOARDS"
+const MEMBER_INACTIVITY_MONTHS_ENV = "MEMBER_INACTIVITY_MONTHS"
+const REMOVE_INACTIVE_MEMBERS_ENV = "REMOVE_INACTIVE_MEMBERS"
+
+// The board actions are fetched by pages of the maximum size Trello allows
+const boardActionsPageSize = 1000
+
+// The members of the board who did something or were added to it since the cutoff
+func activeBoardMembers(client *trello.Client, boardID string, since time.Time) (map[string]bool, error) {
+	active := make(map[string]bool)
+	args := trello.Arguments{"filter": "all", "limit": fmt.Sprint(boardActionsPageSize), "since": since.Format(time.RFC3339), "member": "true", "memberCreator": "false"}
+	for {
+		var actions trello.ActionCollection
+		if err := client.Get(fmt.Sprintf("boards/%s/actions", boardID), args, &actions); err != nil {
+			return nil, err
+		}
+		for _, action := range actions {
+			active[action.IDMemberCreator] = true
+			// the member just added to the board had no chance to act yet
+			if action.Member != nil && (strings.Contains(action.Type, "MemberToBoard") || strings.HasPrefix(action.Type, "make")) {
+				active[action.Member.ID] = true
+			}
+		}
+		if len(actions) < boardActionsPageSize {
+			return active, nil
+		}
+		// the newest first
+		args["before"] = actions[len(actions)-1].ID
+	}
+}
+
+// Reports the members of the boards without any actions on the board for longer than inactivity, and removes them from the board if remove is set.
+// The admins and the member of the token are only reported, so that nobody loses the control of the board
+func cleanUpBoardsInactiveMembers(client *trello.Client, commaSepBoardIds string, inactivity time.Duration, remove bool, confirm *operatorConfirmation) {
+	bot, err := client.GetMyMember(trello.Defaults())
+	if err != nil {
+		log.Panicf("Can't fetch the member of the token: %v", err)
+	}
+	now := time.Now()
+	for _, boardID := range strings.Split(commaSepBoardIds, ",") {
+		boardID = strings.TrimSpace(boardID)
+		board, err := client.GetBoard(boardID)
+		if err != nil {
+			log.Printf("Members of the board %v are not checked: %v\n", boardID, err)
+			continue
+		}
+		var memberships []*trello.Membership
+		if err := client.Get(fmt.Sprintf("boards/%s/memberships", board.ID), trello.Defaults(), &memberships); err != nil {
+			log.Printf("Members of the board %v are not checked: can't fetch the memberships: %v\n", board.Name, err)
+			continue
+		}
+		members, err := board.GetMembers(trello.Defaults())
+		if err != nil {
+			log.Printf("Members of the board %v are not checked: can't fetch them: %v\n", board.Name, err)
+			continue
+		}
+		names := make(map[string]string, len(members))
+		for _, member := range members {
+			names[member.ID] = fmt.Sprintf("%s (@%s)", member.FullName, member.Username)
+		}
+		active, err := activeBoardMembers(client, board.ID, now.Add(-inactivity))
+		if err != nil {
+			log.Printf("Members of the board %v are not checked: can't fetch the actions: %v\n", board.Name, err)
+			continue
+		}
+		inactive := 0
+		for _, membership := range memberships {
+			if active[membership.MemberID] || membership.Deactivated {
+				continue
+			}
+			inactive++
+			name := names[membership.MemberID]
+			if len(name) == 0 {
+				name = membership.MemberID
+			}
+			why := fmt.Sprintf("no actions on the board for %s", humanizeDuration(inactivity))
+			if !remove || membership.Type == "admin" || membership.MemberID == bot.ID {
+				log.Printf("Inactive %s member %s of the board %v: %s\n", membership.Type, name, board.Name, why)
+				continue
+			}
+			if !confirm.approve(fmt.Sprintf("remove inactive %s member %s from the board %v: %s", membership.Type, name, board.Name, why)) {
+				log.Printf("Inactive %s member %s is not removed from the board %v: declined by the operator\n", membership.Type, name, board.Name)
+				continue
+			}
+			if err := trelloops.JSONRequest(client, http.MethodDelete, fmt.Sprintf("boards/%s/members/%s", board.ID, membership.MemberID), nil, nil); err != nil {
+				log.Printf("Failed to remove inactive member %s from the board %v: %v\n", name, board.Name, err)
+				continue
+			}
+			log.Printf("Removed inactive %s member %s from the board %v: %s\n", membership.Type, name, board.Name, why)
+		}
+		log.Printf("%d of %d members of the board %v are inactive\n", inactive, len(memberships), board.Name)
+	}
+}
@@ -0,0 +1,145 @@
+package maintainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adlio/trello"
+	bolt "go.etcd.io/bbolt"
+)
+
+const INCREMENTAL_STATE_PATH_ENV = "INCREMENTAL_STATE_PATH"
+
+var incrementalVerdictsBucket = []byte("verdicts")
+var incrementalMetaBucket = []byte("meta")
+var incrementalLastRunKey = []byte("lastRun")
+
+// The not stale verdict of the previous run about the card
+type stalenessVerdict struct {
+	LastActivity time.Time     `json:"lastActivity"`
+	Threshold    time.Duration `json:"threshold"`
+	StaleAt      time.Time     `json:"staleAt"`
+	// the card dateLastActivity after the run, moved by the own due date and cover updates
+	DateLastActivity time.Time `json:"dateLastActivity,omitempty"`
+	// the activity filter and the calendar the verdict is computed with
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Persistent (BoltDB) verdicts of the last successful run. The cards not changed since that run
+// which were not stale and are not due yet keep the verdict without fetching their actions.
+// The verdicts of the current run replace the stored ones only when the run completes, so a failed run doesn't leave the half of them behind
+type incrementalState struct {
+	db *bolt.DB
+	// start of the last successful run, zero if there was none
+	lastRun  time.Time
+	previous map[string]stalenessVerdict
+
+	mu      sync.Mutex
+	current map[string]stalenessVerdict
+}
+
+// Opens the state configured with INCREMENTAL_STATE_PATH env var.
+// Returns nil if the incremental mode is not configured
+func openIncrementalStateFromEnv() (*incrementalState, error) {
+	path := extractEnvOrDefault(INCREMENTAL_STATE_PATH_ENV, "")
+	if len(path) == 0 {
+		return nil, nil
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("can't open incremental state %v: %w", path, err)
+	}
+	state := &incrementalState{db: db, previous: make(map[string]stalenessVerdict), current: make(map[string]stalenessVerdict)}
+	err = db.Update(func(tx *bolt.Tx) error {
+		verdicts, err := tx.CreateBucketIfNotExists(incrementalVerdictsBucket)
+		if err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(incrementalMetaBucket)
+		if err != nil {
+			return err
+		}
+		if data := meta.Get(incrementalLastRunKey); data != nil {
+			if err := state.lastRun.UnmarshalText(data); err != nil {
+				return err
+			}
+		}
+		return verdicts.ForEach(func(k, v []byte) error {
+			var verdict stalenessVerdict
+			if err := json.Unmarshal(v, &verdict); err != nil {
+				return err
+			}
+			state.previous[string(k)] = verdict
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't read incremental state %v: %w", path, err)
+	}
+	return state, nil
+}
+
+// The previous verdict if it still holds: the card has not changed since the last successful run (besides the own updates of that run),
+// the threshold, the activity filter and the calendar (the fingerprint) are the same and the card is not due yet. A nil state never has one
+func (s *incrementalState) unchangedVerdict(card *trello.Card, threshold time.Duration, fingerprint string, now time.Time) (stalenessVerdict, bool) {
+	if s == nil || s.lastRun.IsZero() || card.DateLastActivity == nil {
+		return stalenessVerdict{}, false
+	}
+	verdict, found := s.previous[card.ID]
+	if !found || verdict.Threshold != threshold || verdict.Fingerprint != fingerprint || !now.Before(verdict.StaleAt) {
+		return stalenessVerdict{}, false
+	}
+	if card.DateLastActivity.After(s.lastRun) && !card.DateLastActivity.Equal(verdict.DateLastActivity) {
+		return stalenessVerdict{}, false
+	}
+	return verdict, true
+}
+
+// Records the not stale verdict of the current run
+func (s *incrementalState) record(cardID string, verdict stalenessVerdict) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current[cardID] = verdict
+}
+
+// Replaces the stored verdicts with the ones of the current run started at runStart
+func (s *incrementalState) commit(runStart time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(incrementalVerdictsBucket); err != nil {
+			return err
+		}
+		verdicts, err := tx.CreateBucket(incrementalVerdictsBucket)
+		if err != nil {
+			return err
+		}
+		for cardID, verdict := range s.current {
+			data, err := json.Marshal(verdict)
+			if err != nil {
+				return err
+			}
+			if err := verdicts.Put([]byte(cardID), data); err != nil {
+				return err
+			}
+		}
+		data, err := runStart.MarshalText()
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(incrementalMetaBucket).Put(incrementalLastRunKey, data)
+	})
+}
+
+func (s *incrementalState) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
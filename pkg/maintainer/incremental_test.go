@@ -0,0 +1,49 @@
+package maintainer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+func TestUnchangedVerdictNeedsSamePolicy(t *testing.T) {
+	now := time.Now()
+	lastRun := now.Add(-time.Hour)
+	created := now.Add(-10 * 24 * time.Hour).Truncate(time.Second)
+	dateLastActivity := lastRun.Add(-time.Hour)
+	card := &trello.Card{ID: testID(created, 1), DateLastActivity: &dateLastActivity}
+	holidays, err := newBusinessCalendar("Sat,Sun", "2024-05-09")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekends, err := newBusinessCalendar("Sat,Sun", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := func(activity string, calendar *businessCalendar) *staleCardPolicy {
+		return &staleCardPolicy{activity: parseActivityFilter(activity), calendar: calendar}
+	}
+	recorded := policy("commentCard", holidays)
+	state := &incrementalState{lastRun: lastRun, previous: map[string]stalenessVerdict{
+		card.ID: {LastActivity: dateLastActivity, Threshold: 24 * time.Hour, StaleAt: now.Add(time.Hour), Fingerprint: recorded.verdictFingerprint()},
+	}}
+
+	cases := []struct {
+		name      string
+		policy    *staleCardPolicy
+		threshold time.Duration
+		unchanged bool
+	}{
+		{"same policy", policy("commentCard", holidays), 24 * time.Hour, true},
+		{"threshold changed", policy("commentCard", holidays), 48 * time.Hour, false},
+		{"activity filter changed", policy("commentCard,updateCard", holidays), 24 * time.Hour, false},
+		{"holidays changed", policy("commentCard", weekends), 24 * time.Hour, false},
+		{"calendar disabled", policy("commentCard", nil), 24 * time.Hour, false},
+	}
+	for _, c := range cases {
+		if _, unchanged := state.unchangedVerdict(card, c.threshold, c.policy.verdictFingerprint(), now); unchanged != c.unchanged {
+			t.Errorf("%s: expected unchanged %v, got %v", c.name, c.unchanged, unchanged)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const INTAKE_BOARD_ENV = "INTAKE_BOARD"
+const INTAKE_LIST_PREFIX_ENV = "INTAKE_LIST_PREFIX"
+const INTAKE_ROTATION_ENV = "INTAKE_ROTATION"
+const INTAKE_ARCHIVE_OLD_LISTS_ENV = "INTAKE_ARCHIVE_OLD_LISTS"
+
+type intakeRotationEnum int32
+
+const (
+	// lists like "Intake 2024-W32" (ISO week)
+	intakeRotationWeekly intakeRotationEnum = iota + 1
+	// lists like "Intake 2024-08"
+	intakeRotationMonthly
+)
+
+var weeklyIntakeLabelRegex = regexp.MustCompile(`^\d{4}-W\d{2}$`)
+var monthlyIntakeLabelRegex = regexp.MustCompile(`^\d{4}-\d{2}$`)
+
+func parseIntakeRotation(name string) (intakeRotationEnum, error) {
+	switch name {
+	case "weekly":
+		return intakeRotationWeekly, nil
+	case "monthly":
+		return intakeRotationMonthly, nil
+	default:
+		return 0, fmt.Errorf("unsupported intake rotation \"%s\" (expected weekly or monthly)", name)
+	}
+}
+
+// Label of the period the time belongs to. Labels of the same rotation sort chronologically
+func (r intakeRotationEnum) label(t time.Time) string {
+	switch r {
+	case intakeRotationWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case intakeRotationMonthly:
+		return t.Format("2006-01")
+	default:
+		log.Panicf("Unsupported intake rotation: %v", r)
+		return ""
+	}
+}
+
+func (r intakeRotationEnum) isLabel(s string) bool {
+	if r == intakeRotationWeekly {
+		return weeklyIntakeLabelRegex.MatchString(s)
+	}
+	return monthlyIntakeLabelRegex.MatchString(s)
+}
+
+// Creates the intake list of the current period (at the top of the board) if it does not exist yet.
+// Returns the id of the current intake list and the ids of the open intake lists of the earlier periods
+func rotateIntakeLists(client *trello.Client, boardId string, prefix string, rotation intakeRotationEnum, now time.Time) (string, []string) {
+	currentLabel := rotation.label(now)
+	currentName := prefix + currentLabel
+	var olderListIds []string
+	currentListId := ""
+	for _, list := range trelloops.FetchOpenLists(client, boardId) {
+		if !strings.HasPrefix(list.Name, prefix) {
+			continue
+		}
+		label := strings.TrimPrefix(list.Name, prefix)
+		if !rotation.isLabel(label) {
+			continue
+		}
+		if label == currentLabel {
+			currentListId = list.ID
+		} else if label < currentLabel {
+			olderListIds = append(olderListIds, list.ID)
+		}
+	}
+	if len(currentListId) == 0 {
+		list, err := client.CreateList(&trello.Board{ID: boardId}, currentName, trello.Arguments{"pos": "top"})
+		if err != nil {
+			log.Panicf("Can't create intake list %v on board %v: %v", currentName, boardId, err)
+		}
+		log.Printf("Created intake list %v (%v)\n", list.Name, list.ID)
+		currentListId = list.ID
+	}
+	log.Printf("%d older intake lists found on board %v\n", len(olderListIds), boardId)
+	return currentListId, olderListIds
+}
@@ -0,0 +1,334 @@
+package maintainer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const ACTION_JOURNAL_PATH_ENV = "ACTION_JOURNAL_PATH"
+
+var journalRunsBucket = []byte("runs")
+var journalActionsBucket = []byte("actions")
+
+type journalRunKind string
+
+const (
+	journalRunMaintenance journalRunKind = "maintenance"
+	journalRunRestore     journalRunKind = "restore"
+	journalRunConsume     journalRunKind = "consume"
+)
+
+type journalActionType string
+
+const (
+	journalActionArchive     journalActionType = "archive"
+	journalActionDelete      journalActionType = "delete"
+	journalActionMoveToBoard journalActionType = "moveToBoard"
+	journalActionMoveToList  journalActionType = "moveToList"
+	journalActionUnarchive   journalActionType = "unarchive"
+	journalActionRecreate    journalActionType = "recreate"
+	journalActionMoveBack    journalActionType = "moveBack"
+	journalActionReorder     journalActionType = "reorder"
+	journalActionCreate      journalActionType = "create"
+)
+
+type journalRun struct {
+	ID        uint64         `json:"id"`
+	Kind      journalRunKind `json:"kind"`
+	StartedAt time.Time      `json:"startedAt"`
+	// missing for the runs in progress and the crashed ones
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// number of the errors (as counted by the audit log) of the finished run
+	Errors int `json:"errors,omitempty"`
+}
+
+// A single action performed by the bot on the card
+type journalEntry struct {
+	RunID     uint64            `json:"runId"`
+	Timestamp time.Time         `json:"timestamp"`
+	Action    journalActionType `json:"action"`
+	CardID    string            `json:"cardId"`
+	CardName  string            `json:"cardName"`
+	BoardID   string            `json:"boardId"`
+	ListID    string            `json:"listId"`
+	ListName  string            `json:"listName"`
+	// human readable explanation why the action was taken
+	Reason string `json:"reason,omitempty"`
+	// where the card was moved to (for moveToBoard and moveToList)
+	TargetBoardID string `json:"targetBoardId,omitempty"`
+	TargetListID  string `json:"targetListId,omitempty"`
+	// id of the card re-created from backup (for recreate)
+	NewCardID string `json:"newCardId,omitempty"`
+}
+
+// Persistent (BoltDB) storage of the actions performed by the bot, grouped by runs
+type actionJournal struct {
+	db *bolt.DB
+}
+
+func openActionJournal(path string) (*actionJournal, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("can't open action journal %v: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{journalRunsBucket, journalActionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't initialize action journal %v: %w", path, err)
+	}
+	return &actionJournal{db: db}, nil
+}
+
+// Opens the existing journal for reading, e.g. by the web UI. Fails if the journal is not released (e.g. by the active run) within the timeout
+func openActionJournalReadOnly(path string, timeout time.Duration) (*actionJournal, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: timeout, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("can't open action journal %v: %w", path, err)
+	}
+	return &actionJournal{db: db}, nil
+}
+
+// Opens the journal configured with ACTION_JOURNAL_PATH env var.
+// Returns nil if the journal is not configured
+func openActionJournalFromEnv() (*actionJournal, error) {
+	path := extractEnvOrDefault(ACTION_JOURNAL_PATH_ENV, "")
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return openActionJournal(path)
+}
+
+func (j *actionJournal) close() error {
+	return j.db.Close()
+}
+
+func journalKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// Registers a new run. Actions are recorded via the returned runJournal
+func (j *actionJournal) startRun(kind journalRunKind, now time.Time) (*runJournal, error) {
+	run := journalRun{Kind: kind, StartedAt: now}
+	err := j.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(journalRunsBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		run.ID = seq
+		data, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(journalKey(seq), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &runJournal{journal: j, run: run}, nil
+}
+
+// Returns up to n most recent runs of the given kind (of any kind if it is empty), the latest first
+func (j *actionJournal) lastRuns(kind journalRunKind, n int) ([]journalRun, error) {
+	var runs []journalRun
+	err := j.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(journalRunsBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(runs) < n; k, v = c.Prev() {
+			var run journalRun
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			if len(kind) == 0 || run.Kind == kind {
+				runs = append(runs, run)
+			}
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// Returns the run with the id and whether it is found
+func (j *actionJournal) findRun(id uint64) (journalRun, bool, error) {
+	var run journalRun
+	var found bool
+	err := j.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(journalRunsBucket).Get(journalKey(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &run)
+	})
+	return run, found, err
+}
+
+// Returns all of the entries that satisfy the filter in chronological order
+func (j *actionJournal) entries(filter func(entry *journalEntry) bool) ([]journalEntry, error) {
+	var result []journalEntry
+	err := j.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(journalActionsBucket).ForEach(func(k, v []byte) error {
+			var entry journalEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if filter(&entry) {
+				result = append(result, entry)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Journal of a single run. A nil runJournal is valid and records nothing
+// Records the actions of a single run to the journal (if set) and publishes them to the sinks
+type runJournal struct {
+	journal *actionJournal
+	run     journalRun
+	sinks   []actionSink
+}
+
+// Registers the run in the journal (may be nil) and opens the action sinks configured by env vars.
+// The extra sinks receive the actions too. Returns nil if there is neither the journal nor any sink
+func startRunFromEnv(journal *actionJournal, kind journalRunKind, now time.Time, extra ...actionSink) (*runJournal, error) {
+	sinks, err := actionSinksFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	sinks = append(sinks, extra...)
+	var run *runJournal
+	if journal != nil {
+		run, err = journal.startRun(kind, now)
+		if err != nil {
+			closeActionSinks(sinks)
+			return nil, fmt.Errorf("can't register the run in the action journal: %w", err)
+		}
+	} else if len(sinks) > 0 {
+		run = &runJournal{run: journalRun{Kind: kind, StartedAt: now}}
+	} else {
+		return nil, nil
+	}
+	run.sinks = sinks
+	for _, sink := range sinks {
+		log.Printf("Actions are published to %s\n", sink.describe())
+	}
+	return run, nil
+}
+
+func (r *runJournal) record(entry journalEntry) {
+	if r == nil {
+		return
+	}
+	entry.RunID = r.run.ID
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if r.journal != nil {
+		err := r.journal.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(journalActionsBucket)
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			return bucket.Put(journalKey(seq), data)
+		})
+		if err != nil {
+			log.Printf("Failed to record action %v for card %v in the journal: %v\n", entry.Action, entry.CardID, err)
+		}
+	}
+	for _, sink := range r.sinks {
+		if err := sink.publish(entry); err != nil {
+			log.Printf("Failed to publish action %v for card %v to %s: %v\n", entry.Action, entry.CardID, sink.describe(), err)
+		}
+	}
+}
+
+// Records the end of the run with the number of its errors
+func (r *runJournal) finish(now time.Time, errors int) {
+	if r == nil || r.journal == nil {
+		return
+	}
+	r.run.FinishedAt = &now
+	r.run.Errors = errors
+	err := r.journal.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(r.run)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(journalRunsBucket).Put(journalKey(r.run.ID), data)
+	})
+	if err != nil {
+		log.Printf("Failed to record the end of run %d in the journal: %v\n", r.run.ID, err)
+	}
+}
+
+// Flushes and closes the sinks. The journal itself is closed by its owner
+func (r *runJournal) close() {
+	if r == nil {
+		return
+	}
+	closeActionSinks(r.sinks)
+}
+
+// Prints all of the journal records about the given cards
+func runHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s history <card id>...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cardIDs := make(map[string]bool)
+	for _, cardID := range flags.Args() {
+		cardIDs[cardID] = true
+	}
+
+	journal, err := openActionJournalFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	if journal == nil {
+		log.Fatalf("ERROR: \"%s\" env var is not defined\n", ACTION_JOURNAL_PATH_ENV)
+	}
+	defer journal.close()
+
+	entries, err := journal.entries(func(entry *journalEntry) bool {
+		return cardIDs[entry.CardID] || cardIDs[entry.NewCardID]
+	})
+	if err != nil {
+		log.Fatalf("ERROR: can't read actions from the journal: %v\n", err)
+	}
+	if len(entries) == 0 {
+		log.Println("No actions recorded for the card(s)")
+		return
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s\trun %d\t%s\t%s (%s)\tlist %s (%s)\t%s\n",
+			entry.Timestamp.Format(time.RFC3339), entry.RunID, entry.Action,
+			entry.CardName, entry.CardID, entry.ListName, entry.ListID, entry.Reason)
+	}
+}
@@ -0,0 +1,203 @@
+package maintainer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_KASHTANKA_LISTS_ENV = "TRELLO_KASHTANKA_LISTS"
+const KASHTANKA_CASE_URL_ENV = "KASHTANKA_CASE_URL"
+const KASHTANKA_STATUS_FIELD_ENV = "KASHTANKA_STATUS_FIELD"
+const KASHTANKA_SOLVED_STATUSES_ENV = "KASHTANKA_SOLVED_STATUSES"
+const KASHTANKA_MATCH_URL_FIELD_ENV = "KASHTANKA_MATCH_URL_FIELD"
+const KASHTANKA_SOLVED_LIST_ENV = "KASHTANKA_SOLVED_LIST"
+const PET_ID_REGEX_ENV = "PET_ID_REGEX"
+
+// Kashtanka API case lookup. caseURL contains "{id}" placeholder for the pet ID,
+// the response is a JSON object with the case status and the link to the match
+type kashtankaClient struct {
+	caseURL        string
+	statusField    string
+	solvedStatuses map[string]bool
+	matchURLField  string
+	petID          *regexp.Regexp
+	http           *http.Client
+}
+
+// Returns nil if the integration is not configured
+func kashtankaClientFromEnv() (*kashtankaClient, error) {
+	caseURL := extractEnvOrDefault(KASHTANKA_CASE_URL_ENV, "")
+	if len(caseURL) == 0 {
+		return nil, nil
+	}
+	if !strings.Contains(caseURL, "{id}") {
+		return nil, fmt.Errorf("%s must contain {id} placeholder", KASHTANKA_CASE_URL_ENV)
+	}
+	pattern := extractEnvOrDefault(PET_ID_REGEX_ENV, "")
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("%s must be set to find the pet ID of the cards", PET_ID_REGEX_ENV)
+	}
+	petID, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("can't compile %s: %w", PET_ID_REGEX_ENV, err)
+	}
+	if petID.NumSubexp() != 1 {
+		return nil, fmt.Errorf("%s must contain exactly one capture group, got %d", PET_ID_REGEX_ENV, petID.NumSubexp())
+	}
+	solved := make(map[string]bool)
+	for _, status := range strings.Split(extractEnvOrDefault(KASHTANKA_SOLVED_STATUSES_ENV, "solved,matched"), ",") {
+		if status = strings.TrimSpace(status); len(status) > 0 {
+			solved[strings.ToLower(status)] = true
+		}
+	}
+	return &kashtankaClient{
+		caseURL:        caseURL,
+		statusField:    extractEnvOrDefault(KASHTANKA_STATUS_FIELD_ENV, "status"),
+		solvedStatuses: solved,
+		matchURLField:  extractEnvOrDefault(KASHTANKA_MATCH_URL_FIELD_ENV, "matchUrl"),
+		petID:          petID,
+		http:           &http.Client{Timeout: 15 * time.Second, Transport: outboundTransport()},
+	}, nil
+}
+
+// The pet ID found in the card name or description, empty if there is none
+func (k *kashtankaClient) cardPetID(card *trello.Card) string {
+	for _, text := range []string{card.Name, card.Desc} {
+		if match := k.petID.FindStringSubmatch(text); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+type kashtankaCase struct {
+	solved   bool
+	status   string
+	matchURL string
+}
+
+func (k *kashtankaClient) lookupCase(petID string) (*kashtankaCase, error) {
+	endpoint := strings.ReplaceAll(k.caseURL, "{id}", url.PathEscape(petID))
+	resp, err := k.http.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Kashtanka API responded with HTTP %d", resp.StatusCode)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("can't parse Kashtanka API response: %w", err)
+	}
+	status, _ := body[k.statusField].(string)
+	matchURL, _ := body[k.matchURLField].(string)
+	return &kashtankaCase{
+		solved:   k.solvedStatuses[strings.ToLower(status)],
+		status:   status,
+		matchURL: matchURL,
+	}, nil
+}
+
+// Moves the cards whose cases are solved in Kashtanka to solvedListID (or archives them if it is empty)
+// and posts the comment with the link to the match. confirm (if set) asks the operator before each of them
+func closeSolvedCards(ctx context.Context, client *trello.Client, commaSepListId string, kashtanka *kashtankaClient, solvedListID string, journal *runJournal, audit *auditLog, confirm *operatorConfirmation) {
+	processLists(ctx, commaSepListId, "Kashtanka solved cases", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		list := trelloops.FetchList(listClient(ctx, client), listId)
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		now := time.Now()
+		for _, card := range cards {
+			petID := kashtanka.cardPetID(card)
+			if len(petID) == 0 {
+				continue
+			}
+			record := auditRecord{
+				Timestamp: now,
+				Pass:      "kashtanka",
+				CardID:    card.ID,
+				CardName:  card.Name,
+				ListID:    list.ID,
+				ListName:  list.Name,
+			}
+			found, err := kashtanka.lookupCase(petID)
+			if err != nil {
+				log.Printf("Can't look up case %v of card \"%v\" (%v): %v\n", petID, card.Name, card.ID, err)
+				record.Decision = auditDecisionError
+				record.Detail = err.Error()
+				audit.write(record)
+				continue
+			}
+			if found == nil || !found.solved {
+				record.Decision = auditDecisionSkip
+				record.Rule = "case is not solved"
+				audit.write(record)
+				continue
+			}
+			record.Rule = fmt.Sprintf("case %s is %s in Kashtanka", petID, found.status)
+			record.Detail = found.matchURL
+			action := journalActionArchive
+			if len(solvedListID) > 0 {
+				action = journalActionMoveToList
+			}
+			if !confirm.approve(fmt.Sprintf("%v card \"%v\" (%v) of the list %v: %s", action, card.Name, card.ID, list.Name, record.Rule)) {
+				record.Decision = auditDecisionSkip
+				record.Detail = "declined by the operator"
+				audit.write(record)
+				continue
+			}
+			comment := renderMessage(messageKashtankaClosed, map[string]interface{}{"Card": card, "Status": found.status, "MatchURL": found.matchURL})
+			if _, err := card.AddComment(comment); err != nil {
+				log.Printf("Failed to post comment to card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+			}
+			entry := journalEntry{
+				Timestamp: now,
+				CardID:    card.ID,
+				CardName:  card.Name,
+				BoardID:   list.IDBoard,
+				ListID:    list.ID,
+				ListName:  list.Name,
+				Reason:    record.Rule,
+			}
+			if len(solvedListID) > 0 {
+				err = card.MoveToList(solvedListID)
+				entry.Action = journalActionMoveToList
+				entry.TargetBoardID = list.IDBoard
+				entry.TargetListID = solvedListID
+				record.Decision = auditDecisionMoveToList
+			} else {
+				err = card.Archive()
+				entry.Action = journalActionArchive
+				record.Decision = auditDecisionArchive
+			}
+			if err != nil {
+				log.Printf("Failed to close solved card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+				record.Decision = auditDecisionError
+				record.Detail = err.Error()
+				audit.write(record)
+				continue
+			}
+			log.Printf("Closed card \"%v\" (%v): %s\n", card.Name, card.ID, record.Rule)
+			journal.record(entry)
+			audit.write(record)
+		}
+	})
+}
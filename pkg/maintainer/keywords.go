@@ -0,0 +1,165 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_KEYWORD_LISTS_ENV = "TRELLO_KEYWORD_LISTS"
+const RESOLVED_KEYWORDS_ENV = "RESOLVED_KEYWORDS"
+const RESOLVED_LIST_ENV = "RESOLVED_LIST"
+const RESOLVED_LABEL_ENV = "RESOLVED_LABEL"
+
+const defaultResolvedKeywords = "found,returned,нашёлся,нашелся,нашлась,вернулся"
+
+// Matches any of the keywords as a whole word (case insensitive).
+// Word boundaries are checked for any letters, as \b of Go regexp supports only ASCII
+func compileKeywordsRegex(commaSepKeywords string) (*regexp.Regexp, error) {
+	var alternatives []string
+	for _, keyword := range strings.Split(commaSepKeywords, ",") {
+		keyword = strings.TrimSpace(keyword)
+		if len(keyword) > 0 {
+			alternatives = append(alternatives, regexp.QuoteMeta(keyword))
+		}
+	}
+	if len(alternatives) == 0 {
+		return nil, fmt.Errorf("no keywords configured")
+	}
+	return regexp.Compile(`(?i)(?:^|[^\p{L}\p{N}])(` + strings.Join(alternatives, "|") + `)(?:$|[^\p{L}\p{N}])`)
+}
+
+// Where the cards mentioning the keywords are moved to, labelName (if set) is applied to them before the move
+type keywordRoutingPolicy struct {
+	keywords     *regexp.Regexp
+	targetListID string
+	labelName    string
+	journal      *runJournal
+	audit        *auditLog
+	// asks the operator before each move (nil approves everything)
+	confirm *operatorConfirmation
+}
+
+// Returns the matched keyword and where it was found, or empty strings if the card doesn't mention the keywords
+func findKeyword(card *trello.Card, keywords *regexp.Regexp) (string, string, error) {
+	if match := keywords.FindStringSubmatch(card.Name); match != nil {
+		return match[1], "title", nil
+	}
+	if match := keywords.FindStringSubmatch(card.Desc); match != nil {
+		return match[1], "description", nil
+	}
+	comments, err := card.GetActions(trello.Arguments{"filter": "commentCard", "limit": "1000"})
+	if err != nil {
+		return "", "", fmt.Errorf("can't fetch comments: %w", err)
+	}
+	for _, action := range comments {
+		if action.Data == nil {
+			continue
+		}
+		if match := keywords.FindStringSubmatch(action.Data.Text); match != nil {
+			return match[1], "comment", nil
+		}
+	}
+	return "", "", nil
+}
+
+func routeCardByKeywords(list *trello.List, card *trello.Card, label *trello.Label, now time.Time, policy keywordRoutingPolicy) {
+	audit := auditRecord{
+		Timestamp: now,
+		Pass:      "keywords",
+		CardID:    card.ID,
+		CardName:  card.Name,
+		ListID:    list.ID,
+		ListName:  list.Name,
+	}
+	keyword, where, err := findKeyword(card, policy.keywords)
+	if err != nil {
+		log.Printf("Can't check card \"%v\" (%v) for keywords: %v\n", card.Name, card.ID, err)
+		audit.Decision = auditDecisionError
+		audit.Detail = err.Error()
+		policy.audit.write(audit)
+		return
+	}
+	if len(keyword) == 0 {
+		audit.Decision = auditDecisionSkip
+		audit.Rule = "no keywords"
+		policy.audit.write(audit)
+		return
+	}
+	audit.Rule = fmt.Sprintf("keyword \"%s\" in the %s", keyword, where)
+	if !policy.confirm.approve(fmt.Sprintf("%v card \"%v\" (%v) of the list %v: %s", journalActionMoveToList, card.Name, card.ID, list.Name, audit.Rule)) {
+		audit.Decision = auditDecisionSkip
+		audit.Detail = "declined by the operator"
+		policy.audit.write(audit)
+		return
+	}
+	if label != nil && !containsString(card.IDLabels, label.ID) {
+		if err := card.AddIDLabel(label.ID); err != nil {
+			log.Printf("Failed to label card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+		}
+	}
+	if err := card.MoveToList(policy.targetListID); err != nil {
+		log.Printf("Failed to move card \"%v\" (%v) to list %v: %v\n", card.Name, card.ID, policy.targetListID, err)
+		audit.Decision = auditDecisionError
+		audit.Detail = err.Error()
+		policy.audit.write(audit)
+		return
+	}
+	log.Printf("Moved card \"%v\" (%v) to the resolved list %v: %s\n", card.Name, card.ID, policy.targetListID, audit.Rule)
+	policy.journal.record(journalEntry{
+		Timestamp:     now,
+		Action:        journalActionMoveToList,
+		CardID:        card.ID,
+		CardName:      card.Name,
+		BoardID:       list.IDBoard,
+		ListID:        list.ID,
+		ListName:      list.Name,
+		Reason:        audit.Rule,
+		TargetBoardID: list.IDBoard,
+		TargetListID:  policy.targetListID,
+	})
+	audit.Decision = auditDecisionMoveToList
+	policy.audit.write(audit)
+}
+
+// Moves the cards of the lists mentioning the keywords (e.g. "found") to the resolved list
+func routeListsByKeywords(ctx context.Context, client *trello.Client, commaSepListId string, policy keywordRoutingPolicy) {
+	processLists(ctx, commaSepListId, "resolved keywords", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		list := trelloops.FetchList(listClient(ctx, client), listId)
+		var label *trello.Label
+		if len(policy.labelName) > 0 {
+			var err error
+			label, err = findOrCreateBoardLabel(client, list.IDBoard, policy.labelName, "green")
+			if err != nil {
+				log.Printf("Resolved cards of the list %v are not labeled: %v\n", list.Name, err)
+			}
+		}
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		now := time.Now()
+		var cardsWg sync.WaitGroup
+		var panics cardPanics
+		cardsWg.Add(len(cards))
+		for _, card := range cards {
+			go func(card *trello.Card) {
+				defer cardsWg.Done()
+				defer panics.catch()
+				routeCardByKeywords(list, card, label, now, policy)
+			}(card)
+		}
+		cardsWg.Wait()
+		panics.rethrow()
+		log.Printf("List %v checked for resolved keywords\n", list.Name)
+	})
+}
@@ -0,0 +1,112 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_LABEL_CLEANUP_BOARDS_ENV = "TRELLO_LABEL_CLEANUP_BOARDS"
+const LABEL_CLEANUP_REGEX_ENV = "LABEL_CLEANUP_REGEX"
+
+// Which labels of the boards are deleted: the ones on no card (including the archived ones) and the ones with the names matching
+// remove (if set) even if they are used. The labels named in keep (case insensitive), e.g. the ones the passes apply, are never deleted
+type labelCleanupPolicy struct {
+	remove *regexp.Regexp
+	keep   map[string]bool
+}
+
+// Returns nil regex if the pattern is not configured
+func labelCleanupRegexFromEnv() (*regexp.Regexp, error) {
+	pattern := extractEnvOrDefault(LABEL_CLEANUP_REGEX_ENV, "")
+	if len(pattern) == 0 {
+		return nil, nil
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("can't compile %s: %w", LABEL_CLEANUP_REGEX_ENV, err)
+	}
+	return regex, nil
+}
+
+// Why the label is deleted, or empty string if it is kept
+func (p labelCleanupPolicy) reason(label *trello.Label, uses int) string {
+	if p.keep[strings.ToLower(label.Name)] {
+		return ""
+	}
+	if p.remove != nil && len(label.Name) > 0 && p.remove.MatchString(label.Name) {
+		return fmt.Sprintf("the name matches %v", p.remove)
+	}
+	if uses == 0 {
+		return "no card has it"
+	}
+	return ""
+}
+
+// Deletes the unused labels of the boards, so that the label picker of a busy board stays manageable
+func cleanUpBoardsLabels(client *trello.Client, commaSepBoardIds string, policy labelCleanupPolicy, confirm *operatorConfirmation) {
+	for _, boardID := range strings.Split(commaSepBoardIds, ",") {
+		boardID = strings.TrimSpace(boardID)
+		board, err := client.GetBoard(boardID)
+		if err != nil {
+			log.Printf("Labels of the board %v are not cleaned up: %v\n", boardID, err)
+			continue
+		}
+		labels, err := board.GetLabels(trello.Arguments{"limit": "1000"})
+		if err != nil {
+			log.Printf("Labels of the board %v are not cleaned up: can't fetch them: %v\n", board.Name, err)
+			continue
+		}
+		// the archived cards count, their labels would be lost otherwise
+		var cards []*trello.Card
+		if err := client.Get(fmt.Sprintf("boards/%s/cards/all", board.ID), trello.Arguments{"fields": "idLabels"}, &cards); err != nil {
+			log.Printf("Labels of the board %v are not cleaned up: can't fetch its cards: %v\n", board.Name, err)
+			continue
+		}
+		uses := make(map[string]int)
+		for _, card := range cards {
+			for _, labelID := range card.IDLabels {
+				uses[labelID]++
+			}
+		}
+		deleted := 0
+		for _, label := range labels {
+			why := policy.reason(label, uses[label.ID])
+			if len(why) == 0 {
+				continue
+			}
+			if !confirm.approve(fmt.Sprintf("delete label \"%v\" (%v, %v) of the board %v: %s", label.Name, label.Color, label.ID, board.Name, why)) {
+				log.Printf("Label \"%v\" (%v, %v) of the board %v is not deleted: declined by the operator\n", label.Name, label.Color, label.ID, board.Name)
+				continue
+			}
+			if err := trelloops.JSONRequest(client, http.MethodDelete, "labels/"+label.ID, nil, nil); err != nil {
+				log.Printf("Failed to delete label \"%v\" (%v, %v) of the board %v: %v\n", label.Name, label.Color, label.ID, board.Name, err)
+				continue
+			}
+			log.Printf("Deleted label \"%v\" (%v, %v) of the board %v: %s\n", label.Name, label.Color, label.ID, board.Name, why)
+			deleted++
+		}
+		log.Printf("%d of %d labels of the board %v are deleted\n", deleted, len(labels), board.Name)
+	}
+}
+
+// The labels the passes of the profile apply, kept even when no card has them at the moment
+func (r *maintenanceRun) appliedLabels(profile maintenanceProfile) map[string]bool {
+	keep := make(map[string]bool)
+	names := []string{profile.brokenLinkLabel, profile.resolvedLabel, r.needsFixLabel}
+	rules, _ := profile.cardRules()
+	for _, rule := range rules {
+		names = append(names, rule.label)
+	}
+	for _, name := range names {
+		if len(name) > 0 {
+			keep[strings.ToLower(name)] = true
+		}
+	}
+	return keep
+}
@@ -0,0 +1,32 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/adlio/trello"
+)
+
+// Returns the label of the board with the given name (case insensitive), creating it with the color if it is missing
+func findOrCreateBoardLabel(client *trello.Client, boardID string, name string, color string) (*trello.Label, error) {
+	board, err := client.GetBoard(boardID)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch board %v: %w", boardID, err)
+	}
+	labels, err := board.GetLabels(trello.Defaults())
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch labels of the board %v: %w", board.Name, err)
+	}
+	for _, label := range labels {
+		if strings.EqualFold(label.Name, name) {
+			return label, nil
+		}
+	}
+	label := &trello.Label{Name: name, Color: color}
+	if err := board.CreateLabel(label); err != nil {
+		return nil, fmt.Errorf("can't create label %v on the board %v: %w", name, board.Name, err)
+	}
+	log.Printf("Created label %v (%v) on the board %v\n", label.Name, label.ID, board.Name)
+	return label, nil
+}
@@ -0,0 +1,98 @@
+package maintainer
+
+import (
+	"fmt"
+	"time"
+)
+
+// Card action taken (or planned) by the maintenance run
+type Action struct {
+	Timestamp time.Time
+	// e.g. "archive", "delete", "moveToBoard" or "moveToList"
+	Action   string
+	CardID   string
+	CardName string
+	BoardID  string
+	ListID   string
+	ListName string
+	// human readable explanation why the action was taken
+	Reason string
+	// where the card was moved to (for moveToBoard and moveToList)
+	TargetBoardID string
+	TargetListID  string
+}
+
+func actionOfEntry(entry journalEntry) Action {
+	return Action{
+		Timestamp:     entry.Timestamp,
+		Action:        string(entry.Action),
+		CardID:        entry.CardID,
+		CardName:      entry.CardName,
+		BoardID:       entry.BoardID,
+		ListID:        entry.ListID,
+		ListName:      entry.ListName,
+		Reason:        entry.Reason,
+		TargetBoardID: entry.TargetBoardID,
+		TargetListID:  entry.TargetListID,
+	}
+}
+
+// How the embedded maintenance run is performed, the zero value is the regular run
+type Options struct {
+	// collects the stale card actions instead of performing them, nothing is changed
+	DryRun bool
+	// called for each of the actions taken (not for the planned ones), in addition to the sinks configured by env vars
+	OnAction func(Action)
+}
+
+// Passes the actions of the run to Options.OnAction
+type actionCallback struct {
+	onAction func(Action)
+}
+
+func (c *actionCallback) publish(entry journalEntry) error {
+	c.onAction(actionOfEntry(entry))
+	return nil
+}
+
+func (c *actionCallback) close() error {
+	return nil
+}
+
+func (c *actionCallback) describe() string {
+	return "embedding service"
+}
+
+// Performs a single maintenance run configured by the env vars (and CONFIG_FILE) the same way the container does,
+// for the services embedding the maintenance instead of running the container.
+// Returns the planned actions for the dry run. The invalid configuration and the failure of any pass
+// (of any of its lists and cards) are returned as the error, the process keeps running
+func Run(options Options) (planned []Action, err error) {
+	lock, err := acquireRunLockFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	defer lock.release()
+	defer func() {
+		if failure := recover(); failure != nil {
+			err = fmt.Errorf("maintenance run failed: %v", failure)
+		}
+	}()
+
+	var runOptions maintenanceOptions
+	if options.DryRun {
+		runOptions.plan = &actionPlan{CreatedAt: time.Now()}
+	}
+	if options.OnAction != nil {
+		runOptions.sinks = []actionSink{&actionCallback{onAction: options.OnAction}}
+	}
+	if err := runMaintenance(runOptions); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if runOptions.plan != nil {
+		for _, action := range runOptions.plan.Actions {
+			planned = append(planned, actionOfEntry(action.journalEntry))
+		}
+	}
+	return planned, nil
+}
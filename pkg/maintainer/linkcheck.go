@@ -0,0 +1,182 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_LINK_CHECK_LISTS_ENV = "TRELLO_LINK_CHECK_LISTS"
+const BROKEN_LINK_LABEL_ENV = "BROKEN_LINK_LABEL"
+const BROKEN_LINK_REVIEW_LIST_ENV = "BROKEN_LINK_REVIEW_LIST"
+
+// Number of cards whose links are checked simultaneously
+const linkCheckConcurrency = 8
+
+var linkCheckClient = &http.Client{Timeout: 15 * time.Second, Transport: outboundTransport()}
+
+// What to do with the cards which have dead attachment links:
+// they are moved to reviewListID if it is set, otherwise labeled with labelName
+type linkCheckPolicy struct {
+	labelName    string
+	reviewListID string
+	journal      *runJournal
+	audit        *auditLog
+}
+
+// Whether the URL points to the page that has been taken down (404 or 410).
+// Other failures (timeouts, server errors) are reported as errors, so that the card isn't flagged by mistake
+func isDeadLink(url string) (bool, error) {
+	resp, err := linkCheckClient.Head(url)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = linkCheckClient.Get(url)
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode >= 500:
+		return false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	default:
+		return false, nil
+	}
+}
+
+// Link attachments pointing outside of Trello (e.g. the advert photos)
+func externalLinkAttachments(attachments []*trello.Attachment) []*trello.Attachment {
+	var links []*trello.Attachment
+	for _, attachment := range attachments {
+		if attachment.IsUpload || len(attachment.URL) == 0 || strings.HasPrefix(attachment.URL, "https://trello.com/") {
+			continue
+		}
+		links = append(links, attachment)
+	}
+	return links
+}
+
+func checkCardLinks(list *trello.List, card *trello.Card, label *trello.Label, now time.Time, policy linkCheckPolicy) {
+	audit := auditRecord{
+		Timestamp: now,
+		Pass:      "linkcheck",
+		CardID:    card.ID,
+		CardName:  card.Name,
+		ListID:    list.ID,
+		ListName:  list.Name,
+	}
+	if label != nil && containsString(card.IDLabels, label.ID) {
+		audit.Decision = auditDecisionSkip
+		audit.Rule = "already labeled"
+		policy.audit.write(audit)
+		return
+	}
+	attachments, err := card.GetAttachments(trello.Defaults())
+	if err != nil {
+		log.Printf("Can't fetch attachments of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+		return
+	}
+	deadURL := ""
+	for _, attachment := range externalLinkAttachments(attachments) {
+		dead, err := isDeadLink(attachment.URL)
+		if err != nil {
+			log.Printf("Can't check link %v of card \"%v\" (%v): %v\n", attachment.URL, card.Name, card.ID, err)
+			continue
+		}
+		if dead {
+			deadURL = attachment.URL
+			break
+		}
+	}
+	if len(deadURL) == 0 {
+		audit.Decision = auditDecisionSkip
+		audit.Rule = "no dead links"
+		policy.audit.write(audit)
+		return
+	}
+	audit.Rule = "dead attachment link " + deadURL
+	if len(policy.reviewListID) > 0 {
+		if err := card.MoveToList(policy.reviewListID); err != nil {
+			log.Printf("Failed to move card \"%v\" (%v) to list %v: %v\n", card.Name, card.ID, policy.reviewListID, err)
+			audit.Decision = auditDecisionError
+			audit.Detail = err.Error()
+			policy.audit.write(audit)
+			return
+		}
+		log.Printf("Moved card \"%v\" (%v) to review list %v: %s\n", card.Name, card.ID, policy.reviewListID, audit.Rule)
+		policy.journal.record(journalEntry{
+			Timestamp:     now,
+			Action:        journalActionMoveToList,
+			CardID:        card.ID,
+			CardName:      card.Name,
+			BoardID:       list.IDBoard,
+			ListID:        list.ID,
+			ListName:      list.Name,
+			Reason:        audit.Rule,
+			TargetBoardID: list.IDBoard,
+			TargetListID:  policy.reviewListID,
+		})
+		audit.Decision = auditDecisionMoveToList
+		policy.audit.write(audit)
+		return
+	}
+	if err := card.AddIDLabel(label.ID); err != nil {
+		log.Printf("Failed to label card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+		audit.Decision = auditDecisionError
+		audit.Detail = err.Error()
+		policy.audit.write(audit)
+		return
+	}
+	log.Printf("Labeled card \"%v\" (%v) with %v: %s\n", card.Name, card.ID, label.Name, audit.Rule)
+	audit.Decision = auditDecisionLabel
+	audit.Detail = label.Name
+	policy.audit.write(audit)
+}
+
+// Checks the link attachments of all of the cards of the lists
+func checkListsForDeadLinks(ctx context.Context, client *trello.Client, commaSepListId string, policy linkCheckPolicy) {
+	processLists(ctx, commaSepListId, "dead links", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		list := trelloops.FetchList(listClient(ctx, client), listId)
+		var label *trello.Label
+		if len(policy.reviewListID) == 0 {
+			var err error
+			label, err = findOrCreateBoardLabel(client, list.IDBoard, policy.labelName, "red")
+			if err != nil {
+				log.Printf("Dead links of the list %v are not checked: %v\n", list.Name, err)
+				return
+			}
+		}
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		now := time.Now()
+		var cardsWg sync.WaitGroup
+		var panics cardPanics
+		slots := make(chan struct{}, linkCheckConcurrency)
+		for _, card := range cards {
+			cardsWg.Add(1)
+			slots <- struct{}{}
+			go func(card *trello.Card) {
+				defer cardsWg.Done()
+				defer func() { <-slots }()
+				defer panics.catch()
+				checkCardLinks(list, card, label, now, policy)
+			}(card)
+		}
+		cardsWg.Wait()
+		panics.rethrow()
+		log.Printf("List %v checked for dead links\n", list.Name)
+	})
+}
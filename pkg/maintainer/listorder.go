@@ -0,0 +1,122 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adlio/trello"
+)
+
+const TRELLO_LIST_ORDER_BOARDS_ENV = "TRELLO_LIST_ORDER_BOARDS"
+
+type listOrderStrategyEnum int32
+
+const (
+	// the configured list names first, in their order
+	listOrderStrategyNames listOrderStrategyEnum = iota + 1
+	listOrderStrategyAlphabetical
+	// the oldest list first
+	listOrderStrategyCreated
+)
+
+// The order of the lists of the board
+type listOrderSpec struct {
+	boardID  string
+	strategy listOrderStrategyEnum
+	names    []string
+}
+
+// Parses "boardId:alphabetical", "boardId:created" or "boardId:Intake|Candidates|Resolved"
+func parseListOrderSpec(spec string) (listOrderSpec, error) {
+	boardID, order, found := strings.Cut(strings.TrimSpace(spec), ":")
+	if !found || len(boardID) == 0 || len(order) == 0 {
+		return listOrderSpec{}, fmt.Errorf("expected \"boardId:order\", got \"%s\"", spec)
+	}
+	result := listOrderSpec{boardID: boardID}
+	switch order {
+	case "alphabetical":
+		result.strategy = listOrderStrategyAlphabetical
+	case "created":
+		result.strategy = listOrderStrategyCreated
+	default:
+		result.strategy = listOrderStrategyNames
+		for _, name := range strings.Split(order, "|") {
+			result.names = append(result.names, strings.TrimSpace(name))
+		}
+	}
+	return result, nil
+}
+
+// Sorts the lists (ordered by their current positions) as the spec says. The sort is stable,
+// so the lists not named by the configured order keep their relative order after the named ones
+func (s listOrderSpec) sort(lists []*trello.List) {
+	rank := func(list *trello.List) int {
+		for i, name := range s.names {
+			if strings.EqualFold(name, list.Name) {
+				return i
+			}
+		}
+		return len(s.names)
+	}
+	sort.SliceStable(lists, func(i, j int) bool {
+		a, b := lists[i], lists[j]
+		switch s.strategy {
+		case listOrderStrategyAlphabetical:
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		case listOrderStrategyCreated:
+			createdA, _ := trello.IDToTime(a.ID)
+			createdB, _ := trello.IDToTime(b.ID)
+			return createdA.Before(createdB)
+		default:
+			return rank(a) < rank(b)
+		}
+	})
+}
+
+// Keeps the open lists of the boards in the configured order, rewriting the list positions to even spacing when the lists are out of it
+func orderBoardsLists(client *trello.Client, commaSepSpecs string) {
+	for _, rawSpec := range strings.Split(commaSepSpecs, ",") {
+		spec, err := parseListOrderSpec(rawSpec)
+		if err != nil {
+			log.Panicf("Invalid list order spec %v: %v", rawSpec, err)
+		}
+		board := &trello.Board{ID: spec.boardID}
+		board.SetClient(client)
+		lists, err := board.GetLists(trello.Arguments{"filter": "open"})
+		if err != nil {
+			log.Printf("Lists of the board %v are not ordered: %v\n", spec.boardID, err)
+			continue
+		}
+		sort.SliceStable(lists, func(i, j int) bool { return lists[i].Pos < lists[j].Pos })
+		ordered := make([]*trello.List, len(lists))
+		copy(ordered, lists)
+		spec.sort(ordered)
+		inOrder := true
+		for i := range lists {
+			if lists[i] != ordered[i] {
+				inOrder = false
+				break
+			}
+		}
+		if inOrder {
+			log.Printf("Lists of the board %v are in order\n", spec.boardID)
+			continue
+		}
+		moved := 0
+		for i, list := range ordered {
+			newPos := float64(i+1) * evenPositionSpacing
+			if float64(list.Pos) == newPos {
+				continue
+			}
+			if err := list.Update(trello.Arguments{"pos": strconv.FormatFloat(newPos, 'f', -1, 64)}); err != nil {
+				log.Printf("Failed to change pos of list %v (%v): %v\n", list.Name, list.ID, err)
+				continue
+			}
+			moved++
+		}
+		log.Printf("Lists of the board %v are reordered, %d of %d lists moved\n", spec.boardID, moved, len(lists))
+	}
+}
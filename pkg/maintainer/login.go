@@ -0,0 +1,191 @@
+package maintainer
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const trelloAuthorizeURL = "https://trello.com/1/authorize"
+
+// Served at the return URL. Trello passes the token in the URL fragment, which only the browser sees, so the page posts it back
+var loginCallbackPage = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html><head><title>TrelloBoardMaintainer login</title></head>
+<body><p id="status">Saving the token...</p>
+<script>
+var token = new URLSearchParams(window.location.hash.substring(1)).get("token");
+var status = document.getElementById("status");
+if (!token) {
+	status.textContent = "Trello didn't return the token, the authorization was probably denied.";
+} else {
+	fetch({{.}}, {method: "POST", body: token}).then(function (resp) {
+		status.textContent = resp.ok ? "Done, you can close this page." : "Failed to save the token, see the terminal.";
+	});
+}
+</script></body></html>
+`))
+
+// Walks the user through the Trello authorization of the bot and writes the key and the token to the env file
+func runLogin(args []string) {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	key := flags.String("key", extractSecretEnvOrDefault(TRELLO_KEY_ENV, ""), "Trello API key (https://trello.com/app-key)")
+	out := flags.String("out", "trello.env", "env file to write TRELLO_KEY and TRELLO_TOKEN to")
+	name := flags.String("name", "TrelloBoardMaintainer", "application name shown on the Trello authorization page")
+	expiration := flags.String("expiration", "never", "token lifetime: 1hour, 1day, 30days or never")
+	listen := flags.String("listen", "127.0.0.1:0", "local address receiving the token from the browser")
+	manual := flags.Bool("manual", false, "paste the token shown by Trello instead of receiving it on the local address")
+	flags.Parse(args)
+	if len(*key) == 0 {
+		log.Fatalf("ERROR: the API key is required. Get it at https://trello.com/app-key and pass it with -key or %s\n", TRELLO_KEY_ENV)
+	}
+
+	authorize := url.Values{
+		"key":           {*key},
+		"name":          {*name},
+		"expiration":    {*expiration},
+		"scope":         {"read,write"},
+		"response_type": {"token"},
+	}
+	var token string
+	if *manual {
+		fmt.Printf("Open the following page, allow the access and paste the token Trello shows:\n\n%s?%s\n\nToken: ", trelloAuthorizeURL, authorize.Encode())
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			log.Fatalf("ERROR: can't read the token: %v\n", err)
+		}
+		token = strings.TrimSpace(line)
+	} else {
+		var err error
+		token, err = receiveLoginToken(*listen, authorize)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+	}
+
+	client := newTrelloClient(*key, token)
+	member, err := client.GetMember("me", trello.Arguments{"fields": "username,fullName"})
+	if err != nil {
+		log.Fatalf("ERROR: the token doesn't work: %v\n", trelloops.RedactCredentials(err.Error()))
+	}
+	if err := writeEnvFile(*out, map[string]string{TRELLO_KEY_ENV: *key, TRELLO_TOKEN_ENV: token}); err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	log.Printf("The bot acts as %s (@%s). The credentials are written to %s, e.g. for docker run --env-file\n", member.FullName, member.Username, *out)
+}
+
+// Serves the return URL of the authorization on the local address and waits for the browser to post the token back
+func receiveLoginToken(listen string, authorize url.Values) (string, error) {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return "", fmt.Errorf("can't listen on %v: %w", listen, err)
+	}
+	defer listener.Close()
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	// the random path keeps other local pages from posting a token of their own
+	callbackPath := "/callback/" + hex.EncodeToString(nonce)
+	authorize.Set("return_url", "http://"+listener.Addr().String()+callbackPath)
+	authorize.Set("callback_method", "fragment")
+
+	tokens := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			loginCallbackPage.Execute(w, callbackPath)
+		case http.MethodPost:
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1024))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			select {
+			case tokens <- strings.TrimSpace(string(body)):
+			default:
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authorizeURL := trelloAuthorizeURL + "?" + authorize.Encode()
+	fmt.Printf("Open the following page and allow the access (the browser should open it by itself):\n\n%s\n\n", authorizeURL)
+	openBrowser(authorizeURL)
+	select {
+	case token := <-tokens:
+		return token, nil
+	case <-time.After(10 * time.Minute):
+		return "", fmt.Errorf("no token received in 10 minutes. Use -manual if the browser runs on another machine")
+	}
+}
+
+func openBrowser(target string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("Can't open the browser: %v\n", err)
+	}
+}
+
+// Sets the variables of the KEY=value env file keeping its other lines. The file is readable by the owner only
+func writeEnvFile(path string, values map[string]string) error {
+	var lines []string
+	if data, err := os.ReadFile(path); err == nil {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("can't read env file %v: %w", path, err)
+	}
+	written := make(map[string]bool)
+	for i, line := range lines {
+		name, _, found := strings.Cut(line, "=")
+		if value, set := values[strings.TrimSpace(name)]; found && set {
+			lines[i] = strings.TrimSpace(name) + "=" + value
+			written[strings.TrimSpace(name)] = true
+		}
+	}
+	var missing []string
+	for name := range values {
+		if !written[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		lines = append(lines, name+"="+values[name])
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		return fmt.Errorf("can't write env file %v: %w", path, err)
+	}
+	// WriteFile keeps the mode of the existing file
+	return os.Chmod(path, 0o600)
+}
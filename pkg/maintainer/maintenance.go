@@ -0,0 +1,1334 @@
+package maintainer
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TRELLO_KEY_ENV = "TRELLO_KEY"
+const TRELLO_TOKEN_ENV = "TRELLO_TOKEN"
+const TRELLO_DELETE_LISTS_ENV = "TRELLO_DELETE_LISTS"
+const TRELLO_ARCHIVES_LISTS_ENV = "TRELLO_ARCHIVE_LISTS"
+const TRELLO_REORDER_LISTS_ENV = "TRELLO_REORDER_LISTS"
+const TRELLO_MOVE_LISTS_ENV = "TRELLO_MOVE_LISTS"
+const TRELLO_MOVE_TARGET_BOARD_ENV = "TRELLO_MOVE_TARGET_BOARD"
+const TRELLO_MOVE_TARGET_LIST_ENV = "TRELLO_MOVE_TARGET_LIST"
+const TRELLO_ARCHIVE_BOARDS_ENV = "TRELLO_ARCHIVE_BOARDS"
+const TRELLO_REORDER_BOARDS_ENV = "TRELLO_REORDER_BOARDS"
+const CARD_INACTIVITY_THRESHOLD_HOURS_ENV = "CARD_INACTIVITY_THRESHOLD_HOURS"
+const ARCHIVE_AUDIT_COMMENT_ENV = "ARCHIVE_AUDIT_COMMENT"
+const STALENESS_DUE_DATE_ENV = "STALENESS_DUE_DATE"
+const PROTECT_ENGAGED_CARDS_ENV = "PROTECT_ENGAGED_CARDS"
+
+// The invalid configuration found by the env helpers. They panic with it instead of exiting,
+// so that runMaintenance returns it (e.g. to the control API) and Main exits with it as before
+type configError struct {
+	message string
+}
+
+func (e configError) Error() string {
+	return e.message
+}
+
+func configFatalf(format string, a ...interface{}) {
+	panic(configError{message: fmt.Sprintf(format, a...)})
+}
+
+// Deferred by the function returning the configError panic as *err, the other panics go on
+func recoverConfigError(err *error) {
+	if r := recover(); r != nil {
+		cfgErr, ok := r.(configError)
+		if !ok {
+			panic(r)
+		}
+		*err = cfgErr
+	}
+}
+
+// Deferred by Main: exits on the configError panic the way the env helpers did
+func exitOnConfigError() {
+	if r := recover(); r != nil {
+		if cfgErr, ok := r.(configError); ok {
+			log.Fatalf("ERROR: %v\n", cfgErr)
+		}
+		panic(r)
+	}
+}
+
+func extractEnvOrExit(envKey string) string {
+	data, defined := os.LookupEnv(envKey)
+	if !defined {
+		configFatalf("\"%s\" env var is not defined", envKey)
+	}
+	return data
+}
+
+func extractEnvOrDefault(envKey string, defaultVal string) string {
+	data, defined := os.LookupEnv(envKey)
+	if !defined {
+		return defaultVal
+	}
+	return data
+}
+
+// Parses boolean env var ("true", "1", "false", etc.). Panics with configError if the value can't be parsed
+func extractBoolEnvOrDefault(envKey string, defaultVal bool) bool {
+	data, defined := os.LookupEnv(envKey)
+	if !defined {
+		return defaultVal
+	}
+	val, err := strconv.ParseBool(data)
+	if err != nil {
+		configFatalf("can't parse \"%s\" env var as boolean. String: %s", envKey, data)
+	}
+	return val
+}
+
+// Parses float env var. Panics with configError if the value can't be parsed
+func extractFloatEnvOrDefault(envKey string, defaultVal float64) float64 {
+	data, defined := os.LookupEnv(envKey)
+	if !defined {
+		return defaultVal
+	}
+	val, err := strconv.ParseFloat(data, 64)
+	if err != nil {
+		configFatalf("can't parse \"%s\" env var as number. String: %s", envKey, data)
+	}
+	return val
+}
+
+// Parses integer env var. Panics with configError if the value can't be parsed
+func extractIntEnvOrDefault(envKey string, defaultVal int) int {
+	data, defined := os.LookupEnv(envKey)
+	if !defined {
+		return defaultVal
+	}
+	val, err := strconv.Atoi(data)
+	if err != nil {
+		configFatalf("can't parse \"%s\" env var as integer. String: %s", envKey, data)
+	}
+	return val
+}
+
+type staleCardActionEnum int32
+
+const (
+	staleCardActionDelete staleCardActionEnum = iota + 1
+	staleCardActionArchive
+	staleCardActionMoveToBoard
+)
+
+// What to do with the stale card.
+// targetBoardID and targetListID are used only by staleCardActionMoveToBoard.
+// backup (if set) receives the full card copy before it is deleted.
+// journal (if set) records the performed actions, audit (if set) records all of the decisions.
+// auditComment enables the explanation comment posted to the card before archiving.
+// activity defines which card actions reset the staleness clock.
+// calendar (if set) excludes weekends and holidays from the inactivity time.
+// coverColors (if set) colors the covers of not yet stale cards by their inactivity, covers holds the current covers of the list cards.
+// staleDueDate sets the due date of not yet stale cards to the moment they become stale.
+// plan (if set) collects the actions instead of performing them, confirm (if set) asks the operator before each of them.
+// scrubber (if set) removes the personal data from the card before it is archived, closing (if set) ticks its closing checklist item.
+// protectEngaged keeps the stale cards with votes or watched by the bot account.
+// checklists extends the threshold of the cards with unfinished checklists or keeps them.
+// incremental (if set) keeps the verdicts of the unchanged cards from the last run without fetching their actions,
+// activityCache (if set) keeps the latest activity times of the unchanged cards across the runs.
+// gateway performs the list and card operations of the pass, the card spans are derived from the context of client (if set)
+type staleCardPolicy struct {
+	action         staleCardActionEnum
+	targetBoardID  string
+	targetListID   string
+	backup         cardBackupStorage
+	journal        *runJournal
+	audit          *auditLog
+	auditComment   bool
+	activity       activityFilter
+	calendar       *businessCalendar
+	coverColors    *coverColorScheme
+	covers         map[string]trelloops.CardCover
+	client         *trello.Client
+	gateway        trelloops.TrelloGateway
+	staleDueDate   bool
+	plan           *actionPlan
+	confirm        *operatorConfirmation
+	scrubber       *piiScrubber
+	closing        *archiveChecklist
+	protectEngaged bool
+	checklists     checklistPolicy
+	incremental    *incrementalState
+	activityCache  *activityCache
+}
+
+// Why the card is protected from the stale card actions by the engagement of the members, or empty string if it isn't.
+// Trello API exposes only whether the card is watched by the member of the token, not by the others
+func engagementProtection(card *trello.Card) string {
+	switch {
+	case card.Badges.Votes > 0:
+		return fmt.Sprintf("the card has %d votes", card.Badges.Votes)
+	case card.Subscribed:
+		return "the card is watched"
+	default:
+		return ""
+	}
+}
+
+// How long the card has been inactive according to the policy
+func (p *staleCardPolicy) inactiveFor(lastActivity time.Time, now time.Time) time.Duration {
+	if p.calendar != nil {
+		return p.calendar.businessDuration(lastActivity, now)
+	}
+	return now.Sub(lastActivity)
+}
+
+// Identifies the activity filter and the calendar of the policy in the incremental verdicts
+func (p *staleCardPolicy) verdictFingerprint() string {
+	return p.activity.fingerprint() + "|" + p.calendar.fingerprint()
+}
+
+// When the card with the given last activity becomes stale
+func (p *staleCardPolicy) staleAt(lastActivity time.Time, threshold time.Duration) time.Time {
+	if p.calendar != nil {
+		return p.calendar.addBusinessDuration(lastActivity, threshold)
+	}
+	return lastActivity.Add(threshold)
+}
+
+// Sets the due date of the card to the moment it becomes stale (unless it is already set to it)
+func updateCardStaleDueDate(gateway trelloops.TrelloGateway, card *trello.Card, staleAt time.Time) {
+	if card.Due != nil && card.Due.Sub(staleAt).Abs() < time.Minute {
+		return
+	}
+	if err := gateway.SetCardDue(card, staleAt); err != nil {
+		log.Printf("Failed to set due date of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+		return
+	}
+	log.Printf("Due date of card \"%v\" (%v) set to %v\n", card.Name, card.ID, staleAt)
+}
+
+// Formats the duration as whole days (or hours for durations shorter than 2 days)
+func humanizeDuration(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	}
+	return fmt.Sprintf("%d hours", int(d.Hours()))
+}
+
+// The time of the latest card action counted as activity and all of the actions counted.
+// The card is never considered inactive since before its creation, so the card without the counted actions is inactive since its last activity,
+// or since its creation if the comments of the members not counted are among its actions (they are the last activity then)
+func cardLastActivity(gateway trelloops.TrelloGateway, list *trello.List, card *trello.Card, activity activityFilter) (time.Time, []*trello.Action) {
+	latestActionTime := card.CreatedAt()
+	var matched []*trello.Action
+
+	actions, err := gateway.GetCardActions(card, trello.Arguments{"filter": activity.apiFilter()})
+	if err != nil {
+		log.Panicf("Error during fetching card %v action: %v\n", card.Name, err)
+	}
+
+	// the creation action found though the list counts regardless of the filter
+	creation := false
+	commentsRejected := false
+	if actions.Len() == 0 {
+		// looking for card creation action though list
+
+		// log.Printf("Card %v(%v) has no actions. Trying find them though board actions\n", card.Name, card.ID)
+		var args trello.Arguments = make(trello.Arguments)
+		args["filter"] = "createCard"
+		args["idModels"] = card.ID
+		actions, err = gateway.GetListActions(list, args)
+
+		if err != nil {
+			log.Panicf("Error during fetching card %v board action: %v\n", card.Name, err)
+		}
+		creation = true
+		// log.Printf("Got %d actions for card %v via list query", len(actions), card.Name)
+	}
+
+	for _, action := range actions {
+		if action.Data.Card.ID != card.ID {
+			log.Printf("skipping action for card %v, as it is not related to card %v\n", action.Data.Card.ID, card.ID)
+			continue
+		}
+		if !creation && !activity.matches(action) {
+			commentsRejected = commentsRejected || activity.rejectsCommentAuthor(action)
+			log.Printf("card %v skipping action %v\n", card.Name, action.Type)
+			continue
+		}
+
+		matched = append(matched, action)
+		curActDate := action.Date
+		if latestActionTime.Before(curActDate) {
+			latestActionTime = curActDate
+		}
+	}
+	if len(matched) == 0 {
+		log.Printf("Card %v(%v) has no actions counted as activity\n", card.Name, card.ID)
+		if !commentsRejected && card.DateLastActivity != nil && latestActionTime.Before(*card.DateLastActivity) {
+			latestActionTime = *card.DateLastActivity
+		}
+	}
+	return latestActionTime, matched
+}
+
+func checkCardForStaleness(ctx context.Context, list *trello.List, card *trello.Card, inactivityTimeSpan time.Duration, now time.Time, policy staleCardPolicy) {
+	defer consoleProgress.cardDone()
+	ctx, span := tracer.Start(ctx, "card staleness", cardSpanAttributes(card.ID, card.Name))
+	defer span.End()
+	policy.gateway = policy.gateway.WithContext(ctx)
+	if policy.client != nil {
+		card.SetClient(policy.client.WithContext(ctx))
+	}
+	var thresholdExtension string
+	if extended := policy.checklists.threshold(card, inactivityTimeSpan); extended != inactivityTimeSpan {
+		thresholdExtension = "threshold extended as " + incompleteChecklist(card)
+		inactivityTimeSpan = extended
+	}
+	var latestActionTime time.Time
+	verdict, unchanged := policy.incremental.unchangedVerdict(card, inactivityTimeSpan, policy.verdictFingerprint(), now)
+	if unchanged {
+		latestActionTime = verdict.LastActivity
+	} else {
+		latestActionTime = cachedCardLastActivity(policy.activityCache, policy.gateway, list, card, policy.activity, now)
+	}
+
+	elapsed := policy.inactiveFor(latestActionTime, now)
+	audit := auditRecord{
+		Timestamp:    now,
+		Pass:         "staleness",
+		CardID:       card.ID,
+		CardName:     card.Name,
+		ListID:       list.ID,
+		ListName:     list.Name,
+		LastActivity: &latestActionTime,
+		InactiveFor:  elapsed.Round(time.Second).String(),
+		Threshold:    inactivityTimeSpan.String(),
+		Detail:       thresholdExtension,
+	}
+	if elapsed <= inactivityTimeSpan {
+		audit.Decision = auditDecisionSkip
+		audit.Rule = "not stale"
+		if unchanged {
+			audit.Detail = "unchanged since the last run"
+		}
+		policy.audit.write(audit)
+		var activityBefore time.Time
+		if card.DateLastActivity != nil {
+			activityBefore = *card.DateLastActivity
+		}
+		if policy.staleDueDate {
+			updateCardStaleDueDate(policy.gateway, card, policy.staleAt(latestActionTime, inactivityTimeSpan))
+		}
+		if policy.coverColors != nil {
+			updateCardCoverColor(policy.gateway, policy.coverColors, card, policy.covers[card.ID], float64(elapsed), float64(inactivityTimeSpan))
+		}
+		// the own updates move the card last activity, the caches are keyed on the moved one so that the card isn't seen as changed next run
+		if card.DateLastActivity != nil && !card.DateLastActivity.Equal(activityBefore) {
+			policy.activityCache.put(card, policy.activity.fingerprint(), latestActionTime, now)
+		}
+		verdict := stalenessVerdict{
+			LastActivity: latestActionTime,
+			Threshold:    inactivityTimeSpan,
+			StaleAt:      policy.staleAt(latestActionTime, inactivityTimeSpan),
+			Fingerprint:  policy.verdictFingerprint(),
+		}
+		if card.DateLastActivity != nil {
+			verdict.DateLastActivity = *card.DateLastActivity
+		}
+		policy.incremental.record(card.ID, verdict)
+		return
+	}
+
+	if policy.protectEngaged {
+		if why := engagementProtection(card); len(why) > 0 {
+			log.Printf("Card \"%v\" (%v) is stale but protected: %s\n", card.Name, card.ID, why)
+			audit.Decision = auditDecisionSkip
+			audit.Rule = "protected by engagement"
+			audit.Detail = why
+			policy.audit.write(audit)
+			return
+		}
+	}
+	if why := policy.checklists.protection(card); len(why) > 0 {
+		log.Printf("Card \"%v\" (%v) is stale but protected: %s\n", card.Name, card.ID, why)
+		audit.Decision = auditDecisionSkip
+		audit.Rule = "protected by incomplete checklist"
+		audit.Detail = why
+		policy.audit.write(audit)
+		return
+	}
+	log.Printf("Card \"%v\" (%v) is due to stale action as last activity was %v ago\n", card.Name, card.ID, elapsed)
+	audit.Rule = "inactivity threshold exceeded"
+	entry := journalEntry{
+		Timestamp: now,
+		CardID:    card.ID,
+		CardName:  card.Name,
+		BoardID:   list.IDBoard,
+		ListID:    list.ID,
+		ListName:  list.Name,
+		Reason:    fmt.Sprintf("no activity for %v (threshold %v)", elapsed.Round(time.Minute), inactivityTimeSpan),
+	}
+	var comment string
+	switch policy.action {
+	case staleCardActionDelete:
+		entry.Action = journalActionDelete
+	case staleCardActionArchive:
+		entry.Action = journalActionArchive
+		if policy.auditComment {
+			comment = renderMessage(messageStaleArchive, map[string]interface{}{"Card": card, "Idle": elapsed, "Threshold": inactivityTimeSpan})
+		}
+	case staleCardActionMoveToBoard:
+		entry.Action = journalActionMoveToBoard
+		entry.TargetBoardID = policy.targetBoardID
+		entry.TargetListID = policy.targetListID
+	default:
+		log.Panicf("Unsupported stale card action: %v", policy.action)
+	}
+	if policy.plan != nil {
+		policy.plan.add(entry, card, comment)
+		return
+	}
+	if !policy.confirm.approve(fmt.Sprintf("%v card \"%v\" (%v) of the list %v: %s", entry.Action, card.Name, card.ID, list.Name, entry.Reason)) {
+		audit.Decision = auditDecisionSkip
+		audit.Detail = "declined by the operator"
+		policy.audit.write(audit)
+		return
+	}
+	if err := performStaleAction(policy.gateway, list, card, entry, comment, policy.backup, policy.scrubber, policy.closing); err != nil {
+		log.Printf("%v\n", err)
+		audit.Decision = auditDecisionError
+		audit.Detail = err.Error()
+		policy.audit.write(audit)
+		return
+	}
+	audit.Decision = staleActionAuditDecision(entry.Action)
+	policy.journal.record(entry)
+	policy.audit.write(audit)
+}
+
+// Deletes (after the backup, if set), archives (after scrubbing the personal data, posting the comment and ticking the closing checklist item, if set)
+// or moves the stale card as the entry says
+func performStaleAction(gateway trelloops.TrelloGateway, list *trello.List, card *trello.Card, entry journalEntry, comment string, backup cardBackupStorage, scrubber *piiScrubber, closing *archiveChecklist) error {
+	switch entry.Action {
+	case journalActionDelete:
+		if backup != nil {
+			if err := backupCard(gateway, backup, list, card, entry.Timestamp); err != nil {
+				return fmt.Errorf("Card \"%v\" (%v) is NOT deleted as its backup failed: %w", card.Name, card.ID, err)
+			}
+		}
+		if err := gateway.DeleteCard(card); err != nil {
+			return fmt.Errorf("Failed to delete card \"%v\" (%v): %w", card.Name, card.ID, err)
+		}
+	case journalActionArchive:
+		if err := scrubber.scrubCard(gateway, card); err != nil {
+			return fmt.Errorf("Card \"%v\" (%v) is NOT archived as its personal data scrubbing failed: %w", card.Name, card.ID, err)
+		}
+		if len(comment) > 0 {
+			if err := gateway.AddComment(card, comment); err != nil {
+				log.Printf("Failed to post audit comment to card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+			}
+		}
+		if err := closing.close(gateway, card); err != nil {
+			log.Printf("Failed to tick the closing checklist item of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+		}
+		if err := gateway.ArchiveCard(card); err != nil {
+			return fmt.Errorf("Failed to archive card \"%v\" (%v): %w", card.Name, card.ID, err)
+		}
+	case journalActionMoveToBoard:
+		if err := gateway.MoveCardToBoard(card, entry.TargetBoardID, entry.TargetListID); err != nil {
+			return fmt.Errorf("Failed to move card \"%v\" (%v) to board %v: %w", card.Name, card.ID, entry.TargetBoardID, err)
+		}
+	default:
+		return fmt.Errorf("unsupported stale card action %v", entry.Action)
+	}
+	return nil
+}
+
+func staleActionAuditDecision(action journalActionType) auditDecision {
+	switch action {
+	case journalActionDelete:
+		return auditDecisionDelete
+	case journalActionMoveToBoard:
+		return auditDecisionMove
+	default:
+		return auditDecisionArchive
+	}
+}
+
+// Splits the "commaSepListId" by comma to get list ids.
+// For each listId applies listAction as gorotine.
+// Waits until all of the lists processing complete.
+// A panic of the list processing is re-raised in the calling goroutine, so that the caller may recover from it.
+// The processing and each of the lists are traced as the spans, listAction gets the context of its list span
+func processLists(ctx context.Context, commaSepListId string, processingDescription string, listAction func(ctx context.Context, listId string, wg *sync.WaitGroup)) {
+	ctx, span := tracer.Start(ctx, processingDescription)
+	defer span.End()
+	var wg sync.WaitGroup
+	var panicOnce sync.Once
+	var listPanic interface{}
+
+	listIdsSplit := strings.Split(commaSepListId, ",")
+	var N = len(listIdsSplit)
+
+	log.Printf("%d lists to check for %s...\n", N, processingDescription)
+	consoleProgress.startPass(processingDescription, N)
+	wg.Add(N)
+	for _, listId := range listIdsSplit {
+		go func(listId string) {
+			defer wg.Done()
+			defer consoleProgress.listDone()
+			listCtx, listSpan := tracer.Start(withNextListClient(ctx), "list", trace.WithAttributes(attribute.String("trello.list.spec", listId)))
+			defer listSpan.End()
+			defer func() {
+				if r := recover(); r != nil {
+					listSpan.SetStatus(codes.Error, fmt.Sprint(r))
+					panicOnce.Do(func() { listPanic = r })
+				}
+			}()
+			// the list actions complete synchronously, their own wait group only keeps the signature
+			var listWg sync.WaitGroup
+			listWg.Add(1)
+			listAction(listCtx, listId, &listWg)
+		}(listId)
+		//go checkListForStaleCards(listId, &wg, staleCardActionArchive)
+	}
+	wg.Wait()
+	if listPanic != nil {
+		panic(listPanic)
+	}
+	log.Printf("Done with %s\n", processingDescription)
+}
+
+// The first panic of the card goroutines of a list. The goroutines recover into it and the list goroutine panics with it
+// once they are done, so that the failed card fails its list (see processLists) rather than the whole process
+type cardPanics struct {
+	once  sync.Once
+	value interface{}
+}
+
+// Deferred by the card goroutine before its wait group is done
+func (p *cardPanics) catch() {
+	if r := recover(); r != nil {
+		p.once.Do(func() { p.value = r })
+	}
+}
+
+// Called by the list goroutine after the card goroutines are done
+func (p *cardPanics) rethrow() {
+	if p.value != nil {
+		panic(p.value)
+	}
+}
+
+// Runs the command line: performs the maintenance or one of the commands (restore, history, plan, ...).
+// args are the command line arguments without the program name
+func Main(args []string) {
+	if len(args) == 1 && (args[0] == "--version" || args[0] == "-version") {
+		fmt.Println(versionString())
+		return
+	}
+	log.Println(versionString())
+	applyBoardTimezoneFromEnv()
+	defer setupTracingFromEnv()()
+	defer setupErrorReportingFromEnv()()
+	defer reportPanic()
+	defer exitOnConfigError()
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "restore":
+			runRestore(args[1:])
+		case "history":
+			runHistory(args[1:])
+		case "migrate-similarity":
+			runMigrateSimilarity(args[1:])
+		case "consume":
+			runConsume(args[1:])
+		case "serve":
+			runServe(args[1:])
+		case "plan":
+			runPlan(args[1:])
+		case "apply":
+			runApply(args[1:])
+		case "report":
+			runReport(args[1:])
+		case "export":
+			runExport(args[1:])
+		case "validate":
+			runValidate(args[1:])
+		case "login":
+			runLogin(args[1:])
+		case "tui":
+			runTUI(args[1:])
+		case "bootstrap":
+			runBootstrap(args[1:])
+		default:
+			log.Fatalf("ERROR: unknown command \"%s\". Supported commands: restore, history, migrate-similarity, consume, serve, plan, apply, report, export, validate, login, tui, bootstrap. Run without arguments (or with -interactive) to perform maintenance\n", args[0])
+		}
+		return
+	}
+	flags := flag.NewFlagSet("maintenance", flag.ExitOnError)
+	interactive := flags.Bool("interactive", false, "confirm each card archive, delete or move on the terminal")
+	var profiling runProfiles
+	flags.StringVar(&profiling.cpuPath, "cpuprofile", "", "write the CPU profile of the run to the file")
+	flags.StringVar(&profiling.heapPath, "memprofile", "", "write the heap profile at the end of the run to the file")
+	flags.Parse(args)
+	var options maintenanceOptions
+	if *interactive {
+		options.confirm = newTerminalConfirmation()
+	}
+
+	lock, err := acquireRunLockFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	defer lock.release()
+	profiling.start()
+	defer profiling.stop()
+	if err := runMaintenance(options); err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+}
+
+// How the maintenance run is performed, the zero value is the regular run
+type maintenanceOptions struct {
+	// collects the stale card actions instead of performing them, nothing is changed
+	plan *actionPlan
+	// collects the summary of the maintained lists instead of maintaining them, nothing is changed
+	report *boardReport
+	// asks the operator before each stale card action
+	confirm *operatorConfirmation
+	// receive the actions taken in addition to the sinks configured by env vars
+	sinks []actionSink
+	// counts the progress instead of the one PROGRESS configures (e.g. for the dashboard)
+	progress *progressReporter
+}
+
+// Performs the maintenance of all profiles. Returns the invalid configuration (including the one the env helpers find, see configError)
+// as the error instead of exiting, the failed passes still panic
+func runMaintenance(options maintenanceOptions) (err error) {
+	defer recoverConfigError(&err)
+	plan := options.plan
+	trelloAppKey := extractSecretEnvOrExit(TRELLO_KEY_ENV)
+	trelloToken := extractSecretEnvOrExit(TRELLO_TOKEN_ENV)
+	driftMinGap := extractFloatEnvOrDefault(POSITION_DRIFT_MIN_GAP_ENV, 0.01)
+	activity := activityFilterFromEnv()
+	log.Printf("Card actions counted as activity: %s\n", activity.apiFilter())
+	calendar, err := businessCalendarFromEnv()
+	if err != nil {
+		return fmt.Errorf("can't configure business days calendar: %v", err)
+	}
+	if calendar != nil {
+		log.Println("Only business days are counted towards card inactivity")
+	}
+	similarity, err := similaritySourceFromEnv()
+	if err != nil {
+		return err
+	}
+	scoring, err := orderScoringFromEnv()
+	if err != nil {
+		return err
+	}
+	tieBreak, err := tieBreakFromEnv()
+	if err != nil {
+		return err
+	}
+	coordinates, err := coordinatesSourceFromEnv()
+	if err != nil {
+		return err
+	}
+	mapProvider, err := parseMapProvider(extractEnvOrDefault(MAP_LINK_PROVIDER_ENV, "osm"))
+	if err != nil {
+		return err
+	}
+	referencePoint, err := referencePointFromEnv()
+	if err != nil {
+		return err
+	}
+	kashtanka, err := kashtankaClientFromEnv()
+	if err != nil {
+		return err
+	}
+	regions, err := regionResolverFromEnv()
+	if err != nil {
+		return err
+	}
+	if regions != nil {
+		log.Printf("Card regions are resolved with %s\n", regions.describe())
+	}
+	coverColors, err := coverColorSchemeFromEnv()
+	if err != nil {
+		return err
+	}
+	checklists, err := checklistPolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	profiles, err := maintenanceProfilesFromEnv()
+	if err != nil {
+		return err
+	}
+	if err := loadExemptCardIDs(); err != nil {
+		return err
+	}
+	if err := loadMessageTemplates(); err != nil {
+		return err
+	}
+	for _, profile := range profiles {
+		if err := profile.validate(); err != nil {
+			return fmt.Errorf("invalid profile \"%s\": %v\n", profile.name, err)
+		}
+		if err := profile.checkServices(kashtanka, regions, referencePoint); err != nil {
+			return err
+		}
+	}
+
+	ctx, span := tracer.Start(context.Background(), "maintenance run")
+	defer span.End()
+	if options.progress != nil {
+		consoleProgress = options.progress
+	} else {
+		consoleProgress = startProgressFromEnv()
+		defer consoleProgress.stop()
+	}
+	pool := trelloClientPoolFromEnv(trelloAppKey, trelloToken)
+	if len(pool.clients) > 1 {
+		log.Printf("The lists are spread across %d Trello tokens\n", len(pool.clients))
+	}
+	ctx = withTrelloClientPool(ctx, pool)
+	client := pool.clients[0].WithContext(ctx)
+	scrubber, err := piiScrubberFromEnv()
+	if err != nil {
+		return err
+	}
+	excludeNames, err := excludeCardNameRegexFromEnv()
+	if err != nil {
+		return err
+	}
+	labelCleanup, err := labelCleanupRegexFromEnv()
+	if err != nil {
+		return err
+	}
+	activityCache, err := openActivityCacheFromEnv()
+	if err != nil {
+		return err
+	}
+	defer activityCache.close()
+	if plan == nil && options.report == nil && extractBoolEnvOrDefault(PREFLIGHT_CHECK_ENV, true) {
+		// any of the tokens may get any of the lists
+		for i, tokenClient := range pool.clients {
+			if problems := preflightAccess(tokenClient.WithContext(ctx), profiles); len(problems) > 0 {
+				return fmt.Errorf("the token #%d can't maintain the configured boards:\n- %s", i+1, strings.Join(problems, "\n- "))
+			}
+		}
+	}
+
+	var currentRun *runJournal
+	var audit *auditLog
+	var summary *runSummary
+	var incremental *incrementalState
+	runStarted := time.Now()
+	statusCard := extractEnvOrDefault(STATUS_CARD_ENV, "")
+	statusList := extractEnvOrDefault(STATUS_LIST_ENV, "")
+	statsd, err := statsdEmitterFromEnv()
+	if err != nil {
+		return err
+	}
+	if plan == nil && options.report == nil {
+		incremental, err = openIncrementalStateFromEnv()
+		if err != nil {
+			return err
+		}
+		defer incremental.close()
+		journal, err := openActionJournalFromEnv()
+		if err != nil {
+			return err
+		}
+		if journal != nil {
+			defer journal.close()
+		}
+		sinks := options.sinks
+		// the journal keeps the number of errors of the run
+		if len(statusCard) > 0 || len(statusList) > 0 || statsd != nil || journal != nil {
+			summary = newRunSummary(time.Now())
+			sinks = append(sinks, summary)
+		}
+		currentRun, err = startRunFromEnv(journal, journalRunMaintenance, time.Now(), sinks...)
+		if err != nil {
+			return err
+		}
+		defer currentRun.close()
+		if journal != nil {
+			log.Printf("Actions are recorded to the journal as run %d\n", currentRun.run.ID)
+		}
+
+		audit, err = openAuditLogFromEnv()
+		if err != nil {
+			return err
+		}
+		defer audit.close()
+		if audit == nil && (summary != nil || errorReportingEnabled) {
+			audit = &auditLog{}
+		}
+		if summary != nil {
+			audit.summary = summary
+		}
+	}
+
+	run := maintenanceRun{
+		ctx:            ctx,
+		client:         client,
+		journal:        currentRun,
+		audit:          audit,
+		activity:       activity,
+		calendar:       calendar,
+		similarity:     similarity,
+		scoring:        scoring,
+		tieBreak:       tieBreak,
+		driftMinGap:    driftMinGap,
+		coverColors:    coverColors,
+		staleDueDate:   extractBoolEnvOrDefault(STALENESS_DUE_DATE_ENV, false),
+		protectEngaged: extractBoolEnvOrDefault(PROTECT_ENGAGED_CARDS_ENV, false),
+		checklists:     checklists,
+		coordinates:    coordinates,
+		mapProvider:    mapProvider,
+		referencePoint: referencePoint,
+		regions:        regions,
+		regionColor:    extractEnvOrDefault(REGION_LABEL_COLOR_ENV, "sky"),
+		kashtanka:      kashtanka,
+		plan:           plan,
+		report:         options.report,
+		confirm:        options.confirm,
+		statusList:     statusList,
+		scrubber:       scrubber,
+		closing:        archiveChecklistFromEnv(),
+		needsFixLabel:  extractEnvOrDefault(SIMILARITY_NEEDS_FIX_LABEL_ENV, ""),
+		labelCleanup:   labelCleanup,
+		excludeNames:   excludeNames,
+		incremental:    incremental,
+		activityCache:  activityCache,
+	}
+	for _, profile := range profiles {
+		if len(profiles) > 1 {
+			log.Printf("Maintaining profile \"%s\"\n", profile.name)
+		}
+		run.maintain(profile)
+	}
+	currentRun.finish(time.Now(), summary.errorCount())
+	if summary != nil && (len(statusCard) > 0 || len(statusList) > 0) {
+		postRunSummary(client, statusCard, statusList, summary, time.Now())
+	}
+	if statsd != nil {
+		if summary != nil {
+			statsd.emitRun(summary, time.Since(summary.startedAt))
+		}
+		statsd.close()
+	}
+	if incremental != nil {
+		// the run completed, its verdicts are the ones to trust next time
+		if err := incremental.commit(runStarted); err != nil {
+			log.Printf("Failed to save incremental state: %v\n", err)
+		}
+	}
+	trelloMetrics.logSummary()
+
+	log.Println("Done")
+	return nil
+}
+
+// Settings shared by all of the profiles of the maintenance run
+type maintenanceRun struct {
+	// context of the run span
+	ctx            context.Context
+	client         *trello.Client
+	journal        *runJournal
+	audit          *auditLog
+	activity       activityFilter
+	calendar       *businessCalendar
+	similarity     similaritySource
+	scoring        orderScoring
+	tieBreak       tieBreakEnum
+	driftMinGap    float64
+	coverColors    *coverColorScheme
+	staleDueDate   bool
+	protectEngaged bool
+	checklists     checklistPolicy
+	coordinates    coordinatesSource
+	mapProvider    mapProviderEnum
+	referencePoint *geoPoint
+	regions        regionResolver
+	regionColor    string
+	kashtanka      *kashtankaClient
+	plan           *actionPlan
+	report         *boardReport
+	confirm        *operatorConfirmation
+	statusList     string
+	scrubber       *piiScrubber
+	closing        *archiveChecklist
+	needsFixLabel  string
+	labelCleanup   *regexp.Regexp
+	excludeNames   *regexp.Regexp
+	incremental    *incrementalState
+	activityCache  *activityCache
+}
+
+// Reorder settings of the profile, the strategy is set per list
+func (r *maintenanceRun) reorderPolicy(profile maintenanceProfile) reorderPolicy {
+	return reorderPolicy{
+		journal:             r.journal,
+		audit:               r.audit,
+		similarity:          r.similarity,
+		scoring:             r.scoring,
+		tieBreak:            r.tieBreak,
+		driftMinGap:         r.driftMinGap,
+		maxCards:            profile.listMaxCards,
+		overflow:            profile.listOverflow,
+		minSimilarity:       profile.minSimilarity,
+		lowSimilarityListID: profile.lowSimilarityList,
+		archiveComment:      profile.archiveAuditComment,
+		coordinates:         r.coordinates,
+		referencePoint:      r.referencePoint,
+		scrubber:            r.scrubber,
+		closing:             r.closing,
+		needsFixLabelName:   r.needsFixLabel,
+		excludeNames:        r.excludeNames,
+		confirm:             r.confirm,
+	}
+}
+
+// Fetches the list of "listId[:strategy]" spec and its cards with everything the strategy needs
+// base.gateway performs the requests
+func fetchReorderList(listSpec string, base reorderPolicy) (*trello.List, []*trello.Card, reorderPolicy) {
+	listId, strategy, _ := parseReorderListSpec(listSpec)
+	gateway := base.gateway
+	list, err := gateway.GetList(listId)
+	if err != nil {
+		log.Panicf("Can't fetch list %v: %v", listId, err)
+	}
+	policy := base
+	policy.strategy = strategy
+	cardsArgs := trello.Defaults()
+	if strategy == reorderStrategySimilarity && len(policy.similarity.customFieldName) > 0 {
+		policy.similarity.boardCustomFields = fetchBoardCustomFields(gateway, list.IDBoard)
+		cardsArgs["customFieldItems"] = "true"
+	}
+	if strategy == reorderStrategyDistance && len(policy.coordinates.customFieldName) > 0 {
+		policy.coordinates.boardCustomFields = fetchBoardCustomFields(gateway, list.IDBoard)
+		cardsArgs["customFieldItems"] = "true"
+	}
+	policy.now = time.Now()
+	log.Printf("Querying cards of the list %v (%v)... \n", listId, list.Name)
+	cards, err := gateway.GetCards(list, cardsArgs)
+	if err != nil {
+		log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+	}
+	cards = withoutExcludedNames(list, withoutExemptCards(list, cards), policy.excludeNames)
+	log.Printf("The list %v contains %d cards\n", list.Name, len(cards))
+	return list, cards, policy
+}
+
+// Checks the cards of the list for staleness, policy.gateway performs the operations
+func checkListForStaleCards(ctx context.Context, listId string, threshold time.Duration, excludeNames *regexp.Regexp, policy staleCardPolicy) {
+	list, err := policy.gateway.GetList(listId)
+	if err != nil {
+		log.Panicf("Can't fetch list %v: %v", listId, err)
+	}
+	log.Printf("Querying cards of the list %v (%v)... \n", listId, list.Name)
+	cards, err := policy.gateway.GetCards(list, trello.Defaults())
+	if err != nil {
+		log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+	}
+	cards = withoutExcludedNames(list, withoutExemptCards(list, cards), excludeNames)
+	log.Printf("The list %v contains %d cards\n", list.Name, len(cards))
+	consoleProgress.addCards(list, len(cards))
+	if policy.coverColors != nil {
+		policy.covers, err = policy.gateway.GetListCardCovers(list)
+		if err != nil {
+			log.Printf("Can't fetch card covers of the list %v, cover colors are not updated: %v\n", list.Name, err)
+			policy.coverColors = nil
+		}
+	}
+
+	now := time.Now()
+
+	var archivalCheckWg sync.WaitGroup
+	var panics cardPanics
+	archivalCheckWg.Add(len(cards))
+	for _, card := range cards {
+		go func(card *trello.Card) {
+			defer archivalCheckWg.Done()
+			defer panics.catch()
+			checkCardForStaleness(ctx, list, card, threshold, now, policy)
+		}(card)
+	}
+	archivalCheckWg.Wait()
+	panics.rethrow()
+	log.Printf("List %v processed for stale cards", list.Name)
+}
+
+// Reorders the cards of the list of "listId[:strategy]" spec, base.gateway performs the operations.
+// base.client creates the similarity fix label and the overflow list, if they are configured
+func reorderList(ctx context.Context, listSpec string, base reorderPolicy) {
+	list, cards, policy := fetchReorderList(listSpec, base)
+	if policy.strategy == reorderStrategySimilarity && len(policy.needsFixLabelName) > 0 {
+		label, err := findOrCreateBoardLabel(policy.client, list.IDBoard, policy.needsFixLabelName, "orange")
+		if err != nil {
+			log.Printf("The cards of the list %v needing the similarity fix are not labeled: %v\n", list.Name, err)
+		}
+		policy.needsFixLabel = label
+	}
+	// the overflow lists themselves archive their extra cards
+	if policy.overflow && policy.maxCards > 0 && len(cards) > policy.maxCards && !strings.HasSuffix(list.Name, overflowListSuffix) {
+		overflow, err := findOrCreateOverflowList(policy.client, list)
+		if err != nil {
+			log.Panicf("Can't find the overflow list of %v: %v", list.Name, err)
+		}
+		policy.overflowListID = overflow.ID
+	}
+	plan := planListOrder(list, cards, &policy)
+	consoleProgress.addCards(list, len(plan))
+	var reorderCheckWg sync.WaitGroup
+	var panics cardPanics
+	reorderCheckWg.Add(len(plan))
+	for _, item := range plan {
+		go func(item *reorderPlanItem) {
+			defer reorderCheckWg.Done()
+			defer panics.catch()
+			checkCardForOrder(ctx, list, item, policy)
+		}(item)
+	}
+	reorderCheckWg.Wait()
+	panics.rethrow()
+	log.Printf("List %v processed for card reorder", list.Name)
+}
+
+// Archives, deletes and moves to another board the stale cards of the profile lists
+func (r *maintenanceRun) staleCardPasses(ctx context.Context, profile maintenanceProfile, trelloArchiveLists string) {
+	client := r.client
+	cardInactivityThreshold := profile.cardInactivityThreshold
+
+	// settings common to all of the stale card actions
+	basePolicy := staleCardPolicy{
+		journal:        r.journal,
+		audit:          r.audit,
+		activity:       r.activity,
+		calendar:       r.calendar,
+		coverColors:    r.coverColors,
+		client:         client,
+		staleDueDate:   r.staleDueDate,
+		protectEngaged: r.protectEngaged,
+		checklists:     r.checklists,
+		confirm:        r.confirm,
+		scrubber:       r.scrubber,
+		closing:        r.closing,
+		incremental:    r.incremental,
+		activityCache:  r.activityCache,
+	}
+	if r.plan != nil {
+		// nothing is changed while planning
+		basePolicy.audit = nil
+		basePolicy.coverColors = nil
+		basePolicy.staleDueDate = false
+		basePolicy.plan = r.plan
+	}
+
+	checkListForStaleCards := func(ctx context.Context, listId string, wg *sync.WaitGroup, policy staleCardPolicy) {
+		defer wg.Done()
+		policy.client = listClient(ctx, client)
+		policy.gateway = trelloops.NewClientGateway(policy.client)
+		checkListForStaleCards(ctx, listId, cardInactivityThreshold, r.excludeNames, policy)
+	}
+
+	if len(trelloArchiveLists) > 0 {
+		archivePolicy := basePolicy
+		archivePolicy.action = staleCardActionArchive
+		archivePolicy.auditComment = profile.archiveAuditComment
+		processLists(
+			ctx,
+			trelloArchiveLists,
+			"stale cards archival",
+			func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+				checkListForStaleCards(ctx, listId, wg, archivePolicy)
+			})
+	}
+
+	if len(profile.deleteLists) > 0 {
+		deletePolicy := basePolicy
+		deletePolicy.action = staleCardActionDelete
+		backup, err := newCardBackupStorageFromEnv()
+		if err != nil {
+			configFatalf("can't configure card backups: %v", err)
+		}
+		if backup != nil {
+			deletePolicy.backup = backup
+			log.Printf("Cards will be backed up to %s before deletion\n", backup.describe())
+		} else {
+			log.Printf("WARNING: neither %s nor %s is set, stale cards will be deleted without backup\n", CARD_BACKUP_DIR_ENV, CARD_BACKUP_STORAGE_ENV)
+		}
+		processLists(
+			ctx,
+			profile.deleteLists,
+			"stale cards delete",
+			func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+				checkListForStaleCards(ctx, listId, wg, deletePolicy)
+			})
+	}
+
+	if len(profile.moveLists) > 0 {
+		movePolicy := basePolicy
+		movePolicy.action = staleCardActionMoveToBoard
+		movePolicy.targetBoardID = profile.moveTargetBoard
+		movePolicy.targetListID = profile.moveTargetList
+		if len(movePolicy.targetListID) == 0 {
+			targetList := trelloops.FetchFirstOpenList(client, movePolicy.targetBoardID)
+			log.Printf("Stale cards will be moved to the list %v (%v) of the board %v\n", targetList.Name, targetList.ID, movePolicy.targetBoardID)
+			movePolicy.targetListID = targetList.ID
+		}
+		processLists(
+			ctx,
+			profile.moveLists,
+			"stale cards move to another board",
+			func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+				checkListForStaleCards(ctx, listId, wg, movePolicy)
+			})
+	}
+}
+
+func (r *maintenanceRun) maintain(profile maintenanceProfile) {
+	ctx, span := tracer.Start(r.ctx, "profile", trace.WithAttributes(attribute.String("profile", profile.name)))
+	defer span.End()
+	client := r.client.WithContext(ctx)
+	trelloArchiveLists := trelloops.AppendBoardLists(client, profile.archiveLists, profile.archiveBoards, false)
+	if r.plan != nil {
+		// only the stale card actions are planned, the rest of the passes are reported as not planned
+		unplanned := profile.unplannedPasses()
+		if r.staleDueDate {
+			unplanned = append(unplanned, "staleness due dates")
+		}
+		if r.coverColors != nil {
+			unplanned = append(unplanned, "staleness cover colors")
+		}
+		r.plan.addUnplanned(profile.name, unplanned)
+		r.staleCardPasses(ctx, profile, trelloArchiveLists)
+		return
+	}
+	if r.report != nil {
+		var staleLists []string
+		for _, lists := range []string{trelloArchiveLists, profile.deleteLists, profile.moveLists} {
+			if len(lists) > 0 {
+				staleLists = append(staleLists, lists)
+			}
+		}
+		r.reportProfile(ctx, profile, staleLists, trelloops.AppendBoardLists(client, profile.reorderLists, profile.reorderBoards, true))
+		return
+	}
+	// lists which must not be archived even if they are empty
+	keepLists := map[string]bool{
+		profile.moveTargetList:    true,
+		profile.lowSimilarityList: true,
+		r.statusList:              true,
+	}
+	if len(profile.intakeBoard) > 0 {
+		rotation, _ := parseIntakeRotation(profile.intakeRotation)
+		currentIntakeList, olderIntakeLists := rotateIntakeLists(client, profile.intakeBoard, profile.intakeListPrefix, rotation, time.Now())
+		keepLists[currentIntakeList] = true
+		if profile.intakeArchiveOldLists && len(olderIntakeLists) > 0 {
+			if len(trelloArchiveLists) > 0 {
+				trelloArchiveLists += ","
+			}
+			trelloArchiveLists += strings.Join(olderIntakeLists, ",")
+		}
+	}
+	trelloReorderLists := trelloops.AppendBoardLists(client, profile.reorderLists, profile.reorderBoards, true)
+
+	if len(profile.descNormalizeLists) > 0 {
+		normalizeListsDescriptions(ctx, client, profile.descNormalizeLists, r.similarity, r.coordinates, r.audit)
+	}
+
+	if len(profile.imageCoverLists) > 0 {
+		setListsImageCovers(ctx, client, profile.imageCoverLists)
+	}
+
+	if len(profile.dedupeLists) > 0 {
+		dedupe, _ := profile.dedupeRules()
+		dedupe.archiveComment = profile.archiveAuditComment
+		dedupe.journal = r.journal
+		dedupe.audit = r.audit
+		dedupe.confirm = r.confirm
+		dedupeLists(ctx, client, profile.dedupeLists, dedupe)
+	}
+
+	if len(profile.mapLinkLists) > 0 {
+		attachListsMapLinks(ctx, client, profile.mapLinkLists, r.coordinates, r.mapProvider)
+	}
+
+	if len(profile.regionLabelLists) > 0 {
+		labelListsWithRegions(ctx, client, profile.regionLabelLists, r.coordinates, r.regions, r.regionColor, r.audit)
+	}
+
+	if len(profile.kashtankaLists) > 0 {
+		closeSolvedCards(ctx, client, profile.kashtankaLists, r.kashtanka, profile.kashtankaSolvedList, r.journal, r.audit, r.confirm)
+		keepLists[profile.kashtankaSolvedList] = true
+	}
+
+	if len(profile.keywordLists) > 0 {
+		keywords, _ := compileKeywordsRegex(profile.resolvedKeywords)
+		routeListsByKeywords(ctx, client, profile.keywordLists, keywordRoutingPolicy{
+			keywords:     keywords,
+			targetListID: profile.resolvedList,
+			labelName:    profile.resolvedLabel,
+			journal:      r.journal,
+			audit:        r.audit,
+			confirm:      r.confirm,
+		})
+		keepLists[profile.resolvedList] = true
+	}
+
+	if len(profile.linkCheckLists) > 0 {
+		checkListsForDeadLinks(ctx, client, profile.linkCheckLists, linkCheckPolicy{
+			labelName:    profile.brokenLinkLabel,
+			reviewListID: profile.brokenLinkReviewList,
+			journal:      r.journal,
+			audit:        r.audit,
+		})
+		keepLists[profile.brokenLinkReviewList] = true
+	}
+
+	if len(profile.ageRouting) > 0 {
+		buckets, _ := parseAgeRouting(profile.ageRouting)
+		routeCardsByAge(ctx, client, buckets, time.Now(), r.journal, r.audit)
+		for _, bucket := range buckets {
+			keepLists[bucket.listID] = true
+		}
+	}
+
+	if len(profile.memberScrubLists) > 0 {
+		scrubListsMemberData(ctx, client, profile.memberScrubLists, profile.memberDataRetention, extractEnvOrDefault(PII_SCRUB_REPLACEMENT_ENV, "[removed]"), r.audit)
+	}
+
+	if len(profile.botCommentLists) > 0 {
+		cleanUpListsBotComments(ctx, client, profile.botCommentLists, profile.botCommentRetention, r.audit, r.confirm)
+	}
+
+	if len(profile.attachmentCleanupLists) > 0 {
+		backup, err := newCardBackupStorageFromEnv()
+		if err != nil {
+			configFatalf("can't configure card backups: %v", err)
+		}
+		if backup != nil {
+			log.Printf("Cards will be backed up to %s before their attachments are deleted\n", backup.describe())
+		}
+		cleanUpListsArchivedAttachments(ctx, client, profile.attachmentCleanupLists, profile.attachmentRetention, backup, r.audit, r.confirm)
+	}
+
+	if rules, _ := profile.cardRules(); len(rules) > 0 {
+		policy := rulePolicy{
+			journal:    r.journal,
+			audit:      r.audit,
+			similarity: r.similarity,
+			scrubber:   r.scrubber,
+			closing:    r.closing,
+			confirm:    r.confirm,
+			plugins:    pluginRunnerFromEnv(),
+		}
+		for _, rule := range rules {
+			if rule.action == ruleActionDelete && policy.backup == nil {
+				backup, err := newCardBackupStorageFromEnv()
+				if err != nil {
+					configFatalf("can't configure card backups: %v", err)
+				}
+				policy.backup = backup
+			}
+			keepLists[rule.targetList] = true
+		}
+		applyRules(ctx, client, rules, policy)
+	}
+
+	r.staleCardPasses(ctx, profile, trelloArchiveLists)
+
+	baseReorderPolicy := r.reorderPolicy(profile)
+
+	checkListForCardReorder := func(ctx context.Context, listSpec string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		policy := baseReorderPolicy
+		policy.client = listClient(ctx, client)
+		policy.gateway = trelloops.NewClientGateway(policy.client)
+		reorderList(ctx, listSpec, policy)
+	}
+
+	if len(trelloReorderLists) > 0 {
+		processLists(
+			ctx,
+			trelloReorderLists,
+			"cards reorder",
+			checkListForCardReorder)
+	}
+
+	// the reorder pass positions its lists itself, renormalizing them would be undone on the next run
+	reorderManaged := make(map[string]bool)
+	for _, listSpec := range strings.Split(trelloReorderLists, ",") {
+		if listId, _, err := parseReorderListSpec(listSpec); err == nil && len(listId) > 0 {
+			reorderManaged[listId] = true
+		}
+	}
+	checkListForDrift := func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		if reorderManaged[listId] {
+			log.Printf("List %v is positioned by the card reorder, not renormalized\n", listId)
+			return
+		}
+		list := trelloops.FetchList(listClient(ctx, client), listId)
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		drifted, why := detectPositionDrift(cards, r.driftMinGap)
+		if !drifted {
+			log.Printf("Positions of the list %v are fine\n", list.Name)
+			return
+		}
+		log.Printf("Positions of the list %v drifted (%s), renormalizing %d cards\n", list.Name, why, len(cards))
+		renormalizeListPositions(list, cards, r.journal)
+	}
+
+	if len(profile.renormalizeLists) > 0 {
+		processLists(
+			ctx,
+			profile.renormalizeLists,
+			"position renormalization",
+			checkListForDrift)
+	}
+
+	if len(profile.archiveEmptyLists) > 0 {
+		archiveEmptyLists(client, profile.archiveEmptyLists, keepLists, r.confirm)
+	}
+
+	if len(profile.labelCleanupBoards) > 0 {
+		cleanUpBoardsLabels(client, profile.labelCleanupBoards, labelCleanupPolicy{remove: r.labelCleanup, keep: r.appliedLabels(profile)}, r.confirm)
+	}
+
+	if len(profile.memberCleanupBoards) > 0 {
+		cleanUpBoardsInactiveMembers(client, profile.memberCleanupBoards, profile.memberInactivity, profile.removeInactiveMembers, r.confirm)
+	}
+
+	if len(profile.listOrderBoards) > 0 {
+		orderBoardsLists(client, profile.listOrderBoards)
+	}
+
+	if len(profile.mirrorLists) > 0 {
+		syncMirrorBoard(client, profile.mirrorLists, profile.mirrorBoard)
+	}
+}
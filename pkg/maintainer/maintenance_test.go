@@ -0,0 +1,187 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// The Trello id of the object created at the time
+func testID(created time.Time, n int) string {
+	return fmt.Sprintf("%08x%016x", created.Unix(), n)
+}
+
+// The fake board with the list and the card created at the time, last active at lastActivity
+func testBoard(created time.Time, lastActivity time.Time) (*trelloops.FakeGateway, *trello.List, *trello.Card) {
+	gateway := trelloops.NewFakeGateway()
+	list := &trello.List{ID: testID(created, 1), Name: "Candidates"}
+	gateway.AddList(list)
+	card := &trello.Card{ID: testID(created, 2), Name: "Cat", IDList: list.ID, DateLastActivity: &lastActivity}
+	gateway.AddCard(card)
+	return gateway, list, card
+}
+
+func TestCardLastActivityCountsCreationRegardlessOfFilter(t *testing.T) {
+	now := time.Now()
+	created := now.Add(-10 * 24 * time.Hour).Truncate(time.Second)
+	gateway, list, card := testBoard(created, now.Add(-time.Hour))
+	gateway.AddAction(card.ID, &trello.Action{ID: testID(created, 3), Type: "createCard", Date: created})
+
+	lastActivity, matched := cardLastActivity(gateway, list, card, parseActivityFilter("commentCard"))
+	if !lastActivity.Equal(created) {
+		t.Errorf("expected the creation time %v, got %v", created, lastActivity)
+	}
+	if len(matched) != 1 {
+		t.Errorf("expected the creation action to be counted, got %d actions", len(matched))
+	}
+}
+
+func TestCardLastActivityWithoutMatchingActions(t *testing.T) {
+	now := time.Now()
+	created := now.Add(-60 * 24 * time.Hour).Truncate(time.Second)
+	dateLastActivity := now.Add(-2 * 24 * time.Hour)
+	gateway, list, card := testBoard(created, dateLastActivity)
+	gateway.AddAction(card.ID, &trello.Action{ID: testID(created, 3), Type: "updateCard", Date: dateLastActivity})
+
+	lastActivity, matched := cardLastActivity(gateway, list, card, parseActivityFilter("commentCard"))
+	if !lastActivity.Equal(dateLastActivity) {
+		t.Errorf("expected the card last activity %v, got %v", dateLastActivity, lastActivity)
+	}
+	if len(matched) != 0 {
+		t.Errorf("expected no counted actions, got %d", len(matched))
+	}
+}
+
+func TestCardLastActivityWithOnlyUncountedComments(t *testing.T) {
+	now := time.Now()
+	created := now.Add(-10 * 24 * time.Hour).Truncate(time.Second)
+	commented := now.Add(-time.Hour)
+	gateway, list, card := testBoard(created, commented)
+	gateway.AddAction(card.ID, &trello.Action{ID: testID(created, 3), Type: "commentCard", IDMemberCreator: "bot", Date: commented})
+	activity := parseActivityFilter("commentCard")
+	activity.commentMembers = map[string]bool{"volunteer": true}
+
+	lastActivity, matched := cardLastActivity(gateway, list, card, activity)
+	if !lastActivity.Equal(created) {
+		t.Errorf("expected the creation time %v, got %v", created, lastActivity)
+	}
+	if len(matched) != 0 {
+		t.Errorf("expected no counted actions, got %d", len(matched))
+	}
+}
+
+func TestCheckListForStaleCards(t *testing.T) {
+	now := time.Now()
+	created := now.Add(-40 * 24 * time.Hour).Truncate(time.Second)
+	gateway, list, stale := testBoard(created, created)
+	gateway.AddAction(stale.ID, &trello.Action{ID: testID(created, 3), Type: "createCard", Date: created})
+	commented := now.Add(-24 * time.Hour).Truncate(time.Second)
+	active := &trello.Card{ID: testID(created, 4), Name: "Dog", IDList: list.ID, DateLastActivity: &commented}
+	gateway.AddCard(active)
+	gateway.AddAction(active.ID, &trello.Action{ID: testID(commented, 5), Type: "commentCard", Date: commented})
+
+	threshold := 30 * 24 * time.Hour
+	checkListForStaleCards(context.Background(), list.ID, threshold, nil, staleCardPolicy{
+		action:       staleCardActionArchive,
+		activity:     parseActivityFilter(defaultActivityActionTypes),
+		gateway:      gateway,
+		staleDueDate: true,
+		coverColors:  &coverColorScheme{warnRatio: 0.5, alertRatio: 0.8},
+	})
+
+	if card, _ := gateway.Card(stale.ID); !card.Closed {
+		t.Errorf("expected the stale card to be archived")
+	}
+	card, _ := gateway.Card(active.ID)
+	if card.Closed {
+		t.Errorf("expected the active card to stay open")
+	}
+	if card.Due == nil || !card.Due.Equal(commented.Add(threshold)) {
+		t.Errorf("expected the due date %v, got %v", commented.Add(threshold), card.Due)
+	}
+	if cover := gateway.Cover(active.ID); cover.Color != "green" {
+		t.Errorf("expected the green cover, got %q", cover.Color)
+	}
+}
+
+func TestOwnUpdatesKeepActivityCached(t *testing.T) {
+	t.Setenv(ACTIVITY_CACHE_PATH_ENV, filepath.Join(t.TempDir(), "activity.db"))
+	cache, err := openActivityCacheFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.close()
+	now := time.Now()
+	created := now.Add(-10 * 24 * time.Hour).Truncate(time.Second)
+	commented := now.Add(-24 * time.Hour).Truncate(time.Second)
+	gateway, list, card := testBoard(created, commented)
+	gateway.AddAction(card.ID, &trello.Action{ID: testID(commented, 3), Type: "commentCard", Date: commented})
+	policy := staleCardPolicy{
+		action:        staleCardActionArchive,
+		activity:      parseActivityFilter(defaultActivityActionTypes),
+		gateway:       gateway,
+		staleDueDate:  true,
+		coverColors:   &coverColorScheme{warnRatio: 0.5, alertRatio: 0.8},
+		activityCache: cache,
+	}
+
+	checkListForStaleCards(context.Background(), list.ID, 30*24*time.Hour, nil, policy)
+
+	updated, _ := gateway.Card(card.ID)
+	if !updated.DateLastActivity.After(commented) {
+		t.Fatalf("expected the due date and cover updates to move the last activity")
+	}
+	if lastActivity, found := cache.get(&updated, policy.activity.fingerprint()); !found || !lastActivity.Equal(commented) {
+		t.Errorf("expected the last activity %v to stay cached after the own updates, got %v (found %v)", commented, lastActivity, found)
+	}
+}
+
+// The fake whose card actions can't be fetched
+type failingActionsGateway struct {
+	*trelloops.FakeGateway
+}
+
+func (g failingActionsGateway) WithContext(ctx context.Context) trelloops.TrelloGateway {
+	return g
+}
+
+func (g failingActionsGateway) GetCardActions(card *trello.Card, args trello.Arguments) (trello.ActionCollection, error) {
+	return nil, fmt.Errorf("Trello is down")
+}
+
+func TestCardFailureFailsListInCallingGoroutine(t *testing.T) {
+	now := time.Now()
+	gateway, list, _ := testBoard(now.Add(-24*time.Hour), now)
+	policy := staleCardPolicy{
+		action:   staleCardActionArchive,
+		activity: parseActivityFilter(defaultActivityActionTypes),
+		gateway:  failingActionsGateway{gateway},
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected the card failure to fail the pass")
+		}
+	}()
+	processLists(context.Background(), list.ID, "stale cards", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		checkListForStaleCards(ctx, listId, 30*24*time.Hour, nil, policy)
+	})
+}
+
+func TestRunMaintenanceReturnsInvalidConfiguration(t *testing.T) {
+	t.Setenv(TRELLO_KEY_ENV, "key")
+	t.Setenv(TRELLO_TOKEN_ENV, "token")
+	t.Setenv(POSITION_DRIFT_MIN_GAP_ENV, "not a number")
+
+	if err := runMaintenance(maintenanceOptions{}); err == nil || !strings.Contains(err.Error(), POSITION_DRIFT_MIN_GAP_ENV) {
+		t.Errorf("expected the invalid %s to be returned, got %v", POSITION_DRIFT_MIN_GAP_ENV, err)
+	}
+}
@@ -0,0 +1,74 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_MEMBER_SCRUB_LISTS_ENV = "TRELLO_MEMBER_SCRUB_LISTS"
+const MEMBER_DATA_RETENTION_DAYS_ENV = "MEMBER_DATA_RETENTION_DAYS"
+
+// "@username" mention. Not preceded by a word character, so the e-mails are not matched
+var memberMentionPattern = piiPattern{name: "mention", regex: regexp.MustCompile(`\B@[A-Za-z0-9_]{3,}`)}
+
+// Removes the member assignments and the member mentions from the cards (including the archived ones) of the lists
+// created longer than retention ago. Unlike the stale card actions, the cards stay where they are
+func scrubListsMemberData(ctx context.Context, client *trello.Client, commaSepListIds string, retention time.Duration, replacement string, audit *auditLog) {
+	mentions := &piiScrubber{patterns: []piiPattern{memberMentionPattern}, replacement: replacement}
+	now := time.Now()
+	processLists(ctx, commaSepListIds, "member data scrubbing", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		trelloClient := listClient(ctx, client)
+		gateway := trelloops.NewClientGateway(trelloClient)
+		list := trelloops.FetchList(trelloClient, listId)
+		cards, err := list.GetCards(trello.Arguments{"filter": "all"})
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		scrubbed := 0
+		for _, card := range cards {
+			age := now.Sub(card.CreatedAt())
+			if age <= retention {
+				continue
+			}
+			record := auditRecord{
+				Timestamp: now,
+				Pass:      "memberScrub",
+				CardID:    card.ID,
+				CardName:  card.Name,
+				ListID:    list.ID,
+				ListName:  list.Name,
+				Rule:      fmt.Sprintf("card age %s exceeds member data retention %s", humanizeDuration(age), humanizeDuration(retention)),
+			}
+			if err := scrubCardMemberData(gateway, card, mentions); err != nil {
+				log.Printf("Failed to scrub member data of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+				record.Decision = auditDecisionError
+				record.Detail = err.Error()
+				audit.write(record)
+				continue
+			}
+			record.Decision = auditDecisionScrub
+			audit.write(record)
+			scrubbed++
+		}
+		log.Printf("Member data of %d cards of the list %v is scrubbed\n", scrubbed, list.Name)
+	})
+}
+
+func scrubCardMemberData(gateway trelloops.TrelloGateway, card *trello.Card, mentions *piiScrubber) error {
+	for _, memberID := range card.IDMembers {
+		if err := card.RemoveMember(memberID); err != nil {
+			return fmt.Errorf("can't remove member %v: %w", memberID, err)
+		}
+		log.Printf("Removed member %v from card \"%v\" (%v)\n", memberID, card.Name, card.ID)
+	}
+	return mentions.scrubCard(gateway, card)
+}
@@ -0,0 +1,176 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+type messageKind string
+
+// The texts the bot posts to the board. Every template gets .Card (the trello.Card the message is about, missing for the run summary)
+// and the fields listed for the message
+const (
+	// .Idle and .Threshold durations
+	messageStaleArchive messageKind = "staleArchive"
+	// .Reason the card is archived off the reordered list for
+	messageReorderArchive messageKind = "reorderArchive"
+	// .Original card the duplicate is merged into
+	messageDuplicateMerged messageKind = "duplicateMerged"
+	// .Original card of the archived duplicate
+	messageDuplicateArchived messageKind = "duplicateArchived"
+	// posted to the original, .Duplicate card merged into it
+	messageDuplicateNote messageKind = "duplicateNote"
+	// .Status of the case and its .MatchURL (may be empty)
+	messageKashtankaClosed messageKind = "kashtankaClosed"
+	// .CardID of the deleted card and .DeletedAt time
+	messageRestored messageKind = "restored"
+	// .StartedAt time, .Duration, .Summary and the counters .Archived, .Deleted, .MovedToBoard, .MovedToList, .Reordered, .Created and .Errors
+	messageRunSummary messageKind = "runSummary"
+)
+
+var defaultMessageTemplates = map[messageKind]string{
+	messageStaleArchive:      "Archived by TrelloBoardMaintainer: no activity for {{humanize .Idle}} (threshold {{humanize .Threshold}})",
+	messageReorderArchive:    "Archived by TrelloBoardMaintainer: {{.Reason}}",
+	messageDuplicateMerged:   "Merged by TrelloBoardMaintainer into {{.Original.ShortURL}}",
+	messageDuplicateArchived: "Archived by TrelloBoardMaintainer: duplicate of {{.Original.ShortURL}}",
+	messageDuplicateNote:     "Merged by TrelloBoardMaintainer: duplicate {{.Duplicate.ShortURL}} ({{.Duplicate.Name}})",
+	messageKashtankaClosed:   "Closed by TrelloBoardMaintainer: the case is {{.Status}} in Kashtanka{{if .MatchURL}}, match: {{.MatchURL}}{{end}}",
+	messageRestored:          "Restored by TrelloBoardMaintainer from the backup of card {{.CardID}} deleted at {{date \"2006-01-02T15:04:05Z07:00\" .DeletedAt}}",
+	messageRunSummary:        "Maintenance run {{date \"2006-01-02 15:04\" .StartedAt}} ({{.Duration}}): {{.Summary}}",
+}
+
+var messageFuncs = template.FuncMap{
+	// e.g. "12 days" or "30 hours"
+	"humanize": humanizeDuration,
+	"days":     func(d time.Duration) int { return int(d.Hours() / 24) },
+	"hours":    func(d time.Duration) int { return int(d.Hours()) },
+	"date":     func(layout string, t time.Time) string { return t.Format(layout) },
+}
+
+// The templates of the messages. Set once at startup by loadMessageTemplates, the defaults are used until then
+var messageTemplates = mustParseMessageTemplates(nil)
+
+func parseMessageTemplate(kind messageKind, text string) (*template.Template, error) {
+	tmpl, err := template.New(string(kind)).Funcs(messageFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse template of message %s: %w", kind, err)
+	}
+	return tmpl, nil
+}
+
+// The default templates overridden by the given ones
+func parseMessageTemplates(overrides map[string]string) (map[messageKind]*template.Template, error) {
+	templates := make(map[messageKind]*template.Template)
+	for kind, text := range defaultMessageTemplates {
+		if override, found := overrides[string(kind)]; found {
+			text = override
+		}
+		tmpl, err := parseMessageTemplate(kind, text)
+		if err != nil {
+			return nil, err
+		}
+		templates[kind] = tmpl
+	}
+	for name := range overrides {
+		if _, found := defaultMessageTemplates[messageKind(name)]; !found {
+			return nil, fmt.Errorf("unknown message %s", name)
+		}
+	}
+	return templates, nil
+}
+
+func mustParseMessageTemplates(overrides map[string]string) map[messageKind]*template.Template {
+	templates, err := parseMessageTemplates(overrides)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// Loads the message templates of the config file
+func loadMessageTemplates() error {
+	config, err := configFileFromEnv()
+	if err != nil {
+		return err
+	}
+	if config == nil || len(config.Messages) == 0 {
+		return nil
+	}
+	templates, err := parseMessageTemplates(config.Messages)
+	if err != nil {
+		return err
+	}
+	log.Printf("%d bot messages are customized\n", len(config.Messages))
+	messageTemplates = templates
+	return nil
+}
+
+// The text of the message. If the template fails (e.g. refers to a missing field) the error is logged and the default template is used
+func renderMessage(kind messageKind, data map[string]interface{}) string {
+	var text strings.Builder
+	err := messageTemplates[kind].Execute(&text, data)
+	if err == nil {
+		return text.String()
+	}
+	log.Printf("Failed to render message %s, using the default one: %v\n", kind, err)
+	text.Reset()
+	if err := template.Must(parseMessageTemplate(kind, defaultMessageTemplates[kind])).Execute(&text, data); err != nil {
+		log.Panicf("Failed to render the default message %s: %v", kind, err)
+	}
+	return text.String()
+}
+
+// The pattern of the texts the template renders: its literal text as is and anything in place of its actions.
+// nil if the template has no literal text to recognize the message by
+func messagePattern(tmpl *template.Template) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	literal := false
+	for _, node := range tmpl.Tree.Root.Nodes {
+		if text, ok := node.(*parse.TextNode); ok {
+			pattern.WriteString(regexp.QuoteMeta(string(text.Text)))
+			literal = literal || strings.TrimSpace(string(text.Text)) != ""
+			continue
+		}
+		pattern.WriteString("(?s:.*?)")
+	}
+	if !literal {
+		return nil
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// The patterns of the bot messages, of both the current and the default templates (the comments posted before the customization)
+func botMessagePatterns() []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, templates := range []map[messageKind]*template.Template{messageTemplates, mustParseMessageTemplates(nil)} {
+		for kind, tmpl := range templates {
+			pattern := messagePattern(tmpl)
+			if pattern == nil {
+				log.Printf("Message %s has no literal text, its comments are not recognized as the bot ones\n", kind)
+				continue
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// Whether the comment is a bot message. The comments copied by the restore and the dedupe merge (the volunteer ones) never are
+func isBotMessage(patterns []*regexp.Regexp, text string) bool {
+	if isCopiedCommentText(text) {
+		return false
+	}
+	for _, pattern := range patterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
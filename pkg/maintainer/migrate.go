@@ -0,0 +1,136 @@
+package maintainer
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// Moves the similarity values from the card descriptions (read as SIMILARITY_REGEX and SIMILARITY_RECOVERY configure) into the custom field
+func runMigrateSimilarity(args []string) {
+	flags := flag.NewFlagSet("migrate-similarity", flag.ExitOnError)
+	lists := flags.String("lists", extractEnvOrDefault(TRELLO_REORDER_LISTS_ENV, ""), "comma separated ids of the lists to migrate (defaults to "+TRELLO_REORDER_LISTS_ENV+")")
+	fieldName := flags.String("field", extractEnvOrDefault(SIMILARITY_CUSTOM_FIELD_ENV, "Similarity"), "name of the number custom field to write similarity to (defaults to "+SIMILARITY_CUSTOM_FIELD_ENV+")")
+	stripDesc := flags.Bool("strip-desc", false, "remove the similarity value from the description after migration")
+	overwrite := flags.Bool("overwrite", false, "overwrite the custom field if it already has a value")
+	dryRun := flags.Bool("dry-run", false, "only print what would be migrated")
+	flags.Parse(args)
+
+	if len(*lists) == 0 {
+		log.Fatalf("ERROR: no lists to migrate. Use -lists or %s\n", TRELLO_REORDER_LISTS_ENV)
+	}
+	if err := loadExemptCardIDs(); err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+
+	similarity, err := similaritySourceFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	// the value is migrated from the description even if the custom field is already configured as the source
+	similarity.customFieldName = ""
+
+	client := newTrelloClient(extractSecretEnvOrExit(TRELLO_KEY_ENV), extractSecretEnvOrExit(TRELLO_TOKEN_ENV))
+	gateway := trelloops.NewClientGateway(client)
+
+	migrated := 0
+	for _, listSpec := range strings.Split(*lists, ",") {
+		listId, _, _ := parseReorderListSpec(listSpec)
+		list := trelloops.FetchList(client, listId)
+		boardFields := fetchBoardCustomFields(gateway, list.IDBoard)
+		field := trelloops.FindBoardCustomField(boardFields, *fieldName)
+		if field == nil {
+			if *dryRun {
+				log.Printf("[dry run] Would create custom field \"%s\" on board %v\n", *fieldName, list.IDBoard)
+			} else {
+				created, err := trelloops.CreateBoardNumberCustomField(client, list.IDBoard, *fieldName)
+				if err != nil {
+					log.Fatalf("ERROR: can't create custom field \"%s\" on board %v: %v\n", *fieldName, list.IDBoard, err)
+				}
+				log.Printf("Created custom field \"%s\" (%v) on board %v\n", *fieldName, created.ID, list.IDBoard)
+				field = created
+				boardFields = append(boardFields, created)
+			}
+		}
+
+		cards, err := list.GetCards(trello.Arguments{"customFieldItems": "true"})
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		log.Printf("Migrating %d cards of the list %v (%v)\n", len(cards), list.Name, list.ID)
+		migration := similarityMigration{
+			gateway:     gateway,
+			similarity:  similarity,
+			field:       field,
+			boardFields: boardFields,
+			fieldName:   *fieldName,
+			stripDesc:   *stripDesc,
+			overwrite:   *overwrite,
+			dryRun:      *dryRun,
+		}
+		for _, card := range cards {
+			if migration.migrateCard(card) {
+				migrated++
+			}
+		}
+	}
+	log.Printf("Done. %d cards migrated\n", migrated)
+}
+
+// Migration settings for the cards of a single board
+type similarityMigration struct {
+	gateway trelloops.TrelloGateway
+	// reads the similarity from the description
+	similarity similaritySource
+	// nil in dry run if the field does not exist yet
+	field       *trello.CustomField
+	boardFields []*trello.CustomField
+	fieldName   string
+	stripDesc   bool
+	overwrite   bool
+	dryRun      bool
+}
+
+// Returns whether the card is migrated
+func (m *similarityMigration) migrateCard(card *trello.Card) bool {
+	sim, recovered := m.similarity.extractRecovering(card)
+	if sim == nil {
+		return false
+	}
+	if !m.overwrite && tryExtractCustomFieldSimilarity(card, m.boardFields, m.fieldName) != nil {
+		log.Printf("Card %v (%v) already has similarity custom field, skipping\n", card.Name, card.ID)
+		return false
+	}
+	strippedDesc, strip := m.similarity.descWithoutSimilarity(card.Desc)
+	if m.stripDesc && (recovered || !strip) {
+		// the recovered value is not where the description format says, so what to strip is unknown
+		log.Printf("Similarity of %v (%v) is not where the description format says, the description is kept\n", card.Name, card.ID)
+		strip = false
+	}
+	strip = strip && m.stripDesc
+
+	if m.dryRun {
+		log.Printf("[dry run] Would set similarity of %v (%v) to %v\n", card.Name, card.ID, *sim)
+		if strip {
+			log.Printf("[dry run] Would change description of %v (%v) to \"%v\"\n", card.Name, card.ID, strippedDesc)
+		}
+		return true
+	}
+
+	if err := m.gateway.SetCardCustomFieldValue(card, m.field.ID, *sim); err != nil {
+		log.Printf("Failed to set similarity custom field of %v (%v): %v\n", card.Name, card.ID, err)
+		return false
+	}
+	if strip {
+		if err := m.gateway.SetCardDesc(card, strippedDesc); err != nil {
+			log.Printf("Failed to strip similarity from the description of %v (%v): %v\n", card.Name, card.ID, err)
+			return false
+		}
+	}
+	log.Printf("Migrated similarity %v of %v (%v)\n", *sim, card.Name, card.ID)
+	return true
+}
@@ -0,0 +1,34 @@
+package maintainer
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+func TestMigrateCardUsesConfiguredSimilarityRegex(t *testing.T) {
+	gateway, _, card := testBoard(time.Now().Add(-24*time.Hour), time.Now())
+	card.Desc = "Similarity: 0.87 (match #123)\nSeen near the park"
+	gateway.AddCard(card)
+	field := &trello.CustomField{ID: "similarity-field", Name: "Similarity", Type: "number"}
+	migration := similarityMigration{
+		gateway:    gateway,
+		similarity: similaritySource{descRegex: regexp.MustCompile(`Similarity: ([0-9.]+)`)},
+		field:      field,
+		fieldName:  field.Name,
+		stripDesc:  true,
+	}
+
+	if !migration.migrateCard(card) {
+		t.Fatal("expected the card to be migrated")
+	}
+
+	if value := gateway.CustomFieldValue(card.ID, field.ID); value != 0.87 {
+		t.Errorf("expected the similarity 0.87, got %v", value)
+	}
+	if stored, _ := gateway.Card(card.ID); stored.Desc != "(match #123)\nSeen near the park" {
+		t.Errorf("expected only the similarity to be stripped, got %q", stored.Desc)
+	}
+}
@@ -0,0 +1,163 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_MIRROR_LISTS_ENV = "TRELLO_MIRROR_LISTS"
+const TRELLO_MIRROR_BOARD_ENV = "TRELLO_MIRROR_BOARD"
+
+// The last line of the mirror card description referring to its source card
+const mirrorSourcePrefix = "Mirror of "
+
+var mirrorSourcePattern = regexp.MustCompile(`\n*` + mirrorSourcePrefix + `([0-9a-f]{24})\s*$`)
+
+// Removes the phones, the emails, the member mentions and the PII_SCRUB_REGEX matches
+// regardless of PII_SCRUB, as the mirror is public
+func mirrorScrubberFromEnv() (*piiScrubber, error) {
+	scrubber := &piiScrubber{
+		patterns:    []piiPattern{builtinPIIPatterns["phone"], builtinPIIPatterns["email"], memberMentionPattern},
+		replacement: extractEnvOrDefault(PII_SCRUB_REPLACEMENT_ENV, "[removed]"),
+	}
+	if custom := extractEnvOrDefault(PII_SCRUB_REGEX_ENV, ""); len(custom) > 0 {
+		regex, err := regexp.Compile(custom)
+		if err != nil {
+			return nil, fmt.Errorf("can't compile %s: %w", PII_SCRUB_REGEX_ENV, err)
+		}
+		scrubber.patterns = append(scrubber.patterns, piiPattern{name: "custom", regex: regex})
+	}
+	return scrubber, nil
+}
+
+// The source card id of the mirror card, empty if the card is not a mirror one
+func mirrorSourceID(card *trello.Card) string {
+	if match := mirrorSourcePattern.FindStringSubmatch(card.Desc); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// The mirror card of the source card: the anonymized name and description. The members, the comments and the attachments are not mirrored
+func mirroredCard(card *trello.Card, scrubber *piiScrubber) trello.Card {
+	name, _ := scrubber.scrub(card.Name)
+	desc, _ := scrubber.scrub(card.Desc)
+	desc = strings.TrimSpace(desc)
+	if len(desc) > 0 {
+		desc += "\n\n"
+	}
+	return trello.Card{Name: name, Desc: desc + mirrorSourcePrefix + card.ID, Pos: card.Pos}
+}
+
+// Returns the list of the mirror board with the name, creating it at the bottom if it is missing
+func findOrCreateMirrorList(client *trello.Client, board *trello.Board, lists []*trello.List, name string) (*trello.List, error) {
+	for _, list := range lists {
+		if list.Name == name {
+			return list, nil
+		}
+	}
+	list, err := client.CreateList(board, name, trello.Arguments{"pos": "bottom"})
+	if err != nil {
+		return nil, fmt.Errorf("can't create list %v on the mirror board %v: %w", name, board.ID, err)
+	}
+	log.Printf("Created mirror list %v (%v)\n", list.Name, list.ID)
+	return list, nil
+}
+
+// Mirrors the open cards of the lists onto the lists of the same names of the public mirror board with the personal data stripped.
+// The mirror cards whose source cards left the lists are archived (the mirror cards of the lists failed to sync are kept),
+// the cards created on the mirror board manually are left as they are
+func syncMirrorBoard(client *trello.Client, commaSepListIds string, mirrorBoardID string) {
+	scrubber, err := mirrorScrubberFromEnv()
+	if err != nil {
+		log.Panicf("Mirror board %v is not synced: %v", mirrorBoardID, err)
+	}
+	board := &trello.Board{ID: mirrorBoardID}
+	board.SetClient(client)
+	mirrorLists := trelloops.FetchOpenLists(client, mirrorBoardID)
+	var mirrorCards []*trello.Card
+	if err := client.Get(fmt.Sprintf("boards/%s/cards", mirrorBoardID), trello.Arguments{"filter": "open", "fields": "name,desc,idList,pos"}, &mirrorCards); err != nil {
+		log.Panicf("Can't fetch cards of the mirror board %v: %v", mirrorBoardID, err)
+	}
+	mirrors := make(map[string]*trello.Card)
+	for _, card := range mirrorCards {
+		card.SetClient(client)
+		if sourceID := mirrorSourceID(card); len(sourceID) > 0 {
+			mirrors[sourceID] = card
+		}
+	}
+
+	created, updated, archived := 0, 0, 0
+	for _, listID := range strings.Split(commaSepListIds, ",") {
+		list := trelloops.FetchList(client, strings.TrimSpace(listID))
+		if list.IDBoard == mirrorBoardID {
+			log.Printf("List %v (%v) is on the mirror board, it is NOT mirrored\n", list.Name, list.ID)
+			continue
+		}
+		cards, err := list.GetCards(trello.Arguments{"filter": "open"})
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		mirrorList, err := findOrCreateMirrorList(client, board, mirrorLists, list.Name)
+		if err != nil {
+			// the cards are still in the list, their mirror cards are kept as they are
+			log.Printf("List %v (%v) is NOT mirrored: %v\n", list.Name, list.ID, err)
+			for _, card := range cards {
+				delete(mirrors, card.ID)
+			}
+			continue
+		}
+		mirrorLists = append(mirrorLists, mirrorList)
+		for _, card := range cards {
+			desired := mirroredCard(card, scrubber)
+			desired.IDList = mirrorList.ID
+			mirror, found := mirrors[card.ID]
+			// only the mirror cards left in the map are archived, the failed update keeps the mirror card as it is
+			delete(mirrors, card.ID)
+			if !found {
+				if err := client.CreateCard(&desired); err != nil {
+					log.Printf("Failed to mirror card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+					continue
+				}
+				created++
+				continue
+			}
+			args := trello.Arguments{}
+			if mirror.Name != desired.Name {
+				args["name"] = desired.Name
+			}
+			if mirror.Desc != desired.Desc {
+				args["desc"] = desired.Desc
+			}
+			if mirror.IDList != desired.IDList {
+				args["idList"] = desired.IDList
+			}
+			if mirror.Pos != desired.Pos {
+				args["pos"] = strconv.FormatFloat(desired.Pos, 'f', -1, 64)
+			}
+			if len(args) == 0 {
+				continue
+			}
+			if err := mirror.Update(args); err != nil {
+				log.Printf("Failed to update mirror card %v of card \"%v\" (%v): %v\n", mirror.ID, card.Name, card.ID, err)
+				continue
+			}
+			updated++
+		}
+	}
+	for sourceID, mirror := range mirrors {
+		if err := mirror.Archive(); err != nil {
+			log.Printf("Failed to archive mirror card %v of card %v: %v\n", mirror.ID, sourceID, err)
+			continue
+		}
+		archived++
+	}
+	log.Printf("Mirror board %v is synced: %d cards created, %d updated, %d archived\n", mirrorBoardID, created, updated, archived)
+}
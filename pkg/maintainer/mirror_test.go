@@ -0,0 +1,144 @@
+package maintainer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// The Trello API of the source lists and the mirror board, records the archived and the created cards
+type testMirrorAPI struct {
+	mu        sync.Mutex
+	lists     map[string]*trello.List
+	cards     map[string][]*trello.Card
+	mirrorID  string
+	mirrors   []*trello.Card
+	archived  []string
+	created   []string
+	failLists bool
+}
+
+func (api *testMirrorAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var response interface{}
+	switch {
+	case r.Method == http.MethodGet && len(path) == 2 && path[0] == "boards":
+		response = &trello.Board{ID: path[1]}
+	case r.Method == http.MethodGet && len(path) == 3 && path[0] == "boards" && path[2] == "lists":
+		var lists []*trello.List
+		for _, list := range api.lists {
+			if list.IDBoard == path[1] {
+				lists = append(lists, list)
+			}
+		}
+		response = lists
+	case r.Method == http.MethodGet && len(path) == 3 && path[0] == "boards" && path[2] == "cards":
+		response = api.mirrors
+	case r.Method == http.MethodGet && len(path) == 2 && path[0] == "lists":
+		response = api.lists[path[1]]
+	case r.Method == http.MethodGet && len(path) == 3 && path[0] == "lists" && path[2] == "cards":
+		response = api.cards[path[1]]
+	case r.Method == http.MethodPost && len(path) == 1 && path[0] == "lists":
+		if api.failLists {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		list := &trello.List{ID: testID(time.Unix(0, 0), len(api.lists)+100), Name: r.URL.Query().Get("name"), IDBoard: api.mirrorID}
+		api.lists[list.ID] = list
+		response = list
+	case r.Method == http.MethodPost && len(path) == 1 && path[0] == "cards":
+		api.created = append(api.created, r.URL.Query().Get("desc"))
+		response = &trello.Card{ID: testID(time.Unix(0, 0), len(api.created)+200)}
+	case r.Method == http.MethodPut && len(path) == 2 && path[0] == "cards":
+		if r.URL.Query().Get("closed") == "true" {
+			api.archived = append(api.archived, path[1])
+		}
+		response = &trello.Card{ID: path[1]}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func TestSyncMirrorBoardKeepsMirrorsOfFailedLists(t *testing.T) {
+	created := time.Now().Add(-24 * time.Hour)
+	lost := &trello.List{ID: testID(created, 1), Name: "Lost", IDBoard: testID(created, 2)}
+	found := &trello.List{ID: testID(created, 3), Name: "Found", IDBoard: lost.IDBoard}
+	mirrorBoard := testID(created, 4)
+	mirrorLost := &trello.List{ID: testID(created, 5), Name: "Lost", IDBoard: mirrorBoard}
+	lostCard := &trello.Card{ID: testID(created, 6), Name: "Cat", IDList: lost.ID}
+	foundCard := &trello.Card{ID: testID(created, 7), Name: "Dog", IDList: found.ID}
+	goneCard := testID(created, 8)
+	mirror := func(n int, source string, list string) *trello.Card {
+		return &trello.Card{ID: testID(created, n), Desc: mirrorSourcePrefix + source, IDList: list}
+	}
+
+	cases := []struct {
+		name      string
+		failLists bool
+		archived  []string
+	}{
+		{"the missing list is created", false, []string{testID(created, 13)}},
+		{"the missing list fails to be created", true, []string{testID(created, 13)}},
+	}
+	for _, c := range cases {
+		api := &testMirrorAPI{
+			lists:     map[string]*trello.List{lost.ID: lost, found.ID: found, mirrorLost.ID: mirrorLost},
+			cards:     map[string][]*trello.Card{lost.ID: {lostCard}, found.ID: {foundCard}},
+			mirrorID:  mirrorBoard,
+			mirrors:   []*trello.Card{mirror(11, lostCard.ID, mirrorLost.ID), mirror(12, foundCard.ID, mirrorLost.ID), mirror(13, goneCard, mirrorLost.ID)},
+			failLists: c.failLists,
+		}
+		server := httptest.NewServer(api)
+		client := trello.NewClient("key", "token")
+		client.BaseURL = server.URL
+
+		syncMirrorBoard(client, lost.ID+","+found.ID, mirrorBoard)
+		server.Close()
+
+		if strings.Join(api.archived, ",") != strings.Join(c.archived, ",") {
+			t.Errorf("%s: expected the mirror cards %v archived, got %v", c.name, c.archived, api.archived)
+		}
+		if len(api.created) != 0 {
+			t.Errorf("%s: expected no mirror cards created, got %q", c.name, api.created)
+		}
+	}
+}
+
+func TestMirroredCardStripsPersonalData(t *testing.T) {
+	scrubber, err := mirrorScrubberFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		card     trello.Card
+		expected trello.Card
+	}{
+		{
+			"email and mention",
+			trello.Card{ID: "c1", Name: "Cat @anna", Desc: "Write to owner@example.org", Pos: 3},
+			trello.Card{Name: "Cat [removed]", Desc: "Write to [removed]\n\n" + mirrorSourcePrefix + "c1", Pos: 3},
+		},
+		{
+			"empty description",
+			trello.Card{ID: "c2", Name: "Dog", Pos: 1},
+			trello.Card{Name: "Dog", Desc: mirrorSourcePrefix + "c2", Pos: 1},
+		},
+	}
+	for _, c := range cases {
+		mirrored := mirroredCard(&c.card, scrubber)
+		if mirrored.Name != c.expected.Name || mirrored.Desc != c.expected.Desc || mirrored.Pos != c.expected.Pos {
+			t.Errorf("%s: expected %+v, got %+v", c.name, c.expected, mirrored)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/adlio/trello"
+)
+
+const LIST_OVERFLOW_ENV = "LIST_OVERFLOW"
+
+// The overflow list of "Candidates" is "Candidates (overflow)"
+const overflowListSuffix = " (overflow)"
+
+// Returns the overflow list of the list, creating it right after the list if it is missing
+func findOrCreateOverflowList(client *trello.Client, list *trello.List) (*trello.List, error) {
+	board := &trello.Board{ID: list.IDBoard}
+	board.SetClient(client)
+	lists, err := board.GetLists(trello.Arguments{"filter": "open"})
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch lists of the board %v: %w", list.IDBoard, err)
+	}
+	name := list.Name + overflowListSuffix
+	// between the list and the next one
+	listPos := float64(list.Pos)
+	pos := listPos + 65536
+	for _, other := range lists {
+		if other.Name == name {
+			return other, nil
+		}
+		if otherPos := float64(other.Pos); otherPos > listPos && otherPos < pos {
+			pos = otherPos
+		}
+	}
+	pos = (listPos + pos) / 2
+	overflow, err := client.CreateList(board, name, trello.Arguments{"pos": strconv.FormatFloat(pos, 'f', -1, 64)})
+	if err != nil {
+		return nil, fmt.Errorf("can't create list %v on the board %v: %w", name, list.IDBoard, err)
+	}
+	log.Printf("Created overflow list %v (%v)\n", overflow.Name, overflow.ID)
+	return overflow, nil
+}
@@ -0,0 +1,266 @@
+package maintainer
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// Stale card action to be performed by apply
+type plannedAction struct {
+	journalEntry
+	// the card last activity when the plan was made. The card changed since then is not touched
+	DateLastActivity time.Time `json:"dateLastActivity"`
+	// the comment to post before archiving
+	Comment string `json:"comment,omitempty"`
+}
+
+// Actions of the plan file, written by plan and executed by apply
+type actionPlan struct {
+	CreatedAt time.Time       `json:"createdAt"`
+	Actions   []plannedAction `json:"actions"`
+	// the enabled passes whose changes are not planned, "profile: pass"
+	Unplanned []string `json:"unplanned,omitempty"`
+	mu        sync.Mutex
+}
+
+// The enabled passes of the profile changing the board besides the stale card actions, they don't run while planning
+func (p *maintenanceProfile) unplannedPasses() []string {
+	var passes []string
+	for _, pass := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"intake rotation", len(p.intakeBoard) > 0},
+		{"description normalization", len(p.descNormalizeLists) > 0},
+		{"image covers", len(p.imageCoverLists) > 0},
+		{"dedupe", len(p.dedupeLists) > 0},
+		{"age routing", len(p.ageRouting) > 0},
+		{"link check", len(p.linkCheckLists) > 0},
+		{"resolved keywords", len(p.keywordLists) > 0},
+		{"map links", len(p.mapLinkLists) > 0},
+		{"region labels", len(p.regionLabelLists) > 0},
+		{"Kashtanka", len(p.kashtankaLists) > 0},
+		{"member data scrubbing", len(p.memberScrubLists) > 0},
+		{"bot comment cleanup", len(p.botCommentLists) > 0},
+		{"attachment cleanup", len(p.attachmentCleanupLists) > 0},
+		{"card rules", len(p.rules) > 0},
+		{"card reorder (including the list size cap and the overflow moves)", len(p.reorderLists) > 0 || len(p.reorderBoards) > 0},
+		{"position renormalization", len(p.renormalizeLists) > 0},
+		{"empty lists archival", len(p.archiveEmptyLists) > 0},
+		{"label cleanup", len(p.labelCleanupBoards) > 0},
+		{"inactive member removal", len(p.memberCleanupBoards) > 0 && p.removeInactiveMembers},
+		{"list order", len(p.listOrderBoards) > 0},
+		{"mirror board sync", len(p.mirrorLists) > 0},
+	} {
+		if pass.enabled {
+			passes = append(passes, pass.name)
+		}
+	}
+	return passes
+}
+
+// Records the passes the plan misses and warns about them
+func (p *actionPlan) addUnplanned(profile string, passes []string) {
+	if len(passes) == 0 {
+		return
+	}
+	log.Printf("WARNING: the passes of the profile \"%s\" are not planned, apply won't perform them and the plan doesn't show their changes: %s\n", profile, strings.Join(passes, ", "))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pass := range passes {
+		p.Unplanned = append(p.Unplanned, profile+": "+pass)
+	}
+}
+
+func (p *actionPlan) add(entry journalEntry, card *trello.Card, comment string) {
+	action := plannedAction{journalEntry: entry, Comment: comment}
+	if card.DateLastActivity != nil {
+		action.DateLastActivity = *card.DateLastActivity
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Actions = append(p.Actions, action)
+	log.Printf("Planned %v of card \"%v\" (%v): %s\n", entry.Action, entry.CardName, entry.CardID, entry.Reason)
+}
+
+// Writes the stale card actions the maintenance would perform to the plan file without changing anything
+func runPlan(args []string) {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	out := flags.String("out", "plan.json", "plan file to write")
+	strict := flags.Bool("strict", false, "fail if any of the enabled passes can't be planned")
+	flags.Parse(args)
+
+	plan := &actionPlan{CreatedAt: time.Now()}
+	if err := runMaintenance(maintenanceOptions{plan: plan}); err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	sort.Slice(plan.Actions, func(i, j int) bool {
+		if plan.Actions[i].ListID != plan.Actions[j].ListID {
+			return plan.Actions[i].ListID < plan.Actions[j].ListID
+		}
+		return plan.Actions[i].CardID < plan.Actions[j].CardID
+	})
+	if *strict && len(plan.Unplanned) > 0 {
+		log.Fatalf("ERROR: %d enabled passes can't be planned, the plan is not written: %s\n", len(plan.Unplanned), strings.Join(plan.Unplanned, "; "))
+	}
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		log.Fatalf("ERROR: can't serialize the plan: %v\n", err)
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatalf("ERROR: can't write the plan: %v\n", err)
+	}
+	counts := make(map[journalActionType]int)
+	for _, action := range plan.Actions {
+		counts[action.Action]++
+	}
+	log.Printf("Plan of %d actions (%d archive, %d delete, %d move to board) is written to %v\n",
+		len(plan.Actions), counts[journalActionArchive], counts[journalActionDelete], counts[journalActionMoveToBoard], *out)
+}
+
+// Performs exactly the actions of the plan file. Nothing is done if any of the planned cards changed since the plan was made
+func runApply(args []string) {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s apply <plan file>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("ERROR: can't read the plan: %v\n", err)
+	}
+	var plan actionPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		log.Fatalf("ERROR: can't parse the plan: %v\n", err)
+	}
+	log.Printf("Applying the plan of %d actions made at %v\n", len(plan.Actions), plan.CreatedAt)
+	if len(plan.Unplanned) > 0 {
+		log.Printf("WARNING: the plan covers only the stale card actions, these passes are not applied: %s\n", strings.Join(plan.Unplanned, "; "))
+	}
+
+	lock, err := acquireRunLockFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	defer lock.release()
+
+	client := newTrelloClient(extractSecretEnvOrExit(TRELLO_KEY_ENV), extractSecretEnvOrExit(TRELLO_TOKEN_ENV))
+	if err := loadExemptCardIDs(); err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+
+	// all of the cards are checked before anything is changed
+	cards := make([]*trello.Card, len(plan.Actions))
+	changed := 0
+	for i, action := range plan.Actions {
+		card, err := client.GetCard(action.CardID, trello.Defaults())
+		var why string
+		switch {
+		case err != nil:
+			why = fmt.Sprintf("can't fetch the card: %v", err)
+		case exemptCardIDs[card.ID]:
+			why = "the card is exempt"
+		case card.Closed:
+			why = "the card is archived"
+		case card.IDList != action.ListID:
+			why = "the card is moved to another list"
+		case card.DateLastActivity == nil || !card.DateLastActivity.Equal(action.DateLastActivity):
+			why = "the card has new activity"
+		}
+		if len(why) > 0 {
+			log.Printf("Card \"%v\" (%v) changed since the plan was made: %s\n", action.CardName, action.CardID, why)
+			changed++
+			continue
+		}
+		cards[i] = card
+	}
+	if changed > 0 {
+		log.Fatalf("ERROR: %d planned cards changed since the plan was made, nothing is applied. Make a new plan\n", changed)
+	}
+
+	var backup cardBackupStorage
+	for _, action := range plan.Actions {
+		if action.Action == journalActionDelete {
+			backup, err = newCardBackupStorageFromEnv()
+			if err != nil {
+				log.Fatalf("ERROR: can't configure card backups: %v\n", err)
+			}
+			break
+		}
+	}
+	scrubber, err := piiScrubberFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	closing := archiveChecklistFromEnv()
+	journal, err := openActionJournalFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	if journal != nil {
+		defer journal.close()
+	}
+	currentRun, err := startRunFromEnv(journal, journalRunMaintenance, time.Now())
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	defer currentRun.close()
+	audit, err := openAuditLogFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	defer audit.close()
+
+	lists := make(map[string]*trello.List)
+	failed := 0
+	for i, action := range plan.Actions {
+		card := cards[i]
+		list, fetched := lists[action.ListID]
+		if !fetched {
+			list = trelloops.FetchList(client, action.ListID)
+			lists[action.ListID] = list
+		}
+		entry := action.journalEntry
+		entry.Timestamp = time.Now()
+		record := auditRecord{
+			Timestamp: entry.Timestamp,
+			Pass:      "apply",
+			CardID:    card.ID,
+			CardName:  card.Name,
+			ListID:    list.ID,
+			ListName:  list.Name,
+			Rule:      entry.Reason,
+		}
+		if err := performStaleAction(trelloops.NewClientGateway(client), list, card, entry, action.Comment, backup, scrubber, closing); err != nil {
+			log.Printf("%v\n", err)
+			record.Decision = auditDecisionError
+			record.Detail = err.Error()
+			audit.write(record)
+			failed++
+			continue
+		}
+		log.Printf("Applied %v of card \"%v\" (%v)\n", entry.Action, card.Name, card.ID)
+		record.Decision = staleActionAuditDecision(entry.Action)
+		currentRun.record(entry)
+		audit.write(record)
+	}
+	if failed > 0 {
+		log.Fatalf("ERROR: %d of %d planned actions failed\n", failed, len(plan.Actions))
+	}
+	log.Println("Done")
+}
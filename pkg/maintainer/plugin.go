@@ -0,0 +1,108 @@
+package maintainer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+const PLUGIN_TIMEOUT_SECONDS_ENV = "PLUGIN_TIMEOUT_SECONDS"
+
+// The longest plugin stderr kept for the error
+const maxPluginStderr = 1024
+
+// What the plugin receives on stdin, one card per plugin process
+type pluginRequest struct {
+	Rule    string       `json:"rule"`
+	Reason  string       `json:"reason"`
+	BoardID string       `json:"boardId"`
+	ListID  string       `json:"listId"`
+	URL     string       `json:"url"`
+	Card    ruleExprCard `json:"card"`
+}
+
+type pluginStatusEnum string
+
+const (
+	pluginStatusDone pluginStatusEnum = "done"
+	pluginStatusSkip pluginStatusEnum = "skip"
+)
+
+// What the plugin writes to stdout. Empty output is the same as {"status": "done"}
+type pluginResponse struct {
+	Status pluginStatusEnum `json:"status"`
+	// recorded to the audit log
+	Detail string `json:"detail"`
+	// posted to the card by the maintainer if set
+	Comment string `json:"comment"`
+}
+
+// Runs the plugin executables of the rules
+type pluginRunner struct {
+	timeout time.Duration
+}
+
+func pluginRunnerFromEnv() *pluginRunner {
+	return &pluginRunner{
+		timeout: time.Duration(extractIntEnvOrDefault(PLUGIN_TIMEOUT_SECONDS_ENV, 30)) * time.Second,
+	}
+}
+
+// Runs the command with the request on stdin. The plugin fails if it exits with non-zero code, times out or writes malformed response
+func (p *pluginRunner) run(ctx context.Context, command []string, request pluginRequest) (pluginResponse, error) {
+	var response pluginResponse
+	input, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return response, fmt.Errorf("plugin %s timed out after %v", command[0], p.timeout)
+		}
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > maxPluginStderr {
+			message = message[:maxPluginStderr] + "..."
+		}
+		return response, fmt.Errorf("plugin %s failed: %w: %s", command[0], err, message)
+	}
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) == 0 {
+		response.Status = pluginStatusDone
+		return response, nil
+	}
+	if err := json.Unmarshal(output, &response); err != nil {
+		return response, fmt.Errorf("can't parse the response of plugin %s: %w", command[0], err)
+	}
+	switch response.Status {
+	case "":
+		response.Status = pluginStatusDone
+	case pluginStatusDone, pluginStatusSkip:
+	default:
+		return response, fmt.Errorf("unsupported status \"%s\" of plugin %s response (expected done or skip)", response.Status, command[0])
+	}
+	return response, nil
+}
+
+func newPluginRequest(rule *cardRule, reason string, list *trello.List, card *trello.Card, similarity *float64, now time.Time) pluginRequest {
+	return pluginRequest{
+		Rule:    rule.name,
+		Reason:  reason,
+		BoardID: list.IDBoard,
+		ListID:  list.ID,
+		URL:     card.ShortURL,
+		Card:    newRuleExprCard(list, card, similarity, now),
+	}
+}
@@ -0,0 +1,69 @@
+package maintainer
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	rpprof "runtime/pprof"
+)
+
+const PPROF_LISTEN_ADDR_ENV = "PPROF_LISTEN_ADDR"
+
+// Serves net/http/pprof on its own address, so the profiles are never exposed via the control API
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	log.Printf("pprof listens on %v\n", addr)
+	log.Printf("pprof stopped: %v\n", http.ListenAndServe(addr, mux))
+}
+
+// Profiles of a single maintenance run, empty paths disable them
+type runProfiles struct {
+	cpuPath  string
+	heapPath string
+	cpuFile  *os.File
+}
+
+func (p *runProfiles) start() {
+	if len(p.cpuPath) == 0 {
+		return
+	}
+	file, err := os.Create(p.cpuPath)
+	if err != nil {
+		log.Fatalf("ERROR: can't create CPU profile: %v\n", err)
+	}
+	if err := rpprof.StartCPUProfile(file); err != nil {
+		log.Fatalf("ERROR: can't start CPU profile: %v\n", err)
+	}
+	p.cpuFile = file
+}
+
+// Finishes the CPU profile and writes the heap profile
+func (p *runProfiles) stop() {
+	if p.cpuFile != nil {
+		rpprof.StopCPUProfile()
+		p.cpuFile.Close()
+		log.Printf("CPU profile is written to %v\n", p.cpuPath)
+	}
+	if len(p.heapPath) == 0 {
+		return
+	}
+	file, err := os.Create(p.heapPath)
+	if err != nil {
+		log.Printf("Can't create heap profile: %v\n", err)
+		return
+	}
+	defer file.Close()
+	runtime.GC()
+	if err := rpprof.WriteHeapProfile(file); err != nil {
+		log.Printf("Can't write heap profile: %v\n", err)
+		return
+	}
+	log.Printf("Heap profile is written to %v\n", p.heapPath)
+}
@@ -0,0 +1,193 @@
+package maintainer
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// auto (when stderr is a terminal), on or off
+const PROGRESS_ENV = "PROGRESS"
+
+const progressRefreshInterval = 500 * time.Millisecond
+
+// The status line of the current pass at the bottom of the terminal, e.g.
+//
+//	stale cards archival: 2/5 lists, 1240/3113 cards, 2m10s
+//
+// The log lines are printed above it. Set once at the start of the maintenance run, nil (reporting nothing) if disabled
+var consoleProgress *progressReporter
+
+// The counters of the current pass
+type progressCounters struct {
+	pass        string
+	passStarted time.Time
+	lists       int
+	listsDone   int
+	cards       int
+	cardsDone   int
+}
+
+// The list seen by the card passes of the run
+type listProgress struct {
+	id   string
+	name string
+	// as fetched by the latest pass
+	cards int
+}
+
+type progressReporter struct {
+	mu sync.Mutex
+	// the log output before the reporter took it over
+	out io.Writer
+	progressCounters
+	listCards map[string]*listProgress
+	// whether the status line is on the screen
+	shown   bool
+	stopped bool
+	done    chan struct{}
+}
+
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Starts the progress reporting if PROGRESS enables it. The log output goes through the reporter until stop
+func startProgressFromEnv() *progressReporter {
+	switch mode := strings.ToLower(extractEnvOrDefault(PROGRESS_ENV, "auto")); mode {
+	case "off":
+		return nil
+	case "auto":
+		if !stderrIsTerminal() {
+			return nil
+		}
+	case "on":
+	default:
+		configFatalf("unsupported \"%s\" env var value %s (expected auto, on or off)", PROGRESS_ENV, mode)
+	}
+	p := &progressReporter{out: log.Writer(), done: make(chan struct{})}
+	log.SetOutput(p)
+	go func() {
+		ticker := time.NewTicker(progressRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.mu.Lock()
+				p.redraw()
+				p.mu.Unlock()
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Removes the status line and gives the log output back
+func (p *progressReporter) stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	p.mu.Lock()
+	p.clear()
+	p.stopped = true
+	p.mu.Unlock()
+	// not holding the lock, as the log calls Write holding its own one
+	log.SetOutput(p.out)
+}
+
+// Writes the log line above the status line
+func (p *progressReporter) Write(line []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	n, err := p.out.Write(line)
+	p.redraw()
+	return n, err
+}
+
+// The caller holds the lock
+func (p *progressReporter) clear() {
+	if p.shown {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.shown = false
+	}
+}
+
+// The caller holds the lock
+func (p *progressReporter) redraw() {
+	if len(p.pass) == 0 || p.stopped {
+		return
+	}
+	line := fmt.Sprintf("%s: %d/%d lists", p.pass, p.listsDone, p.lists)
+	if p.cards > 0 {
+		line += fmt.Sprintf(", %d/%d cards", p.cardsDone, p.cards)
+	}
+	line += ", " + time.Since(p.passStarted).Round(time.Second).String()
+	fmt.Fprint(p.out, "\r\033[K"+line)
+	p.shown = true
+}
+
+// Resets the counters for the pass over the lists
+func (p *progressReporter) startPass(pass string, lists int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pass, p.passStarted = pass, time.Now()
+	p.lists, p.listsDone, p.cards, p.cardsDone = lists, 0, 0, 0
+	p.redraw()
+}
+
+func (p *progressReporter) listDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listsDone++
+}
+
+// The cards of a list of the pass are fetched
+func (p *progressReporter) addCards(list *trello.List, count int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cards += count
+	if p.listCards == nil {
+		p.listCards = make(map[string]*listProgress)
+	}
+	p.listCards[list.ID] = &listProgress{id: list.ID, name: list.Name, cards: count}
+}
+
+// The counters of the current pass and the lists seen so far
+func (p *progressReporter) snapshot() (progressCounters, []listProgress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	lists := make([]listProgress, 0, len(p.listCards))
+	for _, list := range p.listCards {
+		lists = append(lists, *list)
+	}
+	return p.progressCounters, lists
+}
+
+func (p *progressReporter) cardDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cardsDone++
+}
@@ -0,0 +1,260 @@
+package maintainer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const TRELLO_REGION_LABEL_LISTS_ENV = "TRELLO_REGION_LABEL_LISTS"
+const REGIONS_GEOJSON_ENV = "REGIONS_GEOJSON"
+const REGION_NAME_PROPERTY_ENV = "REGION_NAME_PROPERTY"
+const REGION_GEOCODER_URL_ENV = "REGION_GEOCODER_URL"
+const REGION_LABEL_COLOR_ENV = "REGION_LABEL_COLOR"
+
+// Finds the name of the region (city, district, etc.) the point belongs to. Empty name means the region is unknown
+type regionResolver interface {
+	regionOf(point geoPoint) (string, error)
+	describe() string
+}
+
+// Returns nil if neither the regions file nor the geocoder is configured
+func regionResolverFromEnv() (regionResolver, error) {
+	if path := extractEnvOrDefault(REGIONS_GEOJSON_ENV, ""); len(path) > 0 {
+		return loadPolygonRegions(path, extractEnvOrDefault(REGION_NAME_PROPERTY_ENV, "name"))
+	}
+	if endpoint := extractEnvOrDefault(REGION_GEOCODER_URL_ENV, ""); len(endpoint) > 0 {
+		return &geocoderRegions{
+			endpoint: endpoint,
+			client:   &http.Client{Timeout: 15 * time.Second, Transport: outboundTransport()},
+			cache:    make(map[string]string),
+		}, nil
+	}
+	return nil, nil
+}
+
+// Offline regions read from the GeoJSON file. Rings are lists of [lon, lat] positions,
+// the first ring of the polygon is the outer boundary, the rest are holes
+type polygonRegion struct {
+	name     string
+	polygons [][][][2]float64
+}
+
+type polygonRegions struct {
+	path    string
+	regions []polygonRegion
+}
+
+func loadPolygonRegions(path string, nameProperty string) (*polygonRegions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read regions file %v: %w", path, err)
+	}
+	var collection struct {
+		Features []struct {
+			Properties map[string]interface{} `json:"properties"`
+			Geometry   struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("can't parse regions file %v: %w", path, err)
+	}
+	result := &polygonRegions{path: path}
+	for i, feature := range collection.Features {
+		name, _ := feature.Properties[nameProperty].(string)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("feature %d of %v has no \"%s\" property", i, path, nameProperty)
+		}
+		region := polygonRegion{name: name}
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var polygon [][][2]float64
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &polygon); err != nil {
+				return nil, fmt.Errorf("invalid polygon of region %v: %w", name, err)
+			}
+			region.polygons = append(region.polygons, polygon)
+		case "MultiPolygon":
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &region.polygons); err != nil {
+				return nil, fmt.Errorf("invalid multipolygon of region %v: %w", name, err)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported geometry %v of region %v", feature.Geometry.Type, name)
+		}
+		result.regions = append(result.regions, region)
+	}
+	return result, nil
+}
+
+// Ray casting point-in-ring test
+func ringContains(ring [][2]float64, point geoPoint) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > point.lat) != (yj > point.lat) && point.lon < (xj-xi)*(point.lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func polygonContains(polygon [][][2]float64, point geoPoint) bool {
+	if len(polygon) == 0 || !ringContains(polygon[0], point) {
+		return false
+	}
+	for _, hole := range polygon[1:] {
+		if ringContains(hole, point) {
+			return false
+		}
+	}
+	return true
+}
+
+// The first region of the file containing the point
+func (r *polygonRegions) regionOf(point geoPoint) (string, error) {
+	for _, region := range r.regions {
+		for _, polygon := range region.polygons {
+			if polygonContains(polygon, point) {
+				return region.name, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (r *polygonRegions) describe() string {
+	return fmt.Sprintf("%d regions of %v", len(r.regions), r.path)
+}
+
+// Nominatim compatible reverse geocoding API (e.g. https://nominatim.openstreetmap.org/reverse).
+// Requests are sent one per second as required by the public Nominatim instance, the results are cached
+type geocoderRegions struct {
+	endpoint    string
+	client      *http.Client
+	mu          sync.Mutex
+	lastRequest time.Time
+	cache       map[string]string
+}
+
+func (g *geocoderRegions) regionOf(point geoPoint) (string, error) {
+	// ~100 m precision is enough to tell the city
+	key := strconv.FormatFloat(point.lat, 'f', 3, 64) + "," + strconv.FormatFloat(point.lon, 'f', 3, 64)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if name, cached := g.cache[key]; cached {
+		return name, nil
+	}
+	if wait := time.Second - time.Since(g.lastRequest); wait > 0 {
+		time.Sleep(wait)
+	}
+	g.lastRequest = time.Now()
+
+	params := url.Values{}
+	params.Set("format", "jsonv2")
+	params.Set("zoom", "10")
+	params.Set("lat", strconv.FormatFloat(point.lat, 'f', 6, 64))
+	params.Set("lon", strconv.FormatFloat(point.lon, 'f', 6, 64))
+	req, err := http.NewRequest(http.MethodGet, g.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "TrelloBoardMaintainer (github.com/LostPetInitiative/TrelloBoardMaintainer)")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("geocoder responded with HTTP %d", resp.StatusCode)
+	}
+	var result struct {
+		Address map[string]string `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("can't parse geocoder response: %w", err)
+	}
+	name := ""
+	for _, field := range []string{"city", "town", "village", "municipality", "county", "state"} {
+		if value := result.Address[field]; len(value) > 0 {
+			name = value
+			break
+		}
+	}
+	g.cache[key] = name
+	return name, nil
+}
+
+func (g *geocoderRegions) describe() string {
+	return "geocoder " + g.endpoint
+}
+
+// Applies the region label (created if missing) to the cards of the lists having coordinates
+func labelListsWithRegions(ctx context.Context, client *trello.Client, commaSepListId string, coordinates coordinatesSource, regions regionResolver, color string, audit *auditLog) {
+	processLists(ctx, commaSepListId, "region labels", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		list := trelloops.FetchList(listClient(ctx, client), listId)
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		// region name -> label of the board
+		labels := make(map[string]*trello.Label)
+		now := time.Now()
+		for _, card := range cards {
+			point := coordinates.extract(card)
+			if point == nil {
+				continue
+			}
+			region, err := regions.regionOf(*point)
+			if err != nil {
+				log.Printf("Can't find region of card \"%v\" (%v) at %v: %v\n", card.Name, card.ID, *point, err)
+				continue
+			}
+			if len(region) == 0 {
+				continue
+			}
+			label, known := labels[region]
+			if !known {
+				label, err = findOrCreateBoardLabel(client, list.IDBoard, region, color)
+				if err != nil {
+					log.Printf("Can't get label for region %v: %v\n", region, err)
+					continue
+				}
+				labels[region] = label
+			}
+			if containsString(card.IDLabels, label.ID) {
+				continue
+			}
+			if err := card.AddIDLabel(label.ID); err != nil {
+				log.Printf("Failed to label card \"%v\" (%v) with region %v: %v\n", card.Name, card.ID, region, err)
+				continue
+			}
+			log.Printf("Labeled card \"%v\" (%v) with region %v\n", card.Name, card.ID, region)
+			audit.write(auditRecord{
+				Timestamp: now,
+				Pass:      "region",
+				CardID:    card.ID,
+				CardName:  card.Name,
+				ListID:    list.ID,
+				ListName:  list.Name,
+				Decision:  auditDecisionLabel,
+				Rule:      fmt.Sprintf("coordinates %v are in %s", *point, region),
+				Detail:    region,
+			})
+		}
+	})
+}
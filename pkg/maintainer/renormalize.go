@@ -0,0 +1,77 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/adlio/trello"
+)
+
+const TRELLO_RENORMALIZE_LISTS_ENV = "TRELLO_RENORMALIZE_LISTS"
+const POSITION_DRIFT_MIN_GAP_ENV = "POSITION_DRIFT_MIN_GAP"
+
+// Trello itself places the new card 65536 after the bottom one
+const evenPositionSpacing = 65536.0
+
+// Detects the positions that collapsed after many insertions between neighbours:
+// duplicates, gaps smaller than minGap or values that lost float precision
+func detectPositionDrift(cards []*trello.Card, minGap float64) (bool, string) {
+	positions := make([]float64, 0, len(cards))
+	for _, card := range cards {
+		if math.IsNaN(card.Pos) || math.IsInf(card.Pos, 0) || card.Pos <= 0 {
+			return true, fmt.Sprintf("card %v has invalid position %v", card.ID, card.Pos)
+		}
+		positions = append(positions, card.Pos)
+	}
+	sort.Float64s(positions)
+	for i := 1; i < len(positions); i++ {
+		gap := positions[i] - positions[i-1]
+		if gap < minGap {
+			return true, fmt.Sprintf("positions %v and %v are only %v apart", positions[i-1], positions[i], gap)
+		}
+		// the neighbour can't be placed in between with float64 precision
+		if positions[i] == math.Nextafter(positions[i-1], math.Inf(1)) {
+			return true, fmt.Sprintf("no float space between positions %v and %v", positions[i-1], positions[i])
+		}
+	}
+	return false, ""
+}
+
+// Rewrites the positions of all of the cards to evenly spaced values keeping the current order
+func renormalizeListPositions(list *trello.List, cards []*trello.Card, journal *runJournal) {
+	ordered := make([]*trello.Card, len(cards))
+	copy(ordered, cards)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Pos < ordered[j].Pos })
+
+	var wg sync.WaitGroup
+	var panics cardPanics
+	wg.Add(len(ordered))
+	for i, card := range ordered {
+		go func(card *trello.Card, newPos float64) {
+			defer wg.Done()
+			defer panics.catch()
+			oldPos := card.Pos
+			if oldPos == newPos {
+				return
+			}
+			if err := card.SetPos(newPos); err != nil {
+				log.Printf("Failed to renormalize pos of %v (%v): %v\n", card.Name, card.ID, err)
+				return
+			}
+			journal.record(journalEntry{
+				Action:   journalActionReorder,
+				CardID:   card.ID,
+				CardName: card.Name,
+				BoardID:  list.IDBoard,
+				ListID:   list.ID,
+				ListName: list.Name,
+				Reason:   fmt.Sprintf("renormalization, pos %v -> %v", oldPos, newPos),
+			})
+		}(card, float64(i+1)*evenPositionSpacing)
+	}
+	wg.Wait()
+	panics.rethrow()
+}
@@ -0,0 +1,551 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const REORDER_SIMILARITY_WEIGHT_ENV = "REORDER_SIMILARITY_WEIGHT"
+const REORDER_FRESHNESS_WEIGHT_ENV = "REORDER_FRESHNESS_WEIGHT"
+const REORDER_FRESHNESS_HALF_LIFE_HOURS_ENV = "REORDER_FRESHNESS_HALF_LIFE_HOURS"
+const REORDER_TIE_BREAK_ENV = "REORDER_TIE_BREAK"
+const REORDER_POSITION_SCALE_ENV = "REORDER_POSITION_SCALE"
+const REORDER_TOLERANCE_ENV = "REORDER_TOLERANCE"
+const LIST_MAX_CARDS_ENV = "LIST_MAX_CARDS"
+const MIN_SIMILARITY_ENV = "MIN_SIMILARITY"
+const LOW_SIMILARITY_LIST_ENV = "LOW_SIMILARITY_LIST"
+
+// Offset between the tied cards relative to the strategy tolerance,
+// but at least tieBreakMinGapFactor drift minimal gaps so that the tied cards are not seen as drifted
+const tieBreakStepFraction = 1e-4
+const tieBreakMinGapFactor = 2.0
+
+type reorderStrategyEnum int32
+
+const (
+	// the higher the similarity (score) the closer the card to the top
+	reorderStrategySimilarity reorderStrategyEnum = iota + 1
+	// the earliest due date at the top, cards without due date at the bottom
+	reorderStrategyDueDate
+	// the oldest card at the top (creation time is encoded in the card ID)
+	reorderStrategyCreationDate
+	// the closest to the reference point at the top, cards without coordinates at the bottom
+	reorderStrategyDistance
+)
+
+// Positions are unix seconds for the time based strategies.
+// This is past any real due date (year 2096), so cards without due date stay at the bottom
+const noDueDatePos = 4e9
+
+// Positions are meters for the distance strategy. This is longer than any distance on Earth
+const noCoordinatesPos = 1e8
+
+var reorderStrategyNames = map[string]reorderStrategyEnum{
+	"similarity": reorderStrategySimilarity,
+	"due":        reorderStrategyDueDate,
+	"created":    reorderStrategyCreationDate,
+	"distance":   reorderStrategyDistance,
+}
+
+// Splits the reorder list spec "listId[:strategy]" (e.g. "5f1a...:due").
+// Similarity strategy is used if it is not specified
+func parseReorderListSpec(spec string) (string, reorderStrategyEnum, error) {
+	listId, strategyName, hasStrategy := strings.Cut(strings.TrimSpace(spec), ":")
+	if !hasStrategy {
+		return listId, reorderStrategySimilarity, nil
+	}
+	strategy, known := reorderStrategyNames[strategyName]
+	if !known {
+		return listId, 0, fmt.Errorf("unknown reorder strategy \"%s\" for list %s", strategyName, listId)
+	}
+	return listId, strategy, nil
+}
+
+// Secondary sort key for the cards with equal primary key
+type tieBreakEnum int32
+
+const (
+	// the oldest card first
+	tieBreakCreationDate tieBreakEnum = iota + 1
+	// lexicographical order of card IDs
+	tieBreakCardID
+)
+
+func tieBreakFromEnv() (tieBreakEnum, error) {
+	name := extractEnvOrDefault(REORDER_TIE_BREAK_ENV, "created")
+	switch name {
+	case "created":
+		return tieBreakCreationDate, nil
+	case "id":
+		return tieBreakCardID, nil
+	default:
+		return 0, fmt.Errorf("unsupported %s value \"%s\" (expected created or id)", REORDER_TIE_BREAK_ENV, name)
+	}
+}
+
+func (t tieBreakEnum) String() string {
+	switch t {
+	case tieBreakCreationDate:
+		return "creation date"
+	case tieBreakCardID:
+		return "card ID"
+	default:
+		return fmt.Sprintf("tieBreak(%d)", int32(t))
+	}
+}
+
+func (t tieBreakEnum) less(a *trello.Card, b *trello.Card) bool {
+	if t == tieBreakCreationDate {
+		aCreated, bCreated := a.CreatedAt(), b.CreatedAt()
+		if !aCreated.Equal(bCreated) {
+			return aCreated.Before(bCreated)
+		}
+	}
+	return a.ID < b.ID
+}
+
+// How the cards are reordered and where the decisions are recorded to
+type reorderPolicy struct {
+	strategy   reorderStrategyEnum
+	tieBreak   tieBreakEnum
+	journal    *runJournal
+	audit      *auditLog
+	similarity similaritySource
+	scoring    orderScoring
+	now        time.Time
+	// minimal gap between card positions, below which the positions are considered drifted
+	driftMinGap float64
+	// cards beyond the top maxCards of the list are archived (0 means no limit),
+	// or moved to the overflow list of the list (overflowListID, resolved when the list exceeds the limit) if overflow is set
+	maxCards       int
+	overflow       bool
+	overflowListID string
+	// cards with similarity below minSimilarity are archived (0 means no threshold),
+	// or moved to lowSimilarityListID if it is set
+	minSimilarity       float64
+	lowSimilarityListID string
+	// post the explanation comment before archiving the evicted card
+	archiveComment bool
+	// where the card coordinates are read from and the point the distance strategy measures from
+	coordinates    coordinatesSource
+	referencePoint *geoPoint
+	// removes the personal data from the evicted card before archiving (nil if disabled)
+	scrubber *piiScrubber
+	// ticks the closing checklist item of the evicted card before archiving (nil if disabled)
+	closing *archiveChecklist
+	// the label of the cards whose similarity is missing or malformed (disabled if the name is empty),
+	// resolved on the board of the list being reordered
+	needsFixLabelName string
+	needsFixLabel     *trello.Label
+	// cards with the matching names are left alone (nil if disabled)
+	excludeNames *regexp.Regexp
+	// client of the list, the card spans are derived from its context
+	client *trello.Client
+	// performs the card operations: position changes, evictions and labels
+	gateway trelloops.TrelloGateway
+	// asks the operator before each eviction (nil approves everything)
+	confirm *operatorConfirmation
+}
+
+// Ordering score is the weighted average of the similarity and the card freshness.
+// Freshness is 1.0 for a just created card and halves every freshnessHalfLife.
+// The card position is (1 - score) * positionScale, the card is not moved if its position
+// corresponds to the score within the tolerance (in score units)
+type orderScoring struct {
+	similarityWeight  float64
+	freshnessWeight   float64
+	freshnessHalfLife time.Duration
+	positionScale     float64
+	tolerance         float64
+}
+
+func orderScoringFromEnv() (orderScoring, error) {
+	scoring := orderScoring{
+		similarityWeight:  extractFloatEnvOrDefault(REORDER_SIMILARITY_WEIGHT_ENV, 1.0),
+		freshnessWeight:   extractFloatEnvOrDefault(REORDER_FRESHNESS_WEIGHT_ENV, 0.0),
+		freshnessHalfLife: time.Duration(extractFloatEnvOrDefault(REORDER_FRESHNESS_HALF_LIFE_HOURS_ENV, 168) * float64(time.Hour)),
+		positionScale:     extractFloatEnvOrDefault(REORDER_POSITION_SCALE_ENV, 1e7),
+		tolerance:         extractFloatEnvOrDefault(REORDER_TOLERANCE_ENV, 1e-2),
+	}
+	if scoring.similarityWeight < 0 || scoring.freshnessWeight < 0 {
+		return scoring, fmt.Errorf("%s and %s must not be negative", REORDER_SIMILARITY_WEIGHT_ENV, REORDER_FRESHNESS_WEIGHT_ENV)
+	}
+	if scoring.similarityWeight+scoring.freshnessWeight == 0 {
+		return scoring, fmt.Errorf("at least one of %s and %s must be positive", REORDER_SIMILARITY_WEIGHT_ENV, REORDER_FRESHNESS_WEIGHT_ENV)
+	}
+	if scoring.freshnessHalfLife <= 0 {
+		return scoring, fmt.Errorf("%s must be positive", REORDER_FRESHNESS_HALF_LIFE_HOURS_ENV)
+	}
+	// Trello positions must be positive and precise enough to tell the neighbouring cards apart
+	if scoring.positionScale < 1 || scoring.positionScale > 1e12 {
+		return scoring, fmt.Errorf("%s must be in [1; 1e12] range, got %v", REORDER_POSITION_SCALE_ENV, scoring.positionScale)
+	}
+	if scoring.tolerance < 0 || scoring.tolerance >= 1 {
+		return scoring, fmt.Errorf("%s must be in [0; 1) range, got %v", REORDER_TOLERANCE_ENV, scoring.tolerance)
+	}
+	return scoring, nil
+}
+
+// Score in [0;1] range (for similarity in [0;1] range), the higher the score the closer the card is to the top
+func (s orderScoring) score(similarity float64, createdAt time.Time, now time.Time) float64 {
+	if s.freshnessWeight == 0 {
+		return similarity
+	}
+	age := now.Sub(createdAt)
+	if age < 0 {
+		age = 0
+	}
+	freshness := math.Pow(0.5, age.Hours()/s.freshnessHalfLife.Hours())
+	return (s.similarityWeight*similarity + s.freshnessWeight*freshness) / (s.similarityWeight + s.freshnessWeight)
+}
+
+// Returns the position the card should have according to the strategy and how far from it the card may be.
+// ok is false if the card can't be positioned, needsFix is set if its similarity is missing or malformed
+func desiredCardPos(card *trello.Card, policy *reorderPolicy, audit *auditRecord) (pos float64, tolerance float64, detail string, ok bool, needsFix bool) {
+	switch policy.strategy {
+	case reorderStrategySimilarity:
+		cardSim, recovered := policy.similarity.extractRecovering(card)
+		if cardSim == nil {
+			audit.Rule = "no similarity found"
+			return 0, 0, "", false, true
+		}
+		audit.Similarity = cardSim
+		score := policy.scoring.score(*cardSim, card.CreatedAt(), policy.now)
+		detail = fmt.Sprintf("similarity %s, score %s", strconv.FormatFloat(*cardSim, 'f', 4, 64), strconv.FormatFloat(score, 'f', 4, 64))
+		return (1.0 - score) * policy.scoring.positionScale, policy.scoring.tolerance * policy.scoring.positionScale, detail, true, recovered
+	case reorderStrategyDueDate:
+		if card.Due == nil {
+			return noDueDatePos, 1, "no due date", true, false
+		}
+		return float64(card.Due.Unix()), 1, fmt.Sprintf("due %s", card.Due.Format(time.RFC3339)), true, false
+	case reorderStrategyCreationDate:
+		createdAt, err := trello.IDToTime(card.ID)
+		if err != nil {
+			audit.Rule = "can't derive creation time from card ID"
+			return 0, 0, "", false, false
+		}
+		return float64(createdAt.Unix()), 1, fmt.Sprintf("created %s", createdAt.Format(time.RFC3339)), true, false
+	case reorderStrategyDistance:
+		point := policy.coordinates.extract(card)
+		if point == nil {
+			return noCoordinatesPos, 1, "no coordinates", true, false
+		}
+		distance := distanceMeters(*policy.referencePoint, *point)
+		return distance, 1, fmt.Sprintf("%.0f m from %v", distance, *policy.referencePoint), true, false
+	default:
+		log.Panicf("Unsupported reorder strategy: %v", policy.strategy)
+		return 0, 0, "", false, false
+	}
+}
+
+// The position the card should be moved to
+type reorderPlanItem struct {
+	card      *trello.Card
+	pos       float64
+	tolerance float64
+	detail    string
+	ok        bool
+	// the similarity of the card is missing or only recovered, see similaritySource
+	needsFix bool
+	// set when the card must be moved even if it is within the tolerance (e.g. to fix tie order)
+	forceMove bool
+	// set when the card must leave the list (e.g. it is beyond the list size limit):
+	// it is archived, or moved to moveToListID if set
+	evict        bool
+	moveToListID string
+	audit        auditRecord
+}
+
+// Computes desired positions of all of the cards of the list.
+// Cards with equal primary key are ordered by the secondary key (tie break)
+// and spread by a tiny offset, so that their order is deterministic across runs
+func planListOrder(list *trello.List, cards []*trello.Card, policy *reorderPolicy) []*reorderPlanItem {
+	items := make([]*reorderPlanItem, 0, len(cards))
+	ties := make(map[float64][]*reorderPlanItem)
+	for _, card := range cards {
+		item := &reorderPlanItem{
+			card: card,
+			audit: auditRecord{
+				Pass:     "reorder",
+				CardID:   card.ID,
+				CardName: card.Name,
+				ListID:   list.ID,
+				ListName: list.Name,
+			},
+		}
+		item.pos, item.tolerance, item.detail, item.ok, item.needsFix = desiredCardPos(card, policy, &item.audit)
+		items = append(items, item)
+		if item.ok {
+			ties[item.pos] = append(ties[item.pos], item)
+		}
+	}
+
+	for _, group := range ties {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return policy.tieBreak.less(group[i].card, group[j].card)
+		})
+		// moving the whole group only if the cards are not in the tie break order already,
+		// otherwise the cards would be moved back and forth on every run
+		inOrder := true
+		for i := 1; i < len(group); i++ {
+			if group[i-1].card.Pos >= group[i].card.Pos {
+				inOrder = false
+				break
+			}
+		}
+		for i, item := range group {
+			step := math.Max(item.tolerance*tieBreakStepFraction, tieBreakMinGapFactor*policy.driftMinGap)
+			item.pos += float64(i) * step
+			item.forceMove = !inOrder
+		}
+	}
+
+	// the strategies compute absolute positions, so the drift (e.g. after manual dragging)
+	// is fixed by rewriting the whole list to the planned positions
+	if drifted, why := detectPlanDrift(items, policy.driftMinGap); drifted {
+		log.Printf("Positions of the list %v drifted (%s), all cards will be repositioned\n", list.Name, why)
+		for _, item := range items {
+			if item.ok && item.card.Pos != item.pos {
+				item.forceMove = true
+				item.audit.Rule = "position drift: " + why
+			}
+		}
+	}
+
+	if policy.minSimilarity > 0 {
+		for _, item := range items {
+			if item.ok && item.audit.Similarity != nil && *item.audit.Similarity < policy.minSimilarity {
+				item.evict = true
+				item.moveToListID = policy.lowSimilarityListID
+				item.audit.Rule = fmt.Sprintf("similarity %v is below %v", *item.audit.Similarity, policy.minSimilarity)
+			}
+		}
+	}
+	if policy.maxCards > 0 {
+		capListSize(items, policy.maxCards, policy.overflowListID)
+	}
+	return items
+}
+
+// Marks the cards beyond the top maxCards for archival, or for moving to overflowListID if it is set (the cards already leaving the list are not counted).
+// The cards are ranked by the planned position, the cards that can't be positioned
+// go after them in their current order
+func capListSize(items []*reorderPlanItem, maxCards int, overflowListID string) {
+	ranked := make([]*reorderPlanItem, 0, len(items))
+	for _, item := range items {
+		if !item.evict {
+			ranked = append(ranked, item)
+		}
+	}
+	if len(ranked) <= maxCards {
+		return
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.ok != b.ok {
+			return a.ok
+		}
+		if a.ok && a.pos != b.pos {
+			return a.pos < b.pos
+		}
+		return a.card.Pos < b.card.Pos
+	})
+	for _, item := range ranked[maxCards:] {
+		item.evict = true
+		item.moveToListID = overflowListID
+		item.audit.Rule = fmt.Sprintf("beyond top %d cards of the list", maxCards)
+	}
+}
+
+// Like detectPositionDrift, but ignores the cards that are planned to be close to each other (e.g. ties)
+func detectPlanDrift(items []*reorderPlanItem, minGap float64) (bool, string) {
+	planned := make([]*reorderPlanItem, 0, len(items))
+	for _, item := range items {
+		if item.ok {
+			planned = append(planned, item)
+		}
+	}
+	sort.Slice(planned, func(i, j int) bool { return planned[i].card.Pos < planned[j].card.Pos })
+	for i := 1; i < len(planned); i++ {
+		prev, cur := planned[i-1], planned[i]
+		if cur.card.Pos-prev.card.Pos < minGap && math.Abs(cur.pos-prev.pos) >= minGap {
+			return true, fmt.Sprintf("positions %v and %v are only %v apart", prev.card.Pos, cur.card.Pos, cur.card.Pos-prev.card.Pos)
+		}
+	}
+	return false, ""
+}
+
+func checkCardForOrder(ctx context.Context, list *trello.List, item *reorderPlanItem, policy reorderPolicy) {
+	defer consoleProgress.cardDone()
+	card := item.card
+	ctx, span := tracer.Start(ctx, "card order", cardSpanAttributes(card.ID, card.Name))
+	defer span.End()
+	policy.gateway = policy.gateway.WithContext(ctx)
+	if policy.client != nil {
+		card.SetClient(policy.client.WithContext(ctx))
+	}
+	audit := item.audit
+	if item.evict {
+		evictCard(list, item, policy)
+		return
+	}
+	if policy.strategy == reorderStrategySimilarity {
+		markSimilarityFix(list, item, policy)
+	}
+	if !item.ok {
+		audit.Decision = auditDecisionSkip
+		policy.audit.write(audit)
+		return
+	}
+
+	newPos := item.pos
+	if !item.forceMove && math.Abs(card.Pos-newPos) <= item.tolerance {
+		audit.Decision = auditDecisionSkip
+		audit.Rule = "already in place"
+		policy.audit.write(audit)
+		return
+	}
+
+	if !item.forceMove {
+		audit.Rule = "position does not match the order"
+	} else if len(audit.Rule) == 0 {
+		audit.Rule = "tie order does not match " + policy.tieBreak.String()
+	}
+	oldPos := card.Pos
+	err := policy.gateway.SetCardPos(card, newPos)
+	if err != nil {
+		log.Printf("Failed to change pos of %v (%v): %v\n", card.Name, card.ID, err)
+		audit.Decision = auditDecisionError
+		audit.Detail = err.Error()
+		policy.audit.write(audit)
+		return
+	}
+	log.Printf("Changed pos of %v (%v) %s to %v\n", card.Name, card.ID, item.detail, newPos)
+	reason := fmt.Sprintf("%s, pos %v -> %v", item.detail, oldPos, newPos)
+	policy.journal.record(journalEntry{
+		Action:   journalActionReorder,
+		CardID:   card.ID,
+		CardName: card.Name,
+		BoardID:  list.IDBoard,
+		ListID:   list.ID,
+		ListName: list.Name,
+		Reason:   reason,
+	})
+	audit.Decision = auditDecisionReorder
+	audit.Detail = reason
+	policy.audit.write(audit)
+}
+
+// Records the card whose similarity is missing or malformed for the run summary and labels it (if the label is set).
+// The label is removed once the similarity is fixed
+func markSimilarityFix(list *trello.List, item *reorderPlanItem, policy reorderPolicy) {
+	card := item.card
+	if item.needsFix {
+		audit := item.audit
+		audit.Decision = auditDecisionNeedsFix
+		audit.Rule = "similarity is recovered from the description"
+		if !item.ok {
+			audit.Rule = "no similarity found"
+		}
+		audit.Detail = card.ShortURL
+		policy.audit.write(audit)
+	}
+	label := policy.needsFixLabel
+	if label == nil || item.needsFix == containsString(card.IDLabels, label.ID) {
+		return
+	}
+	if item.needsFix {
+		if err := policy.gateway.AddCardLabel(card, label.ID); err != nil {
+			log.Printf("Failed to label card \"%v\" (%v) with %v: %v\n", card.Name, card.ID, label.Name, err)
+			return
+		}
+		log.Printf("Labeled card \"%v\" (%v) with %v: its similarity needs a fix\n", card.Name, card.ID, label.Name)
+		return
+	}
+	if err := policy.gateway.RemoveCardLabel(card, label.ID); err != nil {
+		log.Printf("Failed to remove label %v from card \"%v\" (%v): %v\n", label.Name, card.Name, card.ID, err)
+		return
+	}
+	log.Printf("Removed label %v from card \"%v\" (%v) as its similarity is fixed\n", label.Name, card.Name, card.ID)
+}
+
+// Archives the card (or moves it to moveToListID) instead of positioning it
+func evictCard(list *trello.List, item *reorderPlanItem, policy reorderPolicy) {
+	card := item.card
+	audit := item.audit
+	entry := journalEntry{
+		CardID:   card.ID,
+		CardName: card.Name,
+		BoardID:  list.IDBoard,
+		ListID:   list.ID,
+		ListName: list.Name,
+		Reason:   audit.Rule,
+	}
+	action := journalActionArchive
+	if len(item.moveToListID) > 0 {
+		action = journalActionMoveToList
+	}
+	if !policy.confirm.approve(fmt.Sprintf("%v card \"%v\" (%v) of the list %v: %s", action, card.Name, card.ID, list.Name, audit.Rule)) {
+		audit.Decision = auditDecisionSkip
+		audit.Detail = "declined by the operator"
+		policy.audit.write(audit)
+		return
+	}
+	if len(item.moveToListID) > 0 {
+		if err := policy.gateway.MoveCardToList(card, item.moveToListID); err != nil {
+			log.Printf("Failed to move card \"%v\" (%v) to list %v: %v\n", card.Name, card.ID, item.moveToListID, err)
+			audit.Decision = auditDecisionError
+			audit.Detail = err.Error()
+			policy.audit.write(audit)
+			return
+		}
+		log.Printf("Moved card \"%v\" (%v) from the list %v to %v: %s\n", card.Name, card.ID, list.Name, item.moveToListID, audit.Rule)
+		entry.Action = journalActionMoveToList
+		entry.TargetBoardID = list.IDBoard
+		entry.TargetListID = item.moveToListID
+		audit.Decision = auditDecisionMoveToList
+	} else {
+		if err := policy.scrubber.scrubCard(policy.gateway, card); err != nil {
+			log.Printf("Card \"%v\" (%v) is NOT archived as its personal data scrubbing failed: %v\n", card.Name, card.ID, err)
+			audit.Decision = auditDecisionError
+			audit.Detail = err.Error()
+			policy.audit.write(audit)
+			return
+		}
+		if policy.archiveComment {
+			comment := renderMessage(messageReorderArchive, map[string]interface{}{"Card": card, "Reason": audit.Rule})
+			if err := policy.gateway.AddComment(card, comment); err != nil {
+				log.Printf("Failed to post audit comment to card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+			}
+		}
+		if err := policy.closing.close(policy.gateway, card); err != nil {
+			log.Printf("Failed to tick the closing checklist item of card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+		}
+		if err := policy.gateway.ArchiveCard(card); err != nil {
+			log.Printf("Failed to archive card \"%v\" (%v): %v\n", card.Name, card.ID, err)
+			audit.Decision = auditDecisionError
+			audit.Detail = err.Error()
+			policy.audit.write(audit)
+			return
+		}
+		log.Printf("Archived card \"%v\" (%v) of the list %v: %s\n", card.Name, card.ID, list.Name, audit.Rule)
+		entry.Action = journalActionArchive
+		audit.Decision = auditDecisionArchive
+	}
+	policy.journal.record(entry)
+	audit.Detail = item.detail
+	policy.audit.write(audit)
+}
@@ -0,0 +1,99 @@
+package maintainer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+func testReorderPolicy(gateway trelloops.TrelloGateway) reorderPolicy {
+	return reorderPolicy{
+		scoring:  orderScoring{similarityWeight: 1, freshnessHalfLife: 168 * time.Hour, positionScale: 1e7, tolerance: 1e-2},
+		tieBreak: tieBreakCreationDate,
+		gateway:  gateway,
+	}
+}
+
+// The fake board with the list of the cards with the similarities, in the given order
+func testReorderBoard(similarities map[string]string, order []string) (*trelloops.FakeGateway, *trello.List) {
+	created := time.Now().Add(-24 * time.Hour)
+	gateway := trelloops.NewFakeGateway()
+	list := &trello.List{ID: testID(created, 1), Name: "Candidates"}
+	gateway.AddList(list)
+	for i, name := range order {
+		gateway.AddCard(&trello.Card{ID: testID(created, 2+i), Name: name, Desc: "Seen near the park " + similarities[name], IDList: list.ID, Pos: float64(i + 1)})
+	}
+	return gateway, list
+}
+
+// The names of the open cards of the list in their order
+func testListOrder(t *testing.T, gateway *trelloops.FakeGateway, list *trello.List) []string {
+	cards, err := gateway.GetCards(list, trello.Defaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, card := range cards {
+		names = append(names, card.Name)
+	}
+	return names
+}
+
+func TestReorderListBySimilarity(t *testing.T) {
+	gateway, list := testReorderBoard(map[string]string{"Cat": "0.2", "Dog": "0.9", "Bird": "0.5"}, []string{"Cat", "Dog", "Bird"})
+
+	reorderList(context.Background(), list.ID, testReorderPolicy(gateway))
+
+	if order := testListOrder(t, gateway, list); len(order) != 3 || order[0] != "Dog" || order[1] != "Bird" || order[2] != "Cat" {
+		t.Errorf("expected Dog, Bird, Cat, got %v", order)
+	}
+}
+
+func TestReorderListArchivesCardsBeyondMaxCards(t *testing.T) {
+	gateway, list := testReorderBoard(map[string]string{"Cat": "0.2", "Dog": "0.9", "Bird": "0.5"}, []string{"Cat", "Dog", "Bird"})
+	policy := testReorderPolicy(gateway)
+	policy.maxCards = 2
+
+	reorderList(context.Background(), list.ID, policy)
+
+	if order := testListOrder(t, gateway, list); len(order) != 2 || order[0] != "Dog" || order[1] != "Bird" {
+		t.Errorf("expected Dog, Bird, got %v", order)
+	}
+}
+
+func TestReorderListKeepsEvictionsDeclinedByOperator(t *testing.T) {
+	gateway, list := testReorderBoard(map[string]string{"Cat": "0.2", "Dog": "0.9", "Bird": "0.5"}, []string{"Cat", "Dog", "Bird"})
+	policy := testReorderPolicy(gateway)
+	policy.maxCards = 2
+	policy.confirm = &operatorConfirmation{quit: true}
+
+	reorderList(context.Background(), list.ID, policy)
+
+	if order := testListOrder(t, gateway, list); len(order) != 3 {
+		t.Errorf("expected the declined eviction to keep all 3 cards, got %v", order)
+	}
+}
+
+func TestPlanListOrderSpacesTiesBeyondDriftGap(t *testing.T) {
+	gateway, list := testReorderBoard(map[string]string{"Cat": "0.5", "Dog": "0.5", "Bird": "0.5"}, []string{"Cat", "Dog", "Bird"})
+	cards, err := gateway.GetCards(list, trello.Defaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := testReorderPolicy(gateway)
+	policy.strategy = reorderStrategySimilarity
+	policy.scoring.positionScale = 1
+	policy.driftMinGap = 0.01
+
+	items := planListOrder(list, cards, &policy)
+	for _, item := range items {
+		item.card.Pos = item.pos
+	}
+
+	if drifted, why := detectPositionDrift(cards, policy.driftMinGap); drifted {
+		t.Errorf("expected the planned positions of the tied cards not to drift, got %s", why)
+	}
+}
@@ -0,0 +1,372 @@
+package maintainer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+type reportFormatEnum int32
+
+const (
+	reportFormatJSON reportFormatEnum = iota + 1
+	reportFormatCSV
+	reportFormatMarkdown
+)
+
+func parseReportFormat(name string) (reportFormatEnum, error) {
+	switch name {
+	case "json":
+		return reportFormatJSON, nil
+	case "csv":
+		return reportFormatCSV, nil
+	case "markdown", "md":
+		return reportFormatMarkdown, nil
+	default:
+		return 0, fmt.Errorf("unsupported report format \"%s\" (expected json, csv or markdown)", name)
+	}
+}
+
+// Summary of the list. The counters are nil if the list is not maintained by the corresponding pass
+type listReport struct {
+	Profile  string `json:"profile"`
+	ListID   string `json:"listId"`
+	ListName string `json:"listName"`
+	BoardID  string `json:"boardId"`
+	Cards    int    `json:"cards"`
+	// cards exceeding the inactivity threshold (archive, delete and move lists)
+	StaleCards *int `json:"staleCards,omitempty"`
+	// cards without similarity value (lists reordered by similarity)
+	MissingSimilarity *int `json:"missingSimilarity,omitempty"`
+	// cards the reorder would move (reorder lists)
+	OutOfOrder *int `json:"outOfOrder,omitempty"`
+	// distributions, collected with -stats
+	Stats *listStats `json:"stats,omitempty"`
+}
+
+type histogramBin struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// Distributions of the list cards to tune the thresholds from data
+type listStats struct {
+	// time since the card creation
+	Age []histogramBin `json:"age"`
+	// similarity in 0.1 wide bins (lists reordered by similarity)
+	Similarity []histogramBin `json:"similarity,omitempty"`
+	// the card actions counted as activity by type (archive, delete and move lists)
+	ActivityTypes map[string]int `json:"activityTypes,omitempty"`
+}
+
+var reportAgeBins = []struct {
+	label  string
+	maxAge time.Duration
+}{
+	{"<1d", 24 * time.Hour},
+	{"1-7d", 7 * 24 * time.Hour},
+	{"7-30d", 30 * 24 * time.Hour},
+	{"30-90d", 90 * 24 * time.Hour},
+	{">90d", 0},
+}
+
+const reportSimilarityBins = 10
+
+func ageHistogram(cards []*trello.Card, now time.Time) []histogramBin {
+	bins := make([]histogramBin, len(reportAgeBins))
+	for i, bin := range reportAgeBins {
+		bins[i].Label = bin.label
+	}
+	for _, card := range cards {
+		age := now.Sub(card.CreatedAt())
+		for i, bin := range reportAgeBins {
+			if bin.maxAge == 0 || age < bin.maxAge {
+				bins[i].Count++
+				break
+			}
+		}
+	}
+	return bins
+}
+
+// Values outside of [0, 1] go to the edge bins
+func similarityHistogram(values []float64) []histogramBin {
+	bins := make([]histogramBin, reportSimilarityBins)
+	for i := range bins {
+		bins[i].Label = fmt.Sprintf("%.1f-%.1f", float64(i)/reportSimilarityBins, float64(i+1)/reportSimilarityBins)
+	}
+	for _, value := range values {
+		i := int(value * reportSimilarityBins)
+		if i < 0 {
+			i = 0
+		} else if i >= reportSimilarityBins {
+			i = reportSimilarityBins - 1
+		}
+		bins[i].Count++
+	}
+	return bins
+}
+
+// Summary of the maintained lists of all of the profiles, collected without changing anything
+type boardReport struct {
+	GeneratedAt time.Time     `json:"generatedAt"`
+	Lists       []*listReport `json:"lists"`
+	withStats   bool
+	mu          sync.Mutex
+	index       map[string]*listReport
+}
+
+func newBoardReport(now time.Time, withStats bool) *boardReport {
+	return &boardReport{GeneratedAt: now, withStats: withStats, index: make(map[string]*listReport)}
+}
+
+// Applies the update to the row of the list (created if missing)
+func (b *boardReport) update(profile string, list *trello.List, cards int, update func(row *listReport)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := profile + "/" + list.ID
+	row, found := b.index[key]
+	if !found {
+		row = &listReport{Profile: profile, ListID: list.ID, ListName: list.Name, BoardID: list.IDBoard}
+		b.index[key] = row
+		b.Lists = append(b.Lists, row)
+	}
+	row.Cards = cards
+	if b.withStats && row.Stats == nil {
+		row.Stats = &listStats{}
+	}
+	update(row)
+}
+
+// Counts the stale cards of the stale card lists and the cards out of order of the reorder lists
+func (r *maintenanceRun) reportProfile(ctx context.Context, profile maintenanceProfile, staleLists []string, reorderLists string) {
+	client := r.client
+	if len(staleLists) > 0 {
+		stalePolicy := staleCardPolicy{calendar: r.calendar}
+		processLists(ctx, strings.Join(staleLists, ","), "stale cards report", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+			defer wg.Done()
+			gateway := trelloops.NewClientGateway(listClient(ctx, client))
+			list, err := gateway.GetList(listId)
+			if err != nil {
+				log.Panicf("Can't fetch list %v: %v", listId, err)
+			}
+			cards, err := gateway.GetCards(list, trello.Defaults())
+			if err != nil {
+				log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+			}
+			now := time.Now()
+			stale := 0
+			activityTypes := make(map[string]int)
+			for _, card := range cards {
+				lastActivity, actions := cardLastActivity(gateway, list, card, r.activity)
+				if stalePolicy.inactiveFor(lastActivity, now) > profile.cardInactivityThreshold {
+					stale++
+				}
+				for _, action := range actions {
+					activityTypes[action.Type]++
+				}
+			}
+			r.report.update(profile.name, list, len(cards), func(row *listReport) {
+				row.StaleCards = &stale
+				if row.Stats != nil {
+					row.Stats.Age = ageHistogram(cards, now)
+					row.Stats.ActivityTypes = activityTypes
+				}
+			})
+		})
+	}
+	if len(reorderLists) > 0 {
+		base := r.reorderPolicy(profile)
+		base.journal = nil
+		base.audit = nil
+		processLists(ctx, reorderLists, "cards order report", func(ctx context.Context, listSpec string, wg *sync.WaitGroup) {
+			defer wg.Done()
+			listPolicy := base
+			listPolicy.client = listClient(ctx, client)
+			listPolicy.gateway = trelloops.NewClientGateway(listPolicy.client)
+			list, cards, policy := fetchReorderList(listSpec, listPolicy)
+			missing := 0
+			outOfOrder := 0
+			var similarities []float64
+			for _, item := range planListOrder(list, cards, &policy) {
+				if item.audit.Similarity != nil {
+					similarities = append(similarities, *item.audit.Similarity)
+				}
+				if !item.ok {
+					missing++
+				} else if !item.evict && (item.forceMove || math.Abs(item.card.Pos-item.pos) > item.tolerance) {
+					outOfOrder++
+				}
+			}
+			r.report.update(profile.name, list, len(cards), func(row *listReport) {
+				row.OutOfOrder = &outOfOrder
+				if policy.strategy == reorderStrategySimilarity {
+					row.MissingSimilarity = &missing
+				}
+				if row.Stats != nil {
+					row.Stats.Age = ageHistogram(cards, policy.now)
+					if policy.strategy == reorderStrategySimilarity {
+						row.Stats.Similarity = similarityHistogram(similarities)
+					}
+				}
+			})
+		})
+	}
+}
+
+func (b *boardReport) write(w io.Writer, format reportFormatEnum) error {
+	sort.Slice(b.Lists, func(i, j int) bool {
+		if b.Lists[i].Profile != b.Lists[j].Profile {
+			return b.Lists[i].Profile < b.Lists[j].Profile
+		}
+		return b.Lists[i].ListName < b.Lists[j].ListName
+	})
+	optional := func(value *int, missing string) string {
+		if value == nil {
+			return missing
+		}
+		return strconv.Itoa(*value)
+	}
+	switch format {
+	case reportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(b)
+	case reportFormatCSV:
+		out := csv.NewWriter(w)
+		header := []string{"profile", "list_id", "list_name", "board_id", "cards", "stale_cards", "missing_similarity", "out_of_order"}
+		if b.withStats {
+			for _, bin := range reportAgeBins {
+				header = append(header, "age_"+bin.label)
+			}
+			for _, bin := range similarityHistogram(nil) {
+				header = append(header, "similarity_"+bin.Label)
+			}
+			header = append(header, "activity_types")
+		}
+		out.Write(header)
+		for _, row := range b.Lists {
+			record := []string{row.Profile, row.ListID, row.ListName, row.BoardID, strconv.Itoa(row.Cards),
+				optional(row.StaleCards, ""), optional(row.MissingSimilarity, ""), optional(row.OutOfOrder, "")}
+			if row.Stats != nil {
+				record = append(record, histogramCells(row.Stats.Age, len(reportAgeBins))...)
+				record = append(record, histogramCells(row.Stats.Similarity, reportSimilarityBins)...)
+				record = append(record, activityTypesSummary(row.Stats.ActivityTypes))
+			}
+			out.Write(record)
+		}
+		out.Flush()
+		return out.Error()
+	case reportFormatMarkdown:
+		fmt.Fprintf(w, "# Board report %s\n\n", b.GeneratedAt.Format(time.RFC3339))
+		fmt.Fprintln(w, "| Profile | List | Cards | Stale | Missing similarity | Out of order |")
+		fmt.Fprintln(w, "|---|---|---:|---:|---:|---:|")
+		for _, row := range b.Lists {
+			_, err := fmt.Fprintf(w, "| %s | %s | %d | %s | %s | %s |\n", row.Profile, strings.ReplaceAll(row.ListName, "|", "\\|"), row.Cards,
+				optional(row.StaleCards, "-"), optional(row.MissingSimilarity, "-"), optional(row.OutOfOrder, "-"))
+			if err != nil {
+				return err
+			}
+		}
+		for _, row := range b.Lists {
+			if row.Stats == nil {
+				continue
+			}
+			fmt.Fprintf(w, "\n## %s (%s)\n\n", row.ListName, row.Profile)
+			fmt.Fprintf(w, "- Age: %s\n", histogramSummary(row.Stats.Age))
+			if len(row.Stats.Similarity) > 0 {
+				fmt.Fprintf(w, "- Similarity: %s\n", histogramSummary(row.Stats.Similarity))
+			}
+			if len(row.Stats.ActivityTypes) > 0 {
+				if _, err := fmt.Fprintf(w, "- Activity: %s\n", activityTypesSummary(row.Stats.ActivityTypes)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported report format %v", format)
+	}
+}
+
+// The counts of the bins, empty cells if the histogram is not collected
+func histogramCells(bins []histogramBin, size int) []string {
+	cells := make([]string, size)
+	for i, bin := range bins {
+		cells[i] = strconv.Itoa(bin.Count)
+	}
+	return cells
+}
+
+// e.g. "<1d: 3, 1-7d: 10"
+func histogramSummary(bins []histogramBin) string {
+	parts := make([]string, 0, len(bins))
+	for _, bin := range bins {
+		parts = append(parts, fmt.Sprintf("%s: %d", bin.Label, bin.Count))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// e.g. "commentCard=12 updateCard=3", the most frequent first
+func activityTypesSummary(types map[string]int) string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if types[names[i]] != types[names[j]] {
+			return types[names[i]] > types[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, types[name]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Prints the summary of the maintained lists without changing anything
+func runReport(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	formatName := flags.String("format", "json", "output format: json, csv or markdown")
+	out := flags.String("out", "", "file to write the report to (stdout if empty)")
+	withStats := flags.Bool("stats", false, "include card age, similarity and activity type distributions")
+	flags.Parse(args)
+	format, err := parseReportFormat(*formatName)
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+
+	report := newBoardReport(time.Now(), *withStats)
+	if err := runMaintenance(maintenanceOptions{report: report}); err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if len(*out) > 0 {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("ERROR: can't create report file: %v\n", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := report.write(w, format); err != nil {
+		log.Fatalf("ERROR: can't write the report: %v\n", err)
+	}
+}
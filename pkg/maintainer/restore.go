@@ -0,0 +1,222 @@
+package maintainer
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// Undoes the actions performed by the last N maintenance runs recorded in the action journal:
+// archived cards are unarchived, moved cards are moved back and deleted cards are re-created from backups
+func runRestore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	runsCount := flags.Int("runs", 1, "number of the most recent maintenance runs to undo")
+	dryRun := flags.Bool("dry-run", false, "only print the cards that would be restored")
+	flags.Parse(args)
+
+	trelloAppKey := extractSecretEnvOrExit(TRELLO_KEY_ENV)
+	trelloToken := extractSecretEnvOrExit(TRELLO_TOKEN_ENV)
+
+	journal, err := openActionJournalFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	if journal == nil {
+		log.Fatalf("ERROR: \"%s\" env var is not defined, nothing to restore from\n", ACTION_JOURNAL_PATH_ENV)
+	}
+	defer journal.close()
+
+	backup, err := newCardBackupStorageFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: can't configure card backups: %v\n", err)
+	}
+	if err := loadMessageTemplates(); err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+
+	runs, err := journal.lastRuns(journalRunMaintenance, *runsCount)
+	if err != nil {
+		log.Fatalf("ERROR: can't read runs from the journal: %v\n", err)
+	}
+	runIDs := make(map[uint64]bool)
+	for _, run := range runs {
+		runIDs[run.ID] = true
+		log.Printf("Restoring run %d started at %v\n", run.ID, run.StartedAt)
+	}
+
+	// the latest time each card was already restored, so that running restore twice doesn't duplicate cards
+	restoredAt := make(map[string]time.Time)
+	toRestore, err := journal.entries(func(entry *journalEntry) bool {
+		switch entry.Action {
+		case journalActionUnarchive, journalActionRecreate, journalActionMoveBack:
+			if restoredAt[entry.CardID].Before(entry.Timestamp) {
+				restoredAt[entry.CardID] = entry.Timestamp
+			}
+			return false
+		case journalActionArchive, journalActionDelete, journalActionMoveToBoard, journalActionMoveToList:
+			return runIDs[entry.RunID]
+		default:
+			return false
+		}
+	})
+	if err != nil {
+		log.Fatalf("ERROR: can't read actions from the journal: %v\n", err)
+	}
+
+	client := newTrelloClient(trelloAppKey, trelloToken)
+
+	var restoreJournal *runJournal
+	if !*dryRun {
+		lock, err := acquireRunLockFromEnv()
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		defer lock.release()
+		restoreJournal, err = startRunFromEnv(journal, journalRunRestore, time.Now())
+		if err != nil {
+			log.Fatalf("ERROR: can't register restore run: %v\n", err)
+		}
+		defer restoreJournal.close()
+	}
+
+	restored := 0
+	failed := 0
+	for _, entry := range toRestore {
+		if entry.Timestamp.Before(restoredAt[entry.CardID]) {
+			log.Printf("Card \"%v\" (%v) is already restored, skipping\n", entry.CardName, entry.CardID)
+			continue
+		}
+		if *dryRun {
+			log.Printf("[dry run] Would undo %v of card \"%v\" (%v) from list %v\n", entry.Action, entry.CardName, entry.CardID, entry.ListName)
+			continue
+		}
+		err := restoreEntry(client, backup, entry, restoreJournal)
+		if err != nil {
+			log.Printf("Failed to undo %v of card \"%v\" (%v): %v\n", entry.Action, entry.CardName, entry.CardID, err)
+			failed++
+			continue
+		}
+		restored++
+	}
+	log.Printf("Done. %d cards restored, %d failed\n", restored, failed)
+}
+
+func restoreEntry(client *trello.Client, backup cardBackupStorage, entry journalEntry, journal *runJournal) error {
+	restoreRecord := journalEntry{
+		CardID:   entry.CardID,
+		CardName: entry.CardName,
+		BoardID:  entry.BoardID,
+		ListID:   entry.ListID,
+		ListName: entry.ListName,
+		Reason:   fmt.Sprintf("undo of %v performed by run %d", entry.Action, entry.RunID),
+	}
+	switch entry.Action {
+	case journalActionArchive:
+		card, err := client.GetCard(entry.CardID)
+		if err != nil {
+			return err
+		}
+		if err := card.Unarchive(); err != nil {
+			return err
+		}
+		restoreRecord.Action = journalActionUnarchive
+	case journalActionMoveToBoard, journalActionMoveToList:
+		card, err := client.GetCard(entry.CardID)
+		if err != nil {
+			return err
+		}
+		if err := trelloops.MoveCardToBoard(card, entry.BoardID, entry.ListID); err != nil {
+			return err
+		}
+		restoreRecord.Action = journalActionMoveBack
+	case journalActionDelete:
+		if backup == nil {
+			return fmt.Errorf("card backup storage is not configured")
+		}
+		newCard, err := recreateCardFromBackup(client, backup, entry.CardID)
+		if err != nil {
+			return err
+		}
+		restoreRecord.Action = journalActionRecreate
+		restoreRecord.NewCardID = newCard.ID
+	default:
+		return fmt.Errorf("action %v can't be undone", entry.Action)
+	}
+	log.Printf("Card \"%v\" (%v) restored to list %v\n", entry.CardName, entry.CardID, entry.ListName)
+	journal.record(restoreRecord)
+	return nil
+}
+
+// The header copiedCommentText puts before the original text
+var copiedCommentHeader = regexp.MustCompile(`^[^\n]* \(\d{4}-\d{2}-\d{2}T[^)\n]*\):\n`)
+
+// Whether the text is a comment copied by copiedCommentText
+func isCopiedCommentText(text string) bool {
+	return copiedCommentHeader.MatchString(text)
+}
+
+// The comment re-posted on behalf of the bot keeps the original author and date
+func copiedCommentText(action *trello.Action) string {
+	author := action.IDMemberCreator
+	if action.MemberCreator != nil {
+		author = action.MemberCreator.FullName
+	}
+	return fmt.Sprintf("%s (%s):\n%s", author, action.Date.Format(time.RFC3339), action.Data.Text)
+}
+
+// Creates a new card in the original list out of the backup.
+// Comments are re-posted (on behalf of the bot) and attachments are re-attached by URL
+func recreateCardFromBackup(client *trello.Client, backup cardBackupStorage, cardID string) (*trello.Card, error) {
+	data, err := backup.load(cardBackupName(cardID))
+	if err != nil {
+		return nil, fmt.Errorf("can't load backup: %w", err)
+	}
+	var cardBackup cardBackup
+	if err := json.Unmarshal(data, &cardBackup); err != nil {
+		return nil, fmt.Errorf("can't parse backup: %w", err)
+	}
+	original := cardBackup.Card
+
+	newCard := &trello.Card{
+		Name:      original.Name,
+		Desc:      original.Desc,
+		Pos:       original.Pos,
+		IDList:    cardBackup.ListID,
+		IDLabels:  original.IDLabels,
+		IDMembers: original.IDMembers,
+		Due:       original.Due,
+		Start:     original.Start,
+	}
+	if err := client.CreateCard(newCard); err != nil {
+		return nil, fmt.Errorf("can't create card: %w", err)
+	}
+
+	// Trello returns the actions newest first
+	for i := len(cardBackup.Actions) - 1; i >= 0; i-- {
+		action := cardBackup.Actions[i]
+		if !action.DidCommentCard() || action.Data == nil {
+			continue
+		}
+		if _, err := newCard.AddComment(copiedCommentText(action)); err != nil {
+			log.Printf("Failed to restore comment %v of card %v: %v\n", action.ID, cardID, err)
+		}
+	}
+	for _, attachment := range cardBackup.Attachments {
+		urlAttachment := &trello.Attachment{Name: attachment.Name, URL: attachment.URL}
+		if err := newCard.AddURLAttachment(urlAttachment); err != nil {
+			log.Printf("Failed to restore attachment %v of card %v: %v\n", attachment.ID, cardID, err)
+		}
+	}
+
+	restoreNote := renderMessage(messageRestored, map[string]interface{}{"Card": newCard, "CardID": cardID, "DeletedAt": cardBackup.BackedUpAt})
+	if _, err := newCard.AddComment(restoreNote); err != nil {
+		log.Printf("Failed to add restore note to card %v: %v\n", newCard.ID, err)
+	}
+	return newCard, nil
+}
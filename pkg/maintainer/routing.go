@@ -0,0 +1,127 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const AGE_ROUTING_ENV = "AGE_ROUTING"
+
+// The list for the cards younger than maxAge (0 means no upper bound)
+type ageBucket struct {
+	listID string
+	maxAge time.Duration
+}
+
+func (b ageBucket) String() string {
+	if b.maxAge == 0 {
+		return "older cards"
+	}
+	return "younger than " + humanizeDuration(b.maxAge)
+}
+
+// Parses "listId:maxDays,...,listId" (e.g. "fresh:7,active:30,longterm").
+// The upper bounds must increase, only the last bucket may have no bound
+func parseAgeRouting(spec string) ([]ageBucket, error) {
+	var buckets []ageBucket
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		if len(buckets) > 0 && buckets[len(buckets)-1].maxAge == 0 {
+			return nil, fmt.Errorf("only the last age bucket may have no upper bound")
+		}
+		listID, maxDaysStr, hasBound := strings.Cut(entry, ":")
+		bucket := ageBucket{listID: listID}
+		if hasBound {
+			maxDays, err := strconv.ParseFloat(maxDaysStr, 64)
+			if err != nil || maxDays <= 0 {
+				return nil, fmt.Errorf("invalid age bound \"%s\" of list %s (expected positive number of days)", maxDaysStr, listID)
+			}
+			bucket.maxAge = time.Duration(maxDays * 24 * float64(time.Hour))
+			if len(buckets) > 0 && bucket.maxAge <= buckets[len(buckets)-1].maxAge {
+				return nil, fmt.Errorf("age bound of list %s must be greater than the previous one", listID)
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// Returns the bucket for the card of the given age, or nil if the card is older than all bounds
+func bucketForAge(buckets []ageBucket, age time.Duration) *ageBucket {
+	for i := range buckets {
+		if buckets[i].maxAge == 0 || age < buckets[i].maxAge {
+			return &buckets[i]
+		}
+	}
+	return nil
+}
+
+// Moves the cards of the bucket lists to the lists matching their age (time since the card creation)
+func routeCardsByAge(ctx context.Context, client *trello.Client, buckets []ageBucket, now time.Time, journal *runJournal, audit *auditLog) {
+	listIds := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		listIds = append(listIds, bucket.listID)
+	}
+	processLists(ctx, strings.Join(listIds, ","), "age routing", func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		list := trelloops.FetchList(listClient(ctx, client), listId)
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+		}
+		cards = withoutExemptCards(list, cards)
+		for _, card := range cards {
+			age := now.Sub(card.CreatedAt())
+			record := auditRecord{
+				Timestamp: now,
+				Pass:      "routing",
+				CardID:    card.ID,
+				CardName:  card.Name,
+				ListID:    list.ID,
+				ListName:  list.Name,
+				Detail:    "age " + humanizeDuration(age),
+			}
+			bucket := bucketForAge(buckets, age)
+			if bucket == nil || bucket.listID == list.ID {
+				record.Decision = auditDecisionSkip
+				record.Rule = "already in the age bucket list"
+				audit.write(record)
+				continue
+			}
+			record.Rule = fmt.Sprintf("card age %s, bucket of %s", humanizeDuration(age), bucket)
+			if err := card.MoveToList(bucket.listID); err != nil {
+				log.Printf("Failed to move card \"%v\" (%v) to list %v: %v\n", card.Name, card.ID, bucket.listID, err)
+				record.Decision = auditDecisionError
+				record.Detail = err.Error()
+				audit.write(record)
+				continue
+			}
+			log.Printf("Moved card \"%v\" (%v) from the list %v to %v: %s\n", card.Name, card.ID, list.Name, bucket.listID, record.Rule)
+			journal.record(journalEntry{
+				Timestamp:     now,
+				Action:        journalActionMoveToList,
+				CardID:        card.ID,
+				CardName:      card.Name,
+				BoardID:       list.IDBoard,
+				ListID:        list.ID,
+				ListName:      list.Name,
+				Reason:        record.Rule,
+				TargetBoardID: list.IDBoard,
+				TargetListID:  bucket.listID,
+			})
+			record.Decision = auditDecisionMoveToList
+			audit.write(record)
+		}
+	})
+}
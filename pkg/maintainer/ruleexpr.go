@@ -0,0 +1,82 @@
+package maintainer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adlio/trello"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// The card as the rule expressions see it, e.g. `card.Similarity < 0.6 && card.AgeDays > 7`.
+// Similarity is 0 for the cards without similarity, HasSimilarity tells them apart. The plugins get it as JSON
+type ruleExprCard struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Desc          string   `json:"desc"`
+	ListName      string   `json:"listName"`
+	Labels        []string `json:"labels"`
+	AgeDays       float64  `json:"ageDays"`
+	IdleDays      float64  `json:"idleDays"`
+	Similarity    float64  `json:"similarity"`
+	HasSimilarity bool     `json:"hasSimilarity"`
+	Votes         int      `json:"votes"`
+	Comments      int      `json:"comments"`
+	Attachments   int      `json:"attachments"`
+	Due           bool     `json:"due"`
+	DueComplete   bool     `json:"dueComplete"`
+}
+
+type ruleExprEnv struct {
+	Card ruleExprCard `expr:"card"`
+}
+
+// Compiles the boolean expression (see https://expr-lang.org/docs/language-definition) over the card fields
+func compileRuleExpression(source string) (*vm.Program, error) {
+	return expr.Compile(source, expr.Env(ruleExprEnv{}), expr.AsBool())
+}
+
+// Whether the expression refers to the card similarity, which may need the custom fields of the cards
+func ruleExpressionUsesSimilarity(source string) bool {
+	return strings.Contains(source, "Similarity")
+}
+
+func newRuleExprCard(list *trello.List, card *trello.Card, similarity *float64, now time.Time) ruleExprCard {
+	exprCard := ruleExprCard{
+		ID:          card.ID,
+		Name:        card.Name,
+		Desc:        card.Desc,
+		ListName:    list.Name,
+		AgeDays:     now.Sub(card.CreatedAt()).Hours() / 24,
+		Votes:       card.Badges.Votes,
+		Comments:    card.Badges.Comments,
+		Attachments: card.Badges.Attachments,
+		Due:         card.Due != nil,
+		DueComplete: card.DueComplete,
+	}
+	for _, label := range card.Labels {
+		exprCard.Labels = append(exprCard.Labels, label.Name)
+	}
+	if card.DateLastActivity != nil {
+		exprCard.IdleDays = now.Sub(*card.DateLastActivity).Hours() / 24
+	}
+	if similarity != nil {
+		exprCard.Similarity = *similarity
+		exprCard.HasSimilarity = true
+	}
+	return exprCard
+}
+
+func evalRuleExpression(program *vm.Program, card ruleExprCard) (bool, error) {
+	result, err := expr.Run(program, ruleExprEnv{Card: card})
+	if err != nil {
+		return false, err
+	}
+	matched, isBool := result.(bool)
+	if !isBool {
+		return false, fmt.Errorf("expression result is %T, not bool", result)
+	}
+	return matched, nil
+}
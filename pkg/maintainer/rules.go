@@ -0,0 +1,427 @@
+package maintainer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+	"github.com/expr-lang/expr/vm"
+)
+
+type ruleActionEnum string
+
+const (
+	ruleActionArchive ruleActionEnum = "archive"
+	ruleActionDelete  ruleActionEnum = "delete"
+	ruleActionMove    ruleActionEnum = "move"
+	ruleActionLabel   ruleActionEnum = "label"
+	ruleActionComment ruleActionEnum = "comment"
+	ruleActionPlugin  ruleActionEnum = "plugin"
+)
+
+// Rule of the config file: the cards of the lists matching all of the conditions get the action, e.g.
+//
+//	{"name": "old unlabeled", "lists": ["5f1a..."], "minAgeDays": 60, "withoutLabels": ["Keep"], "action": "archive"}
+//
+// The omitted conditions match every card. Age is the time since the card creation
+type ruleConfig struct {
+	Name          string   `json:"name"`
+	Lists         []string `json:"lists"`
+	MinAgeDays    *float64 `json:"minAgeDays"`
+	MaxAgeDays    *float64 `json:"maxAgeDays"`
+	Labels        []string `json:"labels"`
+	WithoutLabels []string `json:"withoutLabels"`
+	MinSimilarity *float64 `json:"minSimilarity"`
+	MaxSimilarity *float64 `json:"maxSimilarity"`
+	NameRegex     string   `json:"nameRegex"`
+	// boolean expression over the card fields, e.g. "card.Similarity < 0.6 && card.AgeDays > 7" (see ruleExprCard)
+	When string `json:"when"`
+	// archive (posting the comment first if it is set), delete, move (to targetList of targetBoard, the same board if it is empty),
+	// label (with label), comment (posting comment unless it is already posted) or plugin (running the plugin command, see pluginRequest)
+	Action      string   `json:"action"`
+	TargetBoard string   `json:"targetBoard"`
+	TargetList  string   `json:"targetList"`
+	Label       string   `json:"label"`
+	Comment     string   `json:"comment"`
+	Plugin      []string `json:"plugin"`
+}
+
+// The compiled rule
+type cardRule struct {
+	name          string
+	lists         string
+	minAge        time.Duration
+	maxAge        time.Duration
+	labels        []string
+	withoutLabels []string
+	minSimilarity *float64
+	maxSimilarity *float64
+	nameRegex     *regexp.Regexp
+	when          string
+	whenProgram   *vm.Program
+	action        ruleActionEnum
+	targetBoard   string
+	targetList    string
+	label         string
+	comment       *template.Template
+	plugin        []string
+}
+
+func (c *ruleConfig) compile() (cardRule, error) {
+	rule := cardRule{
+		name:          c.Name,
+		lists:         strings.Join(c.Lists, ","),
+		labels:        c.Labels,
+		withoutLabels: c.WithoutLabels,
+		minSimilarity: c.MinSimilarity,
+		maxSimilarity: c.MaxSimilarity,
+		action:        ruleActionEnum(c.Action),
+		targetBoard:   c.TargetBoard,
+		targetList:    c.TargetList,
+		label:         c.Label,
+		plugin:        c.Plugin,
+	}
+	if len(rule.lists) == 0 {
+		return rule, fmt.Errorf("rule \"%s\" has no lists", c.Name)
+	}
+	if c.MinAgeDays != nil {
+		rule.minAge = time.Duration(*c.MinAgeDays * 24 * float64(time.Hour))
+	}
+	if c.MaxAgeDays != nil {
+		rule.maxAge = time.Duration(*c.MaxAgeDays * 24 * float64(time.Hour))
+		if rule.maxAge <= rule.minAge {
+			return rule, fmt.Errorf("rule \"%s\" max age must be greater than its min age", c.Name)
+		}
+	}
+	if len(c.NameRegex) > 0 {
+		nameRegex, err := regexp.Compile(c.NameRegex)
+		if err != nil {
+			return rule, fmt.Errorf("can't compile name regex of rule \"%s\": %w", c.Name, err)
+		}
+		rule.nameRegex = nameRegex
+	}
+	if len(c.Comment) > 0 {
+		comment, err := template.New(c.Name).Funcs(messageFuncs).Option("missingkey=error").Parse(c.Comment)
+		if err != nil {
+			return rule, fmt.Errorf("can't parse comment template of rule \"%s\": %w", c.Name, err)
+		}
+		rule.comment = comment
+	}
+	if len(c.When) > 0 {
+		program, err := compileRuleExpression(c.When)
+		if err != nil {
+			return rule, fmt.Errorf("can't compile expression of rule \"%s\": %w", c.Name, err)
+		}
+		rule.when = c.When
+		rule.whenProgram = program
+	}
+	switch rule.action {
+	case ruleActionArchive, ruleActionDelete:
+	case ruleActionMove:
+		if len(rule.targetList) == 0 {
+			return rule, fmt.Errorf("rule \"%s\" moves the cards but has no target list", c.Name)
+		}
+	case ruleActionLabel:
+		if len(rule.label) == 0 {
+			return rule, fmt.Errorf("rule \"%s\" labels the cards but has no label", c.Name)
+		}
+	case ruleActionComment:
+		if rule.comment == nil {
+			return rule, fmt.Errorf("rule \"%s\" comments the cards but has no comment", c.Name)
+		}
+	case ruleActionPlugin:
+		if len(rule.plugin) == 0 || len(rule.plugin[0]) == 0 {
+			return rule, fmt.Errorf("rule \"%s\" runs a plugin but has no plugin command", c.Name)
+		}
+	default:
+		return rule, fmt.Errorf("unsupported action \"%s\" of rule \"%s\" (expected archive, delete, move, label, comment or plugin)", c.Action, c.Name)
+	}
+	return rule, nil
+}
+
+// The plugins get the similarity of the card whatever the conditions are
+func (r *cardRule) usesSimilarity() bool {
+	return r.action == ruleActionPlugin || r.minSimilarity != nil || r.maxSimilarity != nil || (r.whenProgram != nil && ruleExpressionUsesSimilarity(r.when))
+}
+
+// The comment of the rule for the card, empty if the rule has none
+func (r *cardRule) renderComment(card *trello.Card, reason string) (string, error) {
+	if r.comment == nil {
+		return "", nil
+	}
+	var text strings.Builder
+	if err := r.comment.Execute(&text, map[string]interface{}{"Card": card, "Rule": r.name, "Reason": reason}); err != nil {
+		return "", fmt.Errorf("can't render the comment: %w", err)
+	}
+	return text.String(), nil
+}
+
+func cardHasLabel(card *trello.Card, name string) bool {
+	for _, label := range card.Labels {
+		if strings.EqualFold(label.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the card matches all of the conditions, and the explanation of the match.
+// Fails if the expression can't be evaluated for the card
+func (r *cardRule) matches(list *trello.List, card *trello.Card, similarity similaritySource, now time.Time) (bool, string, error) {
+	var why []string
+	age := now.Sub(card.CreatedAt())
+	if r.minAge > 0 {
+		if age < r.minAge {
+			return false, "", nil
+		}
+		why = append(why, "older than "+humanizeDuration(r.minAge))
+	}
+	if r.maxAge > 0 {
+		if age >= r.maxAge {
+			return false, "", nil
+		}
+		why = append(why, "younger than "+humanizeDuration(r.maxAge))
+	}
+	for _, label := range r.labels {
+		if !cardHasLabel(card, label) {
+			return false, "", nil
+		}
+		why = append(why, "labeled "+label)
+	}
+	for _, label := range r.withoutLabels {
+		if cardHasLabel(card, label) {
+			return false, "", nil
+		}
+		why = append(why, "not labeled "+label)
+	}
+	var sim *float64
+	if r.usesSimilarity() {
+		sim = similarity.extract(card)
+	}
+	if r.minSimilarity != nil || r.maxSimilarity != nil {
+		if sim == nil || (r.minSimilarity != nil && *sim < *r.minSimilarity) || (r.maxSimilarity != nil && *sim > *r.maxSimilarity) {
+			return false, "", nil
+		}
+		why = append(why, fmt.Sprintf("similarity %v", *sim))
+	}
+	if r.nameRegex != nil {
+		if !r.nameRegex.MatchString(card.Name) {
+			return false, "", nil
+		}
+		why = append(why, "name matches "+r.nameRegex.String())
+	}
+	if r.whenProgram != nil {
+		matched, err := evalRuleExpression(r.whenProgram, newRuleExprCard(list, card, sim, now))
+		if err != nil {
+			return false, "", fmt.Errorf("can't evaluate expression %s: %w", r.when, err)
+		}
+		if !matched {
+			return false, "", nil
+		}
+		why = append(why, r.when)
+	}
+	if len(why) == 0 {
+		return true, "no conditions", nil
+	}
+	return true, strings.Join(why, ", "), nil
+}
+
+// Settings of the rules pass
+type rulePolicy struct {
+	journal    *runJournal
+	audit      *auditLog
+	similarity similaritySource
+	backup     cardBackupStorage
+	scrubber   *piiScrubber
+	closing    *archiveChecklist
+	confirm    *operatorConfirmation
+	plugins    *pluginRunner
+}
+
+// Applies the rules in their order, each of them to the current cards of its lists
+func applyRules(ctx context.Context, client *trello.Client, rules []cardRule, policy rulePolicy) {
+	for _, rule := range rules {
+		rule := rule
+		processLists(ctx, rule.lists, "rule "+rule.name, func(ctx context.Context, listId string, wg *sync.WaitGroup) {
+			defer wg.Done()
+			trelloClient := listClient(ctx, client)
+			gateway := trelloops.NewClientGateway(trelloClient)
+			list, err := gateway.GetList(listId)
+			if err != nil {
+				log.Panicf("Can't fetch list %v: %v", listId, err)
+			}
+			listPolicy := policy
+			cardsArgs := trello.Defaults()
+			if rule.usesSimilarity() && len(policy.similarity.customFieldName) > 0 {
+				listPolicy.similarity.boardCustomFields = fetchBoardCustomFields(gateway, list.IDBoard)
+				cardsArgs["customFieldItems"] = "true"
+			}
+			cards, err := gateway.GetCards(list, cardsArgs)
+			if err != nil {
+				log.Panicf("Can't fetch cards for %v: %v", list.Name, err)
+			}
+			var label *trello.Label
+			if rule.action == ruleActionLabel {
+				label, err = findOrCreateBoardLabel(trelloClient, list.IDBoard, rule.label, "purple")
+				if err != nil {
+					log.Panicf("Can't find label %v of rule \"%v\": %v", rule.label, rule.name, err)
+				}
+			}
+			now := time.Now()
+			cards = withoutExemptCards(list, cards)
+			consoleProgress.addCards(list, len(cards))
+			for _, card := range cards {
+				card.SetClient(trelloClient)
+				applyRule(ctx, gateway, list, card, &rule, label, now, listPolicy)
+				consoleProgress.cardDone()
+			}
+		})
+	}
+}
+
+func applyRule(ctx context.Context, gateway trelloops.TrelloGateway, list *trello.List, card *trello.Card, rule *cardRule, label *trello.Label, now time.Time, policy rulePolicy) {
+	audit := auditRecord{
+		Timestamp: now,
+		Pass:      "rules",
+		CardID:    card.ID,
+		CardName:  card.Name,
+		ListID:    list.ID,
+		ListName:  list.Name,
+		Rule:      rule.name,
+	}
+	matched, why, err := rule.matches(list, card, policy.similarity, now)
+	if err != nil {
+		log.Printf("Rule \"%v\" can't check card \"%v\" (%v): %v\n", rule.name, card.Name, card.ID, err)
+		audit.Decision = auditDecisionError
+		audit.Detail = err.Error()
+		policy.audit.write(audit)
+		return
+	}
+	if !matched {
+		audit.Decision = auditDecisionSkip
+		audit.Detail = "conditions not met"
+		policy.audit.write(audit)
+		return
+	}
+	audit.Detail = why
+	reason := fmt.Sprintf("rule \"%s\": %s", rule.name, why)
+	entry := journalEntry{
+		Timestamp: now,
+		CardID:    card.ID,
+		CardName:  card.Name,
+		BoardID:   list.IDBoard,
+		ListID:    list.ID,
+		ListName:  list.Name,
+		Reason:    reason,
+	}
+	comment, err := rule.renderComment(card, why)
+	if err != nil {
+		log.Printf("Rule \"%v\" can't comment card \"%v\" (%v): %v\n", rule.name, card.Name, card.ID, err)
+		audit.Decision = auditDecisionError
+		audit.Detail = err.Error()
+		policy.audit.write(audit)
+		return
+	}
+	switch rule.action {
+	case ruleActionLabel:
+		if containsString(card.IDLabels, label.ID) {
+			audit.Decision = auditDecisionSkip
+			audit.Detail = "already labeled"
+			policy.audit.write(audit)
+			return
+		}
+		if err = card.AddIDLabel(label.ID); err == nil {
+			log.Printf("Labeled card \"%v\" (%v) with %v: %s\n", card.Name, card.ID, rule.label, reason)
+			audit.Decision = auditDecisionLabel
+		}
+	case ruleActionComment:
+		var comments trello.ActionCollection
+		comments, err = gateway.GetCardActions(card, trello.Arguments{"filter": "commentCard", "limit": "1000"})
+		if err == nil {
+			for _, posted := range comments {
+				if posted.Data != nil && posted.Data.Text == comment {
+					audit.Decision = auditDecisionSkip
+					audit.Detail = "already commented"
+					policy.audit.write(audit)
+					return
+				}
+			}
+			if err = gateway.AddComment(card, comment); err == nil {
+				log.Printf("Commented card \"%v\" (%v): %s\n", card.Name, card.ID, reason)
+				audit.Decision = auditDecisionComment
+			}
+		}
+	case ruleActionPlugin:
+		if !policy.confirm.approve(fmt.Sprintf("run plugin %v for card \"%v\" (%v) of the list %v: %s", rule.plugin[0], card.Name, card.ID, list.Name, reason)) {
+			audit.Decision = auditDecisionSkip
+			audit.Detail = "declined by the operator"
+			policy.audit.write(audit)
+			return
+		}
+		var response pluginResponse
+		response, err = policy.plugins.run(ctx, rule.plugin, newPluginRequest(rule, reason, list, card, policy.similarity.extract(card), now))
+		if err == nil && len(response.Comment) > 0 {
+			err = gateway.AddComment(card, response.Comment)
+		}
+		if err == nil {
+			log.Printf("Plugin %v of rule \"%v\" %v card \"%v\" (%v): %s\n", rule.plugin[0], rule.name, response.Status, card.Name, card.ID, response.Detail)
+			audit.Decision = auditDecisionPlugin
+			if response.Status == pluginStatusSkip {
+				audit.Decision = auditDecisionSkip
+			}
+			if len(response.Detail) > 0 {
+				audit.Detail = response.Detail
+			}
+		}
+	default:
+		switch {
+		case rule.action == ruleActionDelete:
+			entry.Action = journalActionDelete
+		case rule.action == ruleActionArchive:
+			entry.Action = journalActionArchive
+		case len(rule.targetBoard) > 0 && rule.targetBoard != list.IDBoard:
+			entry.Action = journalActionMoveToBoard
+			entry.TargetBoardID = rule.targetBoard
+			entry.TargetListID = rule.targetList
+		default:
+			entry.Action = journalActionMoveToList
+			entry.TargetBoardID = list.IDBoard
+			entry.TargetListID = rule.targetList
+		}
+		if !policy.confirm.approve(fmt.Sprintf("%v card \"%v\" (%v) of the list %v: %s", entry.Action, card.Name, card.ID, list.Name, reason)) {
+			audit.Decision = auditDecisionSkip
+			audit.Detail = "declined by the operator"
+			policy.audit.write(audit)
+			return
+		}
+		if entry.Action == journalActionMoveToList {
+			if err = gateway.MoveCardToList(card, rule.targetList); err != nil {
+				err = fmt.Errorf("Failed to move card \"%v\" (%v) to list %v: %w", card.Name, card.ID, rule.targetList, err)
+			}
+		} else {
+			err = performStaleAction(gateway, list, card, entry, comment, policy.backup, policy.scrubber, policy.closing)
+		}
+		if err == nil {
+			log.Printf("Applied %v to card \"%v\" (%v): %s\n", entry.Action, card.Name, card.ID, reason)
+			if entry.Action == journalActionMoveToList {
+				audit.Decision = auditDecisionMoveToList
+			} else {
+				audit.Decision = staleActionAuditDecision(entry.Action)
+			}
+			policy.journal.record(entry)
+		}
+	}
+	if err != nil {
+		log.Printf("Rule \"%v\" failed on card \"%v\" (%v): %v\n", rule.name, card.Name, card.ID, err)
+		audit.Decision = auditDecisionError
+		audit.Detail = err.Error()
+	}
+	policy.audit.write(audit)
+}
@@ -0,0 +1,47 @@
+package maintainer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const LOCK_FILE_ENV = "LOCK_FILE"
+
+// Exclusive lock preventing overlapping runs on the same host.
+// The lock is released when the file is closed, including when the process dies
+type runLock struct {
+	file *os.File
+}
+
+// Acquires the lock at LOCK_FILE (the temp dir by default, "off" disables the lock).
+// Fails immediately if another process holds it
+func acquireRunLockFromEnv() (*runLock, error) {
+	path := extractEnvOrDefault(LOCK_FILE_ENV, filepath.Join(os.TempDir(), "trelloBoardMaintainer.lock"))
+	if path == "off" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("can't open lock file %v: %w", path, err)
+	}
+	if err := lockFile(file); err != nil {
+		holder, _ := os.ReadFile(path)
+		file.Close()
+		return nil, fmt.Errorf("another run (pid %s) is in progress, lock file %v is held: %w", strings.TrimSpace(string(holder)), path, err)
+	}
+	// the pid is informational, the lock itself is the flock
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &runLock{file: file}, nil
+}
+
+func (l *runLock) release() {
+	if l == nil {
+		return
+	}
+	l.file.Close()
+}
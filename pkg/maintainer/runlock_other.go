@@ -0,0 +1,10 @@
+//go:build !unix
+
+package maintainer
+
+import "os"
+
+// Overlapping runs are not detected on this platform
+func lockFile(file *os.File) error {
+	return nil
+}
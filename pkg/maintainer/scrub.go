@@ -0,0 +1,161 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const PII_SCRUB_ENV = "PII_SCRUB"
+const PII_SCRUB_REGEX_ENV = "PII_SCRUB_REGEX"
+const PII_SCRUB_REPLACEMENT_ENV = "PII_SCRUB_REPLACEMENT"
+
+// Personal data removed from the card before it is archived.
+// notPII keeps the matches at text[start:end] that aren't the personal data (e.g. the dates matched by the phone pattern), nil keeps none
+type piiPattern struct {
+	name   string
+	regex  *regexp.Regexp
+	notPII func(text string, start int, end int) bool
+}
+
+var builtinPIIPatterns = map[string]piiPattern{
+	// the digit groups separated by the spaces, the dashes or the dots with the optional country or trunk code and the area code in parentheses
+	// (e.g. "+7 (916) 123-45-67" or "916.123.4567"), or the international number without separators
+	"phone": {name: "phone", regex: regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?|\d[\s.-]?)?(?:\(\d{2,5}\)\s?|\d{2,5}[\s.-])\d{2,4}(?:[\s.-]\d{2,4}){1,3}|\+\d{10,14}`), notPII: notPhone},
+	"email": {name: "email", regex: regexp.MustCompile(`[\p{L}\p{N}._%+-]+@[\p{L}\p{N}-]+(?:\.[\p{L}\p{N}-]+)+`)},
+}
+
+// The dates (e.g. "2024-05-17" or "17.05.2024") and the decimal coordinates (e.g. "55.7558 37.6173") the phone pattern matches
+var notPhonePattern = regexp.MustCompile(`\d{4}[-./]\d{1,2}[-./]\d{1,2}|\d{1,2}[-./]\d{1,2}[-./]\d{4}|\d\.\d{4}\D+\d{1,3}\.\d{4}`)
+
+// Whether the phone pattern match is not a phone: it has fewer digits than the shortest phone or more than the longest one, it is a date or the coordinates,
+// or it is a part of a longer token (e.g. the time "10:30" or the id "a1-23-45")
+func notPhone(text string, start int, end int) bool {
+	match := text[start:end]
+	if digits := countDigits(match); digits < 9 || digits > 15 {
+		return true
+	}
+	if notPhonePattern.MatchString(match) {
+		return true
+	}
+	before, size := utf8.DecodeLastRuneInString(text[:start])
+	beforeSeparator, _ := utf8.DecodeLastRuneInString(text[:start-size])
+	after, size := utf8.DecodeRuneInString(text[end:])
+	afterSeparator, _ := utf8.DecodeRuneInString(text[end+size:])
+	return continuesToken(before, beforeSeparator) || continuesToken(after, afterSeparator)
+}
+
+// Whether the rune next to the match joins it to the token, the separator is the rune beyond it (e.g. the digit after the colon)
+func continuesToken(next rune, beyond rune) bool {
+	if next == utf8.RuneError {
+		return false
+	}
+	if unicode.IsLetter(next) || unicode.IsDigit(next) || next == '_' || next == '+' {
+		return true
+	}
+	return strings.ContainsRune(".,:/-", next) && unicode.IsDigit(beyond)
+}
+
+// Replaces the personal data in the description and the comments of the cards before they are archived,
+// so that the archive doesn't retain it indefinitely
+type piiScrubber struct {
+	patterns    []piiPattern
+	replacement string
+}
+
+// Returns nil if scrubbing is not configured
+func piiScrubberFromEnv() (*piiScrubber, error) {
+	scrubber := &piiScrubber{
+		replacement: extractEnvOrDefault(PII_SCRUB_REPLACEMENT_ENV, "[removed]"),
+	}
+	if names := extractEnvOrDefault(PII_SCRUB_ENV, ""); len(names) > 0 {
+		for _, name := range strings.Split(names, ",") {
+			pattern, known := builtinPIIPatterns[strings.TrimSpace(name)]
+			if !known {
+				return nil, fmt.Errorf("unsupported %s pattern \"%s\" (expected phone or email)", PII_SCRUB_ENV, name)
+			}
+			scrubber.patterns = append(scrubber.patterns, pattern)
+		}
+	}
+	if custom := extractEnvOrDefault(PII_SCRUB_REGEX_ENV, ""); len(custom) > 0 {
+		regex, err := regexp.Compile(custom)
+		if err != nil {
+			return nil, fmt.Errorf("can't compile %s: %w", PII_SCRUB_REGEX_ENV, err)
+		}
+		scrubber.patterns = append(scrubber.patterns, piiPattern{name: "custom", regex: regex})
+	}
+	if len(scrubber.patterns) == 0 {
+		return nil, nil
+	}
+	return scrubber, nil
+}
+
+func countDigits(s string) int {
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits
+}
+
+// Returns the text with the personal data replaced and the number of replacements
+func (s *piiScrubber) scrub(text string) (string, int) {
+	replaced := 0
+	for _, pattern := range s.patterns {
+		var scrubbed strings.Builder
+		last := 0
+		for _, match := range pattern.regex.FindAllStringIndex(text, -1) {
+			if pattern.notPII != nil && pattern.notPII(text, match[0], match[1]) {
+				continue
+			}
+			scrubbed.WriteString(text[last:match[0]])
+			scrubbed.WriteString(s.replacement)
+			last = match[1]
+			replaced++
+		}
+		scrubbed.WriteString(text[last:])
+		text = scrubbed.String()
+	}
+	return text, replaced
+}
+
+// Scrubs the description and the comments of the card. Does nothing if the scrubber is nil.
+// Trello allows editing only own comments, so the comments of other members are kept as they are (and logged)
+func (s *piiScrubber) scrubCard(gateway trelloops.TrelloGateway, card *trello.Card) error {
+	if s == nil {
+		return nil
+	}
+	if desc, replaced := s.scrub(card.Desc); replaced > 0 {
+		if err := gateway.SetCardDesc(card, desc); err != nil {
+			return fmt.Errorf("can't update the description: %w", err)
+		}
+		log.Printf("Removed %d personal data occurrences from the description of card \"%v\" (%v)\n", replaced, card.Name, card.ID)
+	}
+	comments, err := gateway.GetCardActions(card, trello.Arguments{"filter": "commentCard", "limit": "1000"})
+	if err != nil {
+		return fmt.Errorf("can't fetch comments: %w", err)
+	}
+	for _, action := range comments {
+		if action.Data == nil {
+			continue
+		}
+		text, replaced := s.scrub(action.Data.Text)
+		if replaced == 0 {
+			continue
+		}
+		if err := gateway.EditComment(card, action.ID, text); err != nil {
+			log.Printf("Comment %v with %d personal data occurrences of card \"%v\" (%v) is kept as it can't be edited: %v\n", action.ID, replaced, card.Name, card.ID, err)
+			continue
+		}
+		log.Printf("Removed %d personal data occurrences from comment %v of card \"%v\" (%v)\n", replaced, action.ID, card.Name, card.ID)
+	}
+	return nil
+}
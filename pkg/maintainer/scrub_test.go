@@ -0,0 +1,68 @@
+package maintainer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// The fake gateway that can't edit the comments, as Trello for the comments of other members
+type editlessGateway struct {
+	*trelloops.FakeGateway
+}
+
+func (g editlessGateway) EditComment(card *trello.Card, actionID string, text string) error {
+	return fmt.Errorf("unauthorized permission requested")
+}
+
+func TestPhonePatternScrubsOnlyPhones(t *testing.T) {
+	scrubber := &piiScrubber{patterns: []piiPattern{builtinPIIPatterns["phone"]}, replacement: "[removed]"}
+	cases := []struct {
+		text     string
+		expected string
+	}{
+		{"Call +7 (916) 123-45-67 anytime", "Call [removed] anytime"},
+		{"тел. 8 916 123 45 67, Anna", "тел. [removed], Anna"},
+		{"owner: 916.123.4567", "owner: [removed]"},
+		{"+79161234567", "[removed]"},
+		{"(495) 123-4567 or 8-800-555-35-35", "[removed] or [removed]"},
+		{"Seen 2024-05-17 10:30 near the park", "Seen 2024-05-17 10:30 near the park"},
+		{"Seen 17.05.2024 10 30", "Seen 17.05.2024 10 30"},
+		{"Location 55.7558 37.6173", "Location 55.7558 37.6173"},
+		{"Location 55.755831, 37.617673", "Location 55.755831, 37.617673"},
+		{"Kashtanka case 1234567890123", "Kashtanka case 1234567890123"},
+		{"Chip 643-094-100-123-456-789", "Chip 643-094-100-123-456-789"},
+		{"Order a12-345-678-90", "Order a12-345-678-90"},
+		{"Short 555-1234", "Short 555-1234"},
+	}
+	for _, c := range cases {
+		if scrubbed, _ := scrubber.scrub(c.text); scrubbed != c.expected {
+			t.Errorf("%q: expected %q, got %q", c.text, c.expected, scrubbed)
+		}
+	}
+}
+
+func TestScrubCardKeepsCommentsItCantEdit(t *testing.T) {
+	now := time.Now()
+	created := now.Add(-24 * time.Hour).Truncate(time.Second)
+	gateway, _, card := testBoard(created, now)
+	card.Desc = "Owner anna@example.org"
+	gateway.AddAction(card.ID, &trello.Action{ID: testID(created, 3), Type: "commentCard", Date: now, Data: &trello.ActionData{Text: "Write to anna@example.org"}})
+	gateway.AddAction(card.ID, &trello.Action{ID: testID(created, 4), Type: "updateCard", Date: now})
+	scrubber := &piiScrubber{patterns: []piiPattern{builtinPIIPatterns["email"]}, replacement: "[removed]"}
+	editless := editlessGateway{gateway}
+
+	if err := scrubber.scrubCard(editless, card); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := gateway.Card(card.ID)
+	if stored.Desc != "Owner [removed]" {
+		t.Errorf("expected the description scrubbed, got %q", stored.Desc)
+	}
+	if comments := gateway.Comments(card.ID); len(comments) != 1 {
+		t.Errorf("expected the comment kept, got %q", comments)
+	}
+}
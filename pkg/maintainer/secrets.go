@@ -0,0 +1,64 @@
+package maintainer
+
+import (
+	"os"
+	"strings"
+)
+
+// Suffix of the env var holding the path of the file with the secret instead of the secret itself,
+// e.g. TRELLO_TOKEN_FILE=/run/secrets/trello_token for Docker and Kubernetes secret mounts
+const secretFileEnvSuffix = "_FILE"
+
+// Returns the value of the env var, the content of the file named by the env var with _FILE suffix
+// or the field of the Vault secret named as the env var, in this order.
+// The value referring to AWS Secrets Manager or SSM Parameter Store is replaced with the referred secret
+func lookupSecretEnv(envKey string) (string, bool) {
+	data, defined := lookupRawSecretEnv(envKey)
+	if !defined || !isAWSSecretReference(data) {
+		return data, defined
+	}
+	resolved, err := awsSecrets.resolve(data)
+	if err != nil {
+		configFatalf("can't resolve \"%s\": %v", envKey, err)
+	}
+	return resolved, true
+}
+
+func lookupRawSecretEnv(envKey string) (string, bool) {
+	if data, defined := os.LookupEnv(envKey); defined {
+		return data, true
+	}
+	path, defined := os.LookupEnv(envKey + secretFileEnvSuffix)
+	if !defined {
+		if vault := vaultSecretsFromEnv(); vault != nil {
+			data, found, err := vault.lookup(envKey)
+			if err != nil {
+				configFatalf("%v", err)
+			}
+			return data, found
+		}
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		configFatalf("can't read \"%s\" secret file: %v", envKey+secretFileEnvSuffix, err)
+	}
+	// editors and `echo` leave the trailing newline
+	return strings.TrimRight(string(data), "\r\n"), true
+}
+
+func extractSecretEnvOrExit(envKey string) string {
+	data, defined := lookupSecretEnv(envKey)
+	if !defined {
+		configFatalf("neither \"%s\" nor \"%s\" env var is defined (nor the Vault secret field)", envKey, envKey+secretFileEnvSuffix)
+	}
+	return data
+}
+
+func extractSecretEnvOrDefault(envKey string, defaultVal string) string {
+	data, defined := lookupSecretEnv(envKey)
+	if !defined {
+		return defaultVal
+	}
+	return data
+}
@@ -0,0 +1,195 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+const SIMILARITY_CUSTOM_FIELD_ENV = "SIMILARITY_CUSTOM_FIELD"
+const SIMILARITY_REGEX_ENV = "SIMILARITY_REGEX"
+const SIMILARITY_RECOVERY_ENV = "SIMILARITY_RECOVERY"
+const SIMILARITY_NEEDS_FIX_LABEL_ENV = "SIMILARITY_NEEDS_FIX_LABEL"
+
+// Where the similarity of the card is read from.
+// The custom field (if configured) takes precedence over the description.
+// The description is parsed with descRegex (if configured) or the last word of it is taken.
+// recovery looks for the similarity among the earlier words of the description if it is not found there
+type similaritySource struct {
+	customFieldName   string
+	boardCustomFields []*trello.CustomField
+	descRegex         *regexp.Regexp
+	recovery          bool
+}
+
+func similaritySourceFromEnv() (similaritySource, error) {
+	source := similaritySource{
+		customFieldName: extractEnvOrDefault(SIMILARITY_CUSTOM_FIELD_ENV, ""),
+		recovery:        extractBoolEnvOrDefault(SIMILARITY_RECOVERY_ENV, false),
+	}
+	pattern := extractEnvOrDefault(SIMILARITY_REGEX_ENV, "")
+	if len(pattern) > 0 {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return source, fmt.Errorf("can't compile %s: %w", SIMILARITY_REGEX_ENV, err)
+		}
+		if re.NumSubexp() != 1 {
+			return source, fmt.Errorf("%s must contain exactly one capture group, got %d", SIMILARITY_REGEX_ENV, re.NumSubexp())
+		}
+		source.descRegex = re
+	}
+	return source, nil
+}
+
+func (s similaritySource) extract(card *trello.Card) *float64 {
+	sim, _ := s.extractRecovering(card)
+	return sim
+}
+
+// Also tells whether the similarity is only found by the recovery, i.e. the card needs a fix
+func (s similaritySource) extractRecovering(card *trello.Card) (*float64, bool) {
+	if len(s.customFieldName) > 0 {
+		sim := tryExtractCustomFieldSimilarity(card, s.boardCustomFields, s.customFieldName)
+		if sim != nil {
+			return sim, false
+		}
+	}
+	var sim *float64
+	if s.descRegex != nil {
+		sim = tryExtractRegexSimilarity(card, s.descRegex)
+	} else {
+		sim = tryExtractSimilarity(card)
+	}
+	if sim == nil && s.recovery {
+		sim = recoverSimilarity(card)
+		return sim, sim != nil
+	}
+	return sim, false
+}
+
+// The description without the similarity value read from it (the whole descRegex match or the last word),
+// false if the description doesn't contain it
+func (s similaritySource) descWithoutSimilarity(desc string) (string, bool) {
+	if s.descRegex != nil {
+		loc := s.descRegex.FindStringIndex(desc)
+		if loc == nil {
+			return desc, false
+		}
+		return strings.TrimSpace(desc[:loc[0]] + desc[loc[1]:]), true
+	}
+	spaceDescLastIdx := strings.LastIndex(desc, " ")
+	if spaceDescLastIdx == -1 {
+		return desc, false
+	}
+	return strings.TrimRight(desc[:spaceDescLastIdx], " \n"), true
+}
+
+// Takes the last word of the description which is a similarity value in [0, 1], e.g. the one followed by a note
+// or glued to its label as "similarity:0.87"
+func recoverSimilarity(card *trello.Card) *float64 {
+	words := strings.FieldsFunc(card.Desc, func(r rune) bool { return unicode.IsSpace(r) || r == ':' || r == '=' })
+	for i := len(words) - 1; i >= 0; i-- {
+		word := strings.TrimRight(strings.Trim(words[i], "()[]{}\"',;!?*_"), ".")
+		simVal, err := parseSimilarityValue(word)
+		if err != nil || simVal < 0 || simVal > 1 {
+			continue
+		}
+		log.Printf("Recovered similarity %v of card (%v) from the word \"%v\" of its desc\n", simVal, card.Name, words[i])
+		return &simVal
+	}
+	return nil
+}
+
+// e.g. "Similarity: 0.87 (match #123)" with `Similarity: ([0-9.]+)`
+func tryExtractRegexSimilarity(card *trello.Card, re *regexp.Regexp) *float64 {
+	match := re.FindStringSubmatch(card.Desc)
+	if match == nil {
+		log.Printf("Can't extract similarity from card (%v) desc. It does not match %v\n", card.Name, re)
+		return nil
+	}
+	simVal, err := parseSimilarityValue(match[1])
+	if err != nil {
+		log.Printf("Can't extract similarity from card (%v) desc. can't parse float \"%v\"\n", card.Name, match[1])
+		return nil
+	}
+	return &simVal
+}
+
+// Parses "0.93" as well as "0,93" (comma decimal separator) and "93%" (percent notation)
+func parseSimilarityValue(str string) (float64, error) {
+	str = strings.TrimSpace(str)
+	isPercent := strings.HasSuffix(str, "%")
+	if isPercent {
+		str = strings.TrimSpace(strings.TrimSuffix(str, "%"))
+	}
+	if !strings.Contains(str, ".") {
+		str = strings.Replace(str, ",", ".", 1)
+	}
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, err
+	}
+	if isPercent {
+		val /= 100
+	}
+	return val, nil
+}
+
+func tryExtractSimilarity(card *trello.Card) *float64 {
+	var spaceDescLastIdx int = strings.LastIndex(card.Desc, " ")
+	if spaceDescLastIdx == -1 {
+		log.Printf("Can't extract similarity from card (%v) desc\n", card.Name)
+		return nil
+	}
+
+	toParse := card.Desc[spaceDescLastIdx+1:]
+	simVal, err := parseSimilarityValue(toParse)
+	if err == nil {
+		return &simVal
+	}
+	log.Printf("Can't extract similarity from card (%v) desc. can't parse float \"%v\"\n", card.Name, toParse)
+
+	return nil
+}
+
+// The card must be fetched with "customFieldItems" argument for its custom fields to be available
+func tryExtractCustomFieldSimilarity(card *trello.Card, boardCustomFields []*trello.CustomField, fieldName string) *float64 {
+	value, found := card.CustomFields(boardCustomFields)[fieldName]
+	if !found {
+		return nil
+	}
+	var simVal float64
+	switch v := value.(type) {
+	case float64:
+		simVal = v
+	case int:
+		simVal = float64(v)
+	case int64:
+		simVal = float64(v)
+	case string:
+		parsed, err := parseSimilarityValue(v)
+		if err != nil {
+			log.Printf("Can't parse similarity custom field \"%v\" of card (%v): \"%v\"\n", fieldName, card.Name, v)
+			return nil
+		}
+		simVal = parsed
+	default:
+		log.Printf("Unsupported type of similarity custom field \"%v\" of card (%v): %T\n", fieldName, card.Name, value)
+		return nil
+	}
+	return &simVal
+}
+
+func fetchBoardCustomFields(gateway trelloops.TrelloGateway, boardId string) []*trello.CustomField {
+	fields, err := gateway.GetBoardCustomFields(boardId)
+	if err != nil {
+		log.Panicf("Can't fetch custom fields of the board %v: %v", boardId, err)
+	}
+	return fields
+}
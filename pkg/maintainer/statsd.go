@@ -0,0 +1,63 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+const STATSD_ADDR_ENV = "STATSD_ADDR"
+const STATSD_PREFIX_ENV = "STATSD_PREFIX"
+const STATSD_TAGS_ENV = "STATSD_TAGS"
+
+// Sends the run counters to StatsD over UDP. Tags (if set) are appended in DogStatsD format
+type statsdEmitter struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+}
+
+// Returns nil if STATSD_ADDR is not set
+func statsdEmitterFromEnv() (*statsdEmitter, error) {
+	addr := extractEnvOrDefault(STATSD_ADDR_ENV, "")
+	if len(addr) == 0 {
+		return nil, nil
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to StatsD %v: %w", addr, err)
+	}
+	emitter := &statsdEmitter{conn: conn, prefix: extractEnvOrDefault(STATSD_PREFIX_ENV, "trello_board_maintainer.")}
+	if tags := extractEnvOrDefault(STATSD_TAGS_ENV, ""); len(tags) > 0 {
+		emitter.tags = "|#" + tags + ",version:" + version
+	}
+	return emitter, nil
+}
+
+func (e *statsdEmitter) send(name string, value string, kind string) {
+	line := e.prefix + name + ":" + value + "|" + kind + e.tags
+	if _, err := e.conn.Write([]byte(line)); err != nil {
+		log.Printf("Failed to send %s to StatsD: %v\n", name, err)
+	}
+}
+
+// Sends the action and error counters and the duration of the run
+func (e *statsdEmitter) emitRun(summary *runSummary, duration time.Duration) {
+	summary.mu.Lock()
+	counters := map[string]int{"errors": summary.errors}
+	for action, count := range summary.actions {
+		counters["actions."+strings.ToLower(string(action))] = count
+	}
+	summary.mu.Unlock()
+	for name, count := range counters {
+		e.send(name, fmt.Sprint(count), "c")
+	}
+	e.send("runs", "1", "c")
+	e.send("run_duration", fmt.Sprint(duration.Milliseconds()), "ms")
+}
+
+func (e *statsdEmitter) close() {
+	e.conn.Close()
+}
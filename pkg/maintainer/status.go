@@ -0,0 +1,141 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+const STATUS_CARD_ENV = "STATUS_CARD"
+const STATUS_LIST_ENV = "STATUS_LIST"
+
+// Counts the actions and the errors of the run. Receives the actions as the sink and the errors from the audit log
+type runSummary struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	actions   map[journalActionType]int
+	errors    int
+	// the links of the cards whose similarity needs a fix
+	needsFix []string
+}
+
+func newRunSummary(now time.Time) *runSummary {
+	return &runSummary{startedAt: now, actions: make(map[journalActionType]int)}
+}
+
+func (s *runSummary) publish(entry journalEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions[entry.Action]++
+	return nil
+}
+
+func (s *runSummary) close() error {
+	return nil
+}
+
+func (s *runSummary) describe() string {
+	return "run summary"
+}
+
+func (s *runSummary) recordError() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors++
+}
+
+func (s *runSummary) recordNeedsFix(cardURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.needsFix = append(s.needsFix, cardURL)
+}
+
+// The nil summary counts nothing
+func (s *runSummary) errorCount() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errors
+}
+
+// e.g. "archived 12, deleted 3, reordered 45, 2 errors"
+func (s *runSummary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var parts []string
+	for _, action := range []struct {
+		action journalActionType
+		verb   string
+	}{
+		{journalActionArchive, "archived"},
+		{journalActionDelete, "deleted"},
+		{journalActionMoveToBoard, "moved to another board"},
+		{journalActionMoveToList, "moved to another list"},
+		{journalActionReorder, "reordered"},
+		{journalActionCreate, "created"},
+	} {
+		if count := s.actions[action.action]; count > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", action.verb, count))
+		}
+	}
+	if s.errors == 1 {
+		parts = append(parts, "1 error")
+	} else if s.errors > 1 {
+		parts = append(parts, fmt.Sprintf("%d errors", s.errors))
+	}
+	if len(s.needsFix) == 1 {
+		parts = append(parts, "1 card needs the similarity fix")
+	} else if len(s.needsFix) > 1 {
+		parts = append(parts, fmt.Sprintf("%d cards need the similarity fix", len(s.needsFix)))
+	}
+	if len(parts) == 0 {
+		return "nothing to do"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// The fields of the run summary message
+func (s *runSummary) messageData(now time.Time) map[string]interface{} {
+	data := map[string]interface{}{
+		"StartedAt": s.startedAt,
+		"Duration":  now.Sub(s.startedAt).Round(time.Second),
+		"Summary":   s.String(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data["Archived"] = s.actions[journalActionArchive]
+	data["Deleted"] = s.actions[journalActionDelete]
+	data["MovedToBoard"] = s.actions[journalActionMoveToBoard]
+	data["MovedToList"] = s.actions[journalActionMoveToList]
+	data["Reordered"] = s.actions[journalActionReorder]
+	data["Created"] = s.actions[journalActionCreate]
+	data["Errors"] = s.errors
+	data["NeedsFix"] = append([]string(nil), s.needsFix...)
+	return data
+}
+
+// Posts the summary as a comment to the status card and/or as a new card of the status list
+func postRunSummary(client *trello.Client, cardID string, listID string, summary *runSummary, now time.Time) {
+	text := renderMessage(messageRunSummary, summary.messageData(now))
+	if len(cardID) > 0 {
+		card, err := client.GetCard(cardID, trello.Defaults())
+		if err == nil {
+			_, err = card.AddComment(text)
+		}
+		if err != nil {
+			log.Printf("Failed to post the run summary to the status card %v: %v\n", cardID, err)
+		}
+	}
+	if len(listID) > 0 {
+		if err := client.CreateCard(&trello.Card{Name: text, IDList: listID}, trello.Arguments{"pos": "top"}); err != nil {
+			log.Printf("Failed to post the run summary to the status list %v: %v\n", listID, err)
+		}
+	}
+	log.Println(text)
+}
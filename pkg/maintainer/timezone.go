@@ -0,0 +1,27 @@
+package maintainer
+
+import (
+	"log"
+	"time"
+
+	// the alpine image has no zoneinfo database
+	_ "time/tzdata"
+)
+
+const BOARD_TIMEZONE_ENV = "BOARD_TIMEZONE"
+
+// Makes the board owner's timezone (e.g. "Europe/Moscow") the local one,
+// so that "now", business days and log timestamps are computed in it rather than in container's clock zone.
+// Must be called before any goroutine is started
+func applyBoardTimezoneFromEnv() {
+	tzName := extractEnvOrDefault(BOARD_TIMEZONE_ENV, "")
+	if len(tzName) == 0 {
+		return
+	}
+	loc, err := time.LoadLocation(tzName)
+	if err != nil {
+		log.Fatalf("ERROR: can't load timezone \"%s\": %v\n", tzName, err)
+	}
+	time.Local = loc
+	log.Printf("Using timezone %s\n", loc)
+}
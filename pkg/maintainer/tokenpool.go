@@ -0,0 +1,73 @@
+package maintainer
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/adlio/trello"
+	"golang.org/x/time/rate"
+)
+
+// Comma separated additional tokens (of the same API key) the lists are spread across
+const TRELLO_TOKENS_ENV = "TRELLO_TOKENS"
+
+// Trello allows 300 requests per 10 seconds for the API key, the margin is for the clock skew
+const trelloKeyRequestsPerSecond = 28
+
+// Clients of the tokens. Each client throttles itself below the rate limit of its token,
+// so processLists gives every list its own client in turn to maintain more lists at once.
+// All of the clients share the rate limit of the API key
+type trelloClientPool struct {
+	clients []*trello.Client
+	next    uint64
+}
+
+type trelloClientPoolKey struct{}
+type listClientKey struct{}
+
+// The pool of TRELLO_TOKEN and TRELLO_TOKENS
+func trelloClientPoolFromEnv(key string, token string) *trelloClientPool {
+	tokens := []string{token}
+	for _, extra := range strings.Split(extractSecretEnvOrDefault(TRELLO_TOKENS_ENV, ""), ",") {
+		if extra = strings.TrimSpace(extra); len(extra) > 0 && extra != token {
+			tokens = append(tokens, extra)
+		}
+	}
+	if len(tokens) == 1 {
+		return &trelloClientPool{clients: []*trello.Client{newTrelloClient(key, token)}}
+	}
+	keyLimiter := rate.NewLimiter(rate.Every(time.Second/trelloKeyRequestsPerSecond), 1)
+	pool := &trelloClientPool{}
+	for _, token := range tokens {
+		pool.clients = append(pool.clients, newKeyLimitedTrelloClient(key, token, keyLimiter))
+	}
+	return pool
+}
+
+// Round-robin
+func (p *trelloClientPool) take() *trello.Client {
+	return p.clients[(atomic.AddUint64(&p.next, 1)-1)%uint64(len(p.clients))]
+}
+
+func withTrelloClientPool(ctx context.Context, pool *trelloClientPool) context.Context {
+	return context.WithValue(ctx, trelloClientPoolKey{}, pool)
+}
+
+// Assigns the next client of the run pool (if there is one) to the list processed under the context
+func withNextListClient(ctx context.Context) context.Context {
+	pool, found := ctx.Value(trelloClientPoolKey{}).(*trelloClientPool)
+	if !found || len(pool.clients) < 2 {
+		return ctx
+	}
+	return context.WithValue(ctx, listClientKey{}, pool.take())
+}
+
+// The client assigned to the list processed under the context, or the fallback client
+func listClient(ctx context.Context, fallback *trello.Client) *trello.Client {
+	if client, found := ctx.Value(listClientKey{}).(*trello.Client); found {
+		return client.WithContext(ctx)
+	}
+	return fallback.WithContext(ctx)
+}
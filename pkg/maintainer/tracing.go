@@ -0,0 +1,62 @@
+package maintainer
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Standard OpenTelemetry env vars, also read by the OTLP exporter itself
+const OTEL_EXPORTER_OTLP_ENDPOINT_ENV = "OTEL_EXPORTER_OTLP_ENDPOINT"
+const OTEL_EXPORTER_OTLP_TRACES_ENDPOINT_ENV = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+const OTEL_SERVICE_NAME_ENV = "OTEL_SERVICE_NAME"
+
+// Spans of the run, its lists, cards and Trello API calls. The tracer is a no-op until setupTracingFromEnv configures the exporter
+var tracer = otel.Tracer("github.com/LostPetInitiative/TrelloBoardMaintainer")
+
+// Exports the spans over OTLP/HTTP if the OTLP endpoint is set. Returns the function flushing the spans, which must be called before exit
+func setupTracingFromEnv() func() {
+	if len(extractEnvOrDefault(OTEL_EXPORTER_OTLP_ENDPOINT_ENV, "")) == 0 && len(extractEnvOrDefault(OTEL_EXPORTER_OTLP_TRACES_ENDPOINT_ENV, "")) == 0 {
+		return func() {}
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		log.Fatalf("ERROR: can't configure OTLP trace exporter: %v\n", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(extractEnvOrDefault(OTEL_SERVICE_NAME_ENV, "trello-board-maintainer")),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	log.Println("Traces are exported over OTLP")
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v\n", err)
+		}
+	}
+}
+
+// Marks the span failed if the error is not nil
+func recordSpanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+func cardSpanAttributes(cardID string, cardName string) trace.SpanStartOption {
+	return trace.WithAttributes(attribute.String("trello.card.id", cardID), attribute.String("trello.card.name", cardName))
+}
@@ -0,0 +1,78 @@
+package maintainer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// Proxy of the outgoing requests overriding the standard HTTPS_PROXY, HTTP_PROXY and NO_PROXY env vars
+const OUTBOUND_PROXY_URL_ENV = "OUTBOUND_PROXY_URL"
+const TLS_CA_FILE_ENV = "TLS_CA_FILE"
+const TLS_CLIENT_CERT_FILE_ENV = "TLS_CLIENT_CERT_FILE"
+const TLS_CLIENT_KEY_FILE_ENV = "TLS_CLIENT_KEY_FILE"
+const TLS_INSECURE_SKIP_VERIFY_ENV = "TLS_INSECURE_SKIP_VERIFY"
+
+var outboundTransportOnce sync.Once
+var outboundHTTPTransport *http.Transport
+var outboundTransportErr error
+
+// The transport of all of the outgoing HTTP requests (Trello, Kashtanka, geocoder, webhook, link checks, card backups, Vault, AWS)
+// with the proxy and the TLS settings of the env vars
+func outboundTransport() *http.Transport {
+	outboundTransportOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if proxy := extractEnvOrDefault(OUTBOUND_PROXY_URL_ENV, ""); len(proxy) > 0 {
+			proxyURL, err := url.Parse(proxy)
+			if err != nil {
+				outboundTransportErr = fmt.Errorf("can't parse %s: %v", OUTBOUND_PROXY_URL_ENV, err)
+				return
+			}
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if caFile := extractEnvOrDefault(TLS_CA_FILE_ENV, ""); len(caFile) > 0 {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				outboundTransportErr = fmt.Errorf("can't read %s: %v", TLS_CA_FILE_ENV, err)
+				return
+			}
+			// the bundle (e.g. of the corporate TLS inspecting proxy) is trusted in addition to the system roots
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				outboundTransportErr = fmt.Errorf("%s contains no PEM certificates", TLS_CA_FILE_ENV)
+				return
+			}
+			tlsConfig.RootCAs = pool
+		}
+		certFile := extractEnvOrDefault(TLS_CLIENT_CERT_FILE_ENV, "")
+		keyFile := extractEnvOrDefault(TLS_CLIENT_KEY_FILE_ENV, "")
+		if len(certFile) > 0 || len(keyFile) > 0 {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				outboundTransportErr = fmt.Errorf("can't load the TLS client certificate (%s and %s): %v", TLS_CLIENT_CERT_FILE_ENV, TLS_CLIENT_KEY_FILE_ENV, err)
+				return
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		if extractBoolEnvOrDefault(TLS_INSECURE_SKIP_VERIFY_ENV, false) {
+			log.Println("WARNING: TLS certificates of the servers are not verified")
+			tlsConfig.InsecureSkipVerify = true
+		}
+		transport.TLSClientConfig = tlsConfig
+		outboundHTTPTransport = transport
+	})
+	if outboundTransportErr != nil {
+		configFatalf("%v", outboundTransportErr)
+	}
+	return outboundHTTPTransport
+}
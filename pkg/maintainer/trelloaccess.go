@@ -0,0 +1,147 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// Access the Trello token grants to a board, organization or (with idModel "*") to all of them
+type tokenPermission struct {
+	IDModel   string `json:"idModel"`
+	ModelType string `json:"modelType"`
+	Read      bool   `json:"read"`
+	Write     bool   `json:"write"`
+}
+
+type tokenInfo struct {
+	IDMember    string            `json:"idMember"`
+	DateExpires *time.Time        `json:"dateExpires"`
+	Permissions []tokenPermission `json:"permissions"`
+}
+
+const PREFLIGHT_CHECK_ENV = "PREFLIGHT_CHECK"
+
+// Checks that the lists and the boards exist and the token may change them. The boards are fetched once
+type trelloAccessChecker struct {
+	client      *trello.Client
+	token       tokenInfo
+	mu          sync.Mutex
+	boards      map[string]*trello.Board
+	memberships map[string][]*trello.Membership
+}
+
+func newTrelloAccessChecker(client *trello.Client) (*trelloAccessChecker, error) {
+	checker := &trelloAccessChecker{client: client, boards: make(map[string]*trello.Board), memberships: make(map[string][]*trello.Membership)}
+	if err := client.Get("tokens/"+client.Token, trello.Arguments{"fields": "idMember,dateExpires,permissions"}, &checker.token); err != nil {
+		return nil, err
+	}
+	if checker.token.DateExpires != nil && checker.token.DateExpires.Before(time.Now()) {
+		return nil, fmt.Errorf("the token expired at %v", checker.token.DateExpires)
+	}
+	return checker, nil
+}
+
+// Whether the token may write to the model of the type (or to all of the models of the type)
+func (c *trelloAccessChecker) canWrite(modelType string, id string) bool {
+	for _, permission := range c.token.Permissions {
+		if permission.ModelType == modelType && (permission.IDModel == "*" || permission.IDModel == id) && permission.Write {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetches the board and checks the token may change it
+func (c *trelloAccessChecker) checkBoard(boardID string) (*trello.Board, error) {
+	c.mu.Lock()
+	board, fetched := c.boards[boardID]
+	memberships := c.memberships[boardID]
+	c.mu.Unlock()
+	if !fetched {
+		var err error
+		board, err = c.client.GetBoard(boardID, trello.Arguments{"fields": "name,closed,idOrganization"})
+		if err != nil {
+			return nil, fmt.Errorf("can't fetch the board: %w", err)
+		}
+		if err := c.client.Get("boards/"+board.ID+"/memberships", trello.Arguments{"filter": "all"}, &memberships); err != nil {
+			return nil, fmt.Errorf("can't fetch the members of the board \"%s\": %w", board.Name, err)
+		}
+		c.mu.Lock()
+		c.boards[boardID] = board
+		c.memberships[boardID] = memberships
+		c.mu.Unlock()
+	}
+	if board.Closed {
+		return board, fmt.Errorf("the board \"%s\" is closed", board.Name)
+	}
+	if !c.canWrite("Board", board.ID) && (len(board.IDOrganization) == 0 || !c.canWrite("Organization", board.IDOrganization)) {
+		return board, fmt.Errorf("the token has no write access to the board \"%s\"", board.Name)
+	}
+	// a write scoped token still can't archive the cards of a public board its member hasn't joined or only observes
+	membership := membershipOf(memberships, c.token.IDMember)
+	if membership == nil || membership.Deactivated {
+		return board, fmt.Errorf("the token member is not a member of the board \"%s\"", board.Name)
+	}
+	if membership.Type == "observer" {
+		return board, fmt.Errorf("the token member is only an observer of the board \"%s\"", board.Name)
+	}
+	return board, nil
+}
+
+func membershipOf(memberships []*trello.Membership, memberID string) *trello.Membership {
+	for _, membership := range memberships {
+		if membership.MemberID == memberID {
+			return membership
+		}
+	}
+	return nil
+}
+
+// Fetches the list and checks the token may change the cards of its board
+func (c *trelloAccessChecker) checkList(listID string) (*trello.List, error) {
+	list, err := c.client.GetList(listID)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch the list: %w", err)
+	}
+	if list.Closed {
+		return list, fmt.Errorf("the list \"%s\" is archived", list.Name)
+	}
+	if _, err := c.checkBoard(list.IDBoard); err != nil {
+		return list, fmt.Errorf("list \"%s\": %w", list.Name, err)
+	}
+	return list, nil
+}
+
+// Checks the access to all of the lists and boards the profiles maintain before any of them is changed,
+// so a token without the permission fails the run at the start instead of halfway through it.
+// Returns all of the problems found
+func preflightAccess(client *trello.Client, profiles []maintenanceProfile) []string {
+	access, err := newTrelloAccessChecker(client)
+	if err != nil {
+		return []string{trelloops.RedactCredentials(fmt.Sprintf("can't check the token: %v", err))}
+	}
+	var problems []string
+	for i := range profiles {
+		profile := &profiles[i]
+		lists, boards := profile.references()
+		for _, ref := range lists {
+			if _, err := access.checkList(ref.id); err != nil {
+				problems = append(problems, trelloops.RedactCredentials(fmt.Sprintf("profile \"%s\": %s %s: %v", profile.name, ref.setting, ref.id, err)))
+			}
+		}
+		for _, ref := range boards {
+			if _, err := access.checkBoard(ref.id); err != nil {
+				problems = append(problems, trelloops.RedactCredentials(fmt.Sprintf("profile \"%s\": %s %s: %v", profile.name, ref.setting, ref.id, err)))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		log.Println("The token has write access to all of the maintained boards")
+	}
+	return problems
+}
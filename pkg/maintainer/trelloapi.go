@@ -0,0 +1,43 @@
+package maintainer
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adlio/trello"
+	"golang.org/x/time/rate"
+)
+
+// Overrides the Trello API base URL, e.g. to point the bot at a mock server in the integration tests
+const TRELLO_API_BASE_URL_ENV = "TRELLO_API_BASE_URL"
+
+// Deadline of a single Trello request including reading the response, e.g. "30s" or "2m" (plain numbers are seconds)
+const HTTP_TIMEOUT_ENV = "HTTP_TIMEOUT"
+
+func httpTimeoutFromEnv() time.Duration {
+	data := extractEnvOrDefault(HTTP_TIMEOUT_ENV, "30s")
+	if seconds, err := strconv.ParseFloat(data, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	timeout, err := time.ParseDuration(data)
+	if err != nil {
+		configFatalf("can't parse \"%s\" env var as duration. String: %s", HTTP_TIMEOUT_ENV, data)
+	}
+	return timeout
+}
+
+// Trello client reporting its requests to the API usage metrics
+func newTrelloClient(key string, token string) *trello.Client {
+	return newKeyLimitedTrelloClient(key, token, nil)
+}
+
+// Trello client whose requests also wait for the limiter (if not nil) shared by the clients of the same API key
+func newKeyLimitedTrelloClient(key string, token string, keyLimiter *rate.Limiter) *trello.Client {
+	client := trello.NewClient(key, token)
+	client.BaseURL = strings.TrimRight(extractEnvOrDefault(TRELLO_API_BASE_URL_ENV, trello.DefaultBaseURL), "/")
+	instrumented := &instrumentedTransport{next: outboundTransport(), metrics: trelloMetrics, keyLimiter: keyLimiter, breaker: trelloCircuitBreakerFromEnv()}
+	client.Client = &http.Client{Timeout: httpTimeoutFromEnv(), Transport: trelloCachingTransportFromEnv(instrumented)}
+	return client
+}
@@ -0,0 +1,252 @@
+package maintainer
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The screen width, as some shells set it
+const COLUMNS_ENV = "COLUMNS"
+
+const dashboardRefreshInterval = time.Second
+
+// The log lines and the operator decisions kept on the screen
+const dashboardLogLines = 8
+const dashboardDecisions = 5
+
+// The most lists shown, the ones with the most cards
+const dashboardLists = 15
+
+// The action counters of the list
+type dashboardList struct {
+	name    string
+	actions map[journalActionType]int
+}
+
+// Full screen view of the supervised maintenance run: the pass progress, the lists with their card and action counts,
+// the action waiting for the operator and the latest log lines. Receives the actions as the sink and takes the log output over
+type terminalDashboard struct {
+	mu        sync.Mutex
+	in        *bufio.Reader
+	out       io.Writer
+	logOut    io.Writer
+	progress  *progressReporter
+	started   time.Time
+	lists     map[string]*dashboardList
+	logLines  []string
+	decisions []string
+	declined  int
+	// the action waiting for the answer, the screen isn't refreshed meanwhile not to wipe the typed answer
+	pending  string
+	finished bool
+	done     chan struct{}
+}
+
+func newTerminalDashboard() *terminalDashboard {
+	return &terminalDashboard{
+		in:       bufio.NewReader(os.Stdin),
+		out:      os.Stderr,
+		logOut:   log.Writer(),
+		progress: &progressReporter{out: io.Discard, stopped: true},
+		started:  time.Now(),
+		lists:    make(map[string]*dashboardList),
+		done:     make(chan struct{}),
+	}
+}
+
+// Takes the log output over and starts refreshing the screen
+func (d *terminalDashboard) start() {
+	log.SetOutput(d)
+	go func() {
+		ticker := time.NewTicker(dashboardRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.mu.Lock()
+				if len(d.pending) == 0 {
+					d.render()
+				}
+				d.mu.Unlock()
+			case <-d.done:
+				return
+			}
+		}
+	}()
+}
+
+// Shows the final state and gives the log output back
+func (d *terminalDashboard) stop() {
+	close(d.done)
+	d.mu.Lock()
+	d.finished = true
+	d.render()
+	d.mu.Unlock()
+	log.SetOutput(d.logOut)
+}
+
+// Keeps the latest log lines. The errors are written through as well, as log.Fatalf exits before the screen is refreshed
+func (d *terminalDashboard) Write(data []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if strings.Contains(string(data), "ERROR: ") {
+		d.logOut.Write(data)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		d.logLines = append(d.logLines, line)
+	}
+	if len(d.logLines) > dashboardLogLines {
+		d.logLines = d.logLines[len(d.logLines)-dashboardLogLines:]
+	}
+	return len(data), nil
+}
+
+func (d *terminalDashboard) publish(entry journalEntry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list, found := d.lists[entry.ListID]
+	if !found {
+		list = &dashboardList{name: entry.ListName, actions: make(map[journalActionType]int)}
+		d.lists[entry.ListID] = list
+	}
+	list.actions[entry.Action]++
+	return nil
+}
+
+func (d *terminalDashboard) close() error {
+	return nil
+}
+
+func (d *terminalDashboard) describe() string {
+	return "dashboard"
+}
+
+// Shows the action and reads the answer of the operator, see operatorConfirmation
+func (d *terminalDashboard) ask(action string) (string, error) {
+	d.mu.Lock()
+	d.pending = action
+	d.render()
+	d.mu.Unlock()
+
+	answer, err := d.in.ReadString('\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = ""
+	decision := strings.ToLower(strings.TrimSpace(answer))
+	switch decision {
+	case "n", "no", "q", "quit":
+		d.declined++
+	}
+	if len(decision) > 0 {
+		d.decisions = append(d.decisions, fmt.Sprintf("[%s] %s", decision, action))
+		if len(d.decisions) > dashboardDecisions {
+			d.decisions = d.decisions[len(d.decisions)-dashboardDecisions:]
+		}
+	}
+	d.render()
+	return answer, err
+}
+
+func truncateLine(line string, width int) string {
+	if runes := []rune(line); len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return line
+}
+
+// Redraws the whole screen, the caller holds the lock
+func (d *terminalDashboard) render() {
+	width := extractIntEnvOrDefault(COLUMNS_ENV, 120)
+	var screen strings.Builder
+	line := func(format string, a ...interface{}) {
+		screen.WriteString(truncateLine(fmt.Sprintf(format, a...), width))
+		screen.WriteString("\033[K\n")
+	}
+	screen.WriteString("\033[H\033[2J")
+
+	state := "running"
+	if d.finished {
+		state = "finished"
+	}
+	line("TrelloBoardMaintainer dashboard: %s, %v", state, time.Since(d.started).Round(time.Second))
+	counters, lists := d.progress.snapshot()
+	if len(counters.pass) > 0 {
+		line("Pass %s: %d/%d lists, %d/%d cards, %v", counters.pass, counters.listsDone, counters.lists,
+			counters.cardsDone, counters.cards, time.Since(counters.passStarted).Round(time.Second))
+	}
+	line("")
+
+	sort.Slice(lists, func(i, j int) bool { return lists[i].cards > lists[j].cards })
+	if len(lists) > dashboardLists {
+		lists = lists[:dashboardLists]
+	}
+	line("%-40s %6s %8s %8s %6s %10s", "LIST", "CARDS", "ARCHIVED", "DELETED", "MOVED", "REORDERED")
+	var approved int
+	for _, list := range d.lists {
+		for action, count := range list.actions {
+			if action != journalActionReorder {
+				approved += count
+			}
+		}
+	}
+	for _, list := range lists {
+		actions := make(map[journalActionType]int)
+		if counted, found := d.lists[list.id]; found {
+			actions = counted.actions
+		}
+		line("%-40s %6d %8d %8d %6d %10d", truncateLine(list.name, 40), list.cards, actions[journalActionArchive], actions[journalActionDelete],
+			actions[journalActionMoveToBoard]+actions[journalActionMoveToList], actions[journalActionReorder])
+	}
+	line("")
+
+	line("Actions performed: %d, declined: %d", approved, d.declined)
+	for _, decision := range d.decisions {
+		line("  %s", decision)
+	}
+	line("")
+
+	line("Log:")
+	for _, logLine := range d.logLines {
+		line("  %s", logLine)
+	}
+	line("")
+
+	if len(d.pending) > 0 {
+		line("Pending: %s", d.pending)
+		screen.WriteString("Proceed? [y/n/all/quit] ")
+	}
+	fmt.Fprint(d.out, screen.String())
+}
+
+// Performs the maintenance under the dashboard, asking the operator before each destructive action
+func runTUI(args []string) {
+	flags := flag.NewFlagSet("tui", flag.ExitOnError)
+	flags.Parse(args)
+	if !stderrIsTerminal() {
+		log.Fatalf("ERROR: the dashboard needs a terminal\n")
+	}
+
+	lock, err := acquireRunLockFromEnv()
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	defer lock.release()
+
+	dashboard := newTerminalDashboard()
+	confirm := newTerminalConfirmation()
+	confirm.ask = dashboard.ask
+	dashboard.start()
+	defer dashboard.stop()
+	if err := runMaintenance(maintenanceOptions{confirm: confirm, sinks: []actionSink{dashboard}, progress: dashboard.progress}); err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+}
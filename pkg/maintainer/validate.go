@@ -0,0 +1,217 @@
+package maintainer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/trelloops"
+	"github.com/adlio/trello"
+)
+
+// Trello object referred by the setting
+type configReference struct {
+	setting string
+	id      string
+}
+
+func appendReferences(refs []configReference, setting string, commaSepIds string) []configReference {
+	if len(commaSepIds) == 0 {
+		return refs
+	}
+	for _, id := range strings.Split(commaSepIds, ",") {
+		if id = strings.TrimSpace(id); len(id) > 0 {
+			refs = append(refs, configReference{setting: setting, id: id})
+		}
+	}
+	return refs
+}
+
+// The lists and the boards the profile refers to. Specs with suffixes or name regexes are reduced to the ids.
+// The profile must be valid
+func (p *maintenanceProfile) references() (lists []configReference, boards []configReference) {
+	lists = appendReferences(lists, "archive lists", p.archiveLists)
+	lists = appendReferences(lists, "delete lists", p.deleteLists)
+	lists = appendReferences(lists, "move lists", p.moveLists)
+	lists = appendReferences(lists, "move target list", p.moveTargetList)
+	if len(p.reorderLists) > 0 {
+		for _, listSpec := range strings.Split(p.reorderLists, ",") {
+			listId, _, _ := parseReorderListSpec(listSpec)
+			lists = appendReferences(lists, "reorder lists", listId)
+		}
+	}
+	lists = appendReferences(lists, "renormalize lists", p.renormalizeLists)
+	lists = appendReferences(lists, "low similarity list", p.lowSimilarityList)
+	lists = appendReferences(lists, "image cover lists", p.imageCoverLists)
+	lists = appendReferences(lists, "dedupe lists", p.dedupeLists)
+	lists = appendReferences(lists, "link check lists", p.linkCheckLists)
+	lists = appendReferences(lists, "broken link review list", p.brokenLinkReviewList)
+	lists = appendReferences(lists, "keyword lists", p.keywordLists)
+	lists = appendReferences(lists, "resolved list", p.resolvedList)
+	lists = appendReferences(lists, "map link lists", p.mapLinkLists)
+	lists = appendReferences(lists, "region label lists", p.regionLabelLists)
+	lists = appendReferences(lists, "Kashtanka lists", p.kashtankaLists)
+	lists = appendReferences(lists, "Kashtanka solved list", p.kashtankaSolvedList)
+	lists = appendReferences(lists, "member scrub lists", p.memberScrubLists)
+	lists = appendReferences(lists, "bot comment cleanup lists", p.botCommentLists)
+	lists = appendReferences(lists, "attachment cleanup lists", p.attachmentCleanupLists)
+	lists = appendReferences(lists, "description normalization lists", p.descNormalizeLists)
+	lists = appendReferences(lists, "mirror lists", p.mirrorLists)
+	rules, _ := p.cardRules()
+	for _, rule := range rules {
+		lists = appendReferences(lists, "rule "+rule.name, rule.lists)
+		lists = appendReferences(lists, "rule "+rule.name+" target list", rule.targetList)
+		boards = appendReferences(boards, "rule "+rule.name+" target board", rule.targetBoard)
+	}
+	if len(p.ageRouting) > 0 {
+		buckets, _ := parseAgeRouting(p.ageRouting)
+		for _, bucket := range buckets {
+			lists = appendReferences(lists, "age routing", bucket.listID)
+		}
+	}
+
+	boardSpecs := []struct {
+		setting    string
+		specs      string
+		withSuffix bool
+	}{
+		{"archive boards", p.archiveBoards, false},
+		{"reorder boards", p.reorderBoards, true},
+		{"empty lists archival", p.archiveEmptyLists, false},
+	}
+	for _, entry := range boardSpecs {
+		if len(entry.specs) == 0 {
+			continue
+		}
+		for _, rawSpec := range strings.Split(entry.specs, ",") {
+			boardSpec, _ := trelloops.ParseBoardListsSpec(rawSpec, entry.withSuffix)
+			boards = appendReferences(boards, entry.setting, boardSpec.BoardID)
+		}
+	}
+	boards = appendReferences(boards, "move target board", p.moveTargetBoard)
+	boards = appendReferences(boards, "intake board", p.intakeBoard)
+	boards = appendReferences(boards, "label cleanup boards", p.labelCleanupBoards)
+	boards = appendReferences(boards, "member cleanup boards", p.memberCleanupBoards)
+	if len(p.listOrderBoards) > 0 {
+		for _, rawSpec := range strings.Split(p.listOrderBoards, ",") {
+			spec, _ := parseListOrderSpec(rawSpec)
+			boards = appendReferences(boards, "list order boards", spec.boardID)
+		}
+	}
+	boards = appendReferences(boards, "mirror board", p.mirrorBoard)
+	return lists, boards
+}
+
+// Checks the configuration and the access to every configured list and board without changing anything.
+// Exits with non-zero code listing all of the problems found
+func runValidate(args []string) {
+	client := newTrelloClient(extractSecretEnvOrExit(TRELLO_KEY_ENV), extractSecretEnvOrExit(TRELLO_TOKEN_ENV))
+	var problems []string
+	report := func(format string, a ...interface{}) {
+		problems = append(problems, trelloops.RedactCredentials(fmt.Sprintf(format, a...)))
+	}
+
+	for _, check := range []struct {
+		name  string
+		parse func() error
+	}{
+		{"business calendar", func() error { _, err := businessCalendarFromEnv(); return err }},
+		{"similarity source", func() error { _, err := similaritySourceFromEnv(); return err }},
+		{"order scoring", func() error { _, err := orderScoringFromEnv(); return err }},
+		{"tie break", func() error { _, err := tieBreakFromEnv(); return err }},
+		{"coordinates source", func() error { _, err := coordinatesSourceFromEnv(); return err }},
+		{"map link provider", func() error {
+			_, err := parseMapProvider(extractEnvOrDefault(MAP_LINK_PROVIDER_ENV, "osm"))
+			return err
+		}},
+		{"cover colors", func() error { _, err := coverColorSchemeFromEnv(); return err }},
+		{"incomplete checklists", func() error { _, err := checklistPolicyFromEnv(); return err }},
+		{"card backups", func() error { _, err := newCardBackupStorageFromEnv(); return err }},
+		{"personal data scrubbing", func() error { _, err := piiScrubberFromEnv(); return err }},
+		{"excluded card names", func() error { _, err := excludeCardNameRegexFromEnv(); return err }},
+		{"label cleanup", func() error { _, err := labelCleanupRegexFromEnv(); return err }},
+		{"exempt cards", loadExemptCardIDs},
+		{"bot messages", loadMessageTemplates},
+	} {
+		if err := check.parse(); err != nil {
+			report("%s: %v", check.name, err)
+		}
+	}
+	kashtanka, err := kashtankaClientFromEnv()
+	if err != nil {
+		report("Kashtanka: %v", err)
+	}
+	regions, err := regionResolverFromEnv()
+	if err != nil {
+		report("regions: %v", err)
+	}
+	referencePoint, err := referencePointFromEnv()
+	if err != nil {
+		report("reference point: %v", err)
+	}
+
+	profiles, err := maintenanceProfilesFromEnv()
+	if err != nil {
+		report("%v", err)
+	}
+	access, err := newTrelloAccessChecker(client)
+	if err != nil {
+		report("can't check the token: %v", err)
+	}
+
+	checkList := func(where string, ref configReference) {
+		if access == nil {
+			return
+		}
+		if _, err := access.checkList(ref.id); err != nil {
+			report("%s: %s %s: %v", where, ref.setting, ref.id, err)
+		}
+	}
+	checkBoard := func(where string, ref configReference) {
+		if access == nil {
+			return
+		}
+		if _, err := access.checkBoard(ref.id); err != nil {
+			report("%s: %s %s: %v", where, ref.setting, ref.id, err)
+		}
+	}
+	for _, profile := range profiles {
+		where := fmt.Sprintf("profile \"%s\"", profile.name)
+		if err := profile.validate(); err != nil {
+			report("%s: %v", where, err)
+			continue
+		}
+		if err := profile.checkServices(kashtanka, regions, referencePoint); err != nil {
+			report("%s: %v", where, err)
+		}
+		lists, boards := profile.references()
+		for _, ref := range lists {
+			checkList(where, ref)
+		}
+		for _, ref := range boards {
+			checkBoard(where, ref)
+		}
+	}
+	for _, setting := range []string{STATUS_LIST_ENV, CARD_INTAKE_LIST_ENV} {
+		if id := extractEnvOrDefault(setting, ""); len(id) > 0 {
+			checkList("env", configReference{setting: setting, id: id})
+		}
+	}
+	if cardID := extractEnvOrDefault(STATUS_CARD_ENV, ""); len(cardID) > 0 && access != nil {
+		if card, err := client.GetCard(cardID, trello.Arguments{"fields": "idBoard"}); err != nil {
+			report("env: %s %s: can't fetch the card: %v", STATUS_CARD_ENV, cardID, err)
+		} else {
+			checkBoard("env", configReference{setting: STATUS_CARD_ENV + " board", id: card.IDBoard})
+		}
+	}
+
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problems found:\n", len(problems))
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "- %s\n", problem)
+		}
+		os.Exit(1)
+	}
+	log.Println("The configuration is valid, all of the lists and boards are accessible")
+}
@@ -0,0 +1,214 @@
+package maintainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const VAULT_ADDR_ENV = "VAULT_ADDR"
+const VAULT_TOKEN_ENV = "VAULT_TOKEN"
+const VAULT_ROLE_ENV = "VAULT_ROLE"
+const VAULT_AUTH_PATH_ENV = "VAULT_AUTH_PATH"
+const VAULT_SECRET_PATH_ENV = "VAULT_SECRET_PATH"
+const VAULT_SECRET_TTL_SECONDS_ENV = "VAULT_SECRET_TTL_SECONDS"
+
+const kubernetesServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Secrets read from a Vault secret whose fields are named as the env vars, e.g. TRELLO_KEY and TRELLO_TOKEN.
+// The secret is cached for ttl (or its lease) and re-read after, so the rotated credentials are picked up by the next run.
+// Vault authenticates with the static token or with the Kubernetes service account of the pod under the role
+type vaultSecrets struct {
+	addr        string
+	staticToken string
+	role        string
+	authPath    string
+	secretPath  string
+	ttl         time.Duration
+	http        *http.Client
+
+	mu           sync.Mutex
+	token        string
+	tokenExpires time.Time
+	renewable    bool
+	values       map[string]string
+	expires      time.Time
+}
+
+var vaultOnce sync.Once
+var vaultSecretStore *vaultSecrets
+var vaultSecretsErr error
+
+// The process-wide Vault secrets. nil if VAULT_SECRET_PATH is not set
+func vaultSecretsFromEnv() *vaultSecrets {
+	vaultOnce.Do(func() {
+		secretPath := extractEnvOrDefault(VAULT_SECRET_PATH_ENV, "")
+		if len(secretPath) == 0 {
+			return
+		}
+		addr := extractEnvOrDefault(VAULT_ADDR_ENV, "")
+		if len(addr) == 0 {
+			vaultSecretsErr = fmt.Errorf("%s must be set to read the secrets from Vault", VAULT_ADDR_ENV)
+			return
+		}
+		v := &vaultSecrets{
+			addr:        strings.TrimRight(addr, "/"),
+			staticToken: extractEnvOrDefault(VAULT_TOKEN_ENV, ""),
+			role:        extractEnvOrDefault(VAULT_ROLE_ENV, ""),
+			authPath:    extractEnvOrDefault(VAULT_AUTH_PATH_ENV, "kubernetes"),
+			secretPath:  strings.Trim(secretPath, "/"),
+			ttl:         time.Duration(extractIntEnvOrDefault(VAULT_SECRET_TTL_SECONDS_ENV, 300)) * time.Second,
+			http:        &http.Client{Timeout: 15 * time.Second, Transport: outboundTransport()},
+		}
+		if len(v.staticToken) == 0 && len(v.role) == 0 {
+			vaultSecretsErr = fmt.Errorf("either %s or %s must be set to authenticate to Vault", VAULT_TOKEN_ENV, VAULT_ROLE_ENV)
+			return
+		}
+		vaultSecretStore = v
+	})
+	if vaultSecretsErr != nil {
+		configFatalf("%v", vaultSecretsErr)
+	}
+	return vaultSecretStore
+}
+
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+type vaultResponse struct {
+	Auth          *vaultAuth             `json:"auth"`
+	Data          map[string]interface{} `json:"data"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Errors        []string               `json:"errors"`
+}
+
+func (v *vaultSecrets) request(method string, path string, body interface{}) (*vaultResponse, int, error) {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return nil, 0, err
+		}
+	}
+	req, err := http.NewRequest(method, v.addr+"/v1/"+path, &payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(v.token) > 0 {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	var parsed vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("can't parse Vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("Vault responded to %s with HTTP %d: %s", path, resp.StatusCode, strings.Join(parsed.Errors, "; "))
+	}
+	return &parsed, resp.StatusCode, nil
+}
+
+// Gets the Vault token: renews the current one if Vault allows, logs in with the service account otherwise
+func (v *vaultSecrets) authenticate() error {
+	if len(v.staticToken) > 0 {
+		v.token = v.staticToken
+		return nil
+	}
+	if len(v.token) > 0 && time.Now().Before(v.tokenExpires) {
+		return nil
+	}
+	if len(v.token) > 0 && v.renewable {
+		if resp, _, err := v.request(http.MethodPost, "auth/token/renew-self", nil); err == nil && resp.Auth != nil {
+			v.setToken(resp.Auth)
+			return nil
+		} else if err != nil {
+			log.Printf("Can't renew Vault token, logging in again: %v\n", err)
+		}
+	}
+	jwt, err := os.ReadFile(kubernetesServiceAccountTokenPath)
+	if err != nil {
+		return fmt.Errorf("can't read the service account token for Vault login: %w", err)
+	}
+	v.token = ""
+	resp, _, err := v.request(http.MethodPost, "auth/"+v.authPath+"/login", map[string]string{"role": v.role, "jwt": strings.TrimSpace(string(jwt))})
+	if err != nil {
+		return err
+	}
+	if resp.Auth == nil {
+		return fmt.Errorf("Vault login returned no token")
+	}
+	v.setToken(resp.Auth)
+	return nil
+}
+
+func (v *vaultSecrets) setToken(auth *vaultAuth) {
+	v.token = auth.ClientToken
+	v.renewable = auth.Renewable
+	// renew ahead of the expiry so the token doesn't expire during the secret read
+	v.tokenExpires = time.Now().Add(time.Duration(auth.LeaseDuration) * time.Second * 4 / 5)
+}
+
+// Reads the secret. Both KV version 1 ("secret/trello") and version 2 ("secret/data/trello") paths are supported
+func (v *vaultSecrets) refresh() error {
+	if err := v.authenticate(); err != nil {
+		return err
+	}
+	resp, status, err := v.request(http.MethodGet, v.secretPath, nil)
+	if status == http.StatusForbidden && len(v.staticToken) == 0 {
+		// the token was revoked before its lease ended
+		v.token = ""
+		if err := v.authenticate(); err != nil {
+			return err
+		}
+		resp, _, err = v.request(http.MethodGet, v.secretPath, nil)
+	}
+	if err != nil {
+		return err
+	}
+	data := resp.Data
+	if nested, isKV2 := data["data"].(map[string]interface{}); isKV2 {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nested
+		}
+	}
+	values := make(map[string]string, len(data))
+	for name, value := range data {
+		values[name] = fmt.Sprint(value)
+	}
+	ttl := v.ttl
+	if lease := time.Duration(resp.LeaseDuration) * time.Second; lease > 0 && lease < ttl {
+		ttl = lease
+	}
+	v.values = values
+	v.expires = time.Now().Add(ttl)
+	return nil
+}
+
+// Returns the field of the secret, reading it from Vault if the cached copy expired.
+// The cached copy is used if Vault is unavailable
+func (v *vaultSecrets) lookup(name string) (string, bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.values == nil || time.Now().After(v.expires) {
+		if err := v.refresh(); err != nil {
+			if v.values == nil {
+				return "", false, fmt.Errorf("can't read Vault secret %s: %w", v.secretPath, err)
+			}
+			log.Printf("Can't re-read Vault secret %s, using the cached copy: %v\n", v.secretPath, err)
+		}
+	}
+	value, found := v.values[name]
+	return value, found, nil
+}
@@ -0,0 +1,18 @@
+package maintainer
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build metadata, set with -ldflags "-X github.com/LostPetInitiative/TrelloBoardMaintainer/pkg/maintainer.version=... (and commit, buildDate)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// e.g. "TrelloBoardMaintainer v1.4.0 (commit 8f13efc, built 2024-08-12T10:00:00Z, go1.19.13)"
+func versionString() string {
+	return fmt.Sprintf("TrelloBoardMaintainer %s (commit %s, built %s, %s)", version, commit, buildDate, runtime.Version())
+}
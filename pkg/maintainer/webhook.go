@@ -0,0 +1,61 @@
+package maintainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const ACTION_WEBHOOK_URL_ENV = "ACTION_WEBHOOK_URL"
+
+// POSTs every action (including reorders) to the URL as the JSON journal record
+type actionWebhook struct {
+	url    string
+	client *http.Client
+}
+
+func (w *actionWebhook) publish(entry journalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		// the url.Error quotes the URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s failed: %w", w.describe(), urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (w *actionWebhook) close() error {
+	return nil
+}
+
+// Only the scheme and the host, the path and the query may carry the secret of the webhook
+func (w *actionWebhook) describe() string {
+	parsed, err := url.Parse(w.url)
+	if err != nil || len(parsed.Host) == 0 {
+		return "webhook"
+	}
+	return fmt.Sprintf("webhook %s://%s", parsed.Scheme, parsed.Host)
+}
+
+func actionWebhookFromEnv() *actionWebhook {
+	webhookURL := extractSecretEnvOrDefault(ACTION_WEBHOOK_URL_ENV, "")
+	if len(webhookURL) == 0 {
+		return nil
+	}
+	return &actionWebhook{url: webhookURL, client: &http.Client{Timeout: 10 * time.Second, Transport: outboundTransport()}}
+}
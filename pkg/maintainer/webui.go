@@ -0,0 +1,247 @@
+package maintainer
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The most recent runs listed by the web UI
+const webUIRuns = 50
+
+// How long the web UI waits for the journal held by the active run
+const webUIJournalTimeout = time.Second
+
+var webUITemplates = template.Must(template.New("layout").Funcs(template.FuncMap{
+	"time": func(t interface{}) string {
+		switch t := t.(type) {
+		case time.Time:
+			return t.Format("2006-01-02 15:04:05")
+		case *time.Time:
+			if t != nil {
+				return t.Format("2006-01-02 15:04:05")
+			}
+		}
+		return ""
+	},
+}).Parse(`{{define "header"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>TrelloBoardMaintainer</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.failed { color: #b00; }
+</style></head><body>
+<h1><a href="/ui/">TrelloBoardMaintainer</a></h1>
+{{end}}
+{{define "footer"}}</body></html>
+{{end}}
+{{define "runs"}}{{template "header"}}
+{{with .Active}}<p>The run is in progress since {{time .StartedAt}}, actions so far: {{range $action, $count := .Actions}}{{$action}} {{$count}} {{else}}none{{end}}</p>
+{{else}}<form method="post" action="/ui/runs"><input type="hidden" name="csrf" value="{{.CSRF}}"><button>Run the maintenance now</button></form>
+{{end}}
+{{with .JournalError}}<p class="failed">{{.}}</p>{{end}}
+{{range .Failures}}<p class="failed">API run {{.ID}} started at {{time .StartedAt}} failed: {{.Error}}</p>{{end}}
+<table>
+<tr><th>Run</th><th>Kind</th><th>Started</th><th>Finished</th><th>Actions</th><th>Errors</th></tr>
+{{range .Runs}}<tr>
+<td><a href="/ui/runs/{{.ID}}">{{.ID}}</a></td><td>{{.Kind}}</td><td>{{time .StartedAt}}</td><td>{{if .FinishedAt}}{{time .FinishedAt}}{{else}}not finished{{end}}</td>
+<td>{{range $action, $count := .Actions}}{{$action}} {{$count}} {{end}}</td><td{{if .Errors}} class="failed"{{end}}>{{.Errors}}</td>
+</tr>{{else}}<tr><td colspan="6">No runs are recorded</td></tr>{{end}}
+</table>
+{{template "footer"}}{{end}}
+{{define "run"}}{{template "header"}}
+<h2>Run {{.Run.ID}} ({{.Run.Kind}}), started {{time .Run.StartedAt}}{{with .Run.FinishedAt}}, finished {{time .}}{{end}}, {{.Run.Errors}} errors</h2>
+<table>
+<tr><th>Time</th><th>Action</th><th>Card</th><th>List</th><th>Reason</th></tr>
+{{range .Entries}}<tr>
+<td>{{.Timestamp.Format "15:04:05"}}</td><td>{{.Action}}</td><td><a href="https://trello.com/c/{{.CardID}}">{{.CardName}}</a></td><td>{{.ListName}}</td><td>{{.Reason}}</td>
+</tr>{{else}}<tr><td colspan="5">The run took no actions</td></tr>{{end}}
+</table>
+{{template "footer"}}{{end}}`))
+
+// The journal run with its action counters
+type webUIRun struct {
+	journalRun
+	Actions map[journalActionType]int
+}
+
+// Minimal HTML view of the journal served along with the control API. Authenticated with API_TOKEN as the basic auth password,
+// the form to start the run carries the token of the process against cross-site requests
+type webUI struct {
+	server      *apiServer
+	journalPath string
+	csrf        string
+}
+
+func newWebUI(server *apiServer) *webUI {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		log.Fatalf("ERROR: can't generate the web UI token: %v\n", err)
+	}
+	return &webUI{
+		server:      server,
+		journalPath: extractEnvOrDefault(ACTION_JOURNAL_PATH_ENV, ""),
+		csrf:        hex.EncodeToString(token),
+	}
+}
+
+func (u *webUI) register(mux *http.ServeMux) {
+	mux.HandleFunc("/ui/", u.authenticated(u.handleRuns))
+	mux.HandleFunc("/ui/runs", u.authenticated(u.handleStartRun))
+	mux.HandleFunc("/ui/runs/", u.authenticated(u.handleRun))
+}
+
+func (u *webUI) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, password, _ := r.BasicAuth()
+		if subtle.ConstantTimeCompare([]byte(password), []byte(u.server.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="TrelloBoardMaintainer"`)
+			http.Error(w, "the API token is required as the password", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Opens the journal for the request, nil if it isn't configured
+func (u *webUI) openJournal() (*actionJournal, error) {
+	if len(u.journalPath) == 0 {
+		return nil, nil
+	}
+	journal, err := openActionJournalReadOnly(u.journalPath, webUIJournalTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+func (u *webUI) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := webUITemplates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("Failed to render web UI page %s: %v\n", name, err)
+	}
+}
+
+// GET /ui/ lists the recent runs
+func (u *webUI) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ui/" {
+		http.NotFound(w, r)
+		return
+	}
+	page := struct {
+		Active       *apiRun
+		Failures     []apiRun
+		Runs         []webUIRun
+		JournalError string
+		CSRF         string
+	}{CSRF: u.csrf}
+
+	u.server.mu.Lock()
+	if u.server.active != nil {
+		active := u.server.active.snapshot()
+		page.Active = &active
+	}
+	for _, run := range u.server.runs {
+		if run.Status == apiRunFailed {
+			page.Failures = append(page.Failures, run.snapshot())
+		}
+	}
+	u.server.mu.Unlock()
+
+	journal, err := u.openJournal()
+	switch {
+	case err != nil && page.Active != nil:
+		page.JournalError = "The journal is in use by the active run, the runs are shown once it finishes"
+	case err != nil:
+		page.JournalError = err.Error()
+	case journal == nil:
+		page.JournalError = "The action journal is not configured (" + ACTION_JOURNAL_PATH_ENV + "), the runs are not recorded"
+	default:
+		defer journal.close()
+		page.Runs, err = recentWebUIRuns(journal)
+		if err != nil {
+			page.JournalError = "Can't read the journal: " + err.Error()
+		}
+	}
+	u.render(w, "runs", page)
+}
+
+func recentWebUIRuns(journal *actionJournal) ([]webUIRun, error) {
+	runs, err := journal.lastRuns("", webUIRuns)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]webUIRun, len(runs))
+	index := make(map[uint64]*webUIRun)
+	for i, run := range runs {
+		result[i] = webUIRun{journalRun: run, Actions: make(map[journalActionType]int)}
+		index[run.ID] = &result[i]
+	}
+	_, err = journal.entries(func(entry *journalEntry) bool {
+		if run, found := index[entry.RunID]; found {
+			run.Actions[entry.Action]++
+		}
+		return false
+	})
+	return result, err
+}
+
+// POST /ui/runs starts the maintenance run
+func (u *webUI) handleStartRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.FormValue("csrf")), []byte(u.csrf)) != 1 {
+		http.Error(w, "the form is outdated, reload the page", http.StatusForbidden)
+		return
+	}
+	u.server.startRun()
+	http.Redirect(w, r, "/ui/", http.StatusSeeOther)
+}
+
+// GET /ui/runs/{id} lists the actions of the run
+func (u *webUI) handleRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/ui/runs/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	journal, err := u.openJournal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if journal == nil {
+		http.Error(w, "the action journal is not configured", http.StatusNotFound)
+		return
+	}
+	defer journal.close()
+	page := struct {
+		Run     journalRun
+		Entries []journalEntry
+	}{}
+	run, found, err := journal.findRun(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	page.Run = run
+	page.Entries, err = journal.entries(func(entry *journalEntry) bool { return entry.RunID == id })
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	u.render(w, "run", page)
+}
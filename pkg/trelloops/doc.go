@@ -0,0 +1,4 @@
+// Package trelloops contains the Trello API helpers the adlio client lacks:
+// the JSON body requests, custom fields, open lists of the boards and the board list specs.
+// They don't read any configuration, so the other services may use them with their own clients
+package trelloops
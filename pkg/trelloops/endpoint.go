@@ -0,0 +1,28 @@
+package trelloops
+
+import (
+	"regexp"
+	"strings"
+)
+
+var objectIDRegex = regexp.MustCompile(`^[0-9a-f]{24}$`)
+
+// Replaces the object ids of the Trello API path with ":id", e.g. "/1/cards/5f1a.../actions" -> "cards/:id/actions"
+func Endpoint(path string) string {
+	// the API version prefix may be missing with a custom base URL
+	segments := strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "/"), "1/"), "/")
+	for i, segment := range segments {
+		if objectIDRegex.MatchString(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// The key and token query params and the tokens/{token} path
+var credentialRegex = regexp.MustCompile(`\b(key=|token=|tokens/)[^&/?:\s"]+`)
+
+// Trello errors contain the request URL with the credentials
+func RedactCredentials(text string) string {
+	return credentialRegex.ReplaceAllString(text, "${1}<redacted>")
+}
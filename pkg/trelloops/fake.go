@@ -0,0 +1,522 @@
+package trelloops
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// In-memory TrelloGateway for the tests of the passes. The board is set up with AddList, AddCard and AddAction,
+// the operations change it the way Trello does. The cards are returned as copies, so the changes are seen only through the gateway.
+// Safe for the concurrent use by the card goroutines
+type FakeGateway struct {
+	mu      sync.Mutex
+	lists   map[string]*trello.List
+	cards   map[string]*trello.Card
+	actions map[string]trello.ActionCollection
+	deleted map[string]bool
+	// card id -> checklists
+	checklists  map[string][]*trello.Checklist
+	covers      map[string]CardCover
+	attachments map[string][]*trello.Attachment
+	// board id -> custom fields
+	customFields map[string][]*trello.CustomField
+	// card id -> field id -> value
+	fieldValues map[string]map[string]interface{}
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		lists:        make(map[string]*trello.List),
+		cards:        make(map[string]*trello.Card),
+		actions:      make(map[string]trello.ActionCollection),
+		deleted:      make(map[string]bool),
+		checklists:   make(map[string][]*trello.Checklist),
+		covers:       make(map[string]CardCover),
+		attachments:  make(map[string][]*trello.Attachment),
+		customFields: make(map[string][]*trello.CustomField),
+		fieldValues:  make(map[string]map[string]interface{}),
+	}
+}
+
+func (f *FakeGateway) AddList(list *trello.List) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lists[list.ID] = list
+}
+
+// The card is put to its IDList
+func (f *FakeGateway) AddCard(card *trello.Card) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cards[card.ID] = card
+}
+
+// Adds the action of the card, its Data.Card is set if missing
+func (f *FakeGateway) AddAction(cardID string, action *trello.Action) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if action.Data == nil {
+		action.Data = &trello.ActionData{}
+	}
+	if action.Data.Card == nil {
+		action.Data.Card = &trello.ActionDataCard{ID: cardID}
+	}
+	f.actions[cardID] = append(f.actions[cardID], action)
+}
+
+// The current state of the card and whether it exists (i.e. it was added and not deleted)
+func (f *FakeGateway) Card(cardID string) (trello.Card, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	card, found := f.cards[cardID]
+	if !found || f.deleted[cardID] {
+		return trello.Card{}, false
+	}
+	return *card, true
+}
+
+// Adds the checklist of the card, its IDCard is set
+func (f *FakeGateway) AddChecklist(cardID string, checklist *trello.Checklist) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	checklist.IDCard = cardID
+	f.checklists[cardID] = append(f.checklists[cardID], checklist)
+}
+
+// The current checklists of the card
+func (f *FakeGateway) Checklists(cardID string) []trello.Checklist {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var checklists []trello.Checklist
+	for _, checklist := range f.checklists[cardID] {
+		copied := *checklist
+		copied.CheckItems = append([]trello.CheckItem(nil), checklist.CheckItems...)
+		checklists = append(checklists, copied)
+	}
+	return checklists
+}
+
+func (f *FakeGateway) SetCover(cardID string, cover CardCover) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.covers[cardID] = cover
+}
+
+// The current cover of the card
+func (f *FakeGateway) Cover(cardID string) CardCover {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.covers[cardID]
+}
+
+func (f *FakeGateway) AddAttachment(cardID string, attachment *trello.Attachment) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attachments[cardID] = append(f.attachments[cardID], attachment)
+}
+
+func (f *FakeGateway) AddBoardCustomField(boardID string, field *trello.CustomField) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	field.IDModel = boardID
+	f.customFields[boardID] = append(f.customFields[boardID], field)
+}
+
+// The value set to the custom field of the card with SetCardCustomFieldValue, nil if it isn't set
+func (f *FakeGateway) CustomFieldValue(cardID string, fieldID string) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fieldValues[cardID][fieldID]
+}
+
+// The texts of the comments posted to the card, the oldest first
+func (f *FakeGateway) Comments(cardID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var comments []string
+	for _, action := range f.actions[cardID] {
+		if action.Type == "commentCard" {
+			comments = append(comments, action.Data.Text)
+		}
+	}
+	return comments
+}
+
+func (f *FakeGateway) WithContext(ctx context.Context) TrelloGateway {
+	return f
+}
+
+func (f *FakeGateway) GetList(listID string) (*trello.List, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list, found := f.lists[listID]
+	if !found {
+		return nil, fmt.Errorf("list %s not found", listID)
+	}
+	copied := *list
+	return &copied, nil
+}
+
+// args "filter" may be "all" to include the archived cards
+func (f *FakeGateway) GetCards(list *trello.List, args trello.Arguments) ([]*trello.Card, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cards []*trello.Card
+	for id, card := range f.cards {
+		if card.IDList != list.ID || f.deleted[id] || (card.Closed && args["filter"] != "all") {
+			continue
+		}
+		copied := *card
+		cards = append(cards, &copied)
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].Pos < cards[j].Pos })
+	return cards, nil
+}
+
+// The actions of the comma separated filter types (all of them if it is empty or "all"), the newest first
+func selectActions(actions trello.ActionCollection, filter string) trello.ActionCollection {
+	types := make(map[string]bool)
+	for _, actionType := range strings.Split(filter, ",") {
+		types[actionType] = true
+	}
+	var selected trello.ActionCollection
+	for _, action := range actions {
+		if len(filter) == 0 || types["all"] || types[action.Type] {
+			selected = append(selected, action)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool { return selected[i].Date.After(selected[j].Date) })
+	return selected
+}
+
+func (f *FakeGateway) GetCardActions(card *trello.Card, args trello.Arguments) (trello.ActionCollection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.card(card.ID); err != nil {
+		return nil, err
+	}
+	return selectActions(f.actions[card.ID], args["filter"]), nil
+}
+
+func (f *FakeGateway) GetListActions(list *trello.List, args trello.Arguments) (trello.ActionCollection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var actions trello.ActionCollection
+	for id, card := range f.cards {
+		if card.IDList != list.ID {
+			continue
+		}
+		if models, selects := args["idModels"]; selects && !strings.Contains(models, id) {
+			continue
+		}
+		actions = append(actions, f.actions[id]...)
+	}
+	return selectActions(actions, args["filter"]), nil
+}
+
+// The stored card, the caller holds the lock
+func (f *FakeGateway) card(cardID string) (*trello.Card, error) {
+	card, found := f.cards[cardID]
+	if !found || f.deleted[cardID] {
+		return nil, fmt.Errorf("card %s not found", cardID)
+	}
+	return card, nil
+}
+
+func (f *FakeGateway) AddComment(card *trello.Card, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.card(card.ID); err != nil {
+		return err
+	}
+	f.actions[card.ID] = append(f.actions[card.ID], &trello.Action{
+		ID:   fmt.Sprintf("comment%d", len(f.actions[card.ID])),
+		Type: "commentCard",
+		Date: time.Now(),
+		Data: &trello.ActionData{Text: text, Card: &trello.ActionDataCard{ID: card.ID, Name: card.Name}},
+	})
+	return nil
+}
+
+// Moves the last activity of the updated card to now, as Trello does
+func touch(stored *trello.Card, card *trello.Card) {
+	now := time.Now()
+	stored.DateLastActivity = &now
+	card.DateLastActivity = &now
+}
+
+func (f *FakeGateway) ArchiveCard(card *trello.Card) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.card(card.ID)
+	if err != nil {
+		return err
+	}
+	stored.Closed = true
+	card.Closed = true
+	return nil
+}
+
+func (f *FakeGateway) DeleteCard(card *trello.Card) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.card(card.ID); err != nil {
+		return err
+	}
+	f.deleted[card.ID] = true
+	return nil
+}
+
+func (f *FakeGateway) SetCardPos(card *trello.Card, pos float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.card(card.ID)
+	if err != nil {
+		return err
+	}
+	stored.Pos = pos
+	card.Pos = pos
+	return nil
+}
+
+func (f *FakeGateway) MoveCardToList(card *trello.Card, listID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.card(card.ID)
+	if err != nil {
+		return err
+	}
+	list, found := f.lists[listID]
+	if !found {
+		return fmt.Errorf("list %s not found", listID)
+	}
+	stored.IDList, stored.IDBoard = list.ID, list.IDBoard
+	card.IDList, card.IDBoard = list.ID, list.IDBoard
+	return nil
+}
+
+func (f *FakeGateway) MoveCardToBoard(card *trello.Card, boardID string, listID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.card(card.ID)
+	if err != nil {
+		return err
+	}
+	stored.IDList, stored.IDBoard = listID, boardID
+	card.IDList, card.IDBoard = listID, boardID
+	return nil
+}
+
+func (f *FakeGateway) GetChecklists(card *trello.Card) ([]*trello.Checklist, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.card(card.ID); err != nil {
+		return nil, err
+	}
+	var checklists []*trello.Checklist
+	for _, checklist := range f.checklists[card.ID] {
+		copied := *checklist
+		copied.CheckItems = append([]trello.CheckItem(nil), checklist.CheckItems...)
+		checklists = append(checklists, &copied)
+	}
+	return checklists, nil
+}
+
+func (f *FakeGateway) CompleteCheckItem(card *trello.Card, checkItemID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.card(card.ID); err != nil {
+		return err
+	}
+	for _, checklist := range f.checklists[card.ID] {
+		for i := range checklist.CheckItems {
+			if checklist.CheckItems[i].ID == checkItemID {
+				checklist.CheckItems[i].State = "complete"
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("check item %s not found", checkItemID)
+}
+
+func (f *FakeGateway) CreateChecklist(card *trello.Card, name string) (*trello.Checklist, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.card(card.ID); err != nil {
+		return nil, err
+	}
+	checklist := &trello.Checklist{ID: fmt.Sprintf("%s-checklist%d", card.ID, len(f.checklists[card.ID])), Name: name, IDCard: card.ID}
+	f.checklists[card.ID] = append(f.checklists[card.ID], checklist)
+	copied := *checklist
+	return &copied, nil
+}
+
+func (f *FakeGateway) AddCheckItem(checklist *trello.Checklist, name string, complete bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, stored := range f.checklists[checklist.IDCard] {
+		if stored.ID != checklist.ID {
+			continue
+		}
+		item := trello.CheckItem{ID: fmt.Sprintf("%s-item%d", checklist.ID, len(stored.CheckItems)), Name: name, State: "incomplete", IDChecklist: checklist.ID}
+		if complete {
+			item.State = "complete"
+		}
+		stored.CheckItems = append(stored.CheckItems, item)
+		checklist.CheckItems = append(checklist.CheckItems, item)
+		return nil
+	}
+	return fmt.Errorf("checklist %s not found", checklist.ID)
+}
+
+func (f *FakeGateway) SetCardDue(card *trello.Card, due time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.card(card.ID)
+	if err != nil {
+		return err
+	}
+	stored.Due = &due
+	card.Due = &due
+	touch(stored, card)
+	return nil
+}
+
+func (f *FakeGateway) SetCardDesc(card *trello.Card, desc string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.card(card.ID)
+	if err != nil {
+		return err
+	}
+	stored.Desc = desc
+	card.Desc = desc
+	touch(stored, card)
+	return nil
+}
+
+func (f *FakeGateway) GetListCardCovers(list *trello.List) (map[string]CardCover, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	covers := make(map[string]CardCover)
+	for id, card := range f.cards {
+		if card.IDList == list.ID && !card.Closed && !f.deleted[id] {
+			covers[id] = f.covers[id]
+		}
+	}
+	return covers, nil
+}
+
+func (f *FakeGateway) SetCardCoverColor(card *trello.Card, color string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.card(card.ID)
+	if err != nil {
+		return err
+	}
+	f.covers[card.ID] = CardCover{Color: color}
+	touch(stored, card)
+	return nil
+}
+
+func (f *FakeGateway) AddCardLabel(card *trello.Card, labelID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.card(card.ID)
+	if err != nil {
+		return err
+	}
+	for _, id := range stored.IDLabels {
+		if id == labelID {
+			return nil
+		}
+	}
+	stored.IDLabels = append(stored.IDLabels, labelID)
+	card.IDLabels = append([]string(nil), stored.IDLabels...)
+	return nil
+}
+
+func (f *FakeGateway) RemoveCardLabel(card *trello.Card, labelID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.card(card.ID)
+	if err != nil {
+		return err
+	}
+	var labels []string
+	for _, id := range stored.IDLabels {
+		if id != labelID {
+			labels = append(labels, id)
+		}
+	}
+	stored.IDLabels = labels
+	card.IDLabels = append([]string(nil), labels...)
+	return nil
+}
+
+func (f *FakeGateway) GetCardAttachments(card *trello.Card) ([]*trello.Attachment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.card(card.ID); err != nil {
+		return nil, err
+	}
+	return append([]*trello.Attachment(nil), f.attachments[card.ID]...), nil
+}
+
+// The comment of the card with the id, the caller holds the lock
+func (f *FakeGateway) comment(cardID string, actionID string) (int, error) {
+	for i, action := range f.actions[cardID] {
+		if action.ID == actionID && action.Type == "commentCard" {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("comment %s not found", actionID)
+}
+
+func (f *FakeGateway) EditComment(card *trello.Card, actionID string, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, err := f.comment(card.ID, actionID)
+	if err != nil {
+		return err
+	}
+	f.actions[card.ID][i].Data.Text = text
+	return nil
+}
+
+func (f *FakeGateway) DeleteComment(card *trello.Card, actionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, err := f.comment(card.ID, actionID)
+	if err != nil {
+		return err
+	}
+	actions := f.actions[card.ID]
+	f.actions[card.ID] = append(actions[:i:i], actions[i+1:]...)
+	return nil
+}
+
+func (f *FakeGateway) GetBoardCustomFields(boardID string) ([]*trello.CustomField, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*trello.CustomField(nil), f.customFields[boardID]...), nil
+}
+
+func (f *FakeGateway) SetCardCustomFieldValue(card *trello.Card, fieldID string, value interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.card(card.ID); err != nil {
+		return err
+	}
+	if f.fieldValues[card.ID] == nil {
+		f.fieldValues[card.ID] = make(map[string]interface{})
+	}
+	f.fieldValues[card.ID][fieldID] = value
+	return nil
+}
@@ -0,0 +1,212 @@
+package trelloops
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// The Trello operations of the staleness and reorder passes. The adlio client (NewClientGateway) performs them
+// against Trello, FakeGateway against the in-memory board, so the passes run without the credentials
+type TrelloGateway interface {
+	// The gateway whose requests are made with the context, e.g. to trace them as the children of its span
+	WithContext(ctx context.Context) TrelloGateway
+	GetList(listID string) (*trello.List, error)
+	// The open cards of the list in their order
+	GetCards(list *trello.List, args trello.Arguments) ([]*trello.Card, error)
+	GetCardActions(card *trello.Card, args trello.Arguments) (trello.ActionCollection, error)
+	// The actions of the list cards, args "idModels" may select the card
+	GetListActions(list *trello.List, args trello.Arguments) (trello.ActionCollection, error)
+	AddComment(card *trello.Card, text string) error
+	ArchiveCard(card *trello.Card) error
+	DeleteCard(card *trello.Card) error
+	SetCardPos(card *trello.Card, pos float64) error
+	MoveCardToList(card *trello.Card, listID string) error
+	MoveCardToBoard(card *trello.Card, boardID string, listID string) error
+	// The checklists of the card with their items
+	GetChecklists(card *trello.Card) ([]*trello.Checklist, error)
+	// Marks the item of the card checklist complete
+	CompleteCheckItem(card *trello.Card, checkItemID string) error
+	CreateChecklist(card *trello.Card, name string) (*trello.Checklist, error)
+	AddCheckItem(checklist *trello.Checklist, name string, complete bool) error
+	// The card updates (due, description, cover) set the card DateLastActivity to the one the update gave it
+	SetCardDue(card *trello.Card, due time.Time) error
+	SetCardDesc(card *trello.Card, desc string) error
+	// The covers of the open cards of the list by card id
+	GetListCardCovers(list *trello.List) (map[string]CardCover, error)
+	SetCardCoverColor(card *trello.Card, color string) error
+	AddCardLabel(card *trello.Card, labelID string) error
+	RemoveCardLabel(card *trello.Card, labelID string) error
+	GetCardAttachments(card *trello.Card) ([]*trello.Attachment, error)
+	// Trello allows editing only own comments
+	EditComment(card *trello.Card, actionID string, text string) error
+	DeleteComment(card *trello.Card, actionID string) error
+	GetBoardCustomFields(boardID string) ([]*trello.CustomField, error)
+	SetCardCustomFieldValue(card *trello.Card, fieldID string, value interface{}) error
+}
+
+// Card cover as returned by Trello API
+type CardCover struct {
+	Color        string `json:"color,omitempty"`
+	IDAttachment string `json:"idAttachment,omitempty"`
+}
+
+type clientGateway struct {
+	client *trello.Client
+}
+
+// The gateway performing the operations with the client
+func NewClientGateway(client *trello.Client) TrelloGateway {
+	return &clientGateway{client: client}
+}
+
+func (g *clientGateway) WithContext(ctx context.Context) TrelloGateway {
+	return &clientGateway{client: g.client.WithContext(ctx)}
+}
+
+func (g *clientGateway) GetList(listID string) (*trello.List, error) {
+	return g.client.GetList(listID)
+}
+
+func (g *clientGateway) GetCards(list *trello.List, args trello.Arguments) ([]*trello.Card, error) {
+	list.SetClient(g.client)
+	return list.GetCards(args)
+}
+
+func (g *clientGateway) GetCardActions(card *trello.Card, args trello.Arguments) (trello.ActionCollection, error) {
+	card.SetClient(g.client)
+	return card.GetActions(args)
+}
+
+func (g *clientGateway) GetListActions(list *trello.List, args trello.Arguments) (trello.ActionCollection, error) {
+	list.SetClient(g.client)
+	return list.GetActions(args)
+}
+
+func (g *clientGateway) AddComment(card *trello.Card, text string) error {
+	card.SetClient(g.client)
+	_, err := card.AddComment(text)
+	return err
+}
+
+func (g *clientGateway) ArchiveCard(card *trello.Card) error {
+	card.SetClient(g.client)
+	return card.Archive()
+}
+
+func (g *clientGateway) DeleteCard(card *trello.Card) error {
+	card.SetClient(g.client)
+	return card.Delete()
+}
+
+func (g *clientGateway) SetCardPos(card *trello.Card, pos float64) error {
+	card.SetClient(g.client)
+	return card.SetPos(pos)
+}
+
+func (g *clientGateway) MoveCardToList(card *trello.Card, listID string) error {
+	card.SetClient(g.client)
+	return card.MoveToList(listID)
+}
+
+func (g *clientGateway) MoveCardToBoard(card *trello.Card, boardID string, listID string) error {
+	card.SetClient(g.client)
+	return MoveCardToBoard(card, boardID, listID)
+}
+
+func (g *clientGateway) GetChecklists(card *trello.Card) ([]*trello.Checklist, error) {
+	var checklists []*trello.Checklist
+	err := g.client.Get(fmt.Sprintf("cards/%s/checklists", card.ID), trello.Defaults(), &checklists)
+	return checklists, err
+}
+
+func (g *clientGateway) CompleteCheckItem(card *trello.Card, checkItemID string) error {
+	var item trello.CheckItem
+	return g.client.Put(fmt.Sprintf("cards/%s/checkItem/%s", card.ID, checkItemID), trello.Arguments{"state": "complete"}, &item)
+}
+
+func (g *clientGateway) CreateChecklist(card *trello.Card, name string) (*trello.Checklist, error) {
+	return g.client.CreateChecklist(card, name)
+}
+
+func (g *clientGateway) AddCheckItem(checklist *trello.Checklist, name string, complete bool) error {
+	_, err := g.client.CreateCheckItem(checklist, name, trello.Arguments{"checked": fmt.Sprint(complete)})
+	return err
+}
+
+func (g *clientGateway) SetCardDue(card *trello.Card, due time.Time) error {
+	card.SetClient(g.client)
+	return card.Update(trello.Arguments{"due": due.UTC().Format(time.RFC3339)})
+}
+
+func (g *clientGateway) SetCardDesc(card *trello.Card, desc string) error {
+	card.SetClient(g.client)
+	return card.Update(trello.Arguments{"desc": desc})
+}
+
+func (g *clientGateway) GetListCardCovers(list *trello.List) (map[string]CardCover, error) {
+	var cards []struct {
+		ID    string    `json:"id"`
+		Cover CardCover `json:"cover"`
+	}
+	if err := JSONRequest(g.client, http.MethodGet, fmt.Sprintf("lists/%s/cards?fields=cover", list.ID), nil, &cards); err != nil {
+		return nil, err
+	}
+	covers := make(map[string]CardCover, len(cards))
+	for _, card := range cards {
+		covers[card.ID] = card.Cover
+	}
+	return covers, nil
+}
+
+func (g *clientGateway) SetCardCoverColor(card *trello.Card, color string) error {
+	body := map[string]interface{}{"cover": map[string]string{"color": color}}
+	var updated struct {
+		DateLastActivity *time.Time `json:"dateLastActivity"`
+	}
+	if err := JSONRequest(g.client, http.MethodPut, "cards/"+card.ID, body, &updated); err != nil {
+		return err
+	}
+	if updated.DateLastActivity != nil {
+		card.DateLastActivity = updated.DateLastActivity
+	}
+	return nil
+}
+
+func (g *clientGateway) AddCardLabel(card *trello.Card, labelID string) error {
+	card.SetClient(g.client)
+	return card.AddIDLabel(labelID)
+}
+
+func (g *clientGateway) RemoveCardLabel(card *trello.Card, labelID string) error {
+	return JSONRequest(g.client, http.MethodDelete, fmt.Sprintf("cards/%s/idLabels/%s", card.ID, labelID), nil, nil)
+}
+
+func (g *clientGateway) GetCardAttachments(card *trello.Card) ([]*trello.Attachment, error) {
+	card.SetClient(g.client)
+	return card.GetAttachments(trello.Defaults())
+}
+
+func (g *clientGateway) EditComment(card *trello.Card, actionID string, text string) error {
+	return JSONRequest(g.client, http.MethodPut, fmt.Sprintf("actions/%s/text?value=%s", actionID, url.QueryEscape(text)), nil, nil)
+}
+
+func (g *clientGateway) DeleteComment(card *trello.Card, actionID string) error {
+	return JSONRequest(g.client, http.MethodDelete, "actions/"+actionID, nil, nil)
+}
+
+func (g *clientGateway) GetBoardCustomFields(boardID string) ([]*trello.CustomField, error) {
+	board, err := g.client.GetBoard(boardID)
+	if err != nil {
+		return nil, err
+	}
+	return board.GetCustomFields()
+}
+
+func (g *clientGateway) SetCardCustomFieldValue(card *trello.Card, fieldID string, value interface{}) error {
+	return SetCardCustomFieldValue(g.client, card.ID, fieldID, value)
+}
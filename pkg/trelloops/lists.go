@@ -0,0 +1,112 @@
+package trelloops
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/adlio/trello"
+)
+
+// Panics if the list can't be fetched
+func FetchList(client *trello.Client, listId string) *trello.List {
+	list, err := client.GetList(listId)
+	if err != nil {
+		log.Panicf("Can't fetch list %v: %v", listId, err)
+	}
+	return list
+}
+
+// Returns the first open list of the board
+func FetchFirstOpenList(client *trello.Client, boardId string) *trello.List {
+	lists := FetchOpenLists(client, boardId)
+	if len(lists) == 0 {
+		log.Panicf("Board %v has no open lists", boardId)
+	}
+	return lists[0]
+}
+
+// The open lists of the board in their order. Panics if they can't be fetched
+func FetchOpenLists(client *trello.Client, boardId string) []*trello.List {
+	board, err := client.GetBoard(boardId)
+	if err != nil {
+		log.Panicf("Can't fetch board %v: %v", boardId, err)
+	}
+	lists, err := board.GetLists(trello.Arguments{"filter": "open"})
+	if err != nil {
+		log.Panicf("Can't fetch lists of the board %v: %v", board.Name, err)
+	}
+	return lists
+}
+
+// Moves the card to another board. Trello keeps the comments and attachments of the card moved this way
+func MoveCardToBoard(card *trello.Card, boardID string, listID string) error {
+	return card.Update(trello.Arguments{
+		"idBoard": boardID,
+		"idList":  listID,
+	})
+}
+
+// Board spec "boardId[/nameRegex][:suffix]" selects the open lists of the board
+// (only the ones with the name matching NameRegex if it is set).
+// The suffix (e.g. reorder strategy) is kept for each of the lists
+type BoardListsSpec struct {
+	BoardID   string
+	NameRegex *regexp.Regexp
+	// includes the leading colon
+	Suffix string
+}
+
+// The suffix is cut at the last colon if withSuffix is set, so the regex itself may contain colons only when there is no suffix
+func ParseBoardListsSpec(spec string, withSuffix bool) (BoardListsSpec, error) {
+	var result BoardListsSpec
+	spec = strings.TrimSpace(spec)
+	if withSuffix {
+		if i := strings.LastIndex(spec, ":"); i >= 0 {
+			result.Suffix = spec[i:]
+			spec = spec[:i]
+		}
+	}
+	boardID, pattern, hasPattern := strings.Cut(spec, "/")
+	result.BoardID = boardID
+	if hasPattern {
+		nameRegex, err := regexp.Compile(pattern)
+		if err != nil {
+			return result, fmt.Errorf("can't compile list name regex of board %s: %w", boardID, err)
+		}
+		result.NameRegex = nameRegex
+	}
+	return result, nil
+}
+
+// Appends the ids of the lists selected by "commaSepBoardSpecs" (see BoardListsSpec) to "commaSepListSpecs"
+func AppendBoardLists(client *trello.Client, commaSepListSpecs string, commaSepBoardSpecs string, withSuffix bool) string {
+	if len(commaSepBoardSpecs) == 0 {
+		return commaSepListSpecs
+	}
+	var specs []string
+	if len(commaSepListSpecs) > 0 {
+		specs = append(specs, commaSepListSpecs)
+	}
+	for _, rawSpec := range strings.Split(commaSepBoardSpecs, ",") {
+		boardSpec, err := ParseBoardListsSpec(rawSpec, withSuffix)
+		if err != nil {
+			log.Panicf("Invalid board spec %v: %v", rawSpec, err)
+		}
+		selected := 0
+		for _, list := range FetchOpenLists(client, boardSpec.BoardID) {
+			if boardSpec.NameRegex != nil && !boardSpec.NameRegex.MatchString(list.Name) {
+				continue
+			}
+			specs = append(specs, list.ID+boardSpec.Suffix)
+			selected++
+		}
+		if selected == 0 {
+			log.Printf("WARNING: no open lists of the board %v match %v\n", boardSpec.BoardID, rawSpec)
+		} else {
+			log.Printf("%d lists of the board %v selected by %v\n", selected, boardSpec.BoardID, rawSpec)
+		}
+	}
+	return strings.Join(specs, ",")
+}
@@ -0,0 +1,117 @@
+package trelloops
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/adlio/trello"
+)
+
+// Sends a request with JSON body (nil means no body) to Trello API.
+// Some endpoints (e.g. custom field items) accept the data only as a body, which adlio client can't send.
+// The path may contain query arguments
+func JSONRequest(client *trello.Client, method string, path string, body interface{}, target interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("can't serialize request body: %w", err)
+		}
+		payload = bytes.NewReader(data)
+	}
+	params := url.Values{}
+	params.Set("key", client.Key)
+	params.Set("token", client.Token)
+	endpoint := fmt.Sprintf("%s/%s", client.BaseURL, path)
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	req, err := http.NewRequest(method, endpoint+separator+params.Encode(), payload)
+	if err != nil {
+		return fmt.Errorf("invalid %s request %s: %w", method, endpoint, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client.Throttle()
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		// the URL of the error contains the key and the token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = &url.Error{Op: urlErr.Op, URL: endpoint, Err: urlErr.Err}
+		}
+		return fmt.Errorf("HTTP request failure on %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("HTTP read error on response for %s: %w", endpoint, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP request failure on %s: %d: %s", endpoint, resp.StatusCode, string(respBody))
+	}
+	if target == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, target); err != nil {
+		return fmt.Errorf("JSON decode failed on %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// Sets the value (string, number, bool or time.Time) of the card's custom field
+func SetCardCustomFieldValue(client *trello.Client, cardID string, fieldID string, value interface{}) error {
+	body := map[string]interface{}{"value": trello.NewCustomFieldValue(value)}
+	return JSONRequest(client, http.MethodPut, fmt.Sprintf("cards/%s/customField/%s/item", cardID, fieldID), body, nil)
+}
+
+// Returns the custom field of the board with the specified name or nil if there is no such field
+func FindBoardCustomField(fields []*trello.CustomField, name string) *trello.CustomField {
+	for _, field := range fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// Creates "number" custom field on the board. Custom Fields Power-Up must be enabled for the board
+func CreateBoardNumberCustomField(client *trello.Client, boardID string, name string) (*trello.CustomField, error) {
+	return CreateBoardCustomField(client, boardID, name, "number")
+}
+
+// Creates the custom field of the type (number, text, date, checkbox) on the board. Custom Fields Power-Up must be enabled for the board
+func CreateBoardCustomField(client *trello.Client, boardID string, name string, fieldType string) (*trello.CustomField, error) {
+	var field trello.CustomField
+	err := client.Post("customFields", trello.Arguments{
+		"idModel":           boardID,
+		"modelType":         "board",
+		"name":              name,
+		"type":              fieldType,
+		"pos":               "bottom",
+		"display_cardFront": "true",
+	}, &field)
+	if err != nil {
+		return nil, err
+	}
+	return &field, nil
+}
+
+// The id of the Custom Fields Power-Up
+const CustomFieldsPowerUpID = "56d5e249a98895a9797bebb9"
+
+// Enables the Power-Up (e.g. CustomFieldsPowerUpID) on the board
+func EnableBoardPowerUp(client *trello.Client, boardID string, powerUpID string) error {
+	var boardPlugin map[string]interface{}
+	return client.Post(fmt.Sprintf("boards/%s/boardPlugins", boardID), trello.Arguments{"idPlugin": powerUpID}, &boardPlugin)
+}
@@ -0,0 +1,24 @@
+package trelloops
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/adlio/trello"
+)
+
+func TestJSONRequestErrorHasNoCredentials(t *testing.T) {
+	client := trello.NewClient("secret-key", "secret-token")
+	// nothing listens on the port
+	client.BaseURL = "http://127.0.0.1:1/1"
+
+	err := JSONRequest(client, http.MethodGet, "cards/abc?fields=id", nil, nil)
+
+	if err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	if strings.Contains(err.Error(), "secret-key") || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("expected the error without the credentials, got %v", err)
+	}
+}